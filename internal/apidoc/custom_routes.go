@@ -32,19 +32,43 @@ func defineCustomRoutes() []CustomRoute {
 			Tags:        []string{"System"},
 			Protected:   true,
 		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/v1/cache/email-templates",
+			Summary:     "Reload Email Templates",
+			Description: "Validate the email templates and drop the parsed ones so edited files in EMAIL_TEMPLATES_DIR are used by the next emails (requires cache.clear permission). Invalid templates are reported with a 400 and the cached templates are kept",
+			Tags:        []string{"System"},
+			Protected:   true,
+		},
 		{
 			Method:      "POST",
 			Path:        "/api/v1/users/export",
 			Summary:     "Export Users",
-			Description: "Export users data (requires export permission)",
+			Description: "Export users data (requires export permission). Optional JSON body: compression (gzip or zip), encryption (aes-gcm), passphrase (encrypts with a key derived from it instead of a random key, returned once as encryption_key in this response) and notify (email a download link when the export completes, or the error when it fails)",
 			Tags:        []string{"Users"},
 			Protected:   true,
 		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/exports",
+			Summary:     "Export Collection",
+			Description: "Queue an export of the records of a collection that the requester can list (requires data.export permission). JSON body: collection, format (csv, jsonl or xlsx, default csv), filter (PocketBase filter expression), fields (field names or expand.<relation>.<field>), expand (relations exported as JSON in an expand column), sort, compression (gzip or zip), encryption (aes-gcm), passphrase (encrypts with a key derived from it instead of a random key, returned once as encryption_key in this response) and notify (email a download link when the export completes, or the error when it fails). The file is downloaded through the job download link",
+			Tags:        []string{"Data"},
+			Protected:   true,
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/imports",
+			Summary:     "Import Data",
+			Description: "Upload a CSV, JSON or XLSX file as multipart form data and queue its import into a collection listed in IMPORT_ALLOWED_COLLECTIONS (requires data.import permission). Rows are written with the create and update rules of the collection applied to the requester. Form fields: file, collection, format (optional, detected from the file name), mapping (optional JSON object of column to field names), key_field (optional field to update existing records by) and dry_run. Rows that fail validation are listed in an error report available through the job download link",
+			Tags:        []string{"Data"},
+			Protected:   true,
+		},
 		{
 			Method:      "GET",
 			Path:        "/api/v1/jobs/{id}/status",
 			Summary:     "Get Job Status",
-			Description: "Get the status of a specific job",
+			Description: "Get the status of a specific job, including its stored result, error, attempts and duration once it has finished. Batch IDs return the aggregate progress of the batch. Only the user that created the job or users with job.view permission can see it",
 			Tags:        []string{"Jobs"},
 			Protected:   true,
 			Parameters: []Parameter{
@@ -60,8 +84,220 @@ func defineCustomRoutes() []CustomRoute {
 		{
 			Method:      "POST",
 			Path:        "/api/v1/jobs/{id}/download",
+			Summary:     "Create Job Download Link",
+			Description: "Create a short-lived signed link to the file associated with a job (requires being the job owner or job.view permission). Files stored in S3 are linked through a presigned URL, the other files through the download route. The response includes the SHA-256 checksum of the file",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The unique identifier of the job",
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/v1/jobs/download",
 			Summary:     "Download Job File",
-			Description: "Download the file associated with a job",
+			Description: "Download the file associated with a job using a signed token from the download link route, files stored in S3 are redirected to a presigned URL. Files are verified against their SHA-256 checksum, sent in the X-Checksum-Sha256 header",
+			Tags:        []string{"Jobs"},
+			Protected:   false,
+			Parameters: []Parameter{
+				{
+					Name:        "token",
+					In:          "query",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Signed download token",
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/v1/jobs/failed",
+			Summary:     "List Failed Jobs",
+			Description: "List dead-lettered jobs with their last error and attempt history (requires job.failed.view permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "page",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "default": 1},
+					Description: "Page number",
+				},
+				{
+					Name:        "perPage",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "default": 30},
+					Description: "Number of items per page",
+				},
+				{
+					Name:        "type",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Filter by job type",
+				},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/jobs/failed/retry",
+			Summary:     "Retry Failed Jobs",
+			Description: "Re-queue all dead-lettered jobs, optionally filtered by type (requires job.failed.retry permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "type",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Only retry jobs of this type",
+				},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/jobs/failed/{id}/retry",
+			Summary:     "Retry Failed Job",
+			Description: "Re-queue a dead-lettered job with a reset attempt counter (requires job.failed.retry permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The unique identifier of the failed job",
+				},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/v1/jobs/failed/{id}",
+			Summary:     "Delete Failed Job",
+			Description: "Permanently delete a dead-lettered job (requires job.failed.purge permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The unique identifier of the failed job",
+				},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/v1/jobs/failed",
+			Summary:     "Purge Failed Jobs",
+			Description: "Permanently delete all dead-lettered jobs, optionally filtered by type (requires job.failed.purge permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "type",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Only purge jobs of this type",
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/v1/admin/jobs",
+			Summary:     "List Jobs",
+			Description: "List queued, processing and finished jobs, newest first (requires job.view permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "page",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "default": 1},
+					Description: "Page number",
+				},
+				{
+					Name:        "perPage",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "default": 30},
+					Description: "Number of items per page",
+				},
+				{
+					Name:        "type",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Filter by job type",
+				},
+				{
+					Name:        "status",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string", "enum": []string{"queued", "processing", "completed", "failed", "cancelled"}},
+					Description: "Filter by job status",
+				},
+				{
+					Name:        "minAttempts",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "minimum": 0},
+					Description: "Only jobs with at least this many attempts",
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/v1/admin/jobs/{id}",
+			Summary:     "Get Job",
+			Description: "View a job's payload, errors, attempt history and result, including its dead-letter entry (requires job.view permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The unique identifier of the job",
+				},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/admin/jobs/{id}/cancel",
+			Summary:     "Cancel Job",
+			Description: "Cancel a queued job that is not being processed (requires job.cancel permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The unique identifier of the job",
+				},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/admin/jobs/{id}/retry",
+			Summary:     "Retry Job",
+			Description: "Run a queued job waiting for its retry backoff immediately, or re-queue a dead-lettered job by its job ID (requires job.retry permission)",
 			Tags:        []string{"Jobs"},
 			Protected:   true,
 			Parameters: []Parameter{
@@ -74,5 +310,70 @@ func defineCustomRoutes() []CustomRoute {
 				},
 			},
 		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/v1/admin/jobs",
+			Summary:     "Purge Jobs",
+			Description: "Bulk-remove jobs of a status: queued jobs are cancelled, finished jobs have their results deleted (requires job.purge permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "status",
+					In:          "query",
+					Required:    true,
+					Schema:      map[string]any{"type": "string", "enum": []string{"queued", "completed", "failed", "cancelled"}},
+					Description: "Status of the jobs to purge",
+				},
+				{
+					Name:        "type",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string"},
+					Description: "Only purge jobs of this type",
+				},
+				{
+					Name:        "before",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "string", "format": "date-time"},
+					Description: "Only purge jobs queued (or finished) before this time",
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/v1/admin/crons",
+			Summary:     "List Crons",
+			Description: "List the defined crons with their schedule, timezone, next fire time and last recorded run (requires cron.view permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "upcoming",
+					In:          "query",
+					Required:    false,
+					Schema:      map[string]any{"type": "integer", "minimum": 0, "maximum": 100},
+					Description: "Number of upcoming fire times to include per enabled cron",
+				},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/v1/admin/crons/{id}/run",
+			Summary:     "Run Cron",
+			Description: "Start a manual run of an enabled cron in the background; returns 409 while the cron is already running (requires cron.run permission)",
+			Tags:        []string{"Jobs"},
+			Protected:   true,
+			Parameters: []Parameter{
+				{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Schema:      map[string]any{"type": "string"},
+					Description: "The cron ID, e.g. clean_job_results",
+				},
+			},
+		},
 	}
 }
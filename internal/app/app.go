@@ -19,6 +19,9 @@ import (
 	"ims-pocketbase-baas-starter/internal/jobs"
 	"ims-pocketbase-baas-starter/internal/middlewares"
 	"ims-pocketbase-baas-starter/internal/routes"
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/emailtemplate"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	"ims-pocketbase-baas-starter/pkg/logger"
 	"ims-pocketbase-baas-starter/pkg/metrics"
 )
@@ -47,6 +50,12 @@ func NewApp() *pocketbase.PocketBase {
 		}
 	}
 
+	// A broken email template fails the startup instead of the email jobs using it
+	logger.Info("Validating email templates")
+	if err := emailtemplate.GetInstance().Validate(); err != nil {
+		log.Fatalf("Invalid email templates: %v", err)
+	}
+
 	logger.Info("Registering job handlers")
 	if err := jobs.RegisterJobs(app); err != nil {
 		log.Fatalf("Failed to register job handlers: %v", err)
@@ -68,6 +77,16 @@ func NewApp() *pocketbase.PocketBase {
 	}
 
 	app.OnTerminate().BindFunc(func(te *core.TerminateEvent) error {
+		if processor := jobManager.GetProcessor(); processor != nil {
+			drainTimeout := jobutils.GetDrainTimeout()
+			logger.Info("Draining job processor", "timeout", drainTimeout)
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			if err := processor.Shutdown(ctx); err != nil {
+				logger.Error("Failed to drain job processor", "error", err)
+			}
+			cancel()
+		}
+
 		if metricsProvider != nil {
 			logger.Info("Shutting down metrics provider")
 			if err := metricsProvider.Shutdown(context.Background()); err != nil {
@@ -101,6 +120,12 @@ func NewApp() *pocketbase.PocketBase {
 
 		apidoc.RegisterEndpoints(se, generator)
 
+		if common.GetEnvBool("JOB_DISPATCHER_ENABLED", true) {
+			if processor := jobManager.GetProcessor(); processor != nil {
+				processor.StartDispatcher(jobutils.NewDispatcherConfigFromEnv())
+			}
+		}
+
 		return se.Next()
 	})
 
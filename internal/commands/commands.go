@@ -67,6 +67,62 @@ func RegisterCommands(app *pocketbase.PocketBase) error {
 			Handler: command.HandleSeedUsersWithRoleCommand,
 			Enabled: true,
 		},
+		{
+			ID:      "failed-jobs",
+			Use:     "failed-jobs [job-type]",
+			Short:   "List dead-lettered jobs",
+			Long:    "Lists jobs that reached their max attempts and were moved to the failed_jobs collection, optionally filtered by job type",
+			Handler: command.HandleListFailedJobsCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "failed-jobs-retry",
+			Use:     "failed-jobs-retry <id|all> [job-type]",
+			Short:   "Re-queue dead-lettered jobs",
+			Long:    "Moves a failed job (or all failed jobs, optionally of one type) back to the queue with a reset attempt counter",
+			Handler: command.HandleRetryFailedJobsCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "failed-jobs-purge",
+			Use:     "failed-jobs-purge <id|all> [job-type]",
+			Short:   "Delete dead-lettered jobs",
+			Long:    "Permanently deletes a failed job (or all failed jobs, optionally of one type)",
+			Handler: command.HandlePurgeFailedJobsCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "crons",
+			Use:     "crons",
+			Short:   "List scheduled crons",
+			Long:    "Lists the defined crons with their schedule, next fire time and the status and duration of their last run",
+			Handler: command.HandleListCronsCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "crons-run",
+			Use:     "crons-run <cron-id>",
+			Short:   "Run a cron immediately",
+			Long:    "Runs an enabled cron now and waits for it to finish; the run is recorded in cron_runs and skipped if the cron is already running",
+			Handler: command.HandleRunCronCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "crons-preview",
+			Use:     "crons-preview <cron-expr|cron-id> [count] [timezone]",
+			Short:   "Show the next fire times of a cron expression",
+			Long:    "Prints the next fire times (default 5) of a cron expression or defined cron, evaluated in the given IANA timezone or the cron's own timezone (UTC by default)",
+			Handler: command.HandlePreviewCronCommand,
+			Enabled: true,
+		},
+		{
+			ID:      "export-decrypt",
+			Use:     "export-decrypt <file> <key|passphrase> [output]",
+			Short:   "Decrypt an encrypted export file",
+			Long:    "Decrypts an export file encrypted with aes-gcm using the key from the job result or the passphrase given when it was requested, writing it next to the file without the .enc extension by default",
+			Handler: command.HandleDecryptExportCommand,
+			Enabled: true,
+		},
 		// Add more commands here as needed:
 		// {
 		//     ID:      "example",
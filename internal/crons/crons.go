@@ -1,24 +1,54 @@
 package crons
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"ims-pocketbase-baas-starter/internal/handlers/cron"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // Cron represents a scheduled cron job with its configuration
 type Cron struct {
-	ID          string // Unique identifier for the cron
-	CronExpr    string // Cron expression for scheduling (e.g., "0 2 * * *")
-	Handler     func() // Function to execute when cron job runs
-	Enabled     bool   // Whether the cron job should be registered and executed
-	Description string // Human-readable description of what the cron job does
+	ID          string       // Unique identifier for the cron
+	CronExpr    string       // Cron expression for scheduling (e.g., "0 2 * * *", "@hourly" or "@every 10m")
+	Timezone    string       // IANA timezone the expression is evaluated in (e.g., "Europe/Berlin"), empty means UTC
+	Handler     func() error // Function to execute when cron job runs, a returned error marks the run as failed
+	Enabled     bool         // Whether the cron job should be registered and executed
+	Description string       // Human-readable description of what the cron job does
 }
 
+// CronStatus describes a defined cron for the crons CLI command and admin API
+type CronStatus struct {
+	ID           string                    `json:"id"`
+	CronExpr     string                    `json:"cron_expr"`
+	Timezone     string                    `json:"timezone"`
+	Description  string                    `json:"description"`
+	Enabled      bool                      `json:"enabled"`
+	NextRunAt    *time.Time                `json:"next_run_at"`
+	UpcomingRuns []time.Time               `json:"upcoming_runs,omitempty"`
+	LastRun      *cronutils.CronRunSummary `json:"last_run"`
+}
+
+// Errors returned when triggering a cron manually
+var (
+	ErrCronNotFound = errors.New("cron not found")
+	ErrCronDisabled = errors.New("cron is disabled")
+)
+
+var (
+	definedCrons   []Cron
+	definedCronsMu sync.RWMutex
+)
+
 // RegisterCrons registers all scheduled crons with the PocketBase application
 // This function should be called during app initialization, before OnServe setup
 func RegisterCrons(app *pocketbase.PocketBase) error {
@@ -33,22 +63,36 @@ func RegisterCrons(app *pocketbase.PocketBase) error {
 		{
 			ID:          "system_queue",
 			CronExpr:    "* * * * *", // every minutes
-			Handler:     cronutils.WithRecovery(app, "system_queue", func() { cron.HandleSystemQueue(app) }),
+			Handler:     func() error { return cron.HandleSystemQueue(app) },
 			Enabled:     os.Getenv("ENABLE_SYSTEM_QUEUE_CRON") != "false", // Enabled by default
 			Description: "Process the system queue ",
 		},
 		{
 			ID:          "clean_exported_files",
 			CronExpr:    "0 2 * * *", // every day at 2:00 AM
-			Handler:     cronutils.WithRecovery(app, "clean_exported_files", func() { cron.HandleClearExportFiles(app) }),
+			Handler:     func() error { return cron.HandleClearExportFiles(app) },
 			Enabled:     os.Getenv("ENABLE_CLEAR_EXPORT_FILES_CRON") != "false", // Enabled by default
 			Description: "Delete the expired job generated export files",
 		},
+		{
+			ID:          "clean_job_results",
+			CronExpr:    "0 * * * *", // every hour
+			Handler:     func() error { return cron.HandleClearJobResults(app) },
+			Enabled:     os.Getenv("ENABLE_CLEAR_JOB_RESULTS_CRON") != "false", // Enabled by default
+			Description: "Delete job results and cron runs older than the retention window",
+		},
+		{
+			ID:          "scheduled_jobs",
+			CronExpr:    "* * * * *", // every minute
+			Handler:     func() error { return cron.HandleScheduledJobs(app) },
+			Enabled:     os.Getenv("ENABLE_SCHEDULED_JOBS_CRON") != "false", // Enabled by default
+			Description: "Enqueue the due jobs of the scheduled_jobs collection",
+		},
 		// Add more cron jobs here as needed:
 		// {
 		//     ID:          "example_cron",
 		//     CronExpr:    "0 3 * * *", // every day at 3:00 AM
-		//     Handler:     cronutils.WithRecovery(app, "example_cron", func() { cron.HandleExample(app) }),
+		//     Handler:     func() error { return cron.HandleExample(app) },
 		//     Enabled:     os.Getenv("ENABLE_EXAMPLE_CRON") != "false",
 		//     Description: "Example cron job description",
 		// },
@@ -63,20 +107,145 @@ func RegisterCrons(app *pocketbase.PocketBase) error {
 			continue
 		}
 
-		if err := cronutils.ValidateCronExpression(cronJob.CronExpr); err != nil {
-			log.Error("Invalid cron expression for cron job", "cron_id", cronJob.ID, "cron", cronJob.CronExpr, "error", err)
+		schedule, err := cronutils.ParseSchedule(cronJob.CronExpr, cronJob.Timezone)
+		if err != nil {
+			log.Error("Invalid cron expression for cron job", "cron_id", cronJob.ID, "cron", cronJob.CronExpr, "timezone", cronJob.Timezone, "error", err)
 			return err
 		}
 
-		app.Cron().MustAdd(cronJob.ID, cronJob.CronExpr, cronJob.Handler)
+		// Every run is recorded in cron_runs and skipped while the previous one is still running
+		expr, handler := cronJob.CronExpr, cronutils.WithTracking(app, cronJob.ID, jobutils.InstanceID(), cronJob.Handler)
+
+		// The PocketBase scheduler evaluates every expression in UTC and has no "@every", so other schedules
+		// are checked on every minute tick in their own timezone
+		if !schedule.PocketBaseCompatible() {
+			expr, handler = "* * * * *", cronutils.WithSchedule(schedule, handler)
+		}
+
+		app.Cron().MustAdd(cronJob.ID, expr, handler)
 
 		log.Info("Registered cron job",
 			"cron_id", cronJob.ID,
 			"cron_expr", cronJob.CronExpr,
+			"timezone", schedule.Location.String(),
 			"description", cronJob.Description,
 		)
 	}
 
+	definedCronsMu.Lock()
+	definedCrons = crons
+	definedCronsMu.Unlock()
+
 	log.Info("Cron job registration completed", "enabled_cron_jobs", len(crons))
 	return nil
 }
+
+// GetCrons returns every cron defined by RegisterCrons, including disabled ones
+func GetCrons() []Cron {
+	definedCronsMu.RLock()
+	defer definedCronsMu.RUnlock()
+
+	return append([]Cron(nil), definedCrons...)
+}
+
+// FindCron returns the defined cron with the given ID
+func FindCron(id string) (Cron, error) {
+	for _, cronJob := range GetCrons() {
+		if cronJob.ID == id {
+			return cronJob, nil
+		}
+	}
+
+	return Cron{}, fmt.Errorf("%w: %s", ErrCronNotFound, id)
+}
+
+// ListCrons returns the defined crons with their next fire time, the given number of upcoming fire times
+// (at most cronutils.MaxUpcomingRuns) and their last recorded run
+func ListCrons(app core.App, upcoming int) []CronStatus {
+	crons := GetCrons()
+	statuses := make([]CronStatus, 0, len(crons))
+
+	for _, cronJob := range crons {
+		status := CronStatus{
+			ID:          cronJob.ID,
+			CronExpr:    cronJob.CronExpr,
+			Timezone:    cronJob.Timezone,
+			Description: cronJob.Description,
+			Enabled:     cronJob.Enabled,
+		}
+
+		if cronJob.Enabled {
+			if times, err := UpcomingRuns(cronJob, time.Now(), max(upcoming, 1)); err == nil {
+				status.NextRunAt = &times[0]
+				if upcoming > 0 {
+					status.UpcomingRuns = times
+				}
+			}
+		}
+
+		lastRun, err := cronutils.FindLastCronRun(app, cronJob.ID)
+		if err != nil {
+			log.Warn("Failed to find last cron run", "cron_id", cronJob.ID, "error", err)
+		}
+		status.LastRun = lastRun
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// UpcomingRuns returns the next n fire times of a cron after the given time in the cron's timezone
+func UpcomingRuns(cronJob Cron, after time.Time, n int) ([]time.Time, error) {
+	schedule, err := cronutils.ParseSchedule(cronJob.CronExpr, cronJob.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule.NextN(after, n)
+}
+
+// TriggerCron starts a manual run of an enabled cron in the background and returns its cron_runs record.
+// It returns cronutils.ErrCronRunning while a run of the cron is still in progress.
+func TriggerCron(app core.App, id string) (*core.Record, error) {
+	cronJob, run, err := startManualRun(app, id)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := run.Execute(cronJob.Handler); err != nil {
+			log.Error(fmt.Sprintf("Cron %s failed", id), "error", err, "trigger", cronutils.CronTriggerManual)
+		}
+	}()
+
+	return run.Record, nil
+}
+
+// RunCron runs an enabled cron manually and waits for it to finish
+func RunCron(app core.App, id string) (*core.Record, error) {
+	cronJob, run, err := startManualRun(app, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return run.Record, run.Execute(cronJob.Handler)
+}
+
+func startManualRun(app core.App, id string) (Cron, *cronutils.CronRun, error) {
+	cronJob, err := FindCron(id)
+	if err != nil {
+		return Cron{}, nil, err
+	}
+	if !cronJob.Enabled {
+		return Cron{}, nil, fmt.Errorf("%w: %s", ErrCronDisabled, id)
+	}
+
+	run, err := cronutils.StartCronRun(app, cronJob.ID, cronutils.CronTriggerManual, jobutils.InstanceID())
+	if err != nil {
+		return Cron{}, nil, err
+	}
+
+	log.Info("Cron triggered manually", "cron_id", cronJob.ID, "run_id", run.Record.Id)
+	return cronJob, run, nil
+}
@@ -1,8 +1,10 @@
 package crons
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 )
@@ -48,7 +50,7 @@ func TestCronStructure(t *testing.T) {
 	cron := Cron{
 		ID:          "test",
 		CronExpr:    "* * * * *",
-		Handler:     func() {},
+		Handler:     func() error { return nil },
 		Enabled:     true,
 		Description: "Test cron",
 	}
@@ -69,3 +71,68 @@ func TestCronStructure(t *testing.T) {
 		t.Error("Cron Description not set correctly")
 	}
 }
+
+func TestFindCron(t *testing.T) {
+	app := pocketbase.New()
+
+	t.Setenv("ENABLE_CLEAR_EXPORT_FILES_CRON", "false")
+	if err := RegisterCrons(app); err != nil {
+		t.Fatalf("RegisterCrons failed: %v", err)
+	}
+
+	cronJob, err := FindCron("system_queue")
+	if err != nil || !cronJob.Enabled || cronJob.Handler == nil {
+		t.Errorf("expected the enabled system_queue cron, got %+v (%v)", cronJob, err)
+	}
+
+	if _, err := FindCron("missing"); !errors.Is(err, ErrCronNotFound) {
+		t.Errorf("expected ErrCronNotFound, got %v", err)
+	}
+
+	if _, err := TriggerCron(app, "clean_exported_files"); !errors.Is(err, ErrCronDisabled) {
+		t.Errorf("expected ErrCronDisabled for a disabled cron, got %v", err)
+	}
+}
+
+func TestUpcomingRuns(t *testing.T) {
+	cronJob := Cron{ID: "report", CronExpr: "0 9 * * *", Timezone: "Europe/Berlin"}
+
+	times, err := UpcomingRuns(cronJob, time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC), 2)
+	if err != nil {
+		t.Fatalf("UpcomingRuns returned error: %v", err)
+	}
+
+	// 09:00 in Berlin is 08:00 UTC in winter
+	expected := []time.Time{
+		time.Date(2026, 1, 11, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 12, 8, 0, 0, 0, time.UTC),
+	}
+	for i := range expected {
+		if i >= len(times) || !times[i].Equal(expected[i]) {
+			t.Fatalf("expected %v, got %v", expected, times)
+		}
+	}
+
+	if _, err := UpcomingRuns(Cron{CronExpr: "0 9 * * *", Timezone: "Mars/Olympus"}, time.Now(), 1); err == nil {
+		t.Error("expected an invalid timezone to be rejected")
+	}
+}
+
+func TestRegisterCrons_SchedulerExpressions(t *testing.T) {
+	app := pocketbase.New()
+
+	if err := RegisterCrons(app); err != nil {
+		t.Fatalf("RegisterCrons failed: %v", err)
+	}
+
+	// The built-in crons run in UTC, so they are registered with their own expression
+	for _, job := range app.Cron().Jobs() {
+		cronJob, err := FindCron(job.Id())
+		if err != nil {
+			continue // PocketBase's own crons
+		}
+		if job.Expression() != cronJob.CronExpr {
+			t.Errorf("expected cron %s to be registered with %q, got %q", job.Id(), cronJob.CronExpr, job.Expression())
+		}
+	}
+}
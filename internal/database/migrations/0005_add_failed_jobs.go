@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Forward migration
+		schemaPath := filepath.Join("internal", "database", "schema", "0005_pb_schema.json")
+		schemaData, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		var collections []any
+		if err := json.Unmarshal(schemaData, &collections); err != nil {
+			return fmt.Errorf("failed to parse schema JSON: %w", err)
+		}
+
+		collectionsData, err := json.Marshal(collections)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collections: %w", err)
+		}
+
+		if err := app.ImportCollectionsByMarshaledJSON(collectionsData, false); err != nil {
+			return fmt.Errorf("failed to import collections: %w", err)
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Rollback migration
+		collectionsToDelete := []string{"failed_jobs"}
+
+		for _, collectionName := range collectionsToDelete {
+			collection, err := app.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				continue // Collection might not exist
+			}
+
+			if err := app.Delete(collection); err != nil {
+				return fmt.Errorf("failed to delete collection %s: %w", collectionName, err)
+			}
+		}
+
+		// Remove the attempt tracking fields added to the queues collection
+		queues, err := app.FindCollectionByNameOrId("queues")
+		if err != nil {
+			return nil // Collection might not exist
+		}
+
+		queues.Fields.RemoveByName("last_error")
+		queues.Fields.RemoveByName("attempt_history")
+
+		if err := app.Save(queues); err != nil {
+			return fmt.Errorf("failed to update collection queues: %w", err)
+		}
+
+		return nil
+	})
+}
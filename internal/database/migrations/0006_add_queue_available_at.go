@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Forward migration
+		schemaPath := filepath.Join("internal", "database", "schema", "0006_pb_schema.json")
+		schemaData, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		var collections []any
+		if err := json.Unmarshal(schemaData, &collections); err != nil {
+			return fmt.Errorf("failed to parse schema JSON: %w", err)
+		}
+
+		collectionsData, err := json.Marshal(collections)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collections: %w", err)
+		}
+
+		if err := app.ImportCollectionsByMarshaledJSON(collectionsData, false); err != nil {
+			return fmt.Errorf("failed to import collections: %w", err)
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Rollback migration
+		queues, err := app.FindCollectionByNameOrId("queues")
+		if err != nil {
+			return nil // Collection might not exist
+		}
+
+		queues.RemoveIndex("idx_queues_available_at")
+		queues.Fields.RemoveByName("available_at")
+
+		if err := app.Save(queues); err != nil {
+			return fmt.Errorf("failed to update collection queues: %w", err)
+		}
+
+		return nil
+	})
+}
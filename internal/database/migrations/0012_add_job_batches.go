@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Forward migration
+		schemaPath := filepath.Join("internal", "database", "schema", "0012_pb_schema.json")
+		schemaData, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		var collections []any
+		if err := json.Unmarshal(schemaData, &collections); err != nil {
+			return fmt.Errorf("failed to parse schema JSON: %w", err)
+		}
+
+		collectionsData, err := json.Marshal(collections)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collections: %w", err)
+		}
+
+		if err := app.ImportCollectionsByMarshaledJSON(collectionsData, false); err != nil {
+			return fmt.Errorf("failed to import collections: %w", err)
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Rollback migration
+		if batches, err := app.FindCollectionByNameOrId("job_batches"); err == nil {
+			if err := app.Delete(batches); err != nil {
+				return fmt.Errorf("failed to delete collection job_batches: %w", err)
+			}
+		}
+
+		removals := []struct {
+			collection string
+			index      string
+			fields     []string
+		}{
+			{collection: "queues", index: "idx_queues_batch_id", fields: []string{"batch_id", "chain"}},
+			{collection: "failed_jobs", fields: []string{"chain"}},
+			{collection: "job_results", index: "idx_job_results_batch_id", fields: []string{"batch_id"}},
+		}
+
+		for _, removal := range removals {
+			collection, err := app.FindCollectionByNameOrId(removal.collection)
+			if err != nil {
+				continue // Collection might not exist
+			}
+
+			if removal.index != "" {
+				collection.RemoveIndex(removal.index)
+			}
+			for _, field := range removal.fields {
+				collection.Fields.RemoveByName(field)
+			}
+
+			if err := app.Save(collection); err != nil {
+				return fmt.Errorf("failed to update collection %s: %w", removal.collection, err)
+			}
+		}
+
+		return nil
+	})
+}
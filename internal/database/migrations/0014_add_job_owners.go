@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Forward migration
+		schemaPath := filepath.Join("internal", "database", "schema", "0014_pb_schema.json")
+		schemaData, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		var collections []any
+		if err := json.Unmarshal(schemaData, &collections); err != nil {
+			return fmt.Errorf("failed to parse schema JSON: %w", err)
+		}
+
+		collectionsData, err := json.Marshal(collections)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collections: %w", err)
+		}
+
+		if err := app.ImportCollectionsByMarshaledJSON(collectionsData, false); err != nil {
+			return fmt.Errorf("failed to import collections: %w", err)
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Rollback migration
+		removals := []struct {
+			collection string
+			index      string
+		}{
+			{collection: "queues", index: "idx_queues_user_id"},
+			{collection: "failed_jobs"},
+			{collection: "job_results", index: "idx_job_results_user_id"},
+			{collection: "job_batches"},
+			{collection: "export_files", index: "idx_export_files_user_id"},
+		}
+
+		for _, removal := range removals {
+			collection, err := app.FindCollectionByNameOrId(removal.collection)
+			if err != nil {
+				continue // Collection might not exist
+			}
+
+			if removal.index != "" {
+				collection.RemoveIndex(removal.index)
+			}
+			collection.Fields.RemoveByName("user_id")
+
+			if err := app.Save(collection); err != nil {
+				return fmt.Errorf("failed to update collection %s: %w", removal.collection, err)
+			}
+		}
+
+		return nil
+	})
+}
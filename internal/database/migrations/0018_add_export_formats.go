@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Forward migration
+		schemaPath := filepath.Join("internal", "database", "schema", "0018_pb_schema.json")
+		schemaData, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		var collections []any
+		if err := json.Unmarshal(schemaData, &collections); err != nil {
+			return fmt.Errorf("failed to parse schema JSON: %w", err)
+		}
+
+		collectionsData, err := json.Marshal(collections)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collections: %w", err)
+		}
+
+		if err := app.ImportCollectionsByMarshaledJSON(collectionsData, false); err != nil {
+			return fmt.Errorf("failed to import collections: %w", err)
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Rollback migration
+		collection, err := app.FindCollectionByNameOrId("export_files")
+		if err != nil {
+			return nil // Collection might not exist
+		}
+
+		fileField, ok := collection.Fields.GetByName("file").(*core.FileField)
+		if !ok {
+			return nil
+		}
+
+		addedMimeTypes := []string{"application/x-ndjson", "application/json", "text/plain"}
+		mimeTypes := make([]string, 0, len(fileField.MimeTypes))
+		for _, mimeType := range fileField.MimeTypes {
+			if !slices.Contains(addedMimeTypes, mimeType) {
+				mimeTypes = append(mimeTypes, mimeType)
+			}
+		}
+		fileField.MimeTypes = mimeTypes
+
+		if err := app.Save(collection); err != nil {
+			return fmt.Errorf("failed to update collection export_files: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,429 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/internal/handlers/export"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// resultSampleSize is the number of result rows kept in the job result
+const resultSampleSize = 100
+
+// dateBuckets are the strftime layouts of the date buckets of grouping fields, e.g. "created:day"
+var dateBuckets = map[string]string{
+	"hour":  "%Y-%m-%d %H:00",
+	"day":   "%Y-%m-%d",
+	"week":  "%Y-W%W",
+	"month": "%Y-%m",
+	"year":  "%Y",
+}
+
+// columnNamePattern matches the names of result columns, which are also target collection fields
+var columnNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// nonColumnChars are replaced by "_" in the column names derived from grouping fields
+var nonColumnChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// aggregation is a validated aggregate query of a collection. It has one column per grouping field, then one
+// per aggregate function.
+type aggregation struct {
+	app        core.App
+	collection *core.Collection
+	columns    []string
+	groups     int
+	where      dbx.Expression
+	query      *dbx.SelectQuery
+}
+
+// HandleAggregate groups the records of a collection (payload.Data.Source) matching payload.Data.Filter and
+// computes the aggregate functions of each group in a single SQL query. The results are written to an export
+// file when payload.Data.Format or payload.Data.Target is a file format, to the target collection otherwise,
+// with one record per group. Aggregates read every record, like superusers: jobs are created by superusers,
+// directly or through scheduled_jobs. Report files are owned by userId.
+func HandleAggregate(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId, userId string, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataAggregateResult, error) {
+	data := payload.Data
+
+	aggregation, err := newAggregation(app, data)
+	if err != nil {
+		return nil, err
+	}
+
+	format, target, err := resultOutput(app, data, aggregation.columns)
+	if err != nil {
+		return nil, err
+	}
+	fileOptions, err := jobutils.OpenExportFileOptions(app, payload.Options.ExportFileOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Running aggregation",
+		"job_id", jobId,
+		"collection", aggregation.collection.Name,
+		"group_by", data.GroupBy,
+		"format", format,
+		"target", data.Target,
+		"dry_run", payload.Options.DryRun)
+
+	reportAggregateProgress(ctx, 0, 2, "Running aggregation")
+
+	processed, err := aggregation.count()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := aggregation.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reportAggregateProgress(ctx, 1, 2, "Saving aggregation results")
+
+	result := &jobutils.DataAggregateResult{
+		DataProcessingResult: jobutils.DataProcessingResult{
+			BaseJobResultData: jobutils.BaseJobResultData{
+				Message:   fmt.Sprintf("Aggregated %d %s records into %d groups", processed, aggregation.collection.Name, len(rows)),
+				Timestamp: time.Now(),
+			},
+			ProcessedRecords: processed,
+		},
+		DryRun:  payload.Options.DryRun,
+		Columns: aggregation.columns,
+		Groups:  len(rows),
+		Rows:    sampleRows(aggregation.columns, rows),
+	}
+
+	switch {
+	case payload.Options.DryRun:
+	case format != "":
+		file, err := export.SaveReportFile(app, jobId, userId, aggregation.collection.Name+"_report", format, aggregation.columns, rows, fileOptions)
+		if err != nil {
+			return nil, err
+		}
+		result.ExportRecordId = file.ExportRecordId
+		result.FileName = file.FileName
+		result.OutputLocation = file.FileName
+		result.Checksum = file.Checksum
+	case target != nil:
+		if err := saveRows(app, target, aggregation.columns, rows); err != nil {
+			return nil, err
+		}
+		result.Created = len(rows)
+		result.OutputLocation = target.Name
+	}
+
+	reportAggregateProgress(ctx, 2, 2, "Aggregation completed")
+
+	log.Info("Aggregation completed",
+		"job_id", jobId,
+		"collection", aggregation.collection.Name,
+		"processed_records", processed,
+		"groups", len(rows),
+		"output", result.OutputLocation)
+
+	return result, nil
+}
+
+// newAggregation validates the grouping fields, aggregate functions, filter and sort of an aggregate job and
+// builds its query
+func newAggregation(app core.App, data jobutils.DataProcessingJobData) (*aggregation, error) {
+	collection, err := app.FindCachedCollectionByNameOrId(data.Source)
+	if err != nil {
+		return nil, fmt.Errorf("source collection %q not found", data.Source)
+	}
+	if len(data.Aggregates) == 0 {
+		return nil, errors.New("at least one aggregate function is required")
+	}
+
+	a := &aggregation{
+		app:        app,
+		collection: collection,
+		query:      app.DB().Select().From(collection.Name),
+	}
+
+	resolver := core.NewRecordFieldResolver(app, collection, nil, true)
+	for _, groupBy := range data.GroupBy {
+		expr, err := groupExpression(resolver, groupBy)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.Trim(nonColumnChars.ReplaceAllString(groupBy, "_"), "_")
+		if err := a.addColumn(name, expr); err != nil {
+			return nil, err
+		}
+		a.query.AndGroupBy(expr)
+	}
+	a.groups = len(a.columns)
+
+	// Relations of grouping fields are joined, one row per related record
+	if err := resolver.UpdateQuery(a.query); err != nil {
+		return nil, fmt.Errorf("failed to build aggregate query: %w", err)
+	}
+
+	for _, aggregate := range data.Aggregates {
+		name, expr, err := aggregateExpression(collection, aggregate)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.addColumn(name, expr); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(data.Filter) != "" {
+		where, err := jobutils.RecordFilterExpression(app, collection, data.Filter)
+		if err != nil {
+			return nil, err
+		}
+		a.where = where
+		a.query.AndWhere(where)
+	}
+
+	if err := a.orderBy(data.Sort); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// groupExpression returns the SQL expression of a grouping field, a field path optionally followed by a date
+// bucket
+func groupExpression(resolver *core.RecordFieldResolver, groupBy string) (string, error) {
+	path, bucket, hasBucket := strings.Cut(strings.TrimSpace(groupBy), ":")
+	if path == "" || strings.HasPrefix(path, "@") {
+		return "", fmt.Errorf("invalid group by %q, expected a field", groupBy)
+	}
+
+	resolved, err := resolver.Resolve(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid group by %q: %w", groupBy, err)
+	}
+	if !hasBucket {
+		return resolved.Identifier, nil
+	}
+
+	layout, ok := dateBuckets[bucket]
+	if !ok {
+		return "", fmt.Errorf("invalid date bucket %q in group by %q, expected hour, day, week, month or year", bucket, groupBy)
+	}
+	return fmt.Sprintf("strftime('%s', %s)", layout, resolved.Identifier), nil
+}
+
+// aggregateExpression returns the result column and the SQL expression of an aggregate function
+func aggregateExpression(collection *core.Collection, aggregate jobutils.DataAggregate) (string, string, error) {
+	function := strings.ToLower(strings.TrimSpace(aggregate.Function))
+	fieldName := strings.TrimSpace(aggregate.Field)
+
+	name := aggregate.As
+	if name == "" {
+		name = function
+		if fieldName != "" {
+			name += "_" + fieldName
+		}
+	}
+
+	switch function {
+	case jobutils.DataAggregateCount, jobutils.DataAggregateSum, jobutils.DataAggregateAvg, jobutils.DataAggregateMin, jobutils.DataAggregateMax:
+	default:
+		return "", "", fmt.Errorf("unsupported aggregate function %q, expected count, sum, avg, min or max", aggregate.Function)
+	}
+
+	// Records are counted once per group even when a grouping relation joins several rows
+	if fieldName == "" {
+		if function != jobutils.DataAggregateCount {
+			return "", "", fmt.Errorf("aggregate function %s needs a field", function)
+		}
+		return name, "COUNT(DISTINCT [[" + collection.Name + ".id]])", nil
+	}
+
+	field := collection.Fields.GetByName(fieldName)
+	if field == nil || fieldName == core.FieldNamePassword || fieldName == core.FieldNameTokenKey {
+		return "", "", fmt.Errorf("%s has no field %q to aggregate", collection.Name, fieldName)
+	}
+
+	column := "[[" + collection.Name + "." + field.GetName() + "]]"
+	switch function {
+	case jobutils.DataAggregateCount:
+		// Empty values are stored as empty strings, they are not counted
+		return name, "COUNT(NULLIF(" + column + ", ''))", nil
+	case jobutils.DataAggregateSum, jobutils.DataAggregateAvg:
+		if field.Type() != core.FieldTypeNumber {
+			return "", "", fmt.Errorf("aggregate function %s needs a number field, %s is a %s field", function, fieldName, field.Type())
+		}
+	}
+
+	return name, strings.ToUpper(function) + "(" + column + ")", nil
+}
+
+// addColumn adds a result column selecting expr
+func (a *aggregation) addColumn(name, expr string) error {
+	if !columnNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid result column name %q", name)
+	}
+	if slices.Contains(a.columns, name) {
+		return fmt.Errorf("duplicate result column %q, set a different name with \"as\"", name)
+	}
+
+	a.columns = append(a.columns, name)
+	a.query.AndSelect(expr + " AS " + name)
+	return nil
+}
+
+// orderBy sorts the results by result columns, "-" sorts descending. Results are sorted by the grouping
+// columns by default.
+func (a *aggregation) orderBy(sort string) error {
+	if strings.TrimSpace(sort) == "" {
+		for _, column := range a.columns[:a.groups] {
+			a.query.AndOrderBy("[[" + column + "]] ASC")
+		}
+		return nil
+	}
+
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		direction := "ASC"
+		if strings.HasPrefix(part, "-") {
+			direction = "DESC"
+		}
+		column := strings.TrimLeft(part, "+-")
+
+		if !slices.Contains(a.columns, column) {
+			return fmt.Errorf("invalid sort %q, expected one of the result columns %s", part, strings.Join(a.columns, ", "))
+		}
+		a.query.AndOrderBy("[[" + column + "]] " + direction)
+	}
+	return nil
+}
+
+// count returns the number of aggregated records
+func (a *aggregation) count() (int, error) {
+	query := a.app.DB().Select("COUNT(*)").From(a.collection.Name)
+	if a.where != nil {
+		query.AndWhere(a.where)
+	}
+
+	var total int
+	if err := query.Row(&total); err != nil {
+		return 0, fmt.Errorf("failed to count %s records: %w", a.collection.Name, err)
+	}
+	return total, nil
+}
+
+// run executes the aggregate query and returns a row of values per group
+func (a *aggregation) run(ctx *cronutils.CronExecutionContext) ([][]any, error) {
+	rows, err := a.query.WithContext(ctx).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate %s: %w", a.collection.Name, err)
+	}
+	defer rows.Close()
+
+	var results [][]any
+	for rows.Next() {
+		values := make([]any, len(a.columns))
+		pointers := make([]any, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to read aggregate results: %w", err)
+		}
+		for i, value := range values {
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+
+		results = append(results, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read aggregate results: %w", err)
+	}
+
+	return results, nil
+}
+
+// resultOutput returns the export format or the collection that the results are written to. Both are empty
+// when the results are only kept in the job result.
+func resultOutput(app core.App, data jobutils.DataProcessingJobData, columns []string) (string, *core.Collection, error) {
+	format := data.Format
+	if format == "" && export.SupportsFormat(data.Target) {
+		format = data.Target
+	}
+	if format != "" {
+		if !export.SupportsFormat(format) {
+			return "", nil, fmt.Errorf("unsupported report format %q, expected csv, jsonl or xlsx", format)
+		}
+		return format, nil, nil
+	}
+
+	if data.Target == "" {
+		return "", nil, nil
+	}
+
+	target, err := app.FindCachedCollectionByNameOrId(data.Target)
+	if err != nil {
+		return "", nil, fmt.Errorf("target collection %q not found", data.Target)
+	}
+	if target.IsView() || target.System {
+		return "", nil, fmt.Errorf("aggregate results cannot be written to %s", target.Name)
+	}
+
+	for _, column := range columns {
+		if target.Fields.GetByName(column) == nil {
+			return "", nil, fmt.Errorf("target collection %s has no field %q for the result column", target.Name, column)
+		}
+	}
+
+	return "", target, nil
+}
+
+// saveRows creates a record per result row in the target collection, all or none of them
+func saveRows(app core.App, target *core.Collection, columns []string, rows [][]any) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		for i, row := range rows {
+			record := core.NewRecord(target)
+			for j, column := range columns {
+				record.Set(column, row[j])
+			}
+
+			if err := txApp.Save(record); err != nil {
+				return fmt.Errorf("failed to save result row %d in %s: %w", i+1, target.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// sampleRows returns the first result rows as objects keyed by column
+func sampleRows(columns []string, rows [][]any) []map[string]any {
+	sample := make([]map[string]any, 0, min(len(rows), resultSampleSize))
+	for _, row := range rows[:min(len(rows), resultSampleSize)] {
+		values := make(map[string]any, len(columns))
+		for i, column := range columns {
+			values[column] = row[i]
+		}
+		sample = append(sample, values)
+	}
+	return sample
+}
+
+// reportAggregateProgress reports aggregation progress, logging instead of failing the job when it cannot be stored
+func reportAggregateProgress(ctx *cronutils.CronExecutionContext, done, total int, message string) {
+	if err := ctx.ReportProgress(done, total, message); err != nil {
+		log.Warn("Failed to report aggregation progress", "job_id", ctx.CronID, "error", err)
+	}
+}
@@ -0,0 +1,329 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp bootstraps a PocketBase app with export_files, roles, users with roles and an orders collection
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	exportFiles := core.NewBaseCollection(jobutils.ExportFilesCollectionName)
+	exportFiles.Fields.Add(
+		&core.TextField{Name: "job_id", Required: true},
+		&core.FileField{Name: "file", MaxSelect: 1},
+		&core.NumberField{Name: "record_count"},
+		&core.TextField{Name: "user_id"},
+		&core.DateField{Name: "expires_at"},
+		&core.TextField{Name: "storage"},
+		&core.TextField{Name: "storage_key"},
+		&core.TextField{Name: "checksum"},
+		&core.TextField{Name: "compression"},
+		&core.TextField{Name: "encryption"},
+	)
+	mustSave(t, app, exportFiles)
+
+	roles := core.NewBaseCollection("roles")
+	roles.Fields.Add(&core.TextField{Name: "name", Required: true})
+	mustSave(t, app, roles)
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("failed to find users collection: %v", err)
+	}
+	users.Fields.Add(
+		&core.BoolField{Name: "is_active"},
+		&core.RelationField{Name: "roles", CollectionId: roles.Id, MaxSelect: 99},
+	)
+	mustSave(t, app, users)
+
+	orders := core.NewBaseCollection("orders")
+	orders.Fields.Add(
+		&core.TextField{Name: "status"},
+		&core.NumberField{Name: "amount"},
+		&core.DateField{Name: "placed_at"},
+	)
+	mustSave(t, app, orders)
+
+	roleIds := map[string]string{}
+	for _, name := range []string{"admin", "editor"} {
+		role := core.NewRecord(roles)
+		role.Set("name", name)
+		mustSave(t, app, role)
+		roleIds[name] = role.Id
+	}
+
+	for i, user := range []struct {
+		active bool
+		roles  []string
+	}{
+		{true, []string{roleIds["admin"], roleIds["editor"]}},
+		{true, []string{roleIds["editor"]}},
+		{true, []string{roleIds["editor"]}},
+		{false, []string{roleIds["admin"]}},
+	} {
+		record := core.NewRecord(users)
+		record.SetEmail(string(rune('a'+i)) + "@example.com")
+		record.SetPassword("1234567890")
+		record.Set("is_active", user.active)
+		record.Set("roles", user.roles)
+		mustSave(t, app, record)
+	}
+
+	for _, order := range []struct {
+		status   string
+		amount   float64
+		placedAt string
+	}{
+		{"paid", 10, "2026-01-01 09:00:00.000Z"},
+		{"paid", 30, "2026-01-01 18:00:00.000Z"},
+		{"paid", 5, "2026-01-02 10:00:00.000Z"},
+		{"refunded", 100, "2026-01-02 11:00:00.000Z"},
+	} {
+		record := core.NewRecord(orders)
+		record.Set("status", order.status)
+		record.Set("amount", order.amount)
+		record.Set("placed_at", order.placedAt)
+		mustSave(t, app, record)
+	}
+
+	return app
+}
+
+func mustSave(t *testing.T, app *pocketbase.PocketBase, model core.Model) {
+	t.Helper()
+	if err := app.Save(model); err != nil {
+		t.Fatalf("failed to save %v: %v", model, err)
+	}
+}
+
+func aggregatePayload(data jobutils.DataProcessingJobData) *jobutils.DataProcessingJobPayload {
+	data.Operation = jobutils.DataProcessingOperationAggregate
+	return &jobutils.DataProcessingJobPayload{Type: jobutils.JobTypeDataProcessing, Data: data}
+}
+
+func TestHandleAggregate_ActiveUsersByRoleToCollection(t *testing.T) {
+	app := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "aggregate-job")
+
+	reports := core.NewBaseCollection("active_users_by_role")
+	reports.Fields.Add(
+		&core.TextField{Name: "roles_name"},
+		&core.NumberField{Name: "active_users"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	mustSave(t, app, reports)
+
+	payload := aggregatePayload(jobutils.DataProcessingJobData{
+		Source:     "users",
+		Target:     "active_users_by_role",
+		Filter:     "is_active = true",
+		GroupBy:    []string{"roles.name"},
+		Aggregates: []jobutils.DataAggregate{{Function: "count", As: "active_users"}},
+	})
+
+	result, err := HandleAggregate(ctx, app, "aggregate-job", "", payload)
+	if err != nil {
+		t.Fatalf("HandleAggregate returned error: %v", err)
+	}
+
+	// The inactive admin is filtered out, the user with both roles counts in each group
+	if result.ProcessedRecords != 3 || result.Groups != 2 || result.Created != 2 {
+		t.Fatalf("expected 3 users in 2 groups, got %+v", result)
+	}
+
+	records, err := app.FindRecordsByFilter("active_users_by_role", "", "roles_name", 0, 0)
+	if err != nil {
+		t.Fatalf("failed to read reports: %v", err)
+	}
+	got := map[string]int{}
+	for _, record := range records {
+		got[record.GetString("roles_name")] = record.GetInt("active_users")
+	}
+	if len(got) != 2 || got["admin"] != 1 || got["editor"] != 3 {
+		t.Errorf("expected 1 admin and 3 editors, got %v", got)
+	}
+}
+
+func TestHandleAggregate_DailyTotalsToFile(t *testing.T) {
+	app := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "aggregate-job")
+
+	payload := aggregatePayload(jobutils.DataProcessingJobData{
+		Source:  "orders",
+		Target:  jobutils.DataProcessingFileJSONL,
+		Filter:  "status = 'paid'",
+		GroupBy: []string{"placed_at:day"},
+		Aggregates: []jobutils.DataAggregate{
+			{Function: "count"},
+			{Function: "sum", Field: "amount"},
+			{Function: "avg", Field: "amount"},
+			{Function: "max", Field: "amount", As: "largest"},
+		},
+		Sort: "-placed_at_day",
+	})
+
+	result, err := HandleAggregate(ctx, app, "aggregate-job", "user1", payload)
+	if err != nil {
+		t.Fatalf("HandleAggregate returned error: %v", err)
+	}
+
+	expectedColumns := "placed_at_day,count,sum_amount,avg_amount,largest"
+	if strings.Join(result.Columns, ",") != expectedColumns {
+		t.Errorf("expected columns %s, got %v", expectedColumns, result.Columns)
+	}
+	if result.FileName == "" || !strings.HasSuffix(result.FileName, ".jsonl") || result.OutputLocation != result.FileName {
+		t.Fatalf("expected a JSON Lines report file, got %+v", result)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(readReportFile(t, app, result.ExportRecordId)))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 days, got %v", lines)
+	}
+	if lines[0]["placed_at_day"] != "2026-01-02" || lines[0]["count"] != float64(1) || lines[0]["sum_amount"] != float64(5) {
+		t.Errorf("unexpected second day totals: %v", lines[0])
+	}
+	if lines[1]["placed_at_day"] != "2026-01-01" || lines[1]["count"] != float64(2) || lines[1]["avg_amount"] != float64(20) || lines[1]["largest"] != float64(30) {
+		t.Errorf("unexpected first day totals: %v", lines[1])
+	}
+	if len(result.Rows) != 2 || result.Rows[0]["placed_at_day"] != "2026-01-02" {
+		t.Errorf("expected the rows in the job result, got %v", result.Rows)
+	}
+}
+
+func TestHandleAggregate_DryRunWithoutGroups(t *testing.T) {
+	app := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "aggregate-job")
+
+	payload := aggregatePayload(jobutils.DataProcessingJobData{
+		Source:     "orders",
+		Target:     jobutils.DataProcessingFileCSV,
+		Aggregates: []jobutils.DataAggregate{{Function: "min", Field: "placed_at"}, {Function: "count", Field: "status"}},
+	})
+	payload.Options.DryRun = true
+
+	result, err := HandleAggregate(ctx, app, "aggregate-job", "", payload)
+	if err != nil {
+		t.Fatalf("HandleAggregate returned error: %v", err)
+	}
+
+	if result.Groups != 1 || result.ExportRecordId != "" {
+		t.Fatalf("expected a single group and no file in a dry run, got %+v", result)
+	}
+	row := result.Rows[0]
+	if row["min_placed_at"] != "2026-01-01 09:00:00.000Z" || row["count_status"] != int64(4) {
+		t.Errorf("unexpected totals: %v", row)
+	}
+}
+
+func TestNewAggregation_Errors(t *testing.T) {
+	app := newTestApp(t)
+
+	count := []jobutils.DataAggregate{{Function: "count"}}
+	tests := []struct {
+		name    string
+		data    jobutils.DataProcessingJobData
+		errText string
+	}{
+		{name: "unknown source", data: jobutils.DataProcessingJobData{Source: "missing", Aggregates: count}, errText: `source collection "missing" not found`},
+		{name: "no aggregates", data: jobutils.DataProcessingJobData{Source: "orders"}, errText: "at least one aggregate function"},
+		{name: "unknown function", data: jobutils.DataProcessingJobData{Source: "orders", Aggregates: []jobutils.DataAggregate{{Function: "median", Field: "amount"}}}, errText: `unsupported aggregate function "median"`},
+		{name: "sum without field", data: jobutils.DataProcessingJobData{Source: "orders", Aggregates: []jobutils.DataAggregate{{Function: "sum"}}}, errText: "needs a field"},
+		{name: "sum of text", data: jobutils.DataProcessingJobData{Source: "orders", Aggregates: []jobutils.DataAggregate{{Function: "sum", Field: "status"}}}, errText: "needs a number field"},
+		{name: "unknown field", data: jobutils.DataProcessingJobData{Source: "orders", Aggregates: []jobutils.DataAggregate{{Function: "max", Field: "total"}}}, errText: `orders has no field "total"`},
+		{name: "password", data: jobutils.DataProcessingJobData{Source: "users", Aggregates: []jobutils.DataAggregate{{Function: "max", Field: "password"}}}, errText: `users has no field "password"`},
+		{name: "unknown group", data: jobutils.DataProcessingJobData{Source: "orders", GroupBy: []string{"region"}, Aggregates: count}, errText: `invalid group by "region"`},
+		{name: "unknown bucket", data: jobutils.DataProcessingJobData{Source: "orders", GroupBy: []string{"placed_at:minute"}, Aggregates: count}, errText: `invalid date bucket "minute"`},
+		{name: "duplicate column", data: jobutils.DataProcessingJobData{Source: "orders", Aggregates: []jobutils.DataAggregate{{Function: "count"}, {Function: "count"}}}, errText: `duplicate result column "count"`},
+		{name: "invalid filter", data: jobutils.DataProcessingJobData{Source: "orders", Filter: "amount >", Aggregates: count}, errText: "invalid filter"},
+		{name: "invalid sort", data: jobutils.DataProcessingJobData{Source: "orders", Sort: "-amount", Aggregates: count}, errText: `invalid sort "-amount"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newAggregation(app, tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("expected error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
+
+func TestResultOutput(t *testing.T) {
+	app := newTestApp(t)
+	columns := []string{"status", "count"}
+
+	format, target, err := resultOutput(app, jobutils.DataProcessingJobData{Target: "xlsx"}, columns)
+	if err != nil || format != jobutils.DataProcessingFileXLSX || target != nil {
+		t.Errorf("expected the xlsx format, got %q, %v, %v", format, target, err)
+	}
+
+	format, target, err = resultOutput(app, jobutils.DataProcessingJobData{}, columns)
+	if err != nil || format != "" || target != nil {
+		t.Errorf("expected no output, got %q, %v, %v", format, target, err)
+	}
+
+	if _, _, err := resultOutput(app, jobutils.DataProcessingJobData{Format: "pdf"}, columns); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+	if _, _, err := resultOutput(app, jobutils.DataProcessingJobData{Target: "orders"}, columns); err == nil || !strings.Contains(err.Error(), `no field "count"`) {
+		t.Errorf("expected an error for a missing target field, got %v", err)
+	}
+	if _, _, err := resultOutput(app, jobutils.DataProcessingJobData{Target: "_superusers"}, columns); err == nil {
+		t.Error("expected an error for a system target collection")
+	}
+}
+
+// readReportFile returns the content of an export_files record
+func readReportFile(t *testing.T, app *pocketbase.PocketBase, recordId string) []byte {
+	t.Helper()
+
+	record, err := app.FindRecordById(jobutils.ExportFilesCollectionName, recordId)
+	if err != nil {
+		t.Fatalf("report file not found: %v", err)
+	}
+
+	reader, err := jobutils.OpenExportFile(app, record)
+	if err != nil {
+		t.Fatalf("failed to open report file: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read report file: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,101 @@
+package command
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+
+	"ims-pocketbase-baas-starter/internal/crons"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+)
+
+// HandleListCronsCommand lists the defined crons with their next fire time and last run
+func HandleListCronsCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	statuses := crons.ListCrons(app, 0)
+
+	for _, status := range statuses {
+		attrs := []any{
+			"id", status.ID,
+			"cron_expr", status.CronExpr,
+			"timezone", status.Timezone,
+			"enabled", status.Enabled,
+		}
+		if status.NextRunAt != nil {
+			attrs = append(attrs, "next_run_at", status.NextRunAt.Format(time.RFC3339))
+		}
+		if status.LastRun != nil {
+			attrs = append(attrs,
+				"last_status", status.LastRun.Status,
+				"last_started_at", status.LastRun.StartedAt.Format(time.RFC3339),
+				"last_duration_ms", status.LastRun.DurationMs)
+		}
+
+		log.Info("Cron", attrs...)
+	}
+
+	log.Info("Crons listed", "total", len(statuses))
+}
+
+// HandleRunCronCommand runs a cron immediately and waits for it to finish
+func HandleRunCronCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Error("Cron ID is required")
+		return
+	}
+
+	run, err := crons.RunCron(app, args[0])
+	if err != nil {
+		log.Error("Cron run failed", "cron_id", args[0], "error", err)
+		return
+	}
+
+	log.Info("Cron run completed", "cron_id", args[0], "run_id", run.Id, "duration_ms", run.GetInt("duration_ms"))
+}
+
+// HandlePreviewCronCommand prints the next fire times of a cron expression, or of a defined cron by ID
+func HandlePreviewCronCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Error("Cron expression or cron ID is required")
+		return
+	}
+
+	count := 5
+	if len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Error("Invalid count argument", "error", err)
+			return
+		}
+		count = parsed
+	}
+
+	// A defined cron is previewed in its own timezone, unless another one is given
+	cronExpr, timezone := args[0], ""
+	if cronJob, err := crons.FindCron(args[0]); err == nil {
+		cronExpr, timezone = cronJob.CronExpr, cronJob.Timezone
+	}
+	if len(args) > 2 {
+		timezone = args[2]
+	}
+
+	schedule, err := cronutils.ParseSchedule(cronExpr, timezone)
+	if err != nil {
+		log.Error("Invalid cron expression", "cron_expr", cronExpr, "error", err)
+		return
+	}
+
+	times, err := schedule.NextN(time.Now(), count)
+	if err != nil {
+		log.Error("Failed to compute fire times", "cron_expr", cronExpr, "error", err)
+		return
+	}
+
+	for _, t := range times {
+		log.Info("Fire time", "at", t.Format(time.RFC3339), "utc", t.UTC().Format(time.RFC3339))
+	}
+
+	log.Info("Cron preview", "cron_expr", cronExpr, "timezone", schedule.Location.String(), "total", len(times))
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+
+	"ims-pocketbase-baas-starter/pkg/filecrypt"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+)
+
+// HandleDecryptExportCommand decrypts an encrypted export file with its key or passphrase
+func HandleDecryptExportCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Error("Encrypted file and key or passphrase are required")
+		return
+	}
+
+	output := strings.TrimSuffix(args[0], filecrypt.Extension)
+	if len(args) > 2 {
+		output = args[2]
+	}
+	if output == args[0] {
+		log.Error("Output file is required when the file has no .enc extension")
+		return
+	}
+
+	if err := decryptExportFile(args[0], args[1], output); err != nil {
+		log.Error("Failed to decrypt export file", "file", args[0], "error", err)
+		return
+	}
+
+	log.Info("Export file decrypted", "file", args[0], "output", output)
+}
+
+// decryptExportFile decrypts input to output, output is removed when decryption fails
+func decryptExportFile(input, secret, output string) error {
+	src, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	reader, err := filecrypt.NewReader(src, secret)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, reader)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+)
+
+// HandleListFailedJobsCommand lists dead-lettered jobs, optionally filtered by job type
+func HandleListFailedJobsCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	jobType := ""
+	if len(args) > 0 {
+		jobType = args[0]
+	}
+
+	records, total, err := jobutils.ListFailedJobs(app, jobType, 0, 0)
+	if err != nil {
+		log.Error("Failed to list failed jobs", "error", err)
+		return
+	}
+
+	for _, record := range records {
+		log.Info("Failed job",
+			"id", record.Id,
+			"queue_id", record.GetString("queue_id"),
+			"name", record.GetString("name"),
+			"job_type", record.GetString("job_type"),
+			"attempts", int(record.GetFloat("attempts")),
+			"failed_at", record.GetDateTime("failed_at").String(),
+			"error", record.GetString("error"))
+	}
+
+	log.Info("Failed jobs listed", "total", total, "job_type", jobType)
+}
+
+// HandleRetryFailedJobsCommand re-queues a single failed job by ID, or all failed jobs with "all"
+func HandleRetryFailedJobsCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Error("Failed job ID or 'all' is required")
+		return
+	}
+
+	if args[0] == "all" {
+		jobType := ""
+		if len(args) > 1 {
+			jobType = args[1]
+		}
+
+		retried, err := jobutils.RetryFailedJobs(app, jobType)
+		if err != nil {
+			log.Error("Failed to retry failed jobs", "retried", retried, "error", err)
+			return
+		}
+
+		log.Info("Failed jobs re-queued", "retried", retried, "job_type", jobType)
+		return
+	}
+
+	job, err := jobutils.RetryFailedJob(app, args[0])
+	if err != nil {
+		log.Error("Failed to retry failed job", "failed_job_id", args[0], "error", err)
+		return
+	}
+
+	log.Info("Failed job re-queued", "failed_job_id", args[0], "job_id", job.Id)
+}
+
+// HandlePurgeFailedJobsCommand permanently deletes a single failed job by ID, or all failed jobs with "all"
+func HandlePurgeFailedJobsCommand(app *pocketbase.PocketBase, cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Error("Failed job ID or 'all' is required")
+		return
+	}
+
+	if args[0] == "all" {
+		jobType := ""
+		if len(args) > 1 {
+			jobType = args[1]
+		}
+
+		purged, err := jobutils.PurgeFailedJobs(app, jobType)
+		if err != nil {
+			log.Error("Failed to purge failed jobs", "error", err)
+			return
+		}
+
+		log.Info("Failed jobs purged", "purged", purged, "job_type", jobType)
+		return
+	}
+
+	if err := jobutils.DeleteFailedJob(app, args[0]); err != nil {
+		log.Error("Failed to delete failed job", "failed_job_id", args[0], "error", err)
+		return
+	}
+
+	log.Info("Failed job deleted", "failed_job_id", args[0])
+}
@@ -6,28 +6,39 @@ import (
 
 	"ims-pocketbase-baas-starter/pkg/common"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
-// HandleClearExportFiles processes cleanup of expired export files
-func HandleClearExportFiles(app *pocketbase.PocketBase) {
+// HandleClearExportFiles processes cleanup of expired export files and uploaded import files
+func HandleClearExportFiles(app *pocketbase.PocketBase) error {
 	ctx := cronutils.NewCronExecutionContext(app, "clear_export_files")
 	ctx.LogStart("Starting export files cleanup operations")
 
 	batchSize := common.GetEnvInt("EXPORT_CLEANUP_BATCH_SIZE", 100) // Process up to 100 expired files per run
 
-	expiredRecords, err := findExpiredExportFiles(app, batchSize)
+	expiredRecords, err := findExpiredExportFiles(app, jobutils.ExportFilesCollectionName, batchSize)
 	if err != nil {
 		ctx.LogError(err, "Failed to find expired export files")
-		return
+		return err
 	}
 
+	// Import files are kept until they expire so failed imports can be retried
+	expiredImports, err := findExpiredExportFiles(app, jobutils.ImportFilesCollectionName, batchSize)
+	if err != nil {
+		ctx.LogError(err, "Failed to find expired import files")
+		return err
+	}
+	expiredRecords = append(expiredRecords, expiredImports...)
+
 	if len(expiredRecords) == 0 {
 		ctx.LogEnd("Export files cleanup completed - no files to clean")
-		return
+		return nil
 	}
 
 	deletedCount := 0
@@ -50,54 +61,63 @@ func HandleClearExportFiles(app *pocketbase.PocketBase) {
 		"batch_size", batchSize)
 
 	if errorCount > 0 {
-		ctx.LogError(fmt.Errorf("cleanup completed with %d errors out of %d records", errorCount, len(expiredRecords)), "Cleanup had errors")
+		err := fmt.Errorf("cleanup completed with %d errors out of %d records", errorCount, len(expiredRecords))
+		ctx.LogError(err, "Cleanup had errors")
+		return err
 	}
 
 	ctx.LogEnd("Export files cleanup operations completed successfully")
+	return nil
 }
 
-// findExpiredExportFiles finds all export file records that have expired
-func findExpiredExportFiles(app *pocketbase.PocketBase, batchSize int) ([]*core.Record, error) {
-	collection, err := app.FindCollectionByNameOrId("export_files")
+// findExpiredExportFiles finds the file records of a collection (export_files or import_files) that have expired
+func findExpiredExportFiles(app *pocketbase.PocketBase, collectionName string, batchSize int) ([]*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
 	if err != nil {
-		return nil, fmt.Errorf("export_files collection not found: %w", err)
+		return nil, fmt.Errorf("%s collection not found: %w", collectionName, err)
 	}
 
-	now := time.Now()
-	filter := fmt.Sprintf("expires_at <= '%s'", now.Format(time.RFC3339))
-
+	// Bound in the stored datetime format, an RFC 3339 string would sort after every date of the same day
 	records, err := app.FindRecordsByFilter(
 		collection,
-		filter,
+		"expires_at <= {:now}",
 		"created", // sort by creation date (oldest first)
 		batchSize, // limit to batch size
 		0,         // no offset
+		dbx.Params{"now": types.NowDateTime().String()},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query expired export files: %w", err)
+		return nil, fmt.Errorf("failed to query expired %s: %w", collectionName, err)
 	}
 
 	return records, nil
 }
 
-// deleteExportFileRecord deletes an export file record and its associated file
+// deleteExportFileRecord deletes an export file record and its associated file. Export files are deleted from
+// the storage holding them, import files are files of their record.
 func deleteExportFileRecord(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, record *core.Record) error {
 	recordId := record.Id
 	jobId := record.GetString("job_id")
-	filename := record.GetString("file")
+	filename := jobutils.ExportFileName(record)
 	expiresAt := record.GetDateTime("expires_at").Time()
 
-	ctx.LogDebug(fmt.Sprintf("Deleting expired export file: record_id=%s, job_id=%s, filename=%s, expired_at=%s",
-		recordId, jobId, filename, expiresAt.Format(time.RFC3339)), "Processing expired file")
+	ctx.LogDebug(fmt.Sprintf("Deleting expired %s file: record_id=%s, job_id=%s, filename=%s, expired_at=%s",
+		record.Collection().Name, recordId, jobId, filename, expiresAt.Format(time.RFC3339)), "Processing expired file")
 
-	if err := app.Delete(record); err != nil {
+	if record.Collection().Name == jobutils.ExportFilesCollectionName {
+		if err := jobutils.DeleteExportFile(app, record); err != nil {
+			return err
+		}
+	} else if err := app.Delete(record); err != nil {
 		return fmt.Errorf("failed to delete export file record %s: %w", recordId, err)
 	}
 
 	log.Info("Deleted expired export file",
+		"collection", record.Collection().Name,
 		"record_id", recordId,
 		"job_id", jobId,
 		"filename", filename,
+		"storage", record.GetString("storage"),
 		"expired_at", expiresAt.Format(time.RFC3339))
 
 	return nil
@@ -0,0 +1,50 @@
+package cron
+
+import (
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// HandleClearJobResults deletes job results, finished job batches and cron runs older than the configured retention window
+func HandleClearJobResults(app *pocketbase.PocketBase) error {
+	ctx := cronutils.NewCronExecutionContext(app, "clear_job_results")
+	ctx.LogStart("Starting job results cleanup operations")
+
+	batchSize := common.GetEnvInt("JOB_RESULT_CLEANUP_BATCH_SIZE", 500) // Delete up to 500 expired results per run
+	retention := jobutils.GetJobResultRetention()
+	before := time.Now().Add(-retention)
+
+	pruned, err := jobutils.PruneJobResults(app, before, batchSize)
+	if err != nil {
+		ctx.LogError(err, "Failed to prune expired job results")
+		return err
+	}
+
+	prunedBatches, err := jobutils.PruneJobBatches(app, before, batchSize)
+	if err != nil {
+		ctx.LogError(err, "Failed to prune expired job batches")
+		return err
+	}
+
+	prunedCronRuns, err := cronutils.PruneCronRuns(app, before, batchSize)
+	if err != nil {
+		ctx.LogError(err, "Failed to prune expired cron runs")
+		return err
+	}
+
+	log.Info("Job results cleanup batch completed",
+		"deleted", pruned,
+		"deleted_batches", prunedBatches,
+		"deleted_cron_runs", prunedCronRuns,
+		"retention", retention.String(),
+		"batch_size", batchSize)
+
+	ctx.LogEnd("Job results cleanup operations completed successfully")
+	return nil
+}
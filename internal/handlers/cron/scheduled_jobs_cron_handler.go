@@ -0,0 +1,30 @@
+package cron
+
+import (
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// HandleScheduledJobs enqueues the jobs of the scheduled_jobs collection whose next run time has passed
+func HandleScheduledJobs(app *pocketbase.PocketBase) error {
+	ctx := cronutils.NewCronExecutionContext(app, "scheduled_jobs")
+	ctx.LogStart("Starting scheduled jobs run")
+
+	enqueued, err := jobutils.RunDueScheduledJobs(app, time.Now())
+	if err != nil {
+		ctx.LogError(err, "Failed to run scheduled jobs")
+		return err
+	}
+
+	if enqueued > 0 {
+		log.Info("Scheduled jobs enqueued", "enqueued", enqueued)
+	}
+
+	ctx.LogEnd("Scheduled jobs run completed successfully")
+	return nil
+}
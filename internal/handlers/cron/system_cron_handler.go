@@ -1,20 +1,22 @@
 package cron
 
 import (
-	"time"
+	stderrors "errors"
+	"fmt"
 
 	"ims-pocketbase-baas-starter/internal/jobs"
 	"ims-pocketbase-baas-starter/pkg/common"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 	"ims-pocketbase-baas-starter/pkg/metrics"
 
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // HandleSystemQueue processes jobs from the queue table using the job processor
-func HandleSystemQueue(app *pocketbase.PocketBase) {
+func HandleSystemQueue(app *pocketbase.PocketBase) error {
 	ctx := cronutils.NewCronExecutionContext(app, "system_queue")
 	ctx.LogStart("Starting system queue process operations")
 
@@ -22,44 +24,49 @@ func HandleSystemQueue(app *pocketbase.PocketBase) {
 	processor := jobManager.GetProcessor()
 
 	if processor == nil {
-		ctx.LogError(nil, "Job processor not initialized")
-		return
+		err := fmt.Errorf("job processor not initialized")
+		ctx.LogError(err, "Job processor not initialized")
+		return err
 	}
 
-	maxWorkers := common.GetEnvInt("JOB_MAX_WORKERS", 5)                 // Default 5 concurrent workers
-	batchSize := common.GetEnvInt("JOB_BATCH_SIZE", 50)                  // Process up to 50 jobs per run
-	reservationTimeout := common.GetEnvInt("JOB_RESERVATION_TIMEOUT", 5) // Default 5 minutes reservation timeout
-
-	// Fetch pending jobs (not reserved or reservation expired)
-	expiredTime := time.Now().Add(-time.Duration(reservationTimeout) * time.Minute)
-
-	queues, err := app.FindRecordsByFilter(
-		"queues",
-		"reserved_at = '' || reserved_at < {:expired}",
-		"-created", // Order by created descending (FIFO)
-		batchSize,
-		0,
-		dbx.Params{"expired": expiredTime.Format(time.RFC3339)},
-	)
+	// Queue sizes are reported on every run, the dispatcher does not report them
+	if err := processor.RecordQueueSizes(metrics.GetInstance()); err != nil {
+		ctx.LogError(err, "Error counting queued jobs")
+	}
 
-	if err != nil {
-		ctx.LogError(err, "Error fetching queues data")
-		return
+	// The continuous dispatcher already picks up jobs; the cron only acts as a fallback
+	if processor.IsDispatcherRunning() {
+		ctx.LogEnd("Job dispatcher is running, skipping cron dispatch")
+		return nil
 	}
 
-	// Record queue size metrics
-	metricsProvider := metrics.GetInstance()
-	if metricsProvider != nil {
-		metrics.RecordQueueSize(metricsProvider, "system", len(queues))
+	maxWorkers := common.GetEnvInt("JOB_MAX_WORKERS", 5) // Default 5 concurrent workers
+	batchSize := common.GetEnvInt("JOB_BATCH_SIZE", 50)  // Process up to 50 jobs per queue per run
+	reservationTimeout := jobutils.GetReservationTimeout()
+
+	// Fetch pending jobs per named queue (available now and not reserved or reservation expired),
+	// ordered by priority so high priority jobs are dispatched first
+	var queues []*core.Record
+	for _, queueName := range processor.QueueNames() {
+		records, err := processor.FetchPendingJobs(queueName, batchSize, reservationTimeout)
+		if err != nil {
+			ctx.LogError(err, "Error fetching queues data")
+			continue
+		}
+		queues = append(queues, records...)
 	}
 
 	if len(queues) > 0 {
 		errors := processor.ProcessJobsConcurrently(queues, maxWorkers)
 		successCount := 0
 		failureCount := 0
+		skippedCount := 0
 		for _, err := range errors {
 			if err == nil {
 				successCount++
+			} else if stderrors.Is(err, jobutils.ErrJobAlreadyReserved) || stderrors.Is(err, jobutils.ErrWorkerPoolDraining) {
+				// Another worker or instance reserved the job first, or the app is shutting down
+				skippedCount++
 			} else {
 				failureCount++
 				ctx.LogError(err, "Job processing error")
@@ -70,8 +77,10 @@ func HandleSystemQueue(app *pocketbase.PocketBase) {
 			"total_jobs", len(queues),
 			"successful", successCount,
 			"failed", failureCount,
+			"skipped", skippedCount,
 			"workers", maxWorkers)
 	}
 
 	ctx.LogEnd("System queue process operations completed successfully")
+	return nil
 }
@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/internal/jobs"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/metrics"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// newTestApp bootstraps a PocketBase app in a temp data dir with the queues collection created
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	queues := core.NewBaseCollection(jobutils.QueuesCollection)
+	queues.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.JSONField{Name: "payload"},
+		&core.NumberField{Name: "attempts"},
+		&core.DateField{Name: "reserved_at"},
+		&core.TextField{Name: "reserved_by"},
+		&core.DateField{Name: "available_at"},
+		&core.TextField{Name: "queue"},
+		&core.NumberField{Name: "priority", OnlyInt: true},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(queues); err != nil {
+		t.Fatalf("failed to create queues collection: %v", err)
+	}
+
+	return app
+}
+
+func TestHandleSystemQueue_RecordsQueueSizesWhileDispatcherRuns(t *testing.T) {
+	t.Setenv("JOB_QUEUE_WORKERS", "emails:1,default:1")
+	t.Setenv("METRICS_ENABLED", "true")
+	t.Setenv("METRICS_PROVIDER", metrics.ProviderPrometheus)
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+
+	app := newTestApp(t)
+
+	jobs.ResetJobManager()
+	t.Cleanup(jobs.ResetJobManager)
+	if err := jobs.GetJobManager().Initialize(app); err != nil {
+		t.Fatalf("failed to initialize job manager: %v", err)
+	}
+	processor := jobs.GetJobManager().GetProcessor()
+
+	processor.StartDispatcher(jobutils.DispatcherConfig{PollInterval: time.Hour, MaxPollInterval: time.Hour})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.StopDispatcher(ctx)
+		_ = processor.Shutdown(ctx)
+	})
+
+	// Jobs available later stay queued while the dispatcher runs; "reports" has no workers and
+	// counts in the default queue
+	collection, err := app.FindCollectionByNameOrId(jobutils.QueuesCollection)
+	if err != nil {
+		t.Fatalf("failed to find queues collection: %v", err)
+	}
+	later := types.NowDateTime().Add(time.Hour)
+	for _, queueName := range []string{"", "emails", "reports"} {
+		job := core.NewRecord(collection)
+		job.Set("name", "queued "+queueName)
+		job.Set("payload", map[string]any{"type": "test_job"})
+		job.Set("queue", queueName)
+		job.Set("available_at", later)
+		if err := app.Save(job); err != nil {
+			t.Fatalf("failed to create queued job: %v", err)
+		}
+	}
+
+	if err := HandleSystemQueue(app); err != nil {
+		t.Fatalf("HandleSystemQueue returned error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.GetInstance().GetHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	sizes := map[string]string{}
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if !strings.Contains(line, metrics.MetricJobQueueSize+"{") {
+			continue
+		}
+		for _, queueName := range []string{jobutils.DefaultQueueName, "emails"} {
+			if strings.Contains(line, `queue="`+queueName+`"`) {
+				sizes[queueName] = line[strings.LastIndex(line, " ")+1:]
+			}
+		}
+	}
+
+	if sizes[jobutils.DefaultQueueName] != "2" || sizes["emails"] != "1" {
+		t.Errorf("expected queue sizes default=2 and emails=1, got %v in\n%s", sizes, recorder.Body.String())
+	}
+}
@@ -0,0 +1,638 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/internal/middlewares"
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+	"ims-pocketbase-baas-starter/pkg/permission"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+// expandColumn is the column holding the relations listed in DataProcessingJobData.Expand
+const expandColumn = "expand"
+
+// defaultExportBatchSize is the number of records queried and held in memory at a time
+const defaultExportBatchSize = 1000
+
+// exportBufferSize is the size of the write buffer of export files
+const exportBufferSize = 64 * 1024
+
+// ErrExportForbidden is returned when the requester may not export a collection or one of its fields
+var ErrExportForbidden = errors.New("export not allowed")
+
+// exportPermissions checks the export permissions of requesters
+var exportPermissions = middlewares.NewPermissionMiddleware()
+
+// exportColumn is a column of an export file and the field path its values are read from
+type exportColumn struct {
+	Header string
+	Path   string
+}
+
+// exportPlan is a validated export: the query selecting the records the requester can list and the
+// columns read from each record
+type exportPlan struct {
+	app         core.App
+	collection  *core.Collection
+	requestInfo *core.RequestInfo
+	format      string
+	columns     []exportColumn
+	values      []func(record *core.Record) any
+	expands     []string
+	batchSize   int
+
+	// resolver, where and orderBy build the query of each batch
+	resolver *core.RecordFieldResolver
+	where    []dbx.Expression
+	orderBy  []string
+}
+
+// HandleCollectionExport exports the records of any collection (payload.Data.Source) that the requester can
+// list to a CSV, JSON Lines or XLSX file owned by userId. Jobs without a user (e.g. scheduled jobs) export
+// with superuser access.
+func HandleCollectionExport(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId, userId string, payload *jobutils.DataProcessingJobPayload) (*jobutils.FileExportResult, error) {
+	return exportCollection(ctx, app, jobId, userId, payload.Data, payload.Options.ExportFileOptions, nil)
+}
+
+// ValidateCollectionExport checks that requester can export with the given options, so invalid exports are
+// rejected before they are queued
+func ValidateCollectionExport(app core.App, requester *core.Record, data jobutils.DataProcessingJobData) error {
+	_, err := newExportPlan(app, requester, data, nil)
+	return err
+}
+
+// exportCollection runs an export, using defaultColumns when the payload does not list fields. The file is
+// compressed and encrypted as set by opts.
+func exportCollection(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId, userId string, data jobutils.DataProcessingJobData, opts jobutils.ExportFileOptions, defaultColumns []exportColumn) (*jobutils.FileExportResult, error) {
+	opts, err := jobutils.OpenExportFileOptions(app, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	requester, err := findRequester(app, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := newExportPlan(app, requester, data, defaultColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := plan.count()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Exporting records", "job_id", jobId, "collection", plan.collection.Name, "record_count", total, "batch_size", plan.batchSize)
+
+	if total == 0 {
+		return nil, fmt.Errorf("no %s records found to export", plan.collection.Name)
+	}
+
+	reportExportProgress(ctx, 0, total, "Exporting records")
+
+	format := exportFormats[plan.format]
+	filename := fmt.Sprintf("%s_export_%s.%s", plan.collection.Name, time.Now().Format("20060102_150405"), format.extension)
+
+	// The file is written to a temporary directory and streamed to the storage from there
+	dir, err := os.MkdirTemp("", "export-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary export directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filename)
+	recordCount, fileSize, err := plan.writeFile(ctx, path, func(done int) {
+		reportExportProgress(ctx, done, total, "Writing export file")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := filesystem.NewFileFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file: %w", err)
+	}
+
+	saved, err := jobutils.SaveExportFileWithOptions(app, jobId, userId, file, recordCount, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save export file: %w", err)
+	}
+
+	reportExportProgress(ctx, recordCount, recordCount, "Export file saved")
+
+	log.Info("Collection export completed",
+		"job_id", jobId,
+		"collection", plan.collection.Name,
+		"filename", saved.Name,
+		"record_count", recordCount,
+		"file_size", fileSize,
+		"stored_size", saved.Size,
+		"compression", saved.Compression,
+		"encryption", saved.Encryption)
+
+	return saved.ExportResult(fmt.Sprintf("Exported %d %s records", recordCount, plan.collection.Name), recordCount, format.contentType), nil
+}
+
+// newExportPlan validates the export options against the collection schema and the requester's access. A nil
+// requester exports with superuser access.
+func newExportPlan(app core.App, requester *core.Record, data jobutils.DataProcessingJobData, defaultColumns []exportColumn) (*exportPlan, error) {
+	collection, err := app.FindCollectionByNameOrId(data.Source)
+	if err != nil {
+		return nil, fmt.Errorf("collection %q not found", data.Source)
+	}
+
+	plan := &exportPlan{
+		app:        app,
+		collection: collection,
+		format:     exportFormat(data),
+		batchSize:  common.GetEnvInt("EXPORT_BATCH_SIZE", defaultExportBatchSize),
+	}
+	if plan.batchSize <= 0 {
+		plan.batchSize = defaultExportBatchSize
+	}
+	if _, ok := exportFormats[plan.format]; !ok {
+		return nil, fmt.Errorf("unsupported export format %q, expected csv, jsonl or xlsx", plan.format)
+	}
+
+	if requester != nil {
+		plan.requestInfo = &core.RequestInfo{
+			Auth:    requester,
+			Method:  "GET",
+			Context: core.RequestInfoContextDefault,
+			Query:   map[string]string{},
+			Headers: map[string]string{},
+			Body:    map[string]any{},
+		}
+
+		if !requester.IsSuperuser() {
+			if collection.ListRule == nil {
+				return nil, fmt.Errorf("%w: only superusers can export %s", ErrExportForbidden, collection.Name)
+			}
+			if !exportPermissions.UserHasPermission(app, requester, requiredExportPermissions(collection.Name)...) {
+				return nil, fmt.Errorf("%w: missing export permission for %s", ErrExportForbidden, collection.Name)
+			}
+		}
+	}
+
+	if err := plan.resolveColumns(data.Fields, data.Expand, defaultColumns); err != nil {
+		return nil, err
+	}
+
+	if err := plan.buildQuery(data.Filter, data.Sort); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// requiredExportPermissions returns the permissions that allow exporting a collection, any of them is enough
+func requiredExportPermissions(collectionName string) []string {
+	if collectionName == jobutils.DataProcessingCollectionUsers {
+		return []string{permission.DataExport, permission.UserExport}
+	}
+	return []string{permission.DataExport}
+}
+
+// exportFormat returns the format of an export: Format, or the legacy format passed as Target, CSV by default
+func exportFormat(data jobutils.DataProcessingJobData) string {
+	if data.Format != "" {
+		return data.Format
+	}
+	if _, ok := exportFormats[data.Target]; ok {
+		return data.Target
+	}
+	return jobutils.DataProcessingFileCSV
+}
+
+// findRequester returns the auth record of the user that requested an export, nil for jobs without a user
+func findRequester(app core.App, userId string) (*core.Record, error) {
+	requester, err := jobutils.FindJobRequester(app, userId)
+	if errors.Is(err, jobutils.ErrJobRequesterNotFound) {
+		return nil, fmt.Errorf("%w: requester %s no longer exists", ErrExportForbidden, userId)
+	}
+	return requester, err
+}
+
+func (p *exportPlan) isSuperuser() bool {
+	return p.requestInfo == nil || p.requestInfo.HasSuperuserAuth()
+}
+
+// resolveColumns validates the field paths and expanded relations. Without fields, the default columns or
+// the visible fields of the collection are exported.
+func (p *exportPlan) resolveColumns(fields, expands []string, defaultColumns []exportColumn) error {
+	columns := defaultColumns
+	if len(fields) > 0 {
+		columns = make([]exportColumn, 0, len(fields))
+		for _, field := range fields {
+			if field = strings.TrimSpace(field); field != "" {
+				columns = append(columns, exportColumn{Header: field, Path: field})
+			}
+		}
+	}
+	if len(columns) == 0 {
+		for _, field := range p.collection.Fields {
+			if field.GetHidden() || !isExportableField(field) {
+				continue
+			}
+			columns = append(columns, exportColumn{Header: field.GetName(), Path: field.GetName()})
+		}
+	}
+
+	for _, column := range columns {
+		getter, err := p.fieldValue(p.collection, strings.Split(column.Path, "."), "")
+		if err != nil {
+			return fmt.Errorf("invalid field %q: %w", column.Path, err)
+		}
+		p.columns = append(p.columns, column)
+		p.values = append(p.values, getter)
+	}
+
+	if len(expands) == 0 {
+		return nil
+	}
+
+	for _, expand := range expands {
+		if err := p.checkExpand(p.collection, strings.Split(strings.TrimSpace(expand), "."), ""); err != nil {
+			return fmt.Errorf("invalid expand %q: %w", expand, err)
+		}
+	}
+
+	p.columns = append(p.columns, exportColumn{Header: expandColumn, Path: expandColumn})
+	p.values = append(p.values, func(record *core.Record) any {
+		return record.Expand()
+	})
+
+	return nil
+}
+
+// fieldValue returns the function reading a field path from a record. Paths through multiple relations
+// return a list with a value per related record.
+func (p *exportPlan) fieldValue(collection *core.Collection, parts []string, expandPrefix string) (func(record *core.Record) any, error) {
+	if len(parts) >= 3 && parts[0] == expandColumn {
+		relationName := parts[1]
+		relCollection, relField, err := p.relatedCollection(collection, relationName)
+		if err != nil {
+			return nil, err
+		}
+
+		expand := joinPath(expandPrefix, relationName)
+		p.addExpand(expand)
+
+		next, err := p.fieldValue(relCollection, parts[2:], expand)
+		if err != nil {
+			return nil, err
+		}
+
+		if !relField.IsMultiple() {
+			return func(record *core.Record) any {
+				if related := record.ExpandedOne(relationName); related != nil {
+					return next(related)
+				}
+				return nil
+			}, nil
+		}
+
+		return func(record *core.Record) any {
+			var values []any
+			for _, related := range record.ExpandedAll(relationName) {
+				if list, ok := next(related).([]any); ok {
+					values = append(values, list...)
+				} else {
+					values = append(values, next(related))
+				}
+			}
+			return values
+		}, nil
+	}
+
+	if len(parts) != 1 || parts[0] == "" {
+		return nil, errors.New("expected a field name or expand.<relation>.<field>")
+	}
+
+	name := parts[0]
+	field := collection.Fields.GetByName(name)
+	if field == nil {
+		return nil, fmt.Errorf("%s has no field %q", collection.Name, name)
+	}
+	if !isExportableField(field) {
+		return nil, fmt.Errorf("%w: field %q cannot be exported", ErrExportForbidden, name)
+	}
+	if field.GetHidden() && !p.isSuperuser() {
+		return nil, fmt.Errorf("%w: field %q is hidden", ErrExportForbidden, name)
+	}
+
+	if collection.IsAuth() && name == core.FieldNameEmail {
+		return func(record *core.Record) any {
+			if p.canSeeEmail(record) {
+				return record.Email()
+			}
+			return ""
+		}, nil
+	}
+
+	return func(record *core.Record) any {
+		return record.Get(name)
+	}, nil
+}
+
+// checkExpand validates a relation path of the expand option, e.g. "roles.permissions"
+func (p *exportPlan) checkExpand(collection *core.Collection, parts []string, expandPrefix string) error {
+	if len(parts) == 0 || parts[0] == "" {
+		return errors.New("expected a relation field name")
+	}
+
+	relCollection, _, err := p.relatedCollection(collection, parts[0])
+	if err != nil {
+		return err
+	}
+
+	expand := joinPath(expandPrefix, parts[0])
+	p.addExpand(expand)
+
+	if len(parts) > 1 {
+		return p.checkExpand(relCollection, parts[1:], expand)
+	}
+	return nil
+}
+
+// relatedCollection returns the collection of a relation field that the requester may expand
+func (p *exportPlan) relatedCollection(collection *core.Collection, relationName string) (*core.Collection, *core.RelationField, error) {
+	relField, ok := collection.Fields.GetByName(relationName).(*core.RelationField)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has no relation field %q", collection.Name, relationName)
+	}
+	if relField.GetHidden() && !p.isSuperuser() {
+		return nil, nil, fmt.Errorf("%w: field %q is hidden", ErrExportForbidden, relationName)
+	}
+
+	relCollection, err := p.app.FindCachedCollectionByNameOrId(relField.CollectionId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("collection of relation %q not found", relationName)
+	}
+	if relCollection.ViewRule == nil && !p.isSuperuser() {
+		return nil, nil, fmt.Errorf("%w: only superusers can expand %s", ErrExportForbidden, relCollection.Name)
+	}
+
+	return relCollection, relField, nil
+}
+
+func (p *exportPlan) addExpand(expand string) {
+	if !slices.Contains(p.expands, expand) {
+		p.expands = append(p.expands, expand)
+	}
+}
+
+// buildQuery resolves the conditions selecting the records matching the filter that the requester can list,
+// like the records list API, and the sort order
+func (p *exportPlan) buildQuery(filter, sort string) error {
+	p.resolver = core.NewRecordFieldResolver(p.app, p.collection, p.requestInfo, true)
+
+	if !p.isSuperuser() && *p.collection.ListRule != "" {
+		expr, err := search.FilterData(*p.collection.ListRule).BuildExpr(p.resolver)
+		if err != nil {
+			return fmt.Errorf("failed to apply the list rule of %s: %w", p.collection.Name, err)
+		}
+		p.where = append(p.where, expr)
+	}
+
+	// Hidden fields can only be filtered and sorted by superusers
+	p.resolver.SetAllowHiddenFields(p.isSuperuser())
+
+	if strings.TrimSpace(filter) != "" {
+		expr, err := search.FilterData(filter).BuildExpr(p.resolver)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+		p.where = append(p.where, expr)
+	}
+
+	// Batches are read with offsets, the id breaks ties so every record is in exactly one batch
+	sortFields := search.ParseSortFromString(sort)
+	switch {
+	case strings.TrimSpace(sort) == "" && !p.collection.IsView():
+		sortFields = []search.SortField{{Name: "@rowid", Direction: search.SortAsc}}
+	case strings.TrimSpace(sort) == "":
+		sortFields = []search.SortField{{Name: core.FieldNameId, Direction: search.SortAsc}}
+	default:
+		sortFields = append(sortFields, search.SortField{Name: core.FieldNameId, Direction: search.SortAsc})
+	}
+
+	for _, sortField := range sortFields {
+		expr, err := sortField.BuildExpr(p.resolver)
+		if err != nil {
+			return fmt.Errorf("invalid sort: %w", err)
+		}
+		p.orderBy = append(p.orderBy, expr)
+	}
+
+	// Make sure the joins of the conditions resolve
+	if _, err := p.newQuery(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// newQuery returns a query of the exported records, each batch needs its own
+func (p *exportPlan) newQuery() (*dbx.SelectQuery, error) {
+	query := p.app.RecordQuery(p.collection)
+	for _, expr := range p.where {
+		query.AndWhere(expr)
+	}
+	query.OrderBy(p.orderBy...)
+
+	if err := p.resolver.UpdateQuery(query); err != nil {
+		return nil, fmt.Errorf("failed to build export query: %w", err)
+	}
+
+	return query, nil
+}
+
+// count returns the number of records to export
+func (p *exportPlan) count() (int, error) {
+	query, err := p.newQuery()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = query.
+		Select("COUNT(DISTINCT [[" + p.collection.Name + ".id]])").
+		OrderBy().
+		Row(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s records: %w", p.collection.Name, err)
+	}
+
+	return total, nil
+}
+
+// expand loads the expanded relations of records, keeping only the related records the requester can view
+func (p *exportPlan) expand(records []*core.Record) error {
+	if len(p.expands) == 0 {
+		return nil
+	}
+
+	failed := p.app.ExpandRecords(records, p.expands, p.fetchRelated)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to expand relations: %v", failed)
+	}
+
+	return nil
+}
+
+func (p *exportPlan) fetchRelated(relCollection *core.Collection, relIds []string) ([]*core.Record, error) {
+	records, err := p.app.FindRecordsByIds(relCollection.Id, relIds)
+	if err != nil || p.isSuperuser() {
+		return records, err
+	}
+
+	visible := make([]*core.Record, 0, len(records))
+	for _, record := range records {
+		canView, err := p.app.CanAccessRecord(record, p.requestInfo, relCollection.ViewRule)
+		if err != nil {
+			return nil, err
+		}
+		if canView {
+			visible = append(visible, record)
+		}
+	}
+	return visible, nil
+}
+
+// writeFile writes the export file at path and returns the number of exported records and the file size
+func (p *exportPlan) writeFile(ctx context.Context, path string, onProgress func(done int)) (int, int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewWriterSize(file, exportBufferSize)
+	written, err := p.writeBatches(ctx, buffered, onProgress)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat export file: %w", err)
+	}
+
+	return written, info.Size(), nil
+}
+
+// writeBatches queries the records batchSize at a time and encodes them as they are fetched, so memory use
+// depends on the batch size and not on the number of records. It calls onProgress every
+// exportProgressInterval records and stops once ctx is done. Records created or deleted during the export may
+// shift the offsets of the next batches.
+func (p *exportPlan) writeBatches(ctx context.Context, w io.Writer, onProgress func(done int)) (int, error) {
+	writer, err := newRowWriter(p.format, w, p.columns)
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]any, len(p.columns))
+	written := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, fmt.Errorf("export cancelled: %w", err)
+		}
+
+		query, err := p.newQuery()
+		if err != nil {
+			return written, err
+		}
+
+		var records []*core.Record
+		err = query.
+			WithContext(ctx).
+			Limit(int64(p.batchSize)).
+			Offset(int64(written)).
+			All(&records)
+		if err != nil {
+			return written, fmt.Errorf("failed to query %s: %w", p.collection.Name, err)
+		}
+
+		if err := p.expand(records); err != nil {
+			return written, err
+		}
+
+		for _, record := range records {
+			if p.isSuperuser() {
+				record.IgnoreEmailVisibility(true)
+			}
+			for i, value := range p.values {
+				values[i] = value(record)
+			}
+
+			if err := writer.WriteRow(values); err != nil {
+				return written, fmt.Errorf("failed to write %s record %s: %w", p.collection.Name, record.Id, err)
+			}
+
+			written++
+			if written%exportProgressInterval == 0 && onProgress != nil {
+				onProgress(written)
+			}
+		}
+
+		if len(records) < p.batchSize {
+			break
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return written, fmt.Errorf("failed to finish export file: %w", err)
+	}
+	return written, nil
+}
+
+// canSeeEmail applies the email visibility of auth records: superusers see every email, other requesters
+// only public emails and their own
+func (p *exportPlan) canSeeEmail(record *core.Record) bool {
+	if p.isSuperuser() || record.EmailVisibility() {
+		return true
+	}
+
+	auth := p.requestInfo.Auth
+	return auth.Id == record.Id && auth.Collection().Id == record.Collection().Id
+}
+
+// isExportableField reports whether a field can be exported, passwords and token keys never are
+func isExportableField(field core.Field) bool {
+	if _, ok := field.(*core.PasswordField); ok {
+		return false
+	}
+	return field.GetName() != core.FieldNameTokenKey
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// BenchmarkCollectionExport exports notes collections of growing sizes and reports the peak heap in use during
+// the export. The peak follows the batch size and stays about the same whatever the number of rows.
+func BenchmarkCollectionExport(b *testing.B) {
+	for _, rows := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			app, data := newTestApp(b)
+			seedNotes(b, app, data.member.Id, rows)
+
+			ctx := cronutils.NewCronExecutionContext(app, "export-job")
+			payload := exportPayload(jobutils.DataProcessingJobData{
+				Source: "notes",
+				Fields: []string{"id", "title", "rank", "secret", "owner", "created"},
+			})
+
+			var peak uint64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				heap, err := measurePeakHeap(func() error {
+					_, err := HandleCollectionExport(ctx, app, "export-job", "", payload)
+					return err
+				})
+				if err != nil {
+					b.Fatalf("HandleCollectionExport returned error: %v", err)
+				}
+				peak = max(peak, heap)
+			}
+
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+		})
+	}
+}
+
+// seedNotes inserts count notes directly, without the record validation and hooks
+func seedNotes(b *testing.B, app *pocketbase.PocketBase, ownerId string, count int) {
+	b.Helper()
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		for i := 0; i < count; i++ {
+			_, err := txApp.DB().Insert("notes", dbx.Params{
+				"id":      fmt.Sprintf("n%014d", i),
+				"title":   fmt.Sprintf("Note number %d with a title long enough to look like real data", i),
+				"rank":    i % 100,
+				"secret":  "s3cret",
+				"owner":   ownerId,
+				"created": time.Now().UTC().Format("2006-01-02 15:04:05.000Z"),
+			}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("failed to seed notes: %v", err)
+	}
+}
+
+// measurePeakHeap runs fn and returns the highest heap in use sampled while it ran, above the heap in use
+// before it started
+func measurePeakHeap(fn func() error) (uint64, error) {
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapInuse
+
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > baseline && stats.HeapInuse-baseline > peak.Load() {
+				peak.Store(stats.HeapInuse - baseline)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	err := fn()
+	close(done)
+	<-sampled
+
+	return peak.Load(), err
+}
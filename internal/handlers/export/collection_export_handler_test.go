@@ -0,0 +1,459 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/filecrypt"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/permission"
+	"ims-pocketbase-baas-starter/pkg/xlsx"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// exportTestData holds the records created by newTestApp
+type exportTestData struct {
+	admin    *core.Record // has user.export and user.view.all
+	exporter *core.Record // has data.export only
+	member   *core.Record // has no permission
+}
+
+// newTestApp bootstraps a PocketBase app with export_files, the RBAC collections, users and a notes collection
+// whose list rule only shows the requester's own notes
+func newTestApp(t testing.TB) (*pocketbase.PocketBase, exportTestData) {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	exportFiles := core.NewBaseCollection(jobutils.ExportFilesCollectionName)
+	exportFiles.Fields.Add(
+		&core.TextField{Name: "job_id", Required: true},
+		&core.FileField{Name: "file", MaxSelect: 1},
+		&core.NumberField{Name: "record_count"},
+		&core.TextField{Name: "user_id"},
+		&core.DateField{Name: "expires_at"},
+		&core.TextField{Name: "storage"},
+		&core.TextField{Name: "storage_key"},
+		&core.TextField{Name: "checksum"},
+		&core.TextField{Name: "compression"},
+		&core.TextField{Name: "encryption"},
+	)
+	mustSave(t, app, exportFiles)
+
+	authRule := types.Pointer("@request.auth.id != ''")
+
+	permissions := core.NewBaseCollection("permissions")
+	permissions.ListRule = authRule
+	permissions.ViewRule = authRule
+	permissions.Fields.Add(&core.TextField{Name: "slug", Required: true})
+	mustSave(t, app, permissions)
+
+	roles := core.NewBaseCollection("roles")
+	roles.ListRule = authRule
+	roles.ViewRule = authRule
+	roles.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.RelationField{Name: "permissions", CollectionId: permissions.Id, MaxSelect: 99},
+	)
+	mustSave(t, app, roles)
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("failed to find users collection: %v", err)
+	}
+	users.ListRule = types.Pointer("@request.auth.permissions.slug ?= 'user.view.all'")
+	users.ViewRule = authRule
+	users.Fields.Add(
+		&core.BoolField{Name: "is_active"},
+		&core.RelationField{Name: "roles", CollectionId: roles.Id, MaxSelect: 99},
+		&core.RelationField{Name: "permissions", CollectionId: permissions.Id, MaxSelect: 99},
+	)
+	mustSave(t, app, users)
+
+	notes := core.NewBaseCollection("notes")
+	notes.ListRule = types.Pointer("owner = @request.auth.id")
+	notes.Fields.Add(
+		&core.TextField{Name: "title", Required: true},
+		&core.NumberField{Name: "rank"},
+		&core.TextField{Name: "secret", Hidden: true},
+		&core.RelationField{Name: "owner", CollectionId: users.Id, MaxSelect: 1},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	mustSave(t, app, notes)
+
+	slugs := map[string]string{}
+	for _, slug := range []string{permission.UserExport, permission.UserViewAll, permission.DataExport} {
+		record := core.NewRecord(permissions)
+		record.Set("slug", slug)
+		mustSave(t, app, record)
+		slugs[slug] = record.Id
+	}
+
+	adminRole := core.NewRecord(roles)
+	adminRole.Set("name", "admin")
+	adminRole.Set("permissions", []string{slugs[permission.UserExport], slugs[permission.UserViewAll]})
+	mustSave(t, app, adminRole)
+
+	newUser := func(email, name string, visible bool, roleIds, permissionIds []string) *core.Record {
+		record := core.NewRecord(users)
+		record.SetEmail(email)
+		record.SetEmailVisibility(visible)
+		record.SetPassword("1234567890")
+		record.Set("name", name)
+		record.Set("is_active", true)
+		record.Set("roles", roleIds)
+		record.Set("permissions", permissionIds)
+		mustSave(t, app, record)
+		return record
+	}
+
+	data := exportTestData{
+		admin:    newUser("admin@example.com", "Admin", false, []string{adminRole.Id}, []string{slugs[permission.UserViewAll]}),
+		exporter: newUser("exporter@example.com", "Exporter", true, nil, []string{slugs[permission.DataExport]}),
+		member:   newUser("member@example.com", "Member", false, nil, nil),
+	}
+
+	for i, owner := range []*core.Record{data.exporter, data.exporter, data.member} {
+		note := core.NewRecord(notes)
+		note.Set("title", []string{"First", "Second", "Other"}[i])
+		note.Set("rank", i+1)
+		note.Set("secret", "s3cret")
+		note.Set("owner", owner.Id)
+		mustSave(t, app, note)
+	}
+
+	return app, data
+}
+
+func mustSave(t testing.TB, app *pocketbase.PocketBase, model core.Model) {
+	t.Helper()
+	if err := app.Save(model); err != nil {
+		t.Fatalf("failed to save %v: %v", model, err)
+	}
+}
+
+// readExportFile returns the content of the export file of a result
+func readExportFile(t *testing.T, app *pocketbase.PocketBase, result *jobutils.FileExportResult) []byte {
+	t.Helper()
+
+	record, err := app.FindRecordById(jobutils.ExportFilesCollectionName, result.ExportRecordId)
+	if err != nil {
+		t.Fatalf("export file not found: %v", err)
+	}
+
+	reader, err := jobutils.OpenExportFile(app, record)
+	if err != nil {
+		t.Fatalf("failed to open export file: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read export file: %v", err)
+	}
+	return data
+}
+
+func exportPayload(data jobutils.DataProcessingJobData) *jobutils.DataProcessingJobPayload {
+	data.Operation = jobutils.DataProcessingOperationExport
+	return &jobutils.DataProcessingJobPayload{Type: jobutils.JobTypeDataProcessing, Data: data}
+}
+
+func TestHandleUserExport_DefaultColumns(t *testing.T) {
+	app, data := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{Source: jobutils.DataProcessingCollectionUsers, Target: jobutils.DataProcessingFileCSV})
+	result, err := HandleUserExport(ctx, app, "export-job", data.admin.Id, payload)
+	if err != nil {
+		t.Fatalf("HandleUserExport returned error: %v", err)
+	}
+	if result.RecordCount != 3 || result.ContentType != "text/csv" {
+		t.Errorf("expected 3 users exported to CSV, got %+v", result)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(readExportFile(t, app, result))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV export: %v", err)
+	}
+
+	expectedHeader := "ID,Email,Name,Email Visibility,Verified,Is Active,Roles,Permissions,Created,Updated"
+	if strings.Join(rows[0], ",") != expectedHeader {
+		t.Errorf("expected header %s, got %s", expectedHeader, strings.Join(rows[0], ","))
+	}
+
+	byId := map[string][]string{}
+	for _, row := range rows[1:] {
+		byId[row[0]] = row
+	}
+
+	admin := byId[data.admin.Id]
+	if admin == nil || admin[1] != "admin@example.com" || admin[6] != "admin" || admin[7] != permission.UserViewAll {
+		t.Errorf("expected the requester's own email, role and permission names, got %q", admin)
+	}
+	// Hidden emails of other users stay hidden, like in the records list API
+	if member := byId[data.member.Id]; member == nil || member[1] != "" {
+		t.Errorf("expected the hidden email of another user to be empty, got %q", member)
+	}
+	if exporter := byId[data.exporter.Id]; exporter == nil || exporter[1] != "exporter@example.com" {
+		t.Errorf("expected the public email to be exported, got %q", exporter)
+	}
+}
+
+func TestHandleUserExport_CompressedAndEncrypted(t *testing.T) {
+	app, data := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{Source: jobutils.DataProcessingCollectionUsers, Target: jobutils.DataProcessingFileCSV})
+	fileOptions, err := jobutils.SealExportFileOptions(app, jobutils.ExportFileOptions{Compression: jobutils.ExportCompressionGzip, Encryption: jobutils.ExportEncryptionAESGCM})
+	if err != nil {
+		t.Fatalf("SealExportFileOptions returned error: %v", err)
+	}
+	key := fileOptions.Key
+	// The job only reads the sealed key, as from a stored payload
+	fileOptions.Key = ""
+	payload.Options.ExportFileOptions = fileOptions
+
+	result, err := HandleUserExport(ctx, app, "export-job", data.admin.Id, payload)
+	if err != nil {
+		t.Fatalf("HandleUserExport returned error: %v", err)
+	}
+	if !strings.HasSuffix(result.FileName, ".csv.gz.enc") || result.Checksum == "" {
+		t.Fatalf("expected an encrypted gzip file with its checksum, got %+v", result)
+	}
+	if encoded, _ := json.Marshal(result); strings.Contains(string(encoded), key) {
+		t.Fatalf("expected the key to stay out of the job result, got %s", encoded)
+	}
+
+	stored := readExportFile(t, app, result)
+	if bytes.Contains(stored, []byte("admin@example.com")) {
+		t.Fatal("expected the stored file to be encrypted")
+	}
+
+	decrypted, err := filecrypt.NewReader(bytes.NewReader(stored), key)
+	if err != nil {
+		t.Fatalf("failed to decrypt export: %v", err)
+	}
+	gz, err := gzip.NewReader(decrypted)
+	if err != nil {
+		t.Fatalf("failed to decompress export: %v", err)
+	}
+	rows, err := csv.NewReader(gz).ReadAll()
+	if err != nil || len(rows) != 4 {
+		t.Fatalf("expected a header and 3 users, got %v (%v)", rows, err)
+	}
+
+	// Invalid options fail before anything is exported
+	payload.Options.SealedKey = ""
+	payload.Options.Passphrase = "short"
+	if _, err := HandleUserExport(ctx, app, "export-job-2", data.admin.Id, payload); err == nil {
+		t.Error("expected a short passphrase to be rejected")
+	}
+}
+
+func TestHandleCollectionExport_ListRuleAndJSONL(t *testing.T) {
+	app, data := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{
+		Source: "notes",
+		Format: jobutils.DataProcessingFileJSONL,
+		Fields: []string{"title", "rank", "expand.owner.name"},
+		Filter: "rank >= 1",
+		Sort:   "-rank",
+	})
+
+	result, err := HandleCollectionExport(ctx, app, "export-job", data.exporter.Id, payload)
+	if err != nil {
+		t.Fatalf("HandleCollectionExport returned error: %v", err)
+	}
+	if result.ContentType != "application/x-ndjson" || !strings.HasSuffix(result.FileName, ".jsonl") {
+		t.Errorf("expected a JSON Lines file, got %s (%s)", result.FileName, result.ContentType)
+	}
+
+	// The list rule only shows the exporter's own notes
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(readExportFile(t, app, result)))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 || result.RecordCount != 2 {
+		t.Fatalf("expected the 2 notes of the exporter, got %v", lines)
+	}
+	if lines[0]["title"] != "Second" || lines[0]["rank"] != float64(2) || lines[1]["title"] != "First" {
+		t.Errorf("expected notes sorted by rank descending, got %v", lines)
+	}
+	if lines[0]["expand.owner.name"] != "Exporter" {
+		t.Errorf("expected the expanded owner name, got %v", lines[0])
+	}
+}
+
+func TestHandleCollectionExport_XLSXWithoutRequester(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{
+		Source: "notes",
+		Format: jobutils.DataProcessingFileXLSX,
+		Fields: []string{"title", "secret"},
+		Sort:   "rank",
+	})
+
+	// Jobs without a user export with superuser access, including hidden fields
+	result, err := HandleCollectionExport(ctx, app, "export-job", "", payload)
+	if err != nil {
+		t.Fatalf("HandleCollectionExport returned error: %v", err)
+	}
+
+	rows, err := xlsx.ReadRows(readExportFile(t, app, result))
+	if err != nil {
+		t.Fatalf("invalid XLSX export: %v", err)
+	}
+	expected := [][]string{{"title", "secret"}, {"First", "s3cret"}, {"Second", "s3cret"}, {"Other", "s3cret"}}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, rows)
+	}
+	for i := range expected {
+		if strings.Join(rows[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("row %d: expected %v, got %v", i, expected[i], rows[i])
+		}
+	}
+}
+
+func TestHandleCollectionExport_Batches(t *testing.T) {
+	t.Setenv("EXPORT_BATCH_SIZE", "2")
+
+	app, data := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	// Notes with the same rank, the id keeps their order stable across batches
+	notes := mustFindCollection(t, app, "notes")
+	for i := 0; i < 4; i++ {
+		note := core.NewRecord(notes)
+		note.Set("title", "Tied")
+		note.Set("rank", 1)
+		note.Set("owner", data.member.Id)
+		mustSave(t, app, note)
+	}
+
+	payload := exportPayload(jobutils.DataProcessingJobData{
+		Source: "notes",
+		Fields: []string{"id", "rank"},
+		Sort:   "rank",
+	})
+
+	result, err := HandleCollectionExport(ctx, app, "export-job", "", payload)
+	if err != nil {
+		t.Fatalf("HandleCollectionExport returned error: %v", err)
+	}
+
+	content := readExportFile(t, app, result)
+	if result.FileSize != int64(len(content)) {
+		t.Errorf("expected file size %d, got %d", len(content), result.FileSize)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV export: %v", err)
+	}
+	if len(rows) != 8 || result.RecordCount != 7 {
+		t.Fatalf("expected the header and 7 notes, got %d rows and a count of %d", len(rows), result.RecordCount)
+	}
+
+	seen := map[string]bool{}
+	for _, row := range rows[1:] {
+		if seen[row[0]] {
+			t.Errorf("note %s exported twice", row[0])
+		}
+		seen[row[0]] = true
+	}
+	if rows[len(rows)-1][1] != "3" {
+		t.Errorf("expected notes sorted by rank, got %v", rows)
+	}
+}
+
+func TestValidateCollectionExport(t *testing.T) {
+	app, data := newTestApp(t)
+
+	superuser := core.NewRecord(mustFindCollection(t, app, core.CollectionNameSuperusers))
+	superuser.SetEmail("root@example.com")
+	superuser.SetPassword("1234567890")
+	mustSave(t, app, superuser)
+
+	tests := []struct {
+		name      string
+		requester *core.Record
+		data      jobutils.DataProcessingJobData
+		forbidden bool
+		errText   string
+	}{
+		{name: "allowed", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes"}},
+		{name: "superuser hidden field", requester: superuser, data: jobutils.DataProcessingJobData{Source: "notes", Fields: []string{"secret"}}},
+		{name: "missing permission", requester: data.member, data: jobutils.DataProcessingJobData{Source: "notes"}, forbidden: true},
+		{name: "hidden field", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Fields: []string{"secret"}}, forbidden: true},
+		{name: "password", requester: superuser, data: jobutils.DataProcessingJobData{Source: "users", Fields: []string{"password"}}, forbidden: true},
+		{name: "superusers only collection", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: jobutils.ExportFilesCollectionName}, forbidden: true},
+		{name: "unknown collection", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "missing"}, errText: "not found"},
+		{name: "unknown field", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Fields: []string{"body"}}, errText: `notes has no field "body"`},
+		{name: "not a relation", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Fields: []string{"expand.title.name"}}, errText: "no relation field"},
+		{name: "invalid expand", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Expand: []string{"owner.missing"}}, errText: `invalid expand "owner.missing"`},
+		{name: "invalid filter", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Filter: "rank >"}, errText: "invalid filter"},
+		{name: "hidden filter field", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Filter: "secret = 'x'"}, errText: "invalid filter"},
+		{name: "invalid sort", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Sort: "body"}, errText: "invalid sort"},
+		{name: "invalid format", requester: data.exporter, data: jobutils.DataProcessingJobData{Source: "notes", Format: "pdf"}, errText: "unsupported export format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCollectionExport(app, tt.requester, tt.data)
+
+			switch {
+			case tt.forbidden:
+				if !errors.Is(err, ErrExportForbidden) {
+					t.Errorf("expected ErrExportForbidden, got %v", err)
+				}
+			case tt.errText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("expected error containing %q, got %v", tt.errText, err)
+				}
+			case err != nil:
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func mustFindCollection(t *testing.T, app *pocketbase.PocketBase, name string) *core.Collection {
+	t.Helper()
+	collection, err := app.FindCollectionByNameOrId(name)
+	if err != nil {
+		t.Fatalf("failed to find collection %s: %v", name, err)
+	}
+	return collection
+}
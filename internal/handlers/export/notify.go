@@ -0,0 +1,131 @@
+package export
+
+import (
+	"fmt"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ExportReadyTemplate is the email template of export notifications
+const ExportReadyTemplate = "export_ready"
+
+// DefaultNotifyLinkTTL is how long the download link of an export notification is valid by default
+const DefaultNotifyLinkTTL = 24 * time.Hour
+
+// GetNotifyLinkTTL returns how long the download link of an export notification is valid, configured via
+// EXPORT_NOTIFY_LINK_TTL_SECONDS
+func GetNotifyLinkTTL() time.Duration {
+	seconds := common.GetEnvInt("EXPORT_NOTIFY_LINK_TTL_SECONDS", int(DefaultNotifyLinkTTL/time.Second))
+	if seconds <= 0 {
+		return DefaultNotifyLinkTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// EnqueueExportNotification queues an export_ready email to the user that created an export job. A result
+// sends a signed download link to the file, a nil result reports jobErr as the failure of the export.
+func EnqueueExportNotification(app core.App, jobId, userId string, result *jobutils.FileExportResult, jobErr error) (*core.Record, error) {
+	if userId == "" {
+		return nil, fmt.Errorf("export job %s has no user to notify", jobId)
+	}
+
+	user, err := app.FindRecordById(jobutils.DataProcessingCollectionUsers, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user %s to notify: %w", userId, err)
+	}
+
+	email := user.GetString("email")
+	name := user.GetString("name")
+	if name == "" {
+		name = email
+	}
+
+	appName := common.GetEnv("APP_NAME", "N/A")
+	if app.Settings().Meta.AppName != "" {
+		appName = app.Settings().Meta.AppName
+	}
+	appUrl := common.GetEnv("APP_URL", "N/A")
+	if app.Settings().Meta.AppURL != "" {
+		appUrl = app.Settings().Meta.AppURL
+	}
+
+	variables := map[string]any{
+		"AppName": appName,
+		"AppURL":  appUrl,
+		"Year":    time.Now().Year(),
+		"Name":    name,
+		"JobID":   jobId,
+		"Failed":  result == nil,
+	}
+	subject := fmt.Sprintf("Your %s export failed", appName)
+
+	if result != nil {
+		downloadURL, expiresAt, err := notifyDownloadURL(app, result)
+		if err != nil {
+			return nil, err
+		}
+
+		variables["FileName"] = result.FileName
+		variables["RecordCount"] = result.RecordCount
+		variables["DownloadURL"] = downloadURL
+		variables["ExpiresAt"] = expiresAt.UTC().Format("2006-01-02 15:04 MST")
+		variables["Encrypted"] = result.Encryption != ""
+		subject = fmt.Sprintf("Your %s export is ready", appName)
+	} else if jobErr != nil {
+		variables["Error"] = jobErr.Error()
+	}
+
+	payload := jobutils.EmailJobPayload{
+		Type: jobutils.JobTypeEmail,
+		Data: jobutils.EmailJobData{
+			To:        email,
+			Subject:   subject,
+			Template:  ExportReadyTemplate,
+			Variables: variables,
+		},
+		Options: jobutils.EmailJobOptions{
+			RetryCount: 3,
+			Timeout:    30,
+		},
+	}
+
+	// The job id as unique key sends one notification per export, even if it is reported twice
+	record, _, err := jobutils.Enqueue(app, payload, jobutils.EnqueueOptions{
+		Name:        fmt.Sprintf("Export notification for %s", email),
+		Description: fmt.Sprintf("Notify %s that export job %s finished", email, jobId),
+		Queue:       jobutils.QueueEmails,
+		Priority:    jobutils.JobPriorityHigh,
+		UserID:      userId,
+		UniqueKey:   "export_notification:" + jobId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue export notification for job %s: %w", jobId, err)
+	}
+
+	log.Info("Export notification queued", "job_id", jobId, "user_id", userId, "email_job_id", record.Id, "failed", result == nil)
+	return record, nil
+}
+
+// notifyDownloadURL returns a signed download link to the file of an export result, valid for the notification
+// link TTL but never after the file expires nor longer than S3 presigned URLs allow
+func notifyDownloadURL(app core.App, result *jobutils.FileExportResult) (string, time.Time, error) {
+	record, err := app.FindRecordById(jobutils.ExportFilesCollectionName, result.ExportRecordId)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to find export file %s: %w", result.ExportRecordId, err)
+	}
+
+	ttl := min(GetNotifyLinkTTL(), jobutils.MaxPresignTTL)
+	if expiresAt := record.GetDateTime("expires_at"); !expiresAt.IsZero() {
+		ttl = min(ttl, time.Until(expiresAt.Time()).Truncate(time.Second))
+	}
+	if ttl <= 0 {
+		return "", time.Time{}, fmt.Errorf("export file %s has expired", record.Id)
+	}
+
+	return jobutils.ExportFileDownloadURL(app, record, ttl)
+}
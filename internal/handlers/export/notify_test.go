@@ -0,0 +1,153 @@
+package export
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// createQueuesCollection adds the queues fields used to enqueue jobs
+func createQueuesCollection(t *testing.T, app *pocketbase.PocketBase) {
+	t.Helper()
+
+	queues := core.NewBaseCollection(jobutils.QueuesCollection)
+	queues.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.TextField{Name: "description"},
+		&core.JSONField{Name: "payload"},
+		&core.NumberField{Name: "attempts"},
+		&core.DateField{Name: "available_at"},
+		&core.TextField{Name: "queue"},
+		&core.NumberField{Name: "priority", OnlyInt: true},
+		&core.TextField{Name: "unique_key"},
+		&core.TextField{Name: "batch_id"},
+		&core.JSONField{Name: "chain"},
+		&core.TextField{Name: "user_id"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	mustSave(t, app, queues)
+}
+
+// notificationEmail returns the email payload of a queued notification
+func notificationEmail(t *testing.T, record *core.Record) jobutils.EmailJobData {
+	t.Helper()
+
+	jobData, err := jobutils.ParseJobDataFromRecord(record)
+	if err != nil {
+		t.Fatalf("invalid notification job: %v", err)
+	}
+	payload, err := jobutils.ParseEmailJobPayload(jobData)
+	if err != nil {
+		t.Fatalf("invalid email payload: %v", err)
+	}
+	if record.GetString("queue") != jobutils.QueueEmails || payload.Data.Template != ExportReadyTemplate {
+		t.Errorf("expected an %s email on the emails queue, got %+v", ExportReadyTemplate, payload.Data)
+	}
+	return payload.Data
+}
+
+func TestEnqueueExportNotification_Completed(t *testing.T) {
+	t.Setenv("EXPORT_STORAGE", jobutils.ExportStorageLocal)
+	t.Setenv("EXPORT_STORAGE_DIR", t.TempDir())
+	t.Setenv("EXPORT_NOTIFY_LINK_TTL_SECONDS", "3600")
+
+	app, data := newTestApp(t)
+	createQueuesCollection(t, app)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{Source: jobutils.DataProcessingCollectionUsers, Target: jobutils.DataProcessingFileCSV})
+	result, err := HandleUserExport(ctx, app, "export-job", data.admin.Id, payload)
+	if err != nil {
+		t.Fatalf("HandleUserExport returned error: %v", err)
+	}
+
+	record, err := EnqueueExportNotification(app, "export-job", data.admin.Id, result, nil)
+	if err != nil {
+		t.Fatalf("EnqueueExportNotification returned error: %v", err)
+	}
+
+	email := notificationEmail(t, record)
+	if email.To != "admin@example.com" || email.Variables["Failed"] != false {
+		t.Errorf("expected a completion email to the requester, got %+v", email)
+	}
+	if email.Variables["RecordCount"] != float64(3) || email.Variables["FileName"] != result.FileName {
+		t.Errorf("expected the record count and file name, got %v", email.Variables)
+	}
+
+	// Local files are linked through a download token of the job
+	link, err := url.Parse(email.Variables["DownloadURL"].(string))
+	if err != nil || !strings.HasSuffix(link.Path, "/api/v1/jobs/download") {
+		t.Fatalf("expected a download route link, got %v", email.Variables["DownloadURL"])
+	}
+	if jobId, err := jobutils.ParseJobDownloadToken(app, link.Query().Get("token")); err != nil || jobId != "export-job" {
+		t.Errorf("expected a token of the export job, got %q (%v)", jobId, err)
+	}
+
+	expiresAt, err := time.Parse("2006-01-02 15:04 MST", email.Variables["ExpiresAt"].(string))
+	if err != nil || expiresAt.Before(time.Now().Add(58*time.Minute)) || expiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the link to expire in an hour, got %v (%v)", email.Variables["ExpiresAt"], err)
+	}
+
+	// A job is only notified once
+	again, err := EnqueueExportNotification(app, "export-job", data.admin.Id, result, nil)
+	if err != nil || again.Id != record.Id {
+		t.Errorf("expected the queued notification to be reused, got %v (%v)", again, err)
+	}
+}
+
+func TestEnqueueExportNotification_LinkTTLCappedByFileExpiry(t *testing.T) {
+	t.Setenv("EXPORT_STORAGE", jobutils.ExportStorageLocal)
+	t.Setenv("EXPORT_STORAGE_DIR", t.TempDir())
+	t.Setenv("EXPORT_FILE_EXPIRATION_DAYS", "1")
+	t.Setenv("EXPORT_NOTIFY_LINK_TTL_SECONDS", "604800")
+
+	app, data := newTestApp(t)
+	createQueuesCollection(t, app)
+	ctx := cronutils.NewCronExecutionContext(app, "export-job")
+
+	payload := exportPayload(jobutils.DataProcessingJobData{Source: "notes"})
+	result, err := HandleCollectionExport(ctx, app, "export-job", data.exporter.Id, payload)
+	if err != nil {
+		t.Fatalf("HandleCollectionExport returned error: %v", err)
+	}
+
+	record, err := EnqueueExportNotification(app, "export-job", data.exporter.Id, result, nil)
+	if err != nil {
+		t.Fatalf("EnqueueExportNotification returned error: %v", err)
+	}
+
+	expiresAt, err := time.Parse("2006-01-02 15:04 MST", notificationEmail(t, record).Variables["ExpiresAt"].(string))
+	if err != nil || expiresAt.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("expected the link to expire with the file, got %v (%v)", expiresAt, err)
+	}
+}
+
+func TestEnqueueExportNotification_Failed(t *testing.T) {
+	app, data := newTestApp(t)
+	createQueuesCollection(t, app)
+
+	record, err := EnqueueExportNotification(app, "export-job", data.member.Id, nil, errors.New("collection not found"))
+	if err != nil {
+		t.Fatalf("EnqueueExportNotification returned error: %v", err)
+	}
+
+	email := notificationEmail(t, record)
+	if email.To != "member@example.com" || email.Variables["Failed"] != true || email.Variables["Error"] != "collection not found" {
+		t.Errorf("expected a failure email with the error, got %+v", email)
+	}
+	if _, ok := email.Variables["DownloadURL"]; ok {
+		t.Error("expected no download link for a failed export")
+	}
+
+	if _, err := EnqueueExportNotification(app, "system-job", "", nil, errors.New("boom")); err == nil {
+		t.Error("expected jobs without a user to have no one to notify")
+	}
+}
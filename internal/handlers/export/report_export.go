@@ -0,0 +1,60 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// SupportsFormat reports whether format is a file format that exports can be written in
+func SupportsFormat(format string) bool {
+	_, ok := exportFormats[format]
+	return ok
+}
+
+// SaveReportFile writes rows computed by a job, such as aggregate results, to an export file named after name
+// and stores it in export_files, owned by userId, compressed and encrypted as set by opts. Values are
+// formatted like exported field values.
+func SaveReportFile(app *pocketbase.PocketBase, jobId, userId, name, format string, headers []string, rows [][]any, opts jobutils.ExportFileOptions) (*jobutils.FileExportResult, error) {
+	info, ok := exportFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export format %q, expected csv, jsonl or xlsx", format)
+	}
+
+	columns := make([]exportColumn, len(headers))
+	for i, header := range headers {
+		columns[i] = exportColumn{Header: header, Path: header}
+	}
+
+	var buf bytes.Buffer
+	writer, err := newRowWriter(format, &buf, columns)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			return nil, fmt.Errorf("failed to write report row: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish report file: %w", err)
+	}
+
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102_150405"), info.extension)
+	file, err := filesystem.NewFileFromBytes(buf.Bytes(), filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report file: %w", err)
+	}
+
+	saved, err := jobutils.SaveExportFileWithOptions(app, jobId, userId, file, len(rows), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save report file: %w", err)
+	}
+
+	return saved.ExportResult(fmt.Sprintf("Saved %d report rows", len(rows)), len(rows), info.contentType), nil
+}
@@ -1,245 +1,54 @@
 package export
 
 import (
-	"bytes"
-	"encoding/csv"
-	"fmt"
-	"strconv"
-	"strings"
-	"time"
-
+	"ims-pocketbase-baas-starter/pkg/cronutils"
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 
 	"github.com/pocketbase/pocketbase"
-	"github.com/pocketbase/pocketbase/core"
 )
 
-// HandleUserExport processes user export jobs with optimized batch queries
-func HandleUserExport(app *pocketbase.PocketBase, jobId string, payload *jobutils.DataProcessingJobPayload) error {
-	startTime := time.Now()
-
-	users, err := fetchAllUsers(app)
-	if err != nil {
-		log.Error("Failed to fetch users", "job_id", jobId, "error", err)
-		return fmt.Errorf("failed to fetch users: %w", err)
-	}
-
-	log.Info("Fetched users for export", "job_id", jobId, "user_count", len(users))
-
-	if len(users) == 0 {
-		log.Warn("No users found to export", "job_id", jobId)
-		return fmt.Errorf("no users found to export")
-	}
-
-	if payload.Options.Timeout > 0 && time.Since(startTime).Seconds() > float64(payload.Options.Timeout) {
-		log.Warn("User export timeout during CSV conversion", "job_id", jobId, "elapsed", time.Since(startTime))
-		return fmt.Errorf("export operation timed out")
-	}
-
-	csvData, err := convertUsersToCSV(app, users)
-	if err != nil {
-		log.Error("Failed to convert users to CSV", "job_id", jobId, "error", err)
-		return fmt.Errorf("failed to convert users to CSV: %w", err)
-	}
-
-	filename := fmt.Sprintf("users_export_%s.csv", time.Now().Format("20060102_150405"))
-
-	log.Info("Generated CSV data", "job_id", jobId, "filename", filename, "file_size", len(csvData))
-
-	if _, err := jobutils.SaveExportFile(app, jobId, filename, csvData, len(users)); err != nil {
-		log.Error("Failed to save export file", "job_id", jobId, "error", err)
-		return fmt.Errorf("failed to save export file: %w", err)
-	}
-
-	log.Info("User export completed successfully", "job_id", jobId, "filename", filename, "user_count", len(users))
-
-	return nil
+// exportProgressInterval is the number of exported rows between two progress reports
+const exportProgressInterval = 500
+
+// userExportColumns are the columns of user exports that do not list fields, roles and permissions are
+// exported by name
+var userExportColumns = []exportColumn{
+	{Header: "ID", Path: "id"},
+	{Header: "Email", Path: "email"},
+	{Header: "Name", Path: "name"},
+	{Header: "Email Visibility", Path: "emailVisibility"},
+	{Header: "Verified", Path: "verified"},
+	{Header: "Is Active", Path: "is_active"},
+	{Header: "Roles", Path: "expand.roles.name"},
+	{Header: "Permissions", Path: "expand.permissions.slug"},
+	{Header: "Created", Path: "created"},
+	{Header: "Updated", Path: "updated"},
 }
 
-// fetchAllUsers retrieves all users from the users collection
-func fetchAllUsers(app *pocketbase.PocketBase) ([]*core.Record, error) {
-	collection, err := app.FindCollectionByNameOrId("users")
-	if err != nil {
-		return nil, fmt.Errorf("users collection not found: %w", err)
+// HandleUserExport processes user export jobs and returns the stored export file details. It is a collection
+// export of the users collection with the user export columns and the newest users first by default.
+// The export file is owned by userId, the user that requested the export.
+func HandleUserExport(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId, userId string, payload *jobutils.DataProcessingJobPayload) (*jobutils.FileExportResult, error) {
+	data := payload.Data
+	data.Source = jobutils.DataProcessingCollectionUsers
+	if data.Sort == "" {
+		data.Sort = "-created"
 	}
 
-	records, err := app.FindRecordsByFilter(
-		collection,
-		"",         // no filter - get all users
-		"-created", // sort by created date descending
-		0,          // no limit
-		0,          // no offset
-	)
+	result, err := exportCollection(ctx, app, jobId, userId, data, payload.Options.ExportFileOptions, userExportColumns)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query users: %w", err)
+		log.Error("User export failed", "job_id", jobId, "error", err)
+		return nil, err
 	}
 
-	return records, nil
+	result.Message = "User export completed successfully"
+	return result, nil
 }
 
-// convertUsersToCSV converts user records to CSV format using optimized batch queries
-func convertUsersToCSV(app *pocketbase.PocketBase, users []*core.Record) ([]byte, error) {
-	estimatedSize := len(users) * 200 // Rough estimate of 200 bytes per user row
-	var buf bytes.Buffer
-	buf.Grow(estimatedSize)
-
-	writer := csv.NewWriter(&buf)
-
-	header := []string{
-		"ID",
-		"Email",
-		"Name",
-		"Email Visibility",
-		"Verified",
-		"Is Active",
-		"Roles",
-		"Permissions",
-		"Created",
-		"Updated",
-	}
-	if err := writer.Write(header); err != nil {
-		return nil, fmt.Errorf("failed to write CSV header: %w", err)
-	}
-
-	roleNameMap, err := buildRoleNameMap(app, users)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build role name map: %w", err)
-	}
-
-	permissionSlugMap, err := buildPermissionSlugMap(app, users)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build permission slug map: %w", err)
+// reportExportProgress reports export progress, logging instead of failing the export when it cannot be stored
+func reportExportProgress(ctx *cronutils.CronExecutionContext, done, total int, message string) {
+	if err := ctx.ReportProgress(done, total, message); err != nil {
+		log.Warn("Failed to report export progress", "job_id", ctx.CronID, "error", err)
 	}
-
-	for _, user := range users {
-		roleNames := getRoleNames(user, roleNameMap)
-		permissionSlugs := getPermissionSlugs(user, permissionSlugMap)
-
-		row := []string{
-			user.Id,
-			user.GetString("email"),
-			user.GetString("name"),
-			strconv.FormatBool(user.GetBool("emailVisibility")),
-			strconv.FormatBool(user.GetBool("verified")),
-			strconv.FormatBool(user.GetBool("is_active")),
-			roleNames,
-			permissionSlugs,
-			user.GetDateTime("created").Time().Format(time.RFC3339),
-			user.GetDateTime("updated").Time().Format(time.RFC3339),
-		}
-
-		if err := writer.Write(row); err != nil {
-			return nil, fmt.Errorf("failed to write user row: %w", err)
-		}
-	}
-
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return nil, fmt.Errorf("CSV writer error: %w", err)
-	}
-
-	return buf.Bytes(), nil
-}
-
-// buildRoleNameMap creates a map of role ID to role name for all users (single batch query)
-func buildRoleNameMap(app *pocketbase.PocketBase, users []*core.Record) (map[string]string, error) {
-	roleIdSet := make(map[string]struct{})
-	for _, user := range users {
-		roleIds := user.GetStringSlice("roles")
-		for _, roleId := range roleIds {
-			if roleId != "" {
-				roleIdSet[roleId] = struct{}{}
-			}
-		}
-	}
-
-	roleIds := make([]string, 0, len(roleIdSet))
-	for roleId := range roleIdSet {
-		roleIds = append(roleIds, roleId)
-	}
-
-	if len(roleIds) == 0 {
-		return make(map[string]string), nil
-	}
-
-	roles, err := app.FindRecordsByIds("roles", roleIds)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch roles: %w", err)
-	}
-
-	roleNameMap := make(map[string]string, len(roles))
-	for _, role := range roles {
-		roleNameMap[role.Id] = role.GetString("name")
-	}
-
-	return roleNameMap, nil
-}
-
-// buildPermissionSlugMap creates a map of permission ID to permission slug for all users (single batch query)
-func buildPermissionSlugMap(app *pocketbase.PocketBase, users []*core.Record) (map[string]string, error) {
-	permissionIdSet := make(map[string]struct{})
-	for _, user := range users {
-		permissionIds := user.GetStringSlice("permissions")
-		for _, permissionId := range permissionIds {
-			if permissionId != "" {
-				permissionIdSet[permissionId] = struct{}{}
-			}
-		}
-	}
-
-	permissionIds := make([]string, 0, len(permissionIdSet))
-	for permissionId := range permissionIdSet {
-		permissionIds = append(permissionIds, permissionId)
-	}
-
-	if len(permissionIds) == 0 {
-		return make(map[string]string), nil
-	}
-
-	permissions, err := app.FindRecordsByIds("permissions", permissionIds)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch permissions: %w", err)
-	}
-
-	permissionSlugMap := make(map[string]string, len(permissions))
-	for _, permission := range permissions {
-		permissionSlugMap[permission.Id] = permission.GetString("slug")
-	}
-
-	return permissionSlugMap, nil
-}
-
-// getRoleNames extracts role names using optimized batch queries to avoid N+1 problem
-func getRoleNames(user *core.Record, roleNameMap map[string]string) string {
-	roleIds := user.GetStringSlice("roles")
-	if len(roleIds) == 0 {
-		return ""
-	}
-
-	roleNames := make([]string, 0, len(roleIds))
-	for _, roleId := range roleIds {
-		if name, exists := roleNameMap[roleId]; exists {
-			roleNames = append(roleNames, name)
-		}
-	}
-
-	return strings.Join(roleNames, "; ")
-}
-
-// getPermissionSlugs extracts permission slugs using optimized batch queries to avoid N+1 problem
-func getPermissionSlugs(user *core.Record, permissionSlugMap map[string]string) string {
-	permissionIds := user.GetStringSlice("permissions")
-	if len(permissionIds) == 0 {
-		return ""
-	}
-
-	permissionSlugs := make([]string, 0, len(permissionIds))
-	for _, permissionId := range permissionIds {
-		if slug, exists := permissionSlugMap[permissionId]; exists {
-			permissionSlugs = append(permissionSlugs, slug)
-		}
-	}
-
-	return strings.Join(permissionSlugs, "; ")
 }
@@ -0,0 +1,178 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/xlsx"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// exportListSeparator joins the values of multiple relations and selects in CSV and XLSX cells
+const exportListSeparator = "; "
+
+// rowWriter encodes exported rows in a file format, writing them as they come
+type rowWriter interface {
+	// WriteRow writes the values of a record, in the order of the columns
+	WriteRow(values []any) error
+	// Close writes the end of the file, it does not close the underlying writer
+	Close() error
+}
+
+// exportFormats holds the content type and extension of the supported export formats
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	jobutils.DataProcessingFileCSV:   {contentType: "text/csv", extension: "csv"},
+	jobutils.DataProcessingFileJSONL: {contentType: "application/x-ndjson", extension: "jsonl"},
+	jobutils.DataProcessingFileXLSX:  {contentType: xlsx.ContentType, extension: "xlsx"},
+}
+
+// newRowWriter returns the writer of a format, which writes the header row if the format has one
+func newRowWriter(format string, w io.Writer, columns []exportColumn) (rowWriter, error) {
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+
+	switch format {
+	case jobutils.DataProcessingFileCSV:
+		writer := &csvRowWriter{writer: csv.NewWriter(w)}
+		if err := writer.writer.Write(headers); err != nil {
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		return writer, nil
+	case jobutils.DataProcessingFileJSONL:
+		return newJSONLRowWriter(w, headers), nil
+	case jobutils.DataProcessingFileXLSX:
+		writer, err := xlsx.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.WriteRow(headers); err != nil {
+			return nil, fmt.Errorf("failed to write XLSX header: %w", err)
+		}
+		return &xlsxRowWriter{writer: writer}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q, expected csv, jsonl or xlsx", format)
+	}
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvRowWriter) WriteRow(values []any) error {
+	return w.writer.Write(textValues(values))
+}
+
+func (w *csvRowWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type xlsxRowWriter struct {
+	writer *xlsx.Writer
+}
+
+func (w *xlsxRowWriter) WriteRow(values []any) error {
+	return w.writer.WriteRow(textValues(values))
+}
+
+func (w *xlsxRowWriter) Close() error {
+	return w.writer.Close()
+}
+
+// jsonlRowWriter writes one JSON object per line, keeping the column order and the value types
+type jsonlRowWriter struct {
+	writer *bufio.Writer
+	keys   [][]byte
+}
+
+func newJSONLRowWriter(w io.Writer, headers []string) *jsonlRowWriter {
+	keys := make([][]byte, len(headers))
+	for i, header := range headers {
+		keys[i], _ = json.Marshal(header)
+	}
+	return &jsonlRowWriter{writer: bufio.NewWriter(w), keys: keys}
+}
+
+func (w *jsonlRowWriter) WriteRow(values []any) error {
+	_ = w.writer.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			_ = w.writer.WriteByte(',')
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", w.keys[i], err)
+		}
+
+		_, _ = w.writer.Write(w.keys[i])
+		_ = w.writer.WriteByte(':')
+		_, _ = w.writer.Write(encoded)
+	}
+	_, err := w.writer.WriteString("}\n")
+	return err
+}
+
+func (w *jsonlRowWriter) Close() error {
+	return w.writer.Flush()
+}
+
+func textValues(values []any) []string {
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = exportText(value)
+	}
+	return texts
+}
+
+// exportText formats a field value for text formats: dates as RFC 3339 and lists joined by "; "
+func exportText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case types.DateTime:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Time().Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, exportListSeparator)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if text := exportText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, exportListSeparator)
+	case types.JSONRaw:
+		return string(v)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
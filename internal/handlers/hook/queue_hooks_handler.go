@@ -0,0 +1,18 @@
+package hook
+
+import (
+	"ims-pocketbase-baas-starter/internal/jobs"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleQueueJobCreated wakes the job dispatcher so newly queued jobs start without waiting for the next poll
+func HandleQueueJobCreated(e *core.RecordEvent) error {
+	if processor := jobs.GetJobManager().GetProcessor(); processor != nil && processor.IsDispatcherRunning() {
+		log.Debug("Waking job dispatcher for new job", "job_id", e.Record.Id, "queue", e.Record.GetString("queue"))
+		processor.WakeDispatcher()
+	}
+
+	return e.Next()
+}
@@ -1,11 +1,16 @@
 package hook
 
 import (
+	"ims-pocketbase-baas-starter/internal/middlewares"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// jobPermissions checks access to the progress of jobs created by other users
+var jobPermissions = middlewares.NewPermissionMiddleware()
+
 // HandleRealtimeConnect handles realtime connection events
 func HandleRealtimeConnect(e *core.RealtimeConnectRequestEvent) error {
 
@@ -16,8 +21,23 @@ func HandleRealtimeConnect(e *core.RealtimeConnectRequestEvent) error {
 	return e.Next()
 }
 
-// HandleRealtimeSubscribe handles realtime subscription events
+// HandleRealtimeSubscribe handles realtime subscription events. Job progress topics are only allowed for the
+// owner of the job and users with the job.view permission.
 func HandleRealtimeSubscribe(e *core.RealtimeSubscribeRequestEvent) error {
+	for _, subscription := range e.Subscriptions {
+		jobId, ok := jobutils.ParseJobProgressTopic(subscription)
+		if !ok {
+			continue
+		}
+
+		if !jobPermissions.CanAccessJobID(e.App, e.Auth, jobId) {
+			log.Warn("Realtime job progress subscription denied",
+				"client_id", e.Client.Id(),
+				"job_id", jobId,
+			)
+			return e.ForbiddenError("You are not allowed to follow the progress of this job.", nil)
+		}
+	}
 
 	log.Debug("Realtime subscription created",
 		"client_id", e.Client.Id(),
@@ -0,0 +1,30 @@
+package hook
+
+import (
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+func TestHandleRealtimeSubscribe_JobProgressRequiresAccess(t *testing.T) {
+	app := pocketbase.New()
+
+	event := &core.RealtimeSubscribeRequestEvent{
+		RequestEvent:  &core.RequestEvent{App: app},
+		Client:        subscriptions.NewDefaultClient(),
+		Subscriptions: []string{"users", jobutils.JobProgressTopic("job123")},
+	}
+
+	if err := HandleRealtimeSubscribe(event); err == nil {
+		t.Error("expected anonymous clients to be denied job progress subscriptions")
+	}
+
+	event.Subscriptions = []string{"users"}
+	if err := HandleRealtimeSubscribe(event); err != nil {
+		t.Errorf("expected other subscriptions to be allowed, got %v", err)
+	}
+}
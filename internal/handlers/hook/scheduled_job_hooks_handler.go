@@ -0,0 +1,38 @@
+package hook
+
+import (
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleScheduledJobSave validates a scheduled job before it is saved and recalculates its next run time when
+// it is created or its cron expression, timezone or enabled flag changed, so the scheduler picks it up without a restart
+func HandleScheduledJobSave(e *core.RecordEvent) error {
+	if err := jobutils.ValidateScheduledJob(e.Record); err != nil {
+		return apis.NewBadRequestError("Invalid scheduled job: "+err.Error(), nil)
+	}
+
+	original := e.Record.Original()
+	changed := e.Record.IsNew() ||
+		e.Record.GetString("cron") != original.GetString("cron") ||
+		e.Record.GetString("timezone") != original.GetString("timezone") ||
+		e.Record.GetBool("enabled") != original.GetBool("enabled")
+
+	if changed || (e.Record.GetBool("enabled") && e.Record.GetDateTime("next_run_at").IsZero()) {
+		if err := jobutils.ScheduleNextRun(e.Record, time.Now()); err != nil {
+			return apis.NewBadRequestError("Invalid scheduled job: "+err.Error(), nil)
+		}
+
+		log.Debug("Scheduled job next run updated",
+			"scheduled_job_id", e.Record.Id,
+			"name", e.Record.GetString("name"),
+			"next_run_at", e.Record.GetDateTime("next_run_at"))
+	}
+
+	return e.Next()
+}
@@ -1,7 +1,6 @@
 package hook
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -51,26 +50,15 @@ func HandleUserWelcomeEmail(e *core.RecordEvent) error {
 		},
 	}
 
-	collection, err := e.App.FindCollectionByNameOrId("queues")
+	// The user id as unique key keeps a re-triggered hook from sending the welcome email twice
+	jobRecord, _, err := jobutils.Enqueue(e.App, payload, jobutils.EnqueueOptions{
+		Name:        fmt.Sprintf("Welcome email for %s", email),
+		Description: fmt.Sprintf("Send welcome email to new user %s", email),
+		Queue:       jobutils.QueueEmails,
+		Priority:    jobutils.JobPriorityHigh,
+		UniqueKey:   "welcome_email:" + e.Record.Id,
+	})
 	if err != nil {
-		log.Error("Failed to find queues collection", "error", err)
-		return err
-	}
-
-	jobRecord := core.NewRecord(collection)
-	jobRecord.Set("name", fmt.Sprintf("Welcome email for %s", email))
-	jobRecord.Set("description", fmt.Sprintf("Send welcome email to new user %s", email))
-
-	// Convert payload to JSON
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		log.Error("Failed to marshal email payload", "error", err)
-		return err
-	}
-	jobRecord.Set("payload", string(payloadBytes))
-	jobRecord.Set("attempts", 0)
-
-	if err := e.App.Save(jobRecord); err != nil {
 		log.Error("Failed to queue welcome email job", "error", err)
 		return err
 	}
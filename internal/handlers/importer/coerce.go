@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// importDateLayouts are the date formats accepted for date fields, tried in order
+var importDateLayouts = []string{
+	time.RFC3339Nano,
+	types.DefaultDateLayout,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// excelEpoch is day zero of spreadsheet serial dates (including the 1900 leap year bug)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// isImportableField reports whether imported values can be written to a field. Files, autodates, passwords
+// and the token key of auth collections are managed by PocketBase, and relations to roles and permissions
+// would grant access.
+func isImportableField(app core.App, field core.Field) bool {
+	switch f := field.(type) {
+	case *core.FileField, *core.AutodateField, *core.PasswordField:
+		return false
+	case *core.RelationField:
+		related, err := app.FindCachedCollectionByNameOrId(f.CollectionId)
+		if err != nil || slices.Contains(protectedImportCollections, related.Name) {
+			return false
+		}
+	}
+	return field.GetName() != core.FieldNameTokenKey
+}
+
+// coerceValue converts an imported value to the type of a field. Values that PocketBase would silently turn
+// into a zero value (e.g. "abc" for a number) are rejected instead.
+func coerceValue(field core.Field, value any, format string) (any, error) {
+	switch f := field.(type) {
+	case *core.NumberField:
+		return coerceNumber(value)
+	case *core.BoolField:
+		return coerceBool(value)
+	case *core.DateField:
+		return coerceDate(value, format)
+	case *core.JSONField, *core.GeoPointField:
+		return coerceJSON(value, format)
+	case *core.PasswordField:
+		return toText(value), nil
+	case *core.SelectField:
+		if f.IsMultiple() {
+			return coerceList(value), nil
+		}
+	case *core.RelationField:
+		if f.IsMultiple() {
+			return coerceList(value), nil
+		}
+	}
+
+	return strings.TrimSpace(toText(value)), nil
+}
+
+func coerceNumber(value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case string:
+		text := strings.TrimSpace(v)
+		if text == "" {
+			return nil, nil
+		}
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return number, nil
+	}
+
+	return nil, fmt.Errorf("%v is not a number", value)
+}
+
+func coerceBool(value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case json.Number:
+		return coerceBool(v.String())
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "false", "0", "no", "n", "off":
+			return false, nil
+		case "true", "1", "yes", "y", "on":
+			return true, nil
+		}
+		return nil, fmt.Errorf("%q is not a boolean, expected true/false, yes/no or 1/0", v)
+	}
+
+	return nil, fmt.Errorf("%v is not a boolean", value)
+}
+
+func coerceDate(value any, format string) (any, error) {
+	text := strings.TrimSpace(toText(value))
+	if text == "" {
+		return "", nil
+	}
+
+	for _, layout := range importDateLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+
+	// Spreadsheets store dates without a text format as serial day numbers
+	if format == jobutils.DataProcessingFileXLSX {
+		if serial, err := strconv.ParseFloat(text, 64); err == nil && serial > 0 {
+			return excelEpoch.Add(time.Duration(serial * 24 * float64(time.Hour))).Round(time.Second), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q is not a date, expected e.g. 2006-01-02 or 2006-01-02T15:04:05Z", text)
+}
+
+// coerceJSON parses JSON text of CSV and XLSX cells, values of JSON files are used as they are
+func coerceJSON(value any, format string) (any, error) {
+	text, ok := value.(string)
+	if !ok || format == jobutils.DataProcessingFileJSON {
+		return value, nil
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	if !json.Valid([]byte(text)) {
+		return nil, fmt.Errorf("%q is not valid JSON", text)
+	}
+
+	return types.JSONRaw(text), nil
+}
+
+// coerceList splits a text cell of a multiple select or relation field on commas and semicolons
+func coerceList(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, strings.TrimSpace(toText(item)))
+		}
+		return list
+	case string:
+		text := strings.TrimSpace(v)
+		if strings.HasPrefix(text, "[") {
+			var list []string
+			if err := json.Unmarshal([]byte(text), &list); err == nil {
+				return list
+			}
+		}
+
+		parts := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' })
+		list := make([]string, 0, len(parts))
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+		return list
+	}
+
+	return []string{toText(value)}
+}
+
+// toText returns the text of an imported value, as written in the file where possible
+func toText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
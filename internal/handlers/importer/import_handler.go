@@ -0,0 +1,486 @@
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// importProgressInterval is the number of processed rows between two progress reports
+const importProgressInterval = 100
+
+// Import row outcomes
+const (
+	importActionCreate = "create"
+	importActionUpdate = "update"
+)
+
+// Errors returned for imports that are not allowed
+var (
+	ErrImportNotAllowed = errors.New("collection cannot be imported into")
+	ErrImportForbidden  = errors.New("not allowed by the collection rules")
+)
+
+// protectedImportCollections are never imported into, nor written through relation fields: imports would
+// otherwise grant roles and permissions. Auth collections are refused as well.
+var protectedImportCollections = []string{"users", "roles", "permissions"}
+
+// errDryRunRollback rolls back the rows saved by a dry run to check the create rule
+var errDryRunRollback = errors.New("dry run")
+
+// rowError is a row that could not be imported, written to the error report
+type rowError struct {
+	row importRow
+	err error
+}
+
+// importJob holds the state of a running import
+type importJob struct {
+	app        core.App
+	collection *core.Collection
+	format     string
+	keyField   string
+	dryRun     bool
+
+	// requestInfo is the access of the requester, nil for jobs without a user, which import like superusers
+	requestInfo *core.RequestInfo
+
+	// columns maps the imported columns to their collection field
+	columns map[string]core.Field
+	// seenKeys tracks the keys of rows created in a dry run, so repeated keys count as updates
+	seenKeys map[string]bool
+}
+
+// HandleImport imports an uploaded import_files record (payload.Data.Source) into a collection
+// (payload.Data.Target) and returns the row counts. Rows that fail coercion or validation are skipped and
+// listed in a CSV error report stored in export_files and owned by userId. Rows are created and updated with
+// the access of userId: the create and update rules of the collection apply to each row.
+func HandleImport(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId, userId string, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataImportResult, error) {
+	collection, err := ValidateImportTarget(app, payload.Data.Target, payload.Data.Mapping, payload.Data.KeyField)
+	if err != nil {
+		return nil, err
+	}
+
+	importFile, data, err := jobutils.ReadImportFile(app, payload.Data.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := DetectImportFormat(payload.Data.Format, importFile.GetString("file"))
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := readImportTable(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	columns, ignored, err := resolveImportColumns(app, collection, table.Columns, payload.Data.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	keyField := payload.Data.KeyField
+	if keyField != "" && !slices.Contains(mappedFields(columns), keyField) {
+		return nil, fmt.Errorf("key field %q is not mapped from any column", keyField)
+	}
+
+	requester, err := jobutils.FindJobRequester(app, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Importing file",
+		"job_id", jobId,
+		"collection", collection.Name,
+		"format", format,
+		"rows", len(table.Rows),
+		"dry_run", payload.Options.DryRun)
+
+	job := &importJob{
+		app:        app,
+		collection: collection,
+		format:     format,
+		keyField:   keyField,
+		dryRun:     payload.Options.DryRun,
+		columns:    columns,
+		seenKeys:   map[string]bool{},
+	}
+	if requester != nil && !requester.IsSuperuser() {
+		job.requestInfo = &core.RequestInfo{
+			Auth:    requester,
+			Context: core.RequestInfoContextDefault,
+			Query:   map[string]string{},
+			Headers: map[string]string{},
+		}
+	}
+
+	result := &jobutils.DataImportResult{
+		DataProcessingResult: jobutils.DataProcessingResult{
+			OutputLocation: collection.Name,
+		},
+		DryRun:         job.dryRun,
+		Format:         format,
+		TotalRows:      len(table.Rows),
+		IgnoredColumns: ignored,
+	}
+
+	reportImportProgress(ctx, 0, len(table.Rows), "Importing rows")
+
+	var failures []rowError
+	for i, row := range table.Rows {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("import cancelled after %d rows: %w", i, err)
+		}
+
+		action, err := job.importRow(row)
+		switch {
+		case err != nil:
+			failures = append(failures, rowError{row: row, err: err})
+		case action == importActionCreate:
+			result.Created++
+		default:
+			result.Updated++
+		}
+
+		if (i+1)%importProgressInterval == 0 {
+			reportImportProgress(ctx, i+1, len(table.Rows), "Importing rows")
+		}
+	}
+
+	result.Failed = len(failures)
+	result.ProcessedRecords = result.Created + result.Updated
+
+	if len(failures) > 0 {
+		report, err := saveErrorReport(app, jobId, userId, collection.Name, table.Columns, failures)
+		if err != nil {
+			return nil, err
+		}
+		result.ErrorReportId = report.Id
+		result.ErrorReport = jobutils.ExportFileName(report)
+	}
+
+	reportImportProgress(ctx, len(table.Rows), len(table.Rows), "Import finished")
+
+	result.Message = fmt.Sprintf("Imported %d of %d rows into %s", result.ProcessedRecords, result.TotalRows, collection.Name)
+	if job.dryRun {
+		result.Message = fmt.Sprintf("Dry run: %d of %d rows of %s would be imported", result.ProcessedRecords, result.TotalRows, collection.Name)
+	}
+	result.Timestamp = time.Now()
+
+	log.Info("Import completed",
+		"job_id", jobId,
+		"collection", collection.Name,
+		"created", result.Created,
+		"updated", result.Updated,
+		"failed", result.Failed,
+		"dry_run", job.dryRun)
+
+	return result, nil
+}
+
+// ValidateImportTarget checks that a collection accepts imports and that the mapping and key field name
+// fields that can be written. Only the base collections listed in IMPORT_ALLOWED_COLLECTIONS are accepted,
+// never system, auth, users, roles or permissions collections.
+func ValidateImportTarget(app core.App, collectionName string, mapping map[string]string, keyField string) (*core.Collection, error) {
+	if collectionName == "" {
+		return nil, errors.New("target collection is required")
+	}
+
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("target collection %q not found", collectionName)
+	}
+
+	if !collection.IsBase() || collection.System || slices.Contains(protectedImportCollections, collection.Name) ||
+		!isAllowedImportCollection(collection.Name) {
+		return nil, fmt.Errorf("%w: %s", ErrImportNotAllowed, collection.Name)
+	}
+
+	for column, fieldName := range mapping {
+		if err := checkImportField(app, collection, fieldName); err != nil {
+			return nil, fmt.Errorf("invalid mapping of column %q: %w", column, err)
+		}
+	}
+
+	if keyField != "" {
+		if err := checkImportField(app, collection, keyField); err != nil {
+			return nil, fmt.Errorf("invalid key field: %w", err)
+		}
+	}
+
+	return collection, nil
+}
+
+// DetectImportFormat returns the explicit format, or the format matching the extension of the file name
+func DetectImportFormat(format, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+
+	switch format {
+	case jobutils.DataProcessingFileCSV, jobutils.DataProcessingFileJSON, jobutils.DataProcessingFileXLSX:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unsupported import format %q, expected csv, json or xlsx", format)
+}
+
+// importRow coerces, validates and (unless dry running) saves a row and reports whether it created or
+// updated a record
+func (j *importJob) importRow(row importRow) (string, error) {
+	values := make(map[string]any, len(j.columns))
+	for column, field := range j.columns {
+		raw, ok := row.Values[column]
+		if !ok {
+			continue
+		}
+
+		value, err := coerceValue(field, raw, j.format)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", column, err)
+		}
+		values[field.GetName()] = value
+	}
+
+	record, action, err := j.findOrNewRecord(values)
+	if err != nil {
+		return "", err
+	}
+
+	// Updates are checked against the stored record, before the row is applied, like the records API
+	if !record.IsNew() {
+		if err := j.checkRule(j.app, record, j.collection.UpdateRule, http.MethodPatch, values); err != nil {
+			return "", err
+		}
+	}
+
+	for name, value := range values {
+		record.Set(name, value)
+	}
+
+	// Created records are checked once saved, in a transaction rolled back when the rule denies them
+	if record.IsNew() && j.requestInfo != nil {
+		if err := j.saveNew(record, values); err != nil {
+			return "", err
+		}
+		if j.dryRun && j.keyField != "" {
+			j.seenKeys[toText(values[j.keyField])] = true
+		}
+		return action, nil
+	}
+
+	if j.dryRun {
+		if err := j.app.Validate(record); err != nil {
+			return "", err
+		}
+		if j.keyField != "" {
+			j.seenKeys[toText(values[j.keyField])] = true
+		}
+		return action, nil
+	}
+
+	if err := j.app.Save(record); err != nil {
+		return "", err
+	}
+
+	return action, nil
+}
+
+// saveNew saves a new record and checks the create rule of the requester, rolling back denied rows and the
+// rows of dry runs
+func (j *importJob) saveNew(record *core.Record, values map[string]any) error {
+	err := j.app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		if err := j.checkRule(txApp, record, j.collection.CreateRule, http.MethodPost, values); err != nil {
+			return err
+		}
+		if j.dryRun {
+			return errDryRunRollback
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRunRollback) {
+		return nil
+	}
+	return err
+}
+
+// checkRule checks a create or update rule of the collection for the requester, with the row as request body.
+// Jobs without a user and superusers are not checked, and a nil rule only allows superusers.
+func (j *importJob) checkRule(app core.App, record *core.Record, rule *string, method string, values map[string]any) error {
+	if j.requestInfo == nil {
+		return nil
+	}
+
+	info := *j.requestInfo
+	info.Method = method
+	info.Body = values
+
+	allowed, err := app.CanAccessRecord(record, &info, rule)
+	if err != nil {
+		return fmt.Errorf("failed to check the rules of %s: %w", j.collection.Name, err)
+	}
+	if !allowed {
+		return ErrImportForbidden
+	}
+	return nil
+}
+
+// findOrNewRecord returns the record with the row's key to update, or a new record
+func (j *importJob) findOrNewRecord(values map[string]any) (*core.Record, string, error) {
+	if j.keyField == "" {
+		return core.NewRecord(j.collection), importActionCreate, nil
+	}
+
+	key := values[j.keyField]
+	if strings.TrimSpace(toText(key)) == "" {
+		return nil, "", fmt.Errorf("key field %s is empty", j.keyField)
+	}
+
+	existing, err := j.app.FindFirstRecordByData(j.collection, j.keyField, key)
+	switch {
+	case err == nil:
+		return existing, importActionUpdate, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, "", fmt.Errorf("failed to look up %s %v: %w", j.keyField, key, err)
+	}
+
+	// A dry run saves nothing, so a key repeated in the file would still not be found
+	action := importActionCreate
+	if j.seenKeys[toText(key)] {
+		action = importActionUpdate
+	}
+
+	return core.NewRecord(j.collection), action, nil
+}
+
+// resolveImportColumns maps the columns of the file to collection fields using the mapping, or by field
+// name when there is none, and returns the columns that are not imported
+func resolveImportColumns(app core.App, collection *core.Collection, columns []string, mapping map[string]string) (map[string]core.Field, []string, error) {
+	resolved := make(map[string]core.Field, len(columns))
+	var ignored []string
+
+	if len(mapping) > 0 {
+		for column, fieldName := range mapping {
+			if !slices.Contains(columns, column) {
+				return nil, nil, fmt.Errorf("mapped column %q is not in the import file", column)
+			}
+			resolved[column] = collection.Fields.GetByName(fieldName)
+		}
+	}
+
+	for _, column := range columns {
+		if _, ok := resolved[column]; ok {
+			continue
+		}
+
+		field := collection.Fields.GetByName(column)
+		if len(mapping) > 0 || field == nil || !isImportableField(app, field) {
+			ignored = append(ignored, column)
+			continue
+		}
+		resolved[column] = field
+	}
+
+	if len(resolved) == 0 {
+		return nil, nil, fmt.Errorf("no column of the import file matches a field of %s", collection.Name)
+	}
+
+	return resolved, ignored, nil
+}
+
+// checkImportField checks that a collection has a field that imports can write
+func checkImportField(app core.App, collection *core.Collection, fieldName string) error {
+	field := collection.Fields.GetByName(fieldName)
+	if field == nil {
+		return fmt.Errorf("%s has no field %q", collection.Name, fieldName)
+	}
+	if !isImportableField(app, field) {
+		return fmt.Errorf("field %q cannot be imported", fieldName)
+	}
+	return nil
+}
+
+// isAllowedImportCollection checks the IMPORT_ALLOWED_COLLECTIONS allowlist, nothing is allowed when it is empty
+func isAllowedImportCollection(name string) bool {
+	allowed := strings.TrimSpace(common.GetEnv("IMPORT_ALLOWED_COLLECTIONS", ""))
+	if allowed == "" {
+		return false
+	}
+
+	for _, entry := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(entry) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func mappedFields(columns map[string]core.Field) []string {
+	names := make([]string, 0, len(columns))
+	for _, field := range columns {
+		names = append(names, field.GetName())
+	}
+	return names
+}
+
+// saveErrorReport writes the failed rows with their error and original values to a CSV file in export_files
+func saveErrorReport(app *pocketbase.PocketBase, jobId, userId, collectionName string, columns []string, failures []rowError) (*core.Record, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(append([]string{"row", "error"}, columns...)); err != nil {
+		return nil, fmt.Errorf("failed to write error report header: %w", err)
+	}
+
+	for _, failure := range failures {
+		line := make([]string, 0, len(columns)+2)
+		line = append(line, strconv.Itoa(failure.row.Number), failure.err.Error())
+		for _, column := range columns {
+			line = append(line, toText(failure.row.Values[column]))
+		}
+		if err := writer.Write(line); err != nil {
+			return nil, fmt.Errorf("failed to write error report row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write error report: %w", err)
+	}
+
+	filename := fmt.Sprintf("%s_import_errors_%s.csv", collectionName, time.Now().Format("20060102_150405"))
+	record, err := jobutils.SaveExportFileWithUser(app, jobId, userId, filename, buf.Bytes(), len(failures))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save error report: %w", err)
+	}
+
+	return record, nil
+}
+
+// reportImportProgress reports import progress, logging instead of failing the import when it cannot be stored
+func reportImportProgress(ctx *cronutils.CronExecutionContext, done, total int, message string) {
+	if err := ctx.ReportProgress(done, total, message); err != nil {
+		log.Warn("Failed to report import progress", "job_id", ctx.CronID, "error", err)
+	}
+}
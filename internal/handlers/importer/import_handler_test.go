@@ -0,0 +1,519 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/xlsx"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// testRequesterId is the superuser that requests the test imports
+const testRequesterId = "importadmin0001"
+
+// newTestApp bootstraps a PocketBase app with the file collections, a superuser and a "products" collection
+// to import into, the only one allowed by IMPORT_ALLOWED_COLLECTIONS
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	t.Setenv("IMPORT_ALLOWED_COLLECTIONS", "products")
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	importFiles := core.NewBaseCollection(jobutils.ImportFilesCollectionName)
+	importFiles.Fields.Add(
+		&core.FileField{Name: "file", Required: true, MaxSelect: 1, MaxSize: 1 << 20},
+		&core.TextField{Name: "user_id"},
+		&core.DateField{Name: "expires_at"},
+	)
+	if err := app.Save(importFiles); err != nil {
+		t.Fatalf("failed to create import_files collection: %v", err)
+	}
+
+	exportFiles := core.NewBaseCollection(jobutils.ExportFilesCollectionName)
+	exportFiles.Fields.Add(
+		&core.TextField{Name: "job_id", Required: true},
+		&core.FileField{Name: "file", MaxSelect: 1},
+		&core.NumberField{Name: "record_count"},
+		&core.TextField{Name: "user_id"},
+		&core.DateField{Name: "expires_at"},
+		&core.TextField{Name: "storage"},
+		&core.TextField{Name: "storage_key"},
+		&core.TextField{Name: "checksum"},
+		&core.TextField{Name: "compression"},
+		&core.TextField{Name: "encryption"},
+	)
+	if err := app.Save(exportFiles); err != nil {
+		t.Fatalf("failed to create export_files collection: %v", err)
+	}
+
+	products := core.NewBaseCollection("products")
+	products.Fields.Add(
+		&core.TextField{Name: "sku", Required: true},
+		&core.TextField{Name: "name", Required: true},
+		&core.NumberField{Name: "price", Min: floatPtr(0)},
+		&core.BoolField{Name: "active"},
+		&core.DateField{Name: "released"},
+		&core.SelectField{Name: "tags", MaxSelect: 3, Values: []string{"new", "sale", "eco"}},
+		&core.JSONField{Name: "meta"},
+	)
+	products.AddIndex("idx_products_sku", true, "sku", "")
+	if err := app.Save(products); err != nil {
+		t.Fatalf("failed to create products collection: %v", err)
+	}
+
+	superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		t.Fatalf("failed to find superusers collection: %v", err)
+	}
+	superuser := core.NewRecord(superusers)
+	superuser.Id = testRequesterId
+	superuser.SetEmail("admin@example.com")
+	superuser.SetPassword("1234567890")
+	if err := app.Save(superuser); err != nil {
+		t.Fatalf("failed to create superuser: %v", err)
+	}
+
+	return app
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// uploadImportFile stores content as an import file and returns its id
+func uploadImportFile(t *testing.T, app *pocketbase.PocketBase, filename string, content []byte) string {
+	t.Helper()
+
+	file, err := filesystem.NewFileFromBytes(content, filename)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	record, err := jobutils.SaveImportFile(app, "user1", file)
+	if err != nil {
+		t.Fatalf("failed to save import file: %v", err)
+	}
+	return record.Id
+}
+
+func newImportPayload(source, target string) *jobutils.DataProcessingJobPayload {
+	return &jobutils.DataProcessingJobPayload{
+		Type: jobutils.JobTypeDataProcessing,
+		Data: jobutils.DataProcessingJobData{
+			Operation: jobutils.DataProcessingOperationImport,
+			Source:    source,
+			Target:    target,
+		},
+	}
+}
+
+func runImport(t *testing.T, app *pocketbase.PocketBase, payload *jobutils.DataProcessingJobPayload) *jobutils.DataImportResult {
+	t.Helper()
+
+	ctx := cronutils.NewCronExecutionContext(app, "import-job")
+	result, err := HandleImport(ctx, app, "import-job", testRequesterId, payload)
+	if err != nil {
+		t.Fatalf("HandleImport returned error: %v", err)
+	}
+	return result
+}
+
+// readErrorReport returns the rows of the error report of an import
+func readErrorReport(t *testing.T, app *pocketbase.PocketBase, reportId string) [][]string {
+	t.Helper()
+
+	record, err := app.FindRecordById(jobutils.ExportFilesCollectionName, reportId)
+	if err != nil {
+		t.Fatalf("error report not found: %v", err)
+	}
+	if record.GetString("job_id") != "import-job" || record.GetString("user_id") != testRequesterId {
+		t.Errorf("expected the error report to belong to the job and user, got %s/%s", record.GetString("job_id"), record.GetString("user_id"))
+	}
+
+	reader, err := jobutils.OpenExportFile(app, record)
+	if err != nil {
+		t.Fatalf("failed to open error report: %v", err)
+	}
+	defer reader.Close()
+
+	data, _ := io.ReadAll(reader)
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid error report: %v", err)
+	}
+	return rows
+}
+
+func TestHandleImport_CSV(t *testing.T) {
+	app := newTestApp(t)
+
+	content := "\ufeffsku,name,price,active,released,tags,meta,color\n" +
+		"A-1,Lamp,19.5,yes,2024-03-01,\"new,eco\",\"{\"\"watts\"\":40}\",red\n" +
+		"\n" +
+		"A-2,Chair,abc,no,,,,blue\n" +
+		"A-3,Desk,120,1,2024-03-05 10:00:00,sale,,green\n" +
+		"A-4,,5,0,,,,black\n"
+	payload := newImportPayload(uploadImportFile(t, app, "products.csv", []byte(content)), "products")
+
+	result := runImport(t, app, payload)
+
+	if result.Format != jobutils.DataProcessingFileCSV || result.TotalRows != 4 {
+		t.Errorf("expected 4 csv rows, got %d %s rows", result.TotalRows, result.Format)
+	}
+	if result.Created != 2 || result.Updated != 0 || result.Failed != 2 || result.ProcessedRecords != 2 {
+		t.Errorf("expected 2 created and 2 failed rows, got %+v", result)
+	}
+	if len(result.IgnoredColumns) != 1 || result.IgnoredColumns[0] != "color" {
+		t.Errorf("expected the color column to be ignored, got %v", result.IgnoredColumns)
+	}
+
+	lamp, err := app.FindFirstRecordByData("products", "sku", "A-1")
+	if err != nil {
+		t.Fatalf("expected A-1 to be imported: %v", err)
+	}
+	if lamp.GetFloat("price") != 19.5 || !lamp.GetBool("active") || lamp.GetString("name") != "Lamp" {
+		t.Errorf("unexpected imported values: %v", lamp.PublicExport())
+	}
+	if lamp.GetDateTime("released").Time().Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("expected release date 2024-03-01, got %s", lamp.GetDateTime("released"))
+	}
+	if tags := lamp.GetStringSlice("tags"); len(tags) != 2 || tags[0] != "new" || tags[1] != "eco" {
+		t.Errorf("expected tags [new eco], got %v", tags)
+	}
+	if !strings.Contains(lamp.GetString("meta"), `"watts":40`) {
+		t.Errorf("expected meta JSON to be imported, got %s", lamp.GetString("meta"))
+	}
+
+	rows := readErrorReport(t, app, result.ErrorReportId)
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 failed rows, got %q", rows)
+	}
+	if strings.Join(rows[0][:4], ",") != "row,error,sku,name" {
+		t.Errorf("unexpected error report header %q", rows[0])
+	}
+	// Line numbers match the file, including the blank line
+	if rows[1][0] != "4" || !strings.Contains(rows[1][1], "price") || rows[1][2] != "A-2" {
+		t.Errorf("unexpected error for the invalid price: %q", rows[1])
+	}
+	if rows[2][0] != "6" || !strings.Contains(rows[2][1], "name") {
+		t.Errorf("unexpected error for the missing name: %q", rows[2])
+	}
+}
+
+func TestHandleImport_JSONUpsertByKey(t *testing.T) {
+	app := newTestApp(t)
+
+	products, _ := app.FindCollectionByNameOrId("products")
+	existing := core.NewRecord(products)
+	existing.Set("sku", "A-1")
+	existing.Set("name", "Old lamp")
+	existing.Set("price", 10)
+	if err := app.Save(existing); err != nil {
+		t.Fatalf("failed to create existing product: %v", err)
+	}
+
+	content := `[
+		{"code": "A-1", "title": "Lamp", "cost": 25, "meta": {"watts": 60}},
+		{"code": "A-2", "title": "Chair", "cost": "12.5", "tags": ["sale"]},
+		{"code": "", "title": "No key"}
+	]`
+	payload := newImportPayload(uploadImportFile(t, app, "products.json", []byte(content)), "products")
+	payload.Data.Mapping = map[string]string{"code": "sku", "title": "name", "cost": "price", "meta": "meta", "tags": "tags"}
+	payload.Data.KeyField = "sku"
+
+	result := runImport(t, app, payload)
+
+	if result.Created != 1 || result.Updated != 1 || result.Failed != 1 {
+		t.Errorf("expected 1 created, 1 updated and 1 failed row, got %+v", result)
+	}
+
+	updated, err := app.FindRecordById("products", existing.Id)
+	if err != nil {
+		t.Fatalf("failed to reload product: %v", err)
+	}
+	if updated.GetString("name") != "Lamp" || updated.GetFloat("price") != 25 {
+		t.Errorf("expected the existing product to be updated, got %v", updated.PublicExport())
+	}
+	if !strings.Contains(updated.GetString("meta"), `"watts":60`) {
+		t.Errorf("expected JSON values to be kept, got %s", updated.GetString("meta"))
+	}
+
+	chair, err := app.FindFirstRecordByData("products", "sku", "A-2")
+	if err != nil {
+		t.Fatalf("expected A-2 to be created: %v", err)
+	}
+	if chair.GetFloat("price") != 12.5 || len(chair.GetStringSlice("tags")) != 1 {
+		t.Errorf("unexpected values for A-2: %v", chair.PublicExport())
+	}
+
+	rows := readErrorReport(t, app, result.ErrorReportId)
+	if len(rows) != 2 || rows[1][0] != "3" || !strings.Contains(rows[1][1], "key field sku is empty") {
+		t.Errorf("expected the row without a key in the error report, got %q", rows)
+	}
+}
+
+func TestHandleImport_XLSXDryRun(t *testing.T) {
+	app := newTestApp(t)
+
+	var buf bytes.Buffer
+	writer, _ := xlsx.NewWriter(&buf)
+	for _, row := range [][]string{
+		{"sku", "name", "price", "released"},
+		{"B-1", "Shelf", "40", "45352"},
+		{"B-1", "Shelf v2", "45", ""},
+		{"B-2", "Stool", "-3", ""},
+	} {
+		_ = writer.WriteRow(row)
+	}
+	_ = writer.Close()
+
+	payload := newImportPayload(uploadImportFile(t, app, "products.xlsx", buf.Bytes()), "products")
+	payload.Data.KeyField = "sku"
+	payload.Options.DryRun = true
+
+	result := runImport(t, app, payload)
+
+	if !result.DryRun || result.Format != jobutils.DataProcessingFileXLSX {
+		t.Errorf("expected an xlsx dry run, got %+v", result)
+	}
+	// The repeated key counts as an update of the row created before it
+	if result.Created != 1 || result.Updated != 1 || result.Failed != 1 {
+		t.Errorf("expected 1 created, 1 updated and 1 failed row, got %+v", result)
+	}
+	if result.ErrorReportId == "" {
+		t.Error("expected a dry run to report failed rows")
+	}
+
+	total, err := app.CountRecords("products")
+	if err != nil {
+		t.Fatalf("failed to count products: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("expected a dry run not to save records, found %d", total)
+	}
+}
+
+func TestHandleImport_Errors(t *testing.T) {
+	app := newTestApp(t)
+	csvFile := uploadImportFile(t, app, "products.csv", []byte("sku,name\nA-1,Lamp\n"))
+
+	tests := []struct {
+		name    string
+		payload func() *jobutils.DataProcessingJobPayload
+		errText string
+	}{
+		{
+			name:    "missing collection",
+			payload: func() *jobutils.DataProcessingJobPayload { return newImportPayload(csvFile, "missing") },
+			errText: "not found",
+		},
+		{
+			name: "system collection",
+			payload: func() *jobutils.DataProcessingJobPayload {
+				return newImportPayload(csvFile, core.CollectionNameSuperusers)
+			},
+			errText: "cannot be imported into",
+		},
+		{
+			name:    "missing import file",
+			payload: func() *jobutils.DataProcessingJobPayload { return newImportPayload("missing", "products") },
+			errText: "import file missing not found",
+		},
+		{
+			name: "unknown mapped field",
+			payload: func() *jobutils.DataProcessingJobPayload {
+				payload := newImportPayload(csvFile, "products")
+				payload.Data.Mapping = map[string]string{"sku": "code"}
+				return payload
+			},
+			errText: `products has no field "code"`,
+		},
+		{
+			name: "unmapped key field",
+			payload: func() *jobutils.DataProcessingJobPayload {
+				payload := newImportPayload(csvFile, "products")
+				payload.Data.Mapping = map[string]string{"name": "name"}
+				payload.Data.KeyField = "sku"
+				return payload
+			},
+			errText: `key field "sku" is not mapped`,
+		},
+		{
+			name: "unsupported format",
+			payload: func() *jobutils.DataProcessingJobPayload {
+				payload := newImportPayload(csvFile, "products")
+				payload.Data.Format = "pdf"
+				return payload
+			},
+			errText: "unsupported import format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := cronutils.NewCronExecutionContext(app, "import-job")
+			_, err := HandleImport(ctx, app, "import-job", testRequesterId, tt.payload())
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("expected error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
+
+func TestValidateImportTarget_AllowedCollections(t *testing.T) {
+	app := newTestApp(t)
+
+	t.Setenv("IMPORT_ALLOWED_COLLECTIONS", "")
+	if _, err := ValidateImportTarget(app, "products", nil, ""); !errors.Is(err, ErrImportNotAllowed) {
+		t.Errorf("expected imports to be denied without an allowlist, got %v", err)
+	}
+
+	t.Setenv("IMPORT_ALLOWED_COLLECTIONS", "orders, customers")
+	if _, err := ValidateImportTarget(app, "products", nil, ""); !errors.Is(err, ErrImportNotAllowed) {
+		t.Errorf("expected products to be rejected by the allowlist, got %v", err)
+	}
+
+	t.Setenv("IMPORT_ALLOWED_COLLECTIONS", "orders,products")
+	if _, err := ValidateImportTarget(app, "products", nil, ""); err != nil {
+		t.Errorf("expected products to be allowed, got %v", err)
+	}
+}
+
+func TestValidateImportTarget_ProtectedCollectionsAndFields(t *testing.T) {
+	app := newTestApp(t)
+
+	roles := core.NewBaseCollection("roles")
+	roles.Fields.Add(&core.TextField{Name: "name"})
+	if err := app.Save(roles); err != nil {
+		t.Fatalf("failed to create roles collection: %v", err)
+	}
+
+	teams := core.NewBaseCollection("teams")
+	teams.Fields.Add(
+		&core.TextField{Name: "name"},
+		&core.PasswordField{Name: "secret"},
+		&core.RelationField{Name: "role", CollectionId: roles.Id, MaxSelect: 1},
+	)
+	if err := app.Save(teams); err != nil {
+		t.Fatalf("failed to create teams collection: %v", err)
+	}
+
+	// Listing them does not make accounts, roles and permissions importable
+	t.Setenv("IMPORT_ALLOWED_COLLECTIONS", "users,roles,permissions,teams")
+	for _, name := range []string{"users", "roles"} {
+		if _, err := ValidateImportTarget(app, name, nil, ""); !errors.Is(err, ErrImportNotAllowed) {
+			t.Errorf("expected %s to be refused, got %v", name, err)
+		}
+	}
+
+	for _, field := range []string{"secret", "role"} {
+		if _, err := ValidateImportTarget(app, "teams", map[string]string{"column": field}, ""); err == nil || !strings.Contains(err.Error(), "cannot be imported") {
+			t.Errorf("expected field %s to be refused, got %v", field, err)
+		}
+	}
+
+	// Unmapped columns named after protected fields are ignored
+	columns, ignored, err := resolveImportColumns(app, teams, []string{"name", "secret", "role"}, nil)
+	if err != nil || len(columns) != 1 || len(ignored) != 2 {
+		t.Errorf("expected only name to be imported, got %v, ignored %v (%v)", columns, ignored, err)
+	}
+}
+
+func TestHandleImport_RequesterRules(t *testing.T) {
+	app := newTestApp(t)
+
+	products, _ := app.FindCollectionByNameOrId("products")
+	products.CreateRule = types.Pointer("@request.auth.id != '' && @request.body.price < 100")
+	products.UpdateRule = nil
+	if err := app.Save(products); err != nil {
+		t.Fatalf("failed to update products rules: %v", err)
+	}
+
+	existing := core.NewRecord(products)
+	existing.Set("sku", "A-1")
+	existing.Set("name", "Lamp")
+	if err := app.Save(existing); err != nil {
+		t.Fatalf("failed to create existing product: %v", err)
+	}
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("failed to find users collection: %v", err)
+	}
+	member := core.NewRecord(users)
+	member.SetEmail("member@example.com")
+	member.SetPassword("1234567890")
+	if err := app.Save(member); err != nil {
+		t.Fatalf("failed to create member: %v", err)
+	}
+
+	content := []byte("sku,name,price\nA-1,Taken lamp,1\nB-1,Chair,20\nB-2,Sofa,500\n")
+
+	for _, dryRun := range []bool{true, false} {
+		payload := newImportPayload(uploadImportFile(t, app, "products.csv", content), "products")
+		payload.Data.KeyField = "sku"
+		payload.Options.DryRun = dryRun
+
+		ctx := cronutils.NewCronExecutionContext(app, "import-job")
+		result, err := HandleImport(ctx, app, "import-job", member.Id, payload)
+		if err != nil {
+			t.Fatalf("HandleImport returned error: %v", err)
+		}
+
+		// The update of A-1 and the create of B-2 are denied by the rules
+		if result.Created != 1 || result.Updated != 0 || result.Failed != 2 {
+			t.Errorf("dry run %v: expected 1 created and 2 denied rows, got %+v", dryRun, result)
+		}
+	}
+
+	if total, _ := app.CountRecords("products"); total != 2 {
+		t.Errorf("expected only B-1 to be created, found %d products", total)
+	}
+	if reloaded, _ := app.FindRecordById("products", existing.Id); reloaded.GetString("name") != "Lamp" {
+		t.Errorf("expected A-1 not to be updated, got %s", reloaded.GetString("name"))
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		filename string
+		expected string
+		wantErr  bool
+	}{
+		{"", "users.CSV", jobutils.DataProcessingFileCSV, false},
+		{"", "users.json", jobutils.DataProcessingFileJSON, false},
+		{"", "users.xlsx", jobutils.DataProcessingFileXLSX, false},
+		{jobutils.DataProcessingFileCSV, "users.txt", jobutils.DataProcessingFileCSV, false},
+		{"", "users.txt", "", true},
+		{"xml", "users.csv", "", true},
+	}
+
+	for _, tt := range tests {
+		format, err := DetectImportFormat(tt.format, tt.filename)
+		if (err != nil) != tt.wantErr || format != tt.expected {
+			t.Errorf("DetectImportFormat(%q, %q) = %q, %v; expected %q", tt.format, tt.filename, format, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/xlsx"
+)
+
+// utf8BOM is stripped from the start of CSV files, spreadsheet applications often add it
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// importRow is a data row of an import file. Number is the row (CSV, XLSX) or array element (JSON) number
+// used in error reports.
+type importRow struct {
+	Number int
+	Values map[string]any
+}
+
+// importTable is the parsed content of an import file
+type importTable struct {
+	Columns []string
+	Rows    []importRow
+}
+
+// readImportTable parses an import file of the given format. The first row of CSV and XLSX files holds the
+// column names and blank rows are skipped.
+func readImportTable(format string, data []byte) (*importTable, error) {
+	switch format {
+	case jobutils.DataProcessingFileCSV:
+		return readCSVTable(data)
+	case jobutils.DataProcessingFileJSON:
+		return readJSONTable(data)
+	case jobutils.DataProcessingFileXLSX:
+		rows, err := xlsx.ReadRows(data)
+		if err != nil {
+			return nil, err
+		}
+		return newTextTable(rows, func(index int) int { return index + 1 })
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+}
+
+func readCSVTable(data []byte) (*importTable, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	reader.FieldsPerRecord = -1
+
+	var rows [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, record)
+		lines = append(lines, line)
+	}
+
+	return newTextTable(rows, func(index int) int { return lines[index] })
+}
+
+// newTextTable builds a table from rows of text cells, numbering the rows with rowNumber
+func newTextTable(rows [][]string, rowNumber func(index int) int) (*importTable, error) {
+	headerIndex := -1
+	for i, row := range rows {
+		if !isBlankRow(row) {
+			headerIndex = i
+			break
+		}
+	}
+	if headerIndex < 0 {
+		return nil, errors.New("the import file is empty")
+	}
+
+	columns := make([]string, len(rows[headerIndex]))
+	seen := make(map[string]bool, len(columns))
+	for i, name := range rows[headerIndex] {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+
+	table := &importTable{}
+	for _, name := range columns {
+		if name != "" {
+			table.Columns = append(table.Columns, name)
+		}
+	}
+
+	for i := headerIndex + 1; i < len(rows); i++ {
+		if isBlankRow(rows[i]) {
+			continue
+		}
+
+		values := make(map[string]any, len(table.Columns))
+		for j, name := range columns {
+			if name == "" {
+				continue
+			}
+			if j < len(rows[i]) {
+				values[name] = rows[i][j]
+			} else {
+				values[name] = ""
+			}
+		}
+
+		table.Rows = append(table.Rows, importRow{Number: rowNumber(i), Values: values})
+	}
+
+	return table, nil
+}
+
+// readJSONTable parses an array of objects. Keys missing from an object leave the field unchanged.
+func readJSONTable(data []byte) (*importTable, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	decoder.UseNumber()
+
+	var items []map[string]any
+	if err := decoder.Decode(&items); err != nil {
+		return nil, fmt.Errorf("invalid JSON file, expected an array of objects: %w", err)
+	}
+
+	table := &importTable{Rows: make([]importRow, 0, len(items))}
+	seen := map[string]bool{}
+	for i, item := range items {
+		if item == nil {
+			return nil, fmt.Errorf("invalid JSON file: element %d is not an object", i+1)
+		}
+		for name := range item {
+			if !seen[name] {
+				seen[name] = true
+				table.Columns = append(table.Columns, name)
+			}
+		}
+		table.Rows = append(table.Rows, importRow{Number: i + 1, Values: item})
+	}
+	sort.Strings(table.Columns)
+
+	return table, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"time"
 
+	"ims-pocketbase-baas-starter/internal/handlers/aggregate"
 	"ims-pocketbase-baas-starter/internal/handlers/export"
+	"ims-pocketbase-baas-starter/internal/handlers/importer"
+	"ims-pocketbase-baas-starter/internal/handlers/transform"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
@@ -12,7 +15,19 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-// DataProcessingJobHandler handles data processing jobs (placeholder implementation)
+// DefaultDataProcessingTimeout is how long a data processing job may run when its payload sets no timeout
+const DefaultDataProcessingTimeout = 15 * time.Minute
+
+// dataProcessingTimeouts are the default timeouts of data processing operations, imports and transforms
+// write every record and take longer than exports and aggregates
+var dataProcessingTimeouts = map[string]time.Duration{
+	jobutils.DataProcessingOperationExport:    15 * time.Minute,
+	jobutils.DataProcessingOperationImport:    30 * time.Minute,
+	jobutils.DataProcessingOperationAggregate: 10 * time.Minute,
+	jobutils.DataProcessingOperationTransform: 30 * time.Minute,
+}
+
+// DataProcessingJobHandler handles data processing jobs
 type DataProcessingJobHandler struct {
 	app *pocketbase.PocketBase
 }
@@ -26,15 +41,21 @@ func NewDataProcessingJobHandler(app *pocketbase.PocketBase) *DataProcessingJobH
 
 // Handle processes a data processing job using typed payload structures
 func (h *DataProcessingJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *jobutils.JobData) error {
+	_, err := h.HandleWithResult(ctx, job)
+	return err
+}
+
+// HandleWithResult processes a data processing job and returns the operation result to store in job_results
+func (h *DataProcessingJobHandler) HandleWithResult(ctx *cronutils.CronExecutionContext, job *jobutils.JobData) (any, error) {
 	ctx.LogStart(fmt.Sprintf("Processing data processing job: %s", job.ID))
 
 	dataPayload, err := jobutils.ParseDataProcessingJobPayload(job)
 	if err != nil {
-		return fmt.Errorf("failed to parse data processing job payload: %w", err)
+		return nil, fmt.Errorf("failed to parse data processing job payload: %w", err)
 	}
 
 	if err := h.validateDataProcessingPayload(dataPayload); err != nil {
-		return fmt.Errorf("invalid data processing job payload: %w", err)
+		return nil, fmt.Errorf("invalid data processing job payload: %w", err)
 	}
 
 	log.Info("Processing data job",
@@ -48,15 +69,15 @@ func (h *DataProcessingJobHandler) Handle(ctx *cronutils.CronExecutionContext, j
 	// Handle different operation types using typed data
 	switch dataPayload.Data.Operation {
 	case jobutils.DataProcessingOperationTransform:
-		return h.handleTransformOperation(ctx, dataPayload)
+		return h.handleTransformOperation(ctx, job, dataPayload)
 	case jobutils.DataProcessingOperationAggregate:
-		return h.handleAggregateOperation(ctx, dataPayload)
+		return h.handleAggregateOperation(ctx, job, dataPayload)
 	case jobutils.DataProcessingOperationExport:
 		return h.handleExportOperation(ctx, job, dataPayload)
 	case jobutils.DataProcessingOperationImport:
-		return h.handleImportOperation(ctx, dataPayload)
+		return h.handleImportOperation(ctx, job, dataPayload)
 	default:
-		return fmt.Errorf("unsupported data processing operation: %s", dataPayload.Data.Operation)
+		return nil, fmt.Errorf("unsupported data processing operation: %s", dataPayload.Data.Operation)
 	}
 }
 
@@ -65,6 +86,19 @@ func (h *DataProcessingJobHandler) GetJobType() string {
 	return jobutils.JobTypeDataProcessing
 }
 
+// GetTimeout returns the timeout of data processing jobs whose operation has no default timeout
+func (h *DataProcessingJobHandler) GetTimeout() time.Duration {
+	return DefaultDataProcessingTimeout
+}
+
+// GetPayloadTimeout returns the default timeout of the job's operation, so scheduled jobs without
+// options.timeout are not cut off by the global job timeout
+func (h *DataProcessingJobHandler) GetPayloadTimeout(payload map[string]any) time.Duration {
+	data, _ := payload["data"].(map[string]any)
+	operation, _ := data["operation"].(string)
+	return dataProcessingTimeouts[operation]
+}
+
 // validateDataProcessingPayload validates the typed data processing job payload (additional handler-specific validation)
 func (h *DataProcessingJobHandler) validateDataProcessingPayload(payload *jobutils.DataProcessingJobPayload) error {
 	// Validate job type matches what this handler expects
@@ -97,105 +131,95 @@ func (h *DataProcessingJobHandler) validateDataProcessingPayload(payload *jobuti
 	return nil
 }
 
-// handleTransformOperation handles data transformation operations using typed payload
-func (h *DataProcessingJobHandler) handleTransformOperation(ctx *cronutils.CronExecutionContext, payload *jobutils.DataProcessingJobPayload) error {
+// handleTransformOperation runs the records of a collection (payload.Data.Source) through the transform
+// steps and saves them in a collection (payload.Data.Target)
+func (h *DataProcessingJobHandler) handleTransformOperation(ctx *cronutils.CronExecutionContext, job *jobutils.JobData, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataTransformResult, error) {
 	ctx.LogDebug(payload.Data, "Handling transform operation")
 
-	// Simulate processing time
-	time.Sleep(150 * time.Millisecond)
-
-	// Create result
-	result := &jobutils.DataProcessingResult{
-		BaseJobResultData: jobutils.BaseJobResultData{
-			Message:   "Transform operation completed successfully",
-			Timestamp: time.Now(),
-		},
-		ProcessedRecords: 100, // placeholder count
-		OutputLocation:   payload.Data.Target,
+	result, err := transform.HandleTransform(ctx, h.app, job.ID, payload)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx.LogDebug(result, "Transform operation result")
 
-	// Placeholder: In a real implementation, this would:
-	// 1. Load source data from payload.Data.Source
-	// 2. Apply transformation rules
-	// 3. Save transformed data to payload.Data.Target
-
 	log.Info("Transform operation completed", "source", payload.Data.Source, "target", payload.Data.Target)
-	return nil
+	return result, nil
 }
 
-// handleAggregateOperation handles data aggregation operations using typed payload
-func (h *DataProcessingJobHandler) handleAggregateOperation(ctx *cronutils.CronExecutionContext, payload *jobutils.DataProcessingJobPayload) error {
+// handleAggregateOperation groups the records of a collection (payload.Data.Source) and writes the aggregates
+// to a collection or an export file (payload.Data.Target)
+func (h *DataProcessingJobHandler) handleAggregateOperation(ctx *cronutils.CronExecutionContext, job *jobutils.JobData, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataAggregateResult, error) {
 	ctx.LogDebug(payload.Data, "Handling aggregate operation")
 
-	// Simulate processing time
-	time.Sleep(200 * time.Millisecond)
-
-	// Create result
-	result := &jobutils.DataProcessingResult{
-		BaseJobResultData: jobutils.BaseJobResultData{
-			Message:   "Aggregate operation completed successfully",
-			Timestamp: time.Now(),
-		},
-		ProcessedRecords: 500, // placeholder count
-		OutputLocation:   payload.Data.Target,
+	result, err := aggregate.HandleAggregate(ctx, h.app, job.ID, job.UserID, payload)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx.LogDebug(result, "Aggregate operation result")
 
-	// Placeholder: In a real implementation, this would:
-	// 1. Query source data from payload.Data.Source
-	// 2. Perform aggregation calculations
-	// 3. Store aggregated results to payload.Data.Target
-
 	log.Info("Aggregate operation completed", "source", payload.Data.Source, "target", payload.Data.Target)
-	return nil
+	return result, nil
 }
 
 // handleExportOperation handles data export operations using typed payload
-func (h *DataProcessingJobHandler) handleExportOperation(ctx *cronutils.CronExecutionContext, job *jobutils.JobData, payload *jobutils.DataProcessingJobPayload) error {
+func (h *DataProcessingJobHandler) handleExportOperation(ctx *cronutils.CronExecutionContext, job *jobutils.JobData, payload *jobutils.DataProcessingJobPayload) (*jobutils.FileExportResult, error) {
+	var result *jobutils.FileExportResult
+	var err error
 
 	switch payload.Data.Source {
 	case jobutils.DataProcessingCollectionUsers:
-		err := export.HandleUserExport(h.app, job.ID, payload)
+		result, err = export.HandleUserExport(ctx, h.app, job.ID, job.UserID, payload)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	default:
-		return fmt.Errorf("unsupported data processing source: %s", payload.Data.Source)
-
+		result, err = export.HandleCollectionExport(ctx, h.app, job.ID, job.UserID, payload)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	log.Info("Export operation completed", "source", payload.Data.Source, "target", payload.Data.Target)
 
-	return nil
+	// The file is saved, a notification that cannot be queued does not fail the export
+	if payload.Options.Notify {
+		if _, err := export.EnqueueExportNotification(h.app, job.ID, job.UserID, result, nil); err != nil {
+			log.Warn("Failed to notify export completion", "job_id", job.ID, "error", err)
+		}
+	}
+
+	return result, nil
+}
+
+// HandleFailure notifies the user that created an export with the notify option that it failed, once it
+// has no attempts left
+func (h *DataProcessingJobHandler) HandleFailure(job *jobutils.JobData, jobErr error) error {
+	payload, err := jobutils.ParseDataProcessingJobPayload(job)
+	if err != nil {
+		return err
+	}
+
+	if payload.Data.Operation != jobutils.DataProcessingOperationExport || !payload.Options.Notify {
+		return nil
+	}
+
+	_, err = export.EnqueueExportNotification(h.app, job.ID, job.UserID, nil, jobErr)
+	return err
 }
 
-// handleImportOperation handles data import operations using typed payload
-func (h *DataProcessingJobHandler) handleImportOperation(ctx *cronutils.CronExecutionContext, payload *jobutils.DataProcessingJobPayload) error {
+// handleImportOperation imports an uploaded file (payload.Data.Source) into a collection (payload.Data.Target)
+func (h *DataProcessingJobHandler) handleImportOperation(ctx *cronutils.CronExecutionContext, job *jobutils.JobData, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataImportResult, error) {
 	ctx.LogDebug(payload.Data, "Handling import operation")
 
-	// Simulate processing time
-	time.Sleep(250 * time.Millisecond)
-
-	// Create result
-	result := &jobutils.DataProcessingResult{
-		BaseJobResultData: jobutils.BaseJobResultData{
-			Message:   "Import operation completed successfully",
-			Timestamp: time.Now(),
-		},
-		ProcessedRecords: 750, // placeholder count
-		OutputLocation:   payload.Data.Target,
+	result, err := importer.HandleImport(ctx, h.app, job.ID, job.UserID, payload)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx.LogDebug(result, "Import operation result")
 
-	// Placeholder: In a real implementation, this would:
-	// 1. Read data from source at payload.Data.Source
-	// 2. Validate and clean data
-	// 3. Insert into database at payload.Data.Target
-
 	log.Info("Import operation completed", "source", payload.Data.Source, "target", payload.Data.Target)
-	return nil
+	return result, nil
 }
@@ -1,9 +1,11 @@
 package jobs
 
 import (
+	"errors"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	"testing"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 )
@@ -31,6 +33,32 @@ func TestDataProcessingJobHandler_GetJobType(t *testing.T) {
 	}
 }
 
+func TestDataProcessingJobHandler_GetTimeout(t *testing.T) {
+	registry := jobutils.NewJobRegistry()
+	if err := registry.Register(NewDataProcessingJobHandler(pocketbase.New())); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    time.Duration
+	}{
+		{"aggregate", map[string]any{"data": map[string]any{"operation": "aggregate"}}, 10 * time.Minute},
+		{"transform", map[string]any{"data": map[string]any{"operation": "transform"}}, 30 * time.Minute},
+		{"unknown operation", map[string]any{"data": map[string]any{"operation": "other"}}, DefaultDataProcessingTimeout},
+		{"payload timeout", map[string]any{"data": map[string]any{"operation": "import"}, "options": map[string]any{"timeout": float64(60)}}, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.GetTimeout(jobutils.JobTypeDataProcessing, tt.payload); got != tt.want {
+				t.Errorf("expected timeout %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestDataProcessingJobHandler_validateDataProcessingPayload(t *testing.T) {
 	app := pocketbase.New()
 	handler := NewDataProcessingJobHandler(app)
@@ -107,47 +135,75 @@ func TestDataProcessingJobHandler_Handle_InvalidPayload(t *testing.T) {
 }
 
 func TestDataProcessingJobHandler_handleTransformOperation(t *testing.T) {
-	app := pocketbase.New()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
 	handler := NewDataProcessingJobHandler(app)
 	ctx := cronutils.NewCronExecutionContext(app, "test-job")
+	job := &jobutils.JobData{ID: "test-job"}
 
 	payload := &jobutils.DataProcessingJobPayload{
 		Data: jobutils.DataProcessingJobData{
 			Operation: jobutils.DataProcessingOperationTransform,
 			Source:    "source_table",
 			Target:    "target_table",
+			Steps:     []jobutils.DataTransformStep{{Type: jobutils.DataTransformDrop, Field: "name"}},
 		},
 	}
 
-	err := handler.handleTransformOperation(ctx, payload)
-	if err != nil {
-		t.Errorf("handleTransformOperation should not return error: %v", err)
+	// Transforms read real collections, an unknown source collection fails the job
+	_, err := handler.handleTransformOperation(ctx, job, payload)
+	if err == nil {
+		t.Error("handleTransformOperation should return an error for an unknown source collection")
 	}
 }
 
 func TestDataProcessingJobHandler_handleAggregateOperation(t *testing.T) {
-	app := pocketbase.New()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
 	handler := NewDataProcessingJobHandler(app)
 	ctx := cronutils.NewCronExecutionContext(app, "test-job")
+	job := &jobutils.JobData{ID: "test-job"}
 
 	payload := &jobutils.DataProcessingJobPayload{
 		Data: jobutils.DataProcessingJobData{
-			Operation: jobutils.DataProcessingOperationAggregate,
-			Source:    "source_table",
-			Target:    "target_table",
+			Operation:  jobutils.DataProcessingOperationAggregate,
+			Source:     "source_table",
+			Target:     "target_table",
+			Aggregates: []jobutils.DataAggregate{{Function: jobutils.DataAggregateCount}},
 		},
 	}
 
-	err := handler.handleAggregateOperation(ctx, payload)
-	if err != nil {
-		t.Errorf("handleAggregateOperation should not return error: %v", err)
+	// Aggregates query real collections, an unknown source collection fails the job
+	_, err := handler.handleAggregateOperation(ctx, job, payload)
+	if err == nil {
+		t.Error("handleAggregateOperation should return an error for an unknown source collection")
 	}
 }
 
 func TestDataProcessingJobHandler_handleImportOperation(t *testing.T) {
-	app := pocketbase.New()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
 	handler := NewDataProcessingJobHandler(app)
 	ctx := cronutils.NewCronExecutionContext(app, "test-job")
+	job := &jobutils.JobData{ID: "test-job", UserID: "user1"}
 
 	payload := &jobutils.DataProcessingJobPayload{
 		Data: jobutils.DataProcessingJobData{
@@ -157,8 +213,41 @@ func TestDataProcessingJobHandler_handleImportOperation(t *testing.T) {
 		},
 	}
 
-	err := handler.handleImportOperation(ctx, payload)
-	if err != nil {
-		t.Errorf("handleImportOperation should not return error: %v", err)
+	// Imports read real files into real collections, an unknown target collection fails the job
+	_, err := handler.handleImportOperation(ctx, job, payload)
+	if err == nil {
+		t.Error("handleImportOperation should return an error for an unknown target collection")
+	}
+}
+
+func TestDataProcessingJobHandler_HandleFailure(t *testing.T) {
+	app := pocketbase.New()
+	handler := NewDataProcessingJobHandler(app)
+
+	var _ jobutils.JobFailureHandler = handler
+
+	newJob := func(operation string, notify bool) *jobutils.JobData {
+		return &jobutils.JobData{
+			ID:   "test-job",
+			Type: jobutils.JobTypeDataProcessing,
+			Payload: map[string]any{
+				"type":    jobutils.JobTypeDataProcessing,
+				"data":    map[string]any{"operation": operation, "source": "users"},
+				"options": map[string]any{"notify": notify},
+			},
+		}
+	}
+
+	// Nothing is sent without the notify option or for other operations
+	if err := handler.HandleFailure(newJob(jobutils.DataProcessingOperationExport, false), errors.New("boom")); err != nil {
+		t.Errorf("expected exports without notify to be ignored, got %v", err)
+	}
+	if err := handler.HandleFailure(newJob(jobutils.DataProcessingOperationImport, true), errors.New("boom")); err != nil {
+		t.Errorf("expected imports to be ignored, got %v", err)
+	}
+
+	// Exports without a user have no one to notify
+	if err := handler.HandleFailure(newJob(jobutils.DataProcessingOperationExport, true), errors.New("boom")); err == nil {
+		t.Error("expected an error for an export without a user")
 	}
 }
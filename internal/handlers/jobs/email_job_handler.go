@@ -1,42 +1,52 @@
 package jobs
 
 import (
-	"bytes"
 	"fmt"
-	"html/template"
 	"net/mail"
 	"os"
-	"path/filepath"
+	"time"
 
 	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/emailtemplate"
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 	"ims-pocketbase-baas-starter/pkg/metrics"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/tools/mailer"
 )
 
 // EmailJobHandler handles email job processing
 type EmailJobHandler struct {
-	app *pocketbase.PocketBase
+	app       *pocketbase.PocketBase
+	templates *emailtemplate.Engine
 }
 
-// NewEmailJobHandler creates a new email job handler
+// NewEmailJobHandler creates a new email job handler rendering the templates of the email template engine
 func NewEmailJobHandler(app *pocketbase.PocketBase) *EmailJobHandler {
 	return &EmailJobHandler{
-		app: app,
+		app:       app,
+		templates: emailtemplate.GetInstance(),
 	}
 }
 
 // Handle processes an email job using typed payload structures (with metrics instrumentation)
 func (h *EmailJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *jobutils.JobData) error {
+	_, err := h.HandleWithResult(ctx, job)
+	return err
+}
+
+// HandleWithResult processes an email job and returns the delivery result to store in job_results
+func (h *EmailJobHandler) HandleWithResult(ctx *cronutils.CronExecutionContext, job *jobutils.JobData) (any, error) {
 	ctx.LogStart(fmt.Sprintf("Processing email job: %s", job.ID))
 
 	metricsProvider := metrics.GetInstance()
 
+	var result *jobutils.EmailResult
+
 	// Instrument the job handler execution with metrics collection
-	return metrics.InstrumentJobHandler(metricsProvider, "email_job", func() error {
+	err := metrics.InstrumentJobHandler(metricsProvider, "email_job", func() error {
 		emailPayload, err := jobutils.ParseEmailJobPayload(job)
 		if err != nil {
 			return fmt.Errorf("failed to parse email job payload: %w", err)
@@ -55,9 +65,24 @@ func (h *EmailJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *jobut
 			return fmt.Errorf("failed to send email: %w", err)
 		}
 
+		deliveredAt := time.Now()
+		result = &jobutils.EmailResult{
+			BaseJobResultData: jobutils.BaseJobResultData{
+				Message:   "Email sent successfully",
+				Timestamp: deliveredAt,
+			},
+			DeliveredAt: &deliveredAt,
+			Recipients:  []string{emailPayload.Data.To},
+		}
+
 		ctx.LogEnd("Email job processed successfully")
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
 // GetJobType returns the job type this handler processes
@@ -76,45 +101,34 @@ func (h *EmailJobHandler) validateEmailPayload(payload *jobutils.EmailJobPayload
 	return nil
 }
 
-// processEmailTemplates processes both HTML and text email templates with variables
+// processEmailTemplates renders the HTML and text templates of an email with its variables, in the variant
+// of the recipient's locale
 func (h *EmailJobHandler) processEmailTemplates(payload *jobutils.EmailJobPayload) (string, string, error) {
 	if payload.Data.Template == "" {
 		log.Warn("No template specified, using empty content")
 		return "", "", nil
 	}
 
-	htmlContent, err := h.processSingleTemplate(payload, ".html")
-	if err != nil {
-		log.Warn("Failed to process HTML template", "error", err)
-	}
-
-	textContent, err := h.processSingleTemplate(payload, ".txt")
-	if err != nil {
-		log.Warn("Failed to process text template", "error", err)
-	}
-
-	return htmlContent, textContent, nil
+	return h.templates.Render(payload.Data.Template, h.resolveLocale(payload), payload.Data.Variables)
 }
 
-// processSingleTemplate processes a single email template with variables
-func (h *EmailJobHandler) processSingleTemplate(payload *jobutils.EmailJobPayload, extension string) (string, error) {
-	templatePath := filepath.Join("templates", "emails", payload.Data.Template+extension)
-
-	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("template file not found: %s", templatePath)
+// resolveLocale returns the locale of an email: the locale of the payload, else the language setting of the
+// recipient when it is a user, else empty for the default locale
+func (h *EmailJobHandler) resolveLocale(payload *jobutils.EmailJobPayload) string {
+	if payload.Data.Locale != "" {
+		return payload.Data.Locale
 	}
 
-	tmpl, err := template.ParseFiles(templatePath)
+	user, err := h.app.FindAuthRecordByEmail(jobutils.DataProcessingCollectionUsers, payload.Data.To)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+		return ""
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, payload.Data.Variables); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
+	setting, err := h.app.FindFirstRecordByFilter("user_settings", "user = {:user} && settings.slug = 'language'", dbx.Params{"user": user.Id})
+	if err != nil {
+		return ""
 	}
-
-	return buf.String(), nil
+	return setting.GetString("value")
 }
 
 // sendEmail sends the email using PocketBase mailer
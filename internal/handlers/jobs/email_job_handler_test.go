@@ -1,9 +1,12 @@
 package jobs
 
 import (
+	"errors"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/emailtemplate"
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	"ims-pocketbase-baas-starter/pkg/metrics"
+	"strings"
 	"testing"
 
 	"github.com/pocketbase/pocketbase"
@@ -86,22 +89,95 @@ func TestEmailJobHandler_Handle_InvalidPayload(t *testing.T) {
 	}
 }
 
-func TestEmailJobHandler_processSingleTemplate_FileNotFound(t *testing.T) {
+func TestEmailJobHandler_processEmailTemplates_NotFound(t *testing.T) {
 	app := pocketbase.New()
 	handler := NewEmailJobHandler(app)
 
 	payload := &jobutils.EmailJobPayload{
 		Data: jobutils.EmailJobData{
 			Template: "nonexistent_template",
+			Locale:   "en",
 		},
 	}
 
-	content, err := handler.processSingleTemplate(payload, ".html")
-	if err == nil {
-		t.Error("processSingleTemplate should return error for nonexistent template")
+	htmlContent, textContent, err := handler.processEmailTemplates(payload)
+	if !errors.Is(err, emailtemplate.ErrNotFound) {
+		t.Errorf("processEmailTemplates should return ErrNotFound for nonexistent template, got %v", err)
+	}
+
+	if htmlContent != "" || textContent != "" {
+		t.Error("processEmailTemplates should return empty content on error")
+	}
+}
+
+func TestEmailJobHandler_processEmailTemplates_Locale(t *testing.T) {
+	app := pocketbase.New()
+	handler := NewEmailJobHandler(app)
+
+	payload := &jobutils.EmailJobPayload{
+		Data: jobutils.EmailJobData{
+			Template:  "welcome",
+			Locale:    "fr_CA",
+			Variables: map[string]any{"AppName": "IMS", "Name": "Ada", "Year": 2025},
+		},
+	}
+
+	htmlContent, textContent, err := handler.processEmailTemplates(payload)
+	if err != nil {
+		t.Fatalf("processEmailTemplates returned error: %v", err)
+	}
+	if !strings.Contains(htmlContent, `<html lang="fr">`) || !strings.Contains(textContent, "Bonjour Ada") {
+		t.Errorf("expected the French welcome email, got %q", textContent)
+	}
+
+	payload.Data.Locale = "de"
+	htmlContent, _, err = handler.processEmailTemplates(payload)
+	if err != nil || !strings.Contains(htmlContent, `<html lang="en">`) {
+		t.Errorf("expected locales without variant to fall back to the default template, got %v", err)
+	}
+}
+
+func TestEmailJobHandler_processEmailTemplates_ExportReady(t *testing.T) {
+	app := pocketbase.New()
+	handler := NewEmailJobHandler(app)
+
+	downloadURL := "https://bucket.s3.example.com/exports/users.csv?X-Amz-Expires=86400&X-Amz-Signature=abc"
+	payload := &jobutils.EmailJobPayload{
+		Data: jobutils.EmailJobData{
+			Template: "export_ready",
+			Locale:   "en",
+			Variables: map[string]any{
+				"AppName":     "IMS",
+				"Name":        "Ada",
+				"JobID":       "job123",
+				"Failed":      false,
+				"FileName":    "users.csv",
+				"RecordCount": 42,
+				"DownloadURL": downloadURL,
+				"ExpiresAt":   "2025-01-02 15:04 UTC",
+			},
+		},
+	}
+
+	htmlContent, textContent, err := handler.processEmailTemplates(payload)
+	if err != nil {
+		t.Fatalf("processEmailTemplates returned error: %v", err)
+	}
+
+	for _, want := range []string{"42", "users.csv", "2025-01-02 15:04 UTC", strings.ReplaceAll(downloadURL, "&", "&amp;")} {
+		if !strings.Contains(htmlContent, want) {
+			t.Errorf("expected the HTML email to contain %q", want)
+		}
+	}
+	// The text email is not HTML escaped, so its link can be followed as is
+	if !strings.Contains(textContent, downloadURL) || strings.Contains(textContent, "Your export failed") {
+		t.Errorf("expected the text email to contain the download link, got %q", textContent)
 	}
 
-	if content != "" {
-		t.Error("processSingleTemplate should return empty content on error")
+	payload.Data.Variables["Failed"] = true
+	payload.Data.Variables["Error"] = "collection not found"
+	htmlContent, _, _ = handler.processEmailTemplates(payload)
+	if !strings.Contains(htmlContent, "Your export failed") || !strings.Contains(htmlContent, "collection not found") || strings.Contains(htmlContent, "X-Amz") {
+		t.Errorf("expected the failure email, got %q", htmlContent)
 	}
 }
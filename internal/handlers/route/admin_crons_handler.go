@@ -0,0 +1,58 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ims-pocketbase-baas-starter/internal/crons"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleListCrons returns the defined crons with their next fire time, optional upcoming fire times and last run
+func HandleListCrons(e *core.RequestEvent) error {
+	upcoming := 0
+	if value := e.Request.URL.Query().Get("upcoming"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > cronutils.MaxUpcomingRuns {
+			return response.ValidationError(e, "Invalid upcoming", map[string]any{
+				"upcoming": fmt.Sprintf("must be an integer between 0 and %d", cronutils.MaxUpcomingRuns),
+			})
+		}
+		upcoming = parsed
+	}
+
+	return response.OK(e, "Crons", map[string]any{
+		"items": crons.ListCrons(e.App, upcoming),
+	})
+}
+
+// HandleTriggerCron starts a manual run of a cron in the background
+func HandleTriggerCron(e *core.RequestEvent) error {
+	cronId := e.Request.PathValue("id")
+	if cronId == "" {
+		return response.ValidationError(e, "Cron ID is required", nil)
+	}
+
+	run, err := crons.TriggerCron(e.App, cronId)
+	switch {
+	case errors.Is(err, crons.ErrCronNotFound):
+		return response.NotFound(e, "Cron not found")
+	case errors.Is(err, crons.ErrCronDisabled):
+		return response.Error(e, http.StatusConflict, "Cron is disabled", nil)
+	case errors.Is(err, cronutils.ErrCronRunning):
+		return response.Error(e, http.StatusConflict, "Cron is already running", nil)
+	case err != nil:
+		return response.InternalServerError(e, "Failed to trigger cron", nil)
+	}
+
+	return response.Success(e, http.StatusAccepted, "Cron run started", map[string]any{
+		"cron_id": cronId,
+		"run_id":  run.Id,
+		"status":  cronutils.CronRunStatusRunning,
+	})
+}
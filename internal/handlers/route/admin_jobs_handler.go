@@ -0,0 +1,211 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/response"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleListJobs returns a paginated list of queued, processing and finished jobs filtered by type, status and attempts
+func HandleListJobs(e *core.RequestEvent) error {
+	page, perPage := parsePagination(e)
+	query := e.Request.URL.Query()
+
+	filter := jobutils.JobListFilter{
+		Type:   query.Get("type"),
+		Status: query.Get("status"),
+	}
+	if minAttempts := query.Get("minAttempts"); minAttempts != "" {
+		parsed, err := strconv.Atoi(minAttempts)
+		if err != nil || parsed < 0 {
+			return response.ValidationError(e, "Invalid minAttempts", map[string]any{
+				"minAttempts": "must be a non-negative integer",
+			})
+		}
+		filter.MinAttempts = parsed
+	}
+
+	jobs, total, err := jobutils.ListJobs(e.App, filter, perPage, (page-1)*perPage)
+	if errors.Is(err, jobutils.ErrInvalidJobStatus) {
+		return response.ValidationError(e, "Invalid job status", map[string]any{
+			"status": jobutils.JobStatuses,
+		})
+	}
+	if err != nil {
+		return response.InternalServerError(e, "Failed to list jobs", nil)
+	}
+
+	return response.OK(e, "Jobs", map[string]any{
+		"page":       page,
+		"perPage":    perPage,
+		"totalItems": total,
+		"items":      jobs,
+	})
+}
+
+// HandleGetJob returns the payload, errors and attempt history of a job wherever it currently lives
+func HandleGetJob(e *core.RequestEvent) error {
+	jobId := e.Request.PathValue("id")
+	if jobId == "" {
+		return response.ValidationError(e, "Job ID is required", nil)
+	}
+
+	data, found := getJobDetails(e.App, jobId)
+	if !found {
+		return response.NotFound(e, "Job not found")
+	}
+
+	return response.OK(e, "Job details", data)
+}
+
+// HandleCancelJob removes a queued job before a worker picks it up
+func HandleCancelJob(e *core.RequestEvent) error {
+	jobId := e.Request.PathValue("id")
+	if jobId == "" {
+		return response.ValidationError(e, "Job ID is required", nil)
+	}
+
+	if _, err := e.App.FindRecordById(jobutils.QueuesCollection, jobId); err != nil {
+		return response.NotFound(e, "Queued job not found")
+	}
+
+	err := jobutils.CancelJob(e.App, jobId)
+	if errors.Is(err, jobutils.ErrJobProcessing) {
+		return response.Error(e, http.StatusConflict, "Job is being processed and cannot be cancelled", nil)
+	}
+	if err != nil {
+		return response.InternalServerError(e, "Failed to cancel job", nil)
+	}
+
+	return response.OK(e, "Job cancelled successfully", map[string]any{
+		"job_id": jobId,
+		"status": jobutils.JobStatusCancelled,
+	})
+}
+
+// HandleForceRetryJob runs a queued job waiting for its backoff immediately or re-queues a dead-lettered job
+func HandleForceRetryJob(e *core.RequestEvent) error {
+	jobId := e.Request.PathValue("id")
+	if jobId == "" {
+		return response.ValidationError(e, "Job ID is required", nil)
+	}
+
+	job, err := jobutils.ForceRetryJob(e.App, jobId)
+	switch {
+	case errors.Is(err, jobutils.ErrJobProcessing):
+		return response.Error(e, http.StatusConflict, "Job is already being processed", nil)
+	case errors.Is(err, jobutils.ErrJobNotRetryable):
+		return response.NotFound(e, "No queued or dead-lettered job found")
+	case err != nil:
+		return response.InternalServerError(e, "Failed to retry job", nil)
+	}
+
+	return response.OK(e, "Job queued for retry", map[string]any{
+		"job_id": job.Id,
+		"status": jobutils.JobStatusQueued,
+	})
+}
+
+// HandlePurgeJobs bulk-removes jobs of a status, optionally filtered by type and an RFC 3339 "before" time
+func HandlePurgeJobs(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	filter := jobutils.JobPurgeFilter{
+		Status: query.Get("status"),
+		Type:   query.Get("type"),
+	}
+	if before := query.Get("before"); before != "" {
+		parsed, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return response.ValidationError(e, "Invalid before", map[string]any{
+				"before": "must be an RFC 3339 timestamp",
+			})
+		}
+		filter.Before = parsed
+	}
+
+	purged, err := jobutils.PurgeJobs(e.App, filter)
+	if errors.Is(err, jobutils.ErrInvalidJobStatus) {
+		return response.ValidationError(e, "Invalid job status", map[string]any{
+			"status": []string{jobutils.JobStatusQueued, jobutils.JobStatusCompleted, jobutils.JobStatusFailed, jobutils.JobStatusCancelled},
+		})
+	}
+	if err != nil {
+		return response.InternalServerError(e, "Failed to purge jobs", map[string]any{
+			"purged": purged,
+		})
+	}
+
+	return response.OK(e, "Jobs purged successfully", map[string]any{
+		"purged": purged,
+	})
+}
+
+// getJobDetails collects a job's queue record, stored result and dead-letter entry
+func getJobDetails(app core.App, jobId string) (map[string]any, bool) {
+	data := map[string]any{
+		"id": jobId,
+	}
+
+	job, err := app.FindRecordById(jobutils.QueuesCollection, jobId)
+	if err == nil {
+		status := jobutils.JobStatusQueued
+		if !job.GetDateTime("reserved_at").IsZero() {
+			status = jobutils.JobStatusProcessing
+		}
+
+		data["status"] = status
+		data["name"] = job.GetString("name")
+		data["description"] = job.GetString("description")
+		data["queue"] = jobutils.NormalizeQueueName(job.GetString("queue"))
+		data["priority"] = job.GetInt("priority")
+		data["payload"] = jobutils.RedactPayloadSecrets(job.Get("payload"))
+		data["attempts"] = job.GetInt("attempts")
+		data["last_error"] = job.GetString("last_error")
+		data["attempt_history"] = jobutils.GetAttemptHistory(job)
+		data["reserved_at"] = job.GetDateTime("reserved_at")
+		data["reserved_by"] = job.GetString("reserved_by")
+		data["available_at"] = job.GetDateTime("available_at")
+		data["progress"] = jobutils.GetJobProgress(job)
+		data["unique_key"] = job.GetString("unique_key")
+		data["user_id"] = job.GetString("user_id")
+		data["chain"] = jobutils.GetJobChain(job)
+		data["created"] = job.GetDateTime("created")
+		addJobBatch(app, data, job.GetString("batch_id"))
+		return data, true
+	}
+
+	found := false
+
+	jobResult, err := app.FindFirstRecordByFilter(jobutils.JobResultsCollection, "job_id = {:job_id}", dbx.Params{"job_id": jobId})
+	if err == nil {
+		found = true
+		data["status"] = jobResult.GetString("status")
+		data["name"] = jobResult.GetString("name")
+		data["job_type"] = jobResult.GetString("job_type")
+		data["queue"] = jobResult.GetString("queue")
+		data["result"] = jobResult.Get("result")
+		data["error"] = jobResult.GetString("error")
+		data["attempts"] = jobResult.GetInt("attempts")
+		data["duration_ms"] = jobResult.GetInt("duration_ms")
+		data["finished_at"] = jobResult.GetDateTime("finished_at")
+		data["user_id"] = jobResult.GetString("user_id")
+		addJobBatch(app, data, jobResult.GetString("batch_id"))
+	}
+
+	failedJob, err := app.FindFirstRecordByFilter(jobutils.FailedJobsCollection, "queue_id = {:job_id}", dbx.Params{"job_id": jobId})
+	if err == nil {
+		found = true
+		data["status"] = jobutils.JobStatusFailed
+		data["failed_job"] = failedJobToMap(failedJob)
+	}
+
+	return data, found
+}
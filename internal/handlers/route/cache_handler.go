@@ -2,6 +2,7 @@ package route
 
 import (
 	"ims-pocketbase-baas-starter/pkg/cache"
+	"ims-pocketbase-baas-starter/pkg/emailtemplate"
 	"ims-pocketbase-baas-starter/pkg/response"
 	"time"
 
@@ -28,3 +29,19 @@ func HandleCacheClear(e *core.RequestEvent) error {
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
+
+// HandleEmailTemplatesReload validates the email templates and drops the parsed ones, so edited override files
+// are used by the next emails. Invalid templates are reported and the cached templates are kept.
+func HandleEmailTemplatesReload(e *core.RequestEvent) error {
+	engine := emailtemplate.GetInstance()
+	if err := engine.Validate(); err != nil {
+		return response.ValidationError(e, "Email templates are invalid, the cached templates are kept", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return response.OK(e, "Email templates reloaded successfully", map[string]any{
+		"invalidated": engine.Invalidate(),
+		"timestamp":   time.Now().Format(time.RFC3339),
+	})
+}
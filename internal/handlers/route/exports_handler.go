@@ -0,0 +1,118 @@
+package route
+
+import (
+	"errors"
+
+	"ims-pocketbase-baas-starter/internal/handlers/export"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// collectionExportRequest is the body of a collection export request
+type collectionExportRequest struct {
+	Collection string   `json:"collection" form:"collection"`
+	Format     string   `json:"format" form:"format"`
+	Filter     string   `json:"filter" form:"filter"`
+	Fields     []string `json:"fields" form:"fields"`
+	Expand     []string `json:"expand" form:"expand"`
+	Sort       string   `json:"sort" form:"sort"`
+	exportFileRequest
+}
+
+// exportFileRequest are the file and notification options of export requests
+type exportFileRequest struct {
+	Compression string `json:"compression" form:"compression"`
+	Encryption  string `json:"encryption" form:"encryption"`
+	Passphrase  string `json:"passphrase" form:"passphrase"`
+	Notify      bool   `json:"notify" form:"notify"`
+}
+
+// options validates the compression and encryption options and seals their passphrase, or the key generated
+// for encryption without a passphrase, so neither is stored in clear in the job payload
+func (r exportFileRequest) options(app core.App) (jobutils.ExportFileOptions, error) {
+	return jobutils.SealExportFileOptions(app, jobutils.ExportFileOptions{
+		Compression: r.Compression,
+		Encryption:  r.Encryption,
+		Passphrase:  r.Passphrase,
+	})
+}
+
+// addEncryptionKey adds the generated key of an export to the response data, the only place it is returned
+func addEncryptionKey(data map[string]any, opts jobutils.ExportFileOptions) map[string]any {
+	if opts.Key != "" {
+		data["encryption_key"] = opts.Key
+	}
+	return data
+}
+
+// HandleCollectionExport queues an export of the records of a collection that the requester can list
+func HandleCollectionExport(e *core.RequestEvent) error {
+	var body collectionExportRequest
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e, "Invalid export request body", nil)
+	}
+
+	if body.Collection == "" {
+		return response.ValidationError(e, "Collection is required", nil)
+	}
+	if body.Format == "" {
+		body.Format = jobutils.DataProcessingFileCSV
+	}
+
+	fileOptions, err := body.options(e.App)
+	if err != nil {
+		return response.ValidationError(e, err.Error(), nil)
+	}
+
+	payload := jobutils.DataProcessingJobPayload{
+		Type: jobutils.JobTypeDataProcessing,
+		Data: jobutils.DataProcessingJobData{
+			Operation: jobutils.DataProcessingOperationExport,
+			Source:    body.Collection,
+			Target:    body.Format,
+			Format:    body.Format,
+			Filter:    body.Filter,
+			Fields:    body.Fields,
+			Expand:    body.Expand,
+			Sort:      body.Sort,
+		},
+		Options: jobutils.DataProcessingJobOptions{
+			Timeout:           900, // 15 minutes
+			Notify:            body.Notify,
+			ExportFileOptions: fileOptions,
+		},
+	}
+
+	// The export runs with the requester's access, checking it now reports mistakes before the job is queued
+	if err := export.ValidateCollectionExport(e.App, e.Auth, payload.Data); err != nil {
+		if errors.Is(err, export.ErrExportForbidden) {
+			return response.Forbidden(e, err.Error())
+		}
+		return response.ValidationError(e, err.Error(), nil)
+	}
+
+	userId := ""
+	if e.Auth != nil {
+		userId = e.Auth.Id
+	}
+
+	job, _, err := jobutils.Enqueue(e.App, payload, jobutils.EnqueueOptions{
+		Name:        "Collection Export",
+		Description: "Export " + body.Collection + " to " + body.Format,
+		Queue:       jobutils.QueueExports,
+		Priority:    jobutils.JobPriorityNormal,
+		UserID:      userId,
+	})
+	if err != nil {
+		return response.InternalServerError(e, "Failed to queue export job", nil)
+	}
+
+	return response.OK(e, "Export job queued successfully", addEncryptionKey(map[string]any{
+		"job_id":     job.Id,
+		"collection": body.Collection,
+		"format":     body.Format,
+		"status":     "queued",
+	}, fileOptions))
+}
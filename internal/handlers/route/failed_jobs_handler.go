@@ -0,0 +1,143 @@
+package route
+
+import (
+	"strconv"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 500
+)
+
+// HandleListFailedJobs returns a paginated list of dead-lettered jobs
+func HandleListFailedJobs(e *core.RequestEvent) error {
+	page, perPage := parsePagination(e)
+	jobType := e.Request.URL.Query().Get("type")
+
+	records, total, err := jobutils.ListFailedJobs(e.App, jobType, perPage, (page-1)*perPage)
+	if err != nil {
+		return response.InternalServerError(e, "Failed to list failed jobs", nil)
+	}
+
+	items := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		items = append(items, failedJobToMap(record))
+	}
+
+	return response.OK(e, "Failed jobs", map[string]any{
+		"page":       page,
+		"perPage":    perPage,
+		"totalItems": total,
+		"items":      items,
+	})
+}
+
+// HandleRetryFailedJob re-queues a single dead-lettered job
+func HandleRetryFailedJob(e *core.RequestEvent) error {
+	failedJobId := e.Request.PathValue("id")
+	if failedJobId == "" {
+		return response.ValidationError(e, "Failed job ID is required", nil)
+	}
+
+	if _, err := e.App.FindRecordById(jobutils.FailedJobsCollection, failedJobId); err != nil {
+		return response.NotFound(e, "Failed job not found")
+	}
+
+	job, err := jobutils.RetryFailedJob(e.App, failedJobId)
+	if err != nil {
+		return response.InternalServerError(e, "Failed to retry job", nil)
+	}
+
+	return response.OK(e, "Failed job re-queued successfully", map[string]any{
+		"failed_job_id": failedJobId,
+		"job_id":        job.Id,
+		"status":        jobutils.JobStatusQueued,
+	})
+}
+
+// HandleRetryFailedJobs re-queues all dead-lettered jobs, optionally filtered by type
+func HandleRetryFailedJobs(e *core.RequestEvent) error {
+	jobType := e.Request.URL.Query().Get("type")
+
+	retried, err := jobutils.RetryFailedJobs(e.App, jobType)
+	if err != nil {
+		return response.InternalServerError(e, "Failed to retry jobs", map[string]any{
+			"retried": retried,
+		})
+	}
+
+	return response.OK(e, "Failed jobs re-queued successfully", map[string]any{
+		"retried": retried,
+	})
+}
+
+// HandleDeleteFailedJob permanently removes a single dead-lettered job
+func HandleDeleteFailedJob(e *core.RequestEvent) error {
+	failedJobId := e.Request.PathValue("id")
+	if failedJobId == "" {
+		return response.ValidationError(e, "Failed job ID is required", nil)
+	}
+
+	if err := jobutils.DeleteFailedJob(e.App, failedJobId); err != nil {
+		return response.NotFound(e, "Failed job not found")
+	}
+
+	return response.OK(e, "Failed job deleted successfully", map[string]any{
+		"failed_job_id": failedJobId,
+	})
+}
+
+// HandlePurgeFailedJobs permanently removes all dead-lettered jobs, optionally filtered by type
+func HandlePurgeFailedJobs(e *core.RequestEvent) error {
+	jobType := e.Request.URL.Query().Get("type")
+
+	purged, err := jobutils.PurgeFailedJobs(e.App, jobType)
+	if err != nil {
+		return response.InternalServerError(e, "Failed to purge failed jobs", nil)
+	}
+
+	return response.OK(e, "Failed jobs purged successfully", map[string]any{
+		"purged": purged,
+	})
+}
+
+func failedJobToMap(record *core.Record) map[string]any {
+	return map[string]any{
+		"id":              record.Id,
+		"queue_id":        record.GetString("queue_id"),
+		"name":            record.GetString("name"),
+		"description":     record.GetString("description"),
+		"job_type":        record.GetString("job_type"),
+		"payload":         jobutils.RedactPayloadSecrets(record.Get("payload")),
+		"attempts":        int(record.GetFloat("attempts")),
+		"error":           record.GetString("error"),
+		"stack":           record.GetString("stack"),
+		"attempt_history": jobutils.GetAttemptHistory(record),
+		"failed_at":       record.GetDateTime("failed_at"),
+	}
+}
+
+// parsePagination reads the page and perPage query params with sane defaults and bounds
+func parsePagination(e *core.RequestEvent) (int, int) {
+	query := e.Request.URL.Query()
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err := strconv.Atoi(query.Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	return page, perPage
+}
@@ -0,0 +1,94 @@
+package route
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"ims-pocketbase-baas-starter/internal/handlers/importer"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	"ims-pocketbase-baas-starter/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleImport stores an uploaded CSV, JSON or XLSX file and queues a job importing it into a collection
+func HandleImport(e *core.RequestEvent) error {
+	collectionName := e.Request.FormValue("collection")
+	keyField := e.Request.FormValue("key_field")
+
+	var mapping map[string]string
+	if raw := e.Request.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return response.ValidationError(e, "Invalid mapping, expected a JSON object of column to field names", nil)
+		}
+	}
+
+	dryRun := false
+	if raw := e.Request.FormValue("dry_run"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return response.ValidationError(e, "Invalid dry_run value", nil)
+		}
+		dryRun = parsed
+	}
+
+	// Check the target before storing the file so invalid requests fail right away
+	collection, err := importer.ValidateImportTarget(e.App, collectionName, mapping, keyField)
+	if err != nil {
+		return response.ValidationError(e, err.Error(), nil)
+	}
+
+	files, err := e.FindUploadedFiles("file")
+	if err != nil || len(files) == 0 {
+		return response.ValidationError(e, "An import file is required", nil)
+	}
+
+	format, err := importer.DetectImportFormat(e.Request.FormValue("format"), files[0].OriginalName)
+	if err != nil {
+		return response.ValidationError(e, err.Error(), nil)
+	}
+
+	userId := ""
+	if e.Auth != nil {
+		userId = e.Auth.Id
+	}
+
+	importFile, err := jobutils.SaveImportFile(e.App, userId, files[0])
+	if err != nil {
+		return response.InternalServerError(e, "Failed to store import file", nil)
+	}
+
+	payload := jobutils.DataProcessingJobPayload{
+		Type: jobutils.JobTypeDataProcessing,
+		Data: jobutils.DataProcessingJobData{
+			Operation: jobutils.DataProcessingOperationImport,
+			Source:    importFile.Id,
+			Target:    collection.Name,
+			Format:    format,
+			Mapping:   mapping,
+			KeyField:  keyField,
+		},
+		Options: jobutils.DataProcessingJobOptions{
+			Timeout: 900, // 15 minutes
+			DryRun:  dryRun,
+		},
+	}
+
+	job, _, err := jobutils.Enqueue(e.App, payload, jobutils.EnqueueOptions{
+		Name:        "Data Import",
+		Description: "Import " + format + " file into " + collection.Name,
+		Priority:    jobutils.JobPriorityNormal,
+		UserID:      userId,
+	})
+	if err != nil {
+		return response.InternalServerError(e, "Failed to queue import job", nil)
+	}
+
+	return response.OK(e, "Import job queued successfully", map[string]any{
+		"job_id":         job.Id,
+		"import_file_id": importFile.Id,
+		"collection":     collection.Name,
+		"dry_run":        dryRun,
+		"status":         "queued",
+	})
+}
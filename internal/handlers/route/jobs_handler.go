@@ -1,63 +1,198 @@
 package route
 
 import (
+	"errors"
+	"net/http"
+
+	"ims-pocketbase-baas-starter/internal/middlewares"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
 	"ims-pocketbase-baas-starter/pkg/response"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// jobPermissions checks access to jobs created by other users
+var jobPermissions = middlewares.NewPermissionMiddleware()
+
 func HandleGetJobStatus(e *core.RequestEvent) error {
 	jobId := e.Request.PathValue("id")
 	if jobId == "" {
 		return response.ValidationError(e, "Job ID is required", nil)
 	}
 
-	status := getJobStatus(e.App, jobId)
-
-	data := map[string]any{
-		"job_id": jobId,
-		"status": status,
+	// Jobs of other users are reported as missing so their IDs cannot be probed
+	data, ownerId, found := getJobStatus(e.App, jobId)
+	if !found || !canAccessJob(e, ownerId) {
+		return response.NotFound(e, "Job not found")
 	}
 
 	return response.OK(e, "Job status", data)
 }
 
-func HandleDownloadJobFile(e *core.RequestEvent) error {
+// HandleCreateJobDownloadLink returns a short-lived signed link to the export file of a job
+func HandleCreateJobDownloadLink(e *core.RequestEvent) error {
 	jobId := e.Request.PathValue("id")
 	if jobId == "" {
 		return response.ValidationError(e, "Job ID is required", nil)
 	}
 
+	exportRecord, err := getJobFileRecord(e.App, jobId)
+	if err != nil || !canAccessJob(e, exportRecord.GetString("user_id")) {
+		return response.NotFound(e, "Export file not found")
+	}
+
+	// Files in S3 are downloaded from a presigned URL, the other files through a signed download token
+	downloadURL, expiresAt, err := jobutils.ExportFileDownloadURL(e.App, exportRecord, jobutils.GetDownloadTokenTTL())
+	if err != nil {
+		return response.InternalServerError(e, "Failed to create download link", nil)
+	}
+
+	return response.OK(e, "Download link created", map[string]any{
+		"job_id":     jobId,
+		"url":        downloadURL,
+		"expires_at": expiresAt.UTC(),
+		"checksum":   exportRecord.GetString("checksum"),
+	})
+}
+
+// HandleDownloadJobFile serves the export file of a job to anyone holding a valid download token, once its
+// content matches the stored checksum. Files of storages that sign URLs are redirected to a presigned URL
+// instead of going through the app.
+func HandleDownloadJobFile(e *core.RequestEvent) error {
+	token := e.Request.URL.Query().Get("token")
+	if token == "" {
+		return response.ValidationError(e, "Download token is required", nil)
+	}
+
+	jobId, err := jobutils.ParseJobDownloadToken(e.App, token)
+	if err != nil {
+		return response.Unauthorized(e, "Invalid or expired download token")
+	}
+
 	exportRecord, err := getJobFileRecord(e.App, jobId)
 	if err != nil {
 		return response.NotFound(e, "Export file not found")
 	}
 
-	fileName := exportRecord.GetString("file")
-	basePath := exportRecord.BaseFilesPath()
+	storage, key, err := jobutils.ExportFileStorage(e.App, exportRecord)
+	if err != nil {
+		return response.InternalServerError(e, "Failed to access export storage", nil)
+	}
+
+	fileName := jobutils.ExportFileName(exportRecord)
+	if checksum := exportRecord.GetString("checksum"); checksum != "" {
+		e.Response.Header().Set("X-Checksum-Sha256", checksum)
+	}
+
+	// Signed URLs are downloaded from the storage directly, reading the whole object here to verify it would
+	// double the transfer of every download: clients check the checksum of the redirect instead
+	signedURL, err := storage.SignedURL(key, fileName, jobutils.GetDownloadTokenTTL())
+	if err != nil {
+		return response.InternalServerError(e, "Failed to sign download URL", nil)
+	}
+	if signedURL != "" {
+		return e.Redirect(http.StatusFound, signedURL)
+	}
+
+	if err := jobutils.VerifyExportFile(e.App, exportRecord); err != nil {
+		log.Error("Export file failed verification", "job_id", jobId, "record_id", exportRecord.Id, "error", err)
+		if errors.Is(err, jobutils.ErrExportChecksumMismatch) {
+			return response.InternalServerError(e, "Export file is corrupted", nil)
+		}
+		return response.NotFound(e, "File not accessible")
+	}
+
+	reader, err := storage.Open(key)
+	if err != nil {
+		return response.NotFound(e, "File not accessible")
+	}
+	defer reader.Close()
+
+	return response.Stream(e, fileName, reader)
+}
 
-	return response.File(e, fileName, basePath)
+// canAccessJob allows the user that created a job and users with the job.view permission
+func canAccessJob(e *core.RequestEvent, ownerId string) bool {
+	return jobPermissions.CanAccessJob(e.App, e.Auth, ownerId)
 }
 
 func getJobFileRecord(app core.App, jobId string) (*core.Record, error) {
 	return app.FindFirstRecordByFilter("export_files", "job_id = {:job_id}", dbx.Params{"job_id": jobId})
 }
 
-func getJobStatus(app core.App, jobId string) string {
-	job, err := app.FindRecordById("queues", jobId)
+// getJobStatus resolves the status and owner of a job from the queue, its stored result, the dead-letter queue
+// or its export file. Batch IDs resolve to the aggregate progress of the batch.
+func getJobStatus(app core.App, jobId string) (map[string]any, string, bool) {
+	data := map[string]any{
+		"job_id": jobId,
+	}
+
+	job, err := app.FindRecordById(jobutils.QueuesCollection, jobId)
 	if err == nil {
 		if job.GetString("reserved_at") == "" {
-			return "queued"
+			data["status"] = jobutils.JobStatusQueued
 		} else {
-			return "processing"
+			data["status"] = jobutils.JobStatusProcessing
 		}
+		data["attempts"] = job.GetInt("attempts")
+		if progress := jobutils.GetJobProgress(job); progress != nil {
+			data["progress"] = progress
+		}
+		addJobBatch(app, data, job.GetString("batch_id"))
+		return data, job.GetString("user_id"), true
 	}
 
-	_, err = getJobFileRecord(app, jobId)
+	jobResult, err := jobutils.FindJobResult(app, jobId)
 	if err == nil {
-		return "completed"
+		data["status"] = jobResult.GetString("status")
+		data["result"] = jobResult.Get("result")
+		data["error"] = jobResult.GetString("error")
+		data["attempts"] = jobResult.GetInt("attempts")
+		data["duration_ms"] = jobResult.GetInt("duration_ms")
+		data["finished_at"] = jobResult.GetDateTime("finished_at")
+		addJobBatch(app, data, jobResult.GetString("batch_id"))
+		return data, jobResult.GetString("user_id"), true
+	}
+
+	failedJob, err := app.FindFirstRecordByFilter(jobutils.FailedJobsCollection, "queue_id = {:job_id}", dbx.Params{"job_id": jobId})
+	if err == nil {
+		data["status"] = jobutils.JobStatusFailed
+		data["error"] = failedJob.GetString("error")
+		data["attempts"] = failedJob.GetInt("attempts")
+		data["finished_at"] = failedJob.GetDateTime("failed_at")
+		return data, failedJob.GetString("user_id"), true
+	}
+
+	batch, err := jobutils.FindJobBatch(app, jobId)
+	if err == nil {
+		progress := jobutils.GetBatchProgress(batch)
+		data["status"] = progress.Status
+		data["progress"] = jobutils.NewJobProgress(progress.Completed+progress.Failed, progress.Total, "")
+		data["batch"] = progress
+		return data, batch.GetString("user_id"), true
+	}
+
+	exportRecord, err := getJobFileRecord(app, jobId)
+	if err == nil {
+		data["status"] = jobutils.JobStatusCompleted
+		return data, exportRecord.GetString("user_id"), true
+	}
+
+	return nil, "", false
+}
+
+// addJobBatch adds the aggregate progress of the job's batch to its status
+func addJobBatch(app core.App, data map[string]any, batchId string) {
+	if batchId == "" {
+		return
+	}
+
+	batch, err := jobutils.FindJobBatch(app, batchId)
+	if err != nil {
+		return
 	}
 
-	return "failed"
+	data["batch"] = jobutils.GetBatchProgress(batch)
 }
@@ -1,7 +1,8 @@
 package route
 
 import (
-	"encoding/json"
+	"strconv"
+
 	"ims-pocketbase-baas-starter/pkg/jobutils"
 	"ims-pocketbase-baas-starter/pkg/response"
 
@@ -9,6 +10,17 @@ import (
 )
 
 func HandleUserExport(e *core.RequestEvent) error {
+	// The body is optional, it only holds the file and notification options
+	var body exportFileRequest
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e, "Invalid export request body", nil)
+	}
+
+	fileOptions, err := body.options(e.App)
+	if err != nil {
+		return response.ValidationError(e, err.Error(), nil)
+	}
+
 	payload := jobutils.DataProcessingJobPayload{
 		Type: jobutils.JobTypeDataProcessing,
 		Data: jobutils.DataProcessingJobData{
@@ -17,26 +29,36 @@ func HandleUserExport(e *core.RequestEvent) error {
 			Target:    jobutils.DataProcessingFileCSV,
 		},
 		Options: jobutils.DataProcessingJobOptions{
-			Timeout: 900, // 15 minutes
+			Timeout:           900, // 15 minutes
+			Notify:            body.Notify,
+			ExportFileOptions: fileOptions,
 		},
 	}
 
-	queuesCollection, err := e.App.FindCollectionByNameOrId("queues")
+	// Repeated clicks return the export that is already queued or running for the same user and options.
+	// The options are keyed by a digest, so the passphrase is not stored in the key. Exports encrypted with
+	// a generated key are never merged, each requester gets the key of their own file.
+	optionsDigest, err := jobutils.PayloadDigest(e.App, fileOptions.Compression, fileOptions.Encryption,
+		fileOptions.Passphrase, fileOptions.Key, strconv.FormatBool(body.Notify))
 	if err != nil {
-		return response.InternalServerError(e, "Queue system unavailable", nil)
+		return response.InternalServerError(e, "Failed to queue export job", nil)
 	}
 
-	job := core.NewRecord(queuesCollection)
-	job.Set("name", "User Export")
-	job.Set("description", "Export users to CSV")
-
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		return response.InternalServerError(e, "Failed to create job", nil)
+	userId := ""
+	if e.Auth != nil {
+		userId = e.Auth.Id
 	}
-	job.Set("payload", string(payloadJSON))
+	uniqueKey := "user_export:" + userId + ":" + optionsDigest[:16]
 
-	if err := e.App.Save(job); err != nil {
+	job, created, err := jobutils.Enqueue(e.App, payload, jobutils.EnqueueOptions{
+		Name:        "User Export",
+		Description: "Export users to CSV",
+		Queue:       jobutils.QueueExports,
+		Priority:    jobutils.JobPriorityNormal,
+		UniqueKey:   uniqueKey,
+		UserID:      userId,
+	})
+	if err != nil {
 		return response.InternalServerError(e, "Failed to queue export job", nil)
 	}
 
@@ -44,5 +66,8 @@ func HandleUserExport(e *core.RequestEvent) error {
 		"job_id": job.Id,
 		"status": "queued",
 	}
-	return response.OK(e, "User export job queued successfully", data)
+	if !created {
+		return response.OK(e, "User export job already queued", data)
+	}
+	return response.OK(e, "User export job queued successfully", addEncryptionKey(data, fileOptions))
 }
@@ -0,0 +1,195 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// expressionKeywords are the SQL keywords allowed in compute expressions
+var expressionKeywords = []string{
+	"and", "or", "not", "is", "null", "true", "false", "like", "glob", "between", "in", "escape",
+	"case", "when", "then", "else", "end", "cast", "as", "integer", "real", "text", "numeric", "blob",
+	"collate", "nocase", "rtrim",
+}
+
+// expressionFunctions are the SQLite functions allowed in compute expressions: scalar functions of the row
+// values that read nothing else
+var expressionFunctions = []string{
+	"abs", "coalesce", "ifnull", "nullif", "iif", "typeof",
+	"length", "lower", "upper", "trim", "ltrim", "rtrim", "substr", "substring", "replace", "instr",
+	"printf", "format", "char", "unicode", "hex", "quote",
+	"round", "min", "max", "sign", "floor", "ceil", "ceiling", "trunc", "mod", "pow", "power", "sqrt",
+	"date", "time", "datetime", "julianday", "strftime", "unixepoch",
+	"json", "json_extract", "json_array", "json_object", "json_array_length", "json_type", "json_valid",
+}
+
+// expressionOperators are the operators allowed in compute expressions, longest first
+var expressionOperators = []string{
+	"||", "<=", ">=", "==", "!=", "<>", "<<", ">>",
+	"+", "-", "*", "/", "%", "=", "<", ">", "&", "|", "~", "(", ")", ",",
+}
+
+// validateExpression checks that a compute expression only uses the fields of the row (columns), literals and
+// the allowed operators, keywords and functions. Anything else, such as subqueries, other tables, parameters
+// or comments, is rejected before the expression reaches SQLite.
+func validateExpression(columns []string, expression string) error {
+	depth := 0
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'':
+			end, err := quotedEnd(expression, i, '\'')
+			if err != nil {
+				return err
+			}
+			i = end
+
+		case c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end, err := quotedEnd(expression, i, closing)
+			if err != nil {
+				return err
+			}
+			name := strings.ReplaceAll(expression[i+1:end-1], string(closing)+string(closing), string(closing))
+			if !isColumn(columns, name) {
+				return fmt.Errorf("unknown field %q", name)
+			}
+			i = end
+
+		case isDigit(c) || (c == '.' && i+1 < len(expression) && isDigit(expression[i+1])):
+			i = numberEnd(expression, i)
+
+		case isIdentifierStart(c):
+			end := i
+			for end < len(expression) && isIdentifierPart(expression[end]) {
+				end++
+			}
+			word := expression[i:end]
+			lower := strings.ToLower(word)
+
+			switch {
+			case nextToken(expression, end) == '(' && slices.Contains(expressionFunctions, lower):
+			case slices.Contains(expressionKeywords, lower):
+			case isColumn(columns, word) && !slices.Contains(reservedExpressionWords, lower):
+			default:
+				return fmt.Errorf("%q is not a field, keyword or allowed function", word)
+			}
+			i = end
+
+		default:
+			if strings.HasPrefix(expression[i:], "--") || strings.HasPrefix(expression[i:], "/*") {
+				return errors.New("comments are not allowed")
+			}
+
+			operator := ""
+			for _, candidate := range expressionOperators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return fmt.Errorf("unexpected character %q", c)
+			}
+
+			// The expression is wrapped in parentheses, closing more than it opens would escape them
+			switch operator {
+			case "(":
+				depth++
+			case ")":
+				if depth--; depth < 0 {
+					return errors.New("unbalanced parentheses")
+				}
+			}
+			i += len(operator)
+		}
+	}
+
+	if depth != 0 {
+		return errors.New("unbalanced parentheses")
+	}
+	return nil
+}
+
+// reservedExpressionWords are never read as field names, even when a field has that name
+var reservedExpressionWords = []string{"select", "from", "where", "with", "values", "union", "exists", "raise"}
+
+// quotedEnd returns the index after the closing quote of a string or quoted identifier starting at start.
+// Doubled closing quotes are escaped quotes.
+func quotedEnd(expression string, start int, closing byte) (int, error) {
+	for i := start + 1; i < len(expression); i++ {
+		if expression[i] != closing {
+			continue
+		}
+		if closing != ']' && i+1 < len(expression) && expression[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1, nil
+	}
+	return 0, errors.New("unterminated quote")
+}
+
+// numberEnd returns the index after the number starting at start, with its fraction and exponent
+func numberEnd(expression string, start int) int {
+	i := start
+	if strings.HasPrefix(strings.ToLower(expression[i:]), "0x") {
+		i += 2
+		for i < len(expression) && strings.ContainsRune("0123456789abcdefABCDEF", rune(expression[i])) {
+			i++
+		}
+		return i
+	}
+
+	for i < len(expression) && (isDigit(expression[i]) || expression[i] == '.') {
+		i++
+	}
+	if i < len(expression) && (expression[i] == 'e' || expression[i] == 'E') {
+		i++
+		if i < len(expression) && (expression[i] == '+' || expression[i] == '-') {
+			i++
+		}
+		for i < len(expression) && isDigit(expression[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+// nextToken returns the first character that is not a space from index i, 0 at the end of the expression
+func nextToken(expression string, i int) byte {
+	for ; i < len(expression); i++ {
+		if c := expression[i]; c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c
+		}
+	}
+	return 0
+}
+
+func isColumn(columns []string, name string) bool {
+	return slices.ContainsFunc(columns, func(column string) bool {
+		return strings.EqualFold(column, name)
+	})
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c)
+}
@@ -0,0 +1,335 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/dbx"
+)
+
+// fieldNamePattern matches the names of renamed and computed fields
+var fieldNamePattern = regexp.MustCompile(`^\w+$`)
+
+// step is a compiled transform step. apply changes the fields of a row in place and returns false for rows
+// removed from the pipeline.
+type step interface {
+	apply(row map[string]any) (bool, error)
+}
+
+// pipeline is the compiled list of steps of a transform job
+type pipeline struct {
+	steps []step
+	// columns are the fields of the transformed rows, in order
+	columns []string
+	// queries are the prepared statements of compute steps
+	queries []*dbx.Query
+}
+
+// compilePipeline validates the steps against the fields of the source rows, preparing the expressions of
+// compute steps with db
+func compilePipeline(db dbx.Builder, columns []string, specs []jobutils.DataTransformStep) (*pipeline, error) {
+	p := &pipeline{columns: slices.Clone(columns)}
+
+	for i, spec := range specs {
+		s, err := p.compile(db, spec)
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, spec.Type, err)
+		}
+		p.steps = append(p.steps, s)
+	}
+
+	return p, nil
+}
+
+// run applies the steps to a row, it returns false when a step removed the row
+func (p *pipeline) run(row map[string]any) (bool, error) {
+	for _, s := range p.steps {
+		keep, err := s.apply(row)
+		if err != nil || !keep {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// close releases the prepared statements of compute steps
+func (p *pipeline) close() {
+	for _, query := range p.queries {
+		_ = query.Close()
+	}
+}
+
+func (p *pipeline) compile(db dbx.Builder, spec jobutils.DataTransformStep) (step, error) {
+	switch spec.Type {
+	case jobutils.DataTransformRename:
+		if err := p.requireColumns(spec.Field); err != nil {
+			return nil, err
+		}
+		if err := p.checkNewColumn(spec.To); err != nil {
+			return nil, err
+		}
+		p.columns[slices.Index(p.columns, spec.Field)] = spec.To
+		return &renameStep{from: spec.Field, to: spec.To}, nil
+
+	case jobutils.DataTransformCompute:
+		if !fieldNamePattern.MatchString(spec.Field) {
+			return nil, fmt.Errorf("invalid field name %q", spec.Field)
+		}
+		query, err := prepareExpression(db, p.columns, spec.Expression)
+		if err != nil {
+			return nil, err
+		}
+		p.queries = append(p.queries, query)
+
+		s := &computeStep{field: spec.Field, columns: slices.Clone(p.columns), query: query}
+		if !slices.Contains(p.columns, spec.Field) {
+			p.columns = append(p.columns, spec.Field)
+		}
+		return s, nil
+
+	case jobutils.DataTransformMap:
+		if err := p.requireColumns(spec.Field); err != nil {
+			return nil, err
+		}
+		if len(spec.Values) == 0 {
+			return nil, errors.New("values are required")
+		}
+		return &mapStep{field: spec.Field, values: spec.Values, fallback: spec.Default}, nil
+
+	case jobutils.DataTransformDrop:
+		fields := stepFields(spec)
+		if err := p.requireColumns(fields...); err != nil {
+			return nil, err
+		}
+		p.columns = slices.DeleteFunc(p.columns, func(column string) bool {
+			return slices.Contains(fields, column)
+		})
+		return &dropStep{fields: fields}, nil
+
+	case jobutils.DataTransformDedupe:
+		fields := stepFields(spec)
+		if err := p.requireColumns(fields...); err != nil {
+			return nil, err
+		}
+		return &dedupeStep{fields: fields, seen: map[string]struct{}{}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported step type %q, expected rename, compute, map, drop or dedupe", spec.Type)
+	}
+}
+
+// requireColumns checks that fields are fields of the rows at this point of the pipeline
+func (p *pipeline) requireColumns(fields ...string) error {
+	if len(fields) == 0 {
+		return errors.New("a field is required")
+	}
+	for _, field := range fields {
+		if !slices.Contains(p.columns, field) {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+func (p *pipeline) checkNewColumn(field string) error {
+	if !fieldNamePattern.MatchString(field) {
+		return fmt.Errorf("invalid field name %q", field)
+	}
+	if slices.Contains(p.columns, field) {
+		return fmt.Errorf("field %q already exists", field)
+	}
+	return nil
+}
+
+// stepFields returns the fields of a drop or dedupe step, listed in Fields or given as Field
+func stepFields(spec jobutils.DataTransformStep) []string {
+	if len(spec.Fields) > 0 {
+		return spec.Fields
+	}
+	if spec.Field != "" {
+		return []string{spec.Field}
+	}
+	return nil
+}
+
+// prepareExpression prepares a statement evaluating a SQLite expression over the fields of a row, bound as
+// the columns of a single row subquery. The expression is checked by validateExpression first, so it can
+// only read the fields of the row.
+func prepareExpression(db dbx.Builder, columns []string, expression string) (*dbx.Query, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, errors.New("an expression is required")
+	}
+	if strings.Contains(expression, ";") {
+		return nil, errors.New("the expression must be a single SQL expression")
+	}
+	if err := validateExpression(columns, expression); err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = fmt.Sprintf("{:c%d} AS [[%s]]", i, column)
+	}
+
+	query := db.NewQuery("SELECT (" + expression + ") FROM (SELECT " + strings.Join(fields, ", ") + ")").Prepare()
+
+	// Statements may only be compiled when they first run, a run with empty fields reports syntax errors and
+	// unknown columns before any record is transformed
+	params := make(dbx.Params, len(columns))
+	for i := range columns {
+		params["c"+strconv.Itoa(i)] = nil
+	}
+	var value any
+	if err := query.Bind(params).Row(&value); err != nil {
+		_ = query.Close()
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+
+	return query, nil
+}
+
+type renameStep struct {
+	from, to string
+}
+
+func (s *renameStep) apply(row map[string]any) (bool, error) {
+	row[s.to] = row[s.from]
+	delete(row, s.from)
+	return true, nil
+}
+
+// computeStep sets a field to the result of an expression, the fields of the row are its columns
+type computeStep struct {
+	field   string
+	columns []string
+	query   *dbx.Query
+}
+
+func (s *computeStep) apply(row map[string]any) (bool, error) {
+	params := make(dbx.Params, len(s.columns))
+	for i, column := range s.columns {
+		params["c"+strconv.Itoa(i)] = sqlValue(row[column])
+	}
+
+	var value any
+	if err := s.query.Bind(params).Row(&value); err != nil {
+		return false, fmt.Errorf("failed to compute %s: %w", s.field, err)
+	}
+	if raw, ok := value.([]byte); ok {
+		value = string(raw)
+	}
+
+	row[s.field] = value
+	return true, nil
+}
+
+// mapStep replaces the values of a field, each value of multiple value fields is mapped on its own
+type mapStep struct {
+	field    string
+	values   map[string]any
+	fallback any
+}
+
+func (s *mapStep) apply(row map[string]any) (bool, error) {
+	if values, ok := row[s.field].([]string); ok {
+		mapped := make([]any, len(values))
+		for i, value := range values {
+			mapped[i] = s.mapValue(value)
+		}
+		row[s.field] = mapped
+		return true, nil
+	}
+
+	row[s.field] = s.mapValue(row[s.field])
+	return true, nil
+}
+
+func (s *mapStep) mapValue(value any) any {
+	if mapped, ok := s.values[valueKey(value)]; ok {
+		return mapped
+	}
+	if s.fallback != nil {
+		return s.fallback
+	}
+	return value
+}
+
+type dropStep struct {
+	fields []string
+}
+
+func (s *dropStep) apply(row map[string]any) (bool, error) {
+	for _, field := range s.fields {
+		delete(row, field)
+	}
+	return true, nil
+}
+
+// dedupeStep removes the rows whose fields have the values of a previous row
+type dedupeStep struct {
+	fields []string
+	seen   map[string]struct{}
+}
+
+func (s *dedupeStep) apply(row map[string]any) (bool, error) {
+	values := make([]any, len(s.fields))
+	for i, field := range s.fields {
+		values[i] = row[field]
+	}
+
+	key, err := json.Marshal(values)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare duplicates: %w", err)
+	}
+	if _, ok := s.seen[string(key)]; ok {
+		return false, nil
+	}
+
+	s.seen[string(key)] = struct{}{}
+	return true, nil
+}
+
+// valueKey returns the text form of a value, the keys of map steps
+func valueKey(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// sqlValue converts a field value to a value that SQLite can bind, lists and objects as JSON
+func sqlValue(value any) any {
+	switch v := value.(type) {
+	case nil, string, bool, float64, int, int64:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
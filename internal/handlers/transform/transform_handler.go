@@ -0,0 +1,366 @@
+package transform
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// transformBatchSize is the number of source records read at a time
+const transformBatchSize = 500
+
+// Samples kept in the job result
+const (
+	diffSampleSize  = 20
+	errorSampleSize = 20
+)
+
+// Record outcomes
+const (
+	transformActionCreate = "create"
+	transformActionUpdate = "update"
+)
+
+// transformJob holds the state of a running transform
+type transformJob struct {
+	app      core.App
+	source   *core.Collection
+	target   *core.Collection
+	pipeline *pipeline
+	dryRun   bool
+
+	// where selects the source records, maxRowid excludes the records created while the transform runs
+	where    dbx.Expression
+	maxRowid int64
+
+	result *jobutils.DataTransformResult
+}
+
+// HandleTransform runs the records of a collection (payload.Data.Source) matching payload.Data.Filter
+// through the steps of payload.Data.Steps and saves them in the target collection (payload.Data.Target, the
+// source by default). Rows keep the id of their source record unless a step drops it: the target record with
+// that id is updated, or created when there is none. In a dry run the records are validated but not saved.
+// Transforms read and write every record, like superusers: jobs are created by superusers, directly or
+// through scheduled_jobs.
+func HandleTransform(ctx *cronutils.CronExecutionContext, app *pocketbase.PocketBase, jobId string, payload *jobutils.DataProcessingJobPayload) (*jobutils.DataTransformResult, error) {
+	job, err := newTransformJob(app, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer job.pipeline.close()
+
+	total, err := job.count()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Transforming records",
+		"job_id", jobId,
+		"source", job.source.Name,
+		"target", job.target.Name,
+		"steps", len(payload.Data.Steps),
+		"record_count", total,
+		"dry_run", job.dryRun)
+
+	reportTransformProgress(ctx, 0, total, "Transforming records")
+
+	var lastRowid int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("transform cancelled after %d records: %w", job.result.ProcessedRecords, err)
+		}
+
+		records, rowid, err := job.nextBatch(lastRowid)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			break
+		}
+		lastRowid = rowid
+
+		for _, record := range records {
+			if err := job.transform(record); err != nil {
+				return nil, err
+			}
+		}
+
+		reportTransformProgress(ctx, job.result.ProcessedRecords, total, "Transforming records")
+	}
+
+	result := job.result
+	result.Message = fmt.Sprintf("Transformed %d %s records: %d created, %d updated, %d unchanged, %d skipped, %d failed",
+		result.ProcessedRecords, job.source.Name, result.Created, result.Updated, result.Unchanged, result.Skipped, result.Failed)
+	result.Timestamp = time.Now()
+
+	log.Info("Transform completed",
+		"job_id", jobId,
+		"source", job.source.Name,
+		"target", job.target.Name,
+		"processed_records", result.ProcessedRecords,
+		"created", result.Created,
+		"updated", result.Updated,
+		"failed", result.Failed,
+		"dry_run", job.dryRun)
+
+	return result, nil
+}
+
+// newTransformJob validates the source, target, filter and steps of a transform job
+func newTransformJob(app core.App, payload *jobutils.DataProcessingJobPayload) (*transformJob, error) {
+	data := payload.Data
+
+	source, err := app.FindCachedCollectionByNameOrId(data.Source)
+	if err != nil {
+		return nil, fmt.Errorf("source collection %q not found", data.Source)
+	}
+	if source.IsView() {
+		return nil, fmt.Errorf("view collection %s cannot be transformed", source.Name)
+	}
+
+	targetName := data.Target
+	if targetName == "" {
+		targetName = source.Name
+	}
+	target, err := app.FindCachedCollectionByNameOrId(targetName)
+	if err != nil {
+		return nil, fmt.Errorf("target collection %q not found", targetName)
+	}
+	if target.IsView() || target.System {
+		return nil, fmt.Errorf("transform results cannot be written to %s", target.Name)
+	}
+
+	if len(data.Steps) == 0 {
+		return nil, errors.New("at least one transform step is required")
+	}
+
+	pipeline, err := compilePipeline(app.ConcurrentDB(), sourceColumns(source), data.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, column := range pipeline.columns {
+		if target.Fields.GetByName(column) == nil {
+			pipeline.close()
+			return nil, fmt.Errorf("target collection %s has no field %q, drop or rename it", target.Name, column)
+		}
+	}
+
+	job := &transformJob{
+		app:      app,
+		source:   source,
+		target:   target,
+		pipeline: pipeline,
+		dryRun:   payload.Options.DryRun,
+		result: &jobutils.DataTransformResult{
+			DataProcessingResult: jobutils.DataProcessingResult{OutputLocation: target.Name},
+			DryRun:               payload.Options.DryRun,
+		},
+	}
+
+	if strings.TrimSpace(data.Filter) != "" {
+		if job.where, err = jobutils.RecordFilterExpression(app, source, data.Filter); err != nil {
+			pipeline.close()
+			return nil, err
+		}
+	}
+
+	// Records created by the transform itself are not transformed again
+	err = app.ConcurrentDB().Select("COALESCE(MAX(_rowid_), 0)").From(source.Name).Row(&job.maxRowid)
+	if err != nil {
+		pipeline.close()
+		return nil, fmt.Errorf("failed to read %s: %w", source.Name, err)
+	}
+
+	return job, nil
+}
+
+// sourceColumns returns the fields read from source records. Passwords, token keys and autodate fields are
+// left out, they cannot be copied.
+func sourceColumns(collection *core.Collection) []string {
+	var columns []string
+	for _, field := range collection.Fields {
+		if field.GetName() == core.FieldNamePassword || field.GetName() == core.FieldNameTokenKey || field.Type() == core.FieldTypeAutodate {
+			continue
+		}
+		columns = append(columns, field.GetName())
+	}
+	return columns
+}
+
+// count returns the number of source records
+func (j *transformJob) count() (int, error) {
+	query := j.app.DB().
+		Select("COUNT(*)").
+		From(j.source.Name).
+		AndWhere(dbx.NewExp("[[_rowid_]] <= {:max_rowid}", dbx.Params{"max_rowid": j.maxRowid}))
+	if j.where != nil {
+		query.AndWhere(j.where)
+	}
+
+	var total int
+	if err := query.Row(&total); err != nil {
+		return 0, fmt.Errorf("failed to count %s records: %w", j.source.Name, err)
+	}
+	return total, nil
+}
+
+// nextBatch returns the source records following lastRowid and the rowid of the last one. Records are paged
+// by rowid, so updates that change whether a record matches the filter do not shift the next batches.
+func (j *transformJob) nextBatch(lastRowid int64) ([]*core.Record, int64, error) {
+	query := j.app.DB().
+		Select("_rowid_ AS row_id", "id").
+		From(j.source.Name).
+		AndWhere(dbx.NewExp("[[_rowid_]] > {:last_rowid} AND [[_rowid_]] <= {:max_rowid}", dbx.Params{
+			"last_rowid": lastRowid,
+			"max_rowid":  j.maxRowid,
+		})).
+		OrderBy("_rowid_ ASC").
+		Limit(transformBatchSize)
+	if j.where != nil {
+		query.AndWhere(j.where)
+	}
+
+	var rows []struct {
+		RowId int64  `db:"row_id"`
+		Id    string `db:"id"`
+	}
+	if err := query.All(&rows); err != nil {
+		return nil, 0, fmt.Errorf("failed to query %s: %w", j.source.Name, err)
+	}
+	if len(rows) == 0 {
+		return nil, lastRowid, nil
+	}
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Id
+	}
+
+	records, err := j.app.FindRecordsByIds(j.source, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load %s records: %w", j.source.Name, err)
+	}
+
+	// Keep the rowid order, FindRecordsByIds does not
+	slices.SortFunc(records, func(a, b *core.Record) int {
+		return slices.Index(ids, a.Id) - slices.Index(ids, b.Id)
+	})
+
+	return records, rows[len(rows)-1].RowId, nil
+}
+
+// transform runs a source record through the pipeline and saves the result. Records that fail the pipeline
+// or the validation of the target collection are counted as failed.
+func (j *transformJob) transform(source *core.Record) error {
+	j.result.ProcessedRecords++
+
+	row := make(map[string]any, len(j.pipeline.columns))
+	for _, column := range sourceColumns(j.source) {
+		row[column] = source.Get(column)
+	}
+
+	keep, err := j.pipeline.run(row)
+	if err != nil {
+		j.fail(source.Id, err)
+		return nil
+	}
+	if !keep {
+		j.result.Skipped++
+		return nil
+	}
+
+	record, action, err := j.targetRecord(row)
+	if err != nil {
+		return err
+	}
+
+	change := jobutils.DataTransformChange{Action: action, Id: record.Id, Fields: map[string]jobutils.DataFieldChange{}}
+	for _, column := range j.pipeline.columns {
+		before := record.Get(column)
+		record.Set(column, row[column])
+		after := record.Get(column)
+
+		if action == transformActionCreate {
+			change.Fields[column] = jobutils.DataFieldChange{To: after}
+		} else if !sameValue(before, after) {
+			change.Fields[column] = jobutils.DataFieldChange{From: before, To: after}
+		}
+	}
+
+	if action == transformActionUpdate && len(change.Fields) == 0 {
+		j.result.Unchanged++
+		return nil
+	}
+
+	if j.dryRun {
+		err = j.app.Validate(record)
+	} else {
+		err = j.app.Save(record)
+	}
+	if err != nil {
+		j.fail(source.Id, err)
+		return nil
+	}
+
+	if action == transformActionCreate {
+		j.result.Created++
+		change.Id = record.Id
+	} else {
+		j.result.Updated++
+	}
+	if len(j.result.Diff) < diffSampleSize {
+		j.result.Diff = append(j.result.Diff, change)
+	}
+
+	return nil
+}
+
+// targetRecord returns the target record with the id of the row, or a new record
+func (j *transformJob) targetRecord(row map[string]any) (*core.Record, string, error) {
+	if id, _ := row[core.FieldNameId].(string); id != "" {
+		record, err := j.app.FindRecordById(j.target, id)
+		if err == nil {
+			return record, transformActionUpdate, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, "", fmt.Errorf("failed to find %s record %s: %w", j.target.Name, id, err)
+		}
+	}
+
+	return core.NewRecord(j.target), transformActionCreate, nil
+}
+
+// fail counts a failed record and keeps its error in the result
+func (j *transformJob) fail(id string, err error) {
+	j.result.Failed++
+	if len(j.result.Errors) < errorSampleSize {
+		j.result.Errors = append(j.result.Errors, fmt.Sprintf("record %s: %v", id, err))
+	}
+}
+
+// sameValue compares field values by their JSON form, as dates and lists are not comparable
+func sameValue(a, b any) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(rawA) == string(rawB)
+}
+
+// reportTransformProgress reports transform progress, logging instead of failing the job when it cannot be stored
+func reportTransformProgress(ctx *cronutils.CronExecutionContext, done, total int, message string) {
+	if err := ctx.ReportProgress(done, total, message); err != nil {
+		log.Warn("Failed to report transform progress", "job_id", ctx.CronID, "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp bootstraps a PocketBase app with a contacts collection holding legacy data and an empty people
+// collection to migrate it to
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	contacts := core.NewBaseCollection("contacts")
+	contacts.Fields.Add(
+		&core.TextField{Name: "first_name"},
+		&core.TextField{Name: "last_name"},
+		&core.TextField{Name: "full_name"},
+		&core.TextField{Name: "email"},
+		&core.TextField{Name: "status"},
+		&core.NumberField{Name: "score"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	mustSave(t, app, contacts)
+
+	people := core.NewBaseCollection("people")
+	people.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.EmailField{Name: "email"},
+		&core.SelectField{Name: "state", Values: []string{"active", "inactive", "unknown"}, MaxSelect: 1},
+	)
+	mustSave(t, app, people)
+
+	for _, contact := range [][]string{
+		{"Ada", "Lovelace", " ADA@example.com ", "A"},
+		{"Alan", "Turing", "alan@example.com", "I"},
+		{"Ada", "L.", "ada@example.com", "A"},
+		{"", "", "nobody@example.com", "X"},
+	} {
+		record := core.NewRecord(contacts)
+		record.Set("first_name", contact[0])
+		record.Set("last_name", contact[1])
+		record.Set("email", contact[2])
+		record.Set("status", contact[3])
+		record.Set("score", 1)
+		mustSave(t, app, record)
+	}
+
+	return app
+}
+
+func mustSave(t *testing.T, app *pocketbase.PocketBase, model core.Model) {
+	t.Helper()
+	if err := app.Save(model); err != nil {
+		t.Fatalf("failed to save %v: %v", model, err)
+	}
+}
+
+func transformPayload(data jobutils.DataProcessingJobData, dryRun bool) *jobutils.DataProcessingJobPayload {
+	data.Operation = jobutils.DataProcessingOperationTransform
+	return &jobutils.DataProcessingJobPayload{
+		Type:    jobutils.JobTypeDataProcessing,
+		Data:    data,
+		Options: jobutils.DataProcessingJobOptions{DryRun: dryRun},
+	}
+}
+
+func TestHandleTransform_BackfillInPlace(t *testing.T) {
+	app := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "transform-job")
+
+	payload := transformPayload(jobutils.DataProcessingJobData{
+		Source: "contacts",
+		Filter: "first_name != ''",
+		Steps: []jobutils.DataTransformStep{
+			{Type: "compute", Field: "full_name", Expression: "trim(first_name || ' ' || last_name)"},
+			{Type: "compute", Field: "email", Expression: "lower(trim(email))"},
+			{Type: "compute", Field: "score", Expression: "score * 10"},
+			{Type: "map", Field: "status", Values: map[string]any{"A": "active", "I": "inactive"}},
+		},
+	}, false)
+
+	result, err := HandleTransform(ctx, app, "transform-job", payload)
+	if err != nil {
+		t.Fatalf("HandleTransform returned error: %v", err)
+	}
+	if result.ProcessedRecords != 3 || result.Updated != 3 || result.Created != 0 || result.Failed != 0 {
+		t.Fatalf("expected the 3 named contacts updated, got %+v", result)
+	}
+
+	record, err := app.FindFirstRecordByData("contacts", "last_name", "Lovelace")
+	if err != nil {
+		t.Fatalf("failed to find contact: %v", err)
+	}
+	if record.GetString("full_name") != "Ada Lovelace" || record.GetString("email") != "ada@example.com" ||
+		record.GetString("status") != "active" || record.GetFloat("score") != 10 {
+		t.Errorf("unexpected transformed contact: %v", record.FieldsData())
+	}
+
+	// The record outside of the filter is left as is
+	record, err = app.FindFirstRecordByData("contacts", "email", "nobody@example.com")
+	if err != nil || record.GetString("status") != "X" {
+		t.Errorf("expected the unnamed contact untouched, got %v (%v)", record, err)
+	}
+
+	// The diff lists the changed fields only
+	change := result.Diff[0]
+	if change.Action != "update" || change.Fields["full_name"].To != "Ada Lovelace" || change.Fields["status"].From != "A" {
+		t.Errorf("unexpected diff: %+v", change)
+	}
+	if _, ok := change.Fields["first_name"]; ok {
+		t.Errorf("expected unchanged fields out of the diff, got %+v", change)
+	}
+
+	// Running the same backfill on transformed data changes nothing but the score
+	payload.Data.Steps = payload.Data.Steps[:2]
+	result, err = HandleTransform(ctx, app, "transform-job", payload)
+	if err != nil {
+		t.Fatalf("HandleTransform returned error: %v", err)
+	}
+	if result.Unchanged != 3 || result.Updated != 0 {
+		t.Errorf("expected 3 unchanged records, got %+v", result)
+	}
+}
+
+func TestHandleTransform_MigrateWithDryRun(t *testing.T) {
+	app := newTestApp(t)
+	ctx := cronutils.NewCronExecutionContext(app, "transform-job")
+
+	data := jobutils.DataProcessingJobData{
+		Source: "contacts",
+		Target: "people",
+		Steps: []jobutils.DataTransformStep{
+			{Type: "compute", Field: "name", Expression: "trim(first_name || ' ' || last_name)"},
+			{Type: "compute", Field: "email", Expression: "lower(trim(email))"},
+			{Type: "rename", Field: "status", To: "state"},
+			{Type: "map", Field: "state", Values: map[string]any{"A": "active", "I": "inactive"}, Default: "unknown"},
+			{Type: "dedupe", Fields: []string{"first_name"}},
+			{Type: "drop", Fields: []string{"id", "first_name", "last_name", "full_name", "score"}},
+		},
+	}
+
+	result, err := HandleTransform(ctx, app, "transform-job", transformPayload(data, true))
+	if err != nil {
+		t.Fatalf("HandleTransform returned error: %v", err)
+	}
+
+	// The second Ada is a duplicate and the unnamed contact fails the required name
+	if !result.DryRun || result.Created != 2 || result.Skipped != 1 || result.Failed != 1 || len(result.Errors) != 1 {
+		t.Fatalf("unexpected dry run result: %+v", result)
+	}
+	if !strings.Contains(result.Errors[0], "name") {
+		t.Errorf("expected a name validation error, got %v", result.Errors)
+	}
+	if len(result.Diff) != 2 || result.Diff[0].Action != "create" || result.Diff[0].Fields["state"].To != "active" {
+		t.Errorf("unexpected diff sample: %+v", result.Diff)
+	}
+
+	if total, _ := app.CountRecords("people"); total != 0 {
+		t.Fatalf("expected a dry run to save nothing, got %d people", total)
+	}
+
+	result, err = HandleTransform(ctx, app, "transform-job", transformPayload(data, false))
+	if err != nil {
+		t.Fatalf("HandleTransform returned error: %v", err)
+	}
+	if result.Created != 2 || result.Failed != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	record, err := app.FindFirstRecordByData("people", "email", "alan@example.com")
+	if err != nil {
+		t.Fatalf("migrated person not found: %v", err)
+	}
+	if record.GetString("name") != "Alan Turing" || record.GetString("state") != "inactive" {
+		t.Errorf("unexpected migrated person: %v", record.FieldsData())
+	}
+}
+
+func TestValidateExpression(t *testing.T) {
+	columns := []string{"first_name", "email", "score", "date"}
+
+	valid := []string{
+		"trim(first_name || ' ' || \"EMAIL\")",
+		"CASE WHEN score >= 10 THEN 'high' ELSE 'low' END",
+		"CAST(score AS TEXT) || 'select from'",
+		"iif(email LIKE '%@example.com' ESCAPE '\\', 1, 0)",
+		"date(date, '+1 day') || [first_name]",
+		"round(score * 1.5e2 / 0x10, 2) <> -1 AND email IS NOT NULL",
+	}
+	for _, expression := range valid {
+		if err := validateExpression(columns, expression); err != nil {
+			t.Errorf("expected %q to be valid, got %v", expression, err)
+		}
+	}
+
+	invalid := []string{
+		"email IN (SELECT email FROM users)",
+		"\"password\"",
+		"email /* comment */",
+		"'unterminated",
+		"score + ?",
+		"random()",
+	}
+	for _, expression := range invalid {
+		if err := validateExpression(columns, expression); err == nil {
+			t.Errorf("expected %q to be rejected", expression)
+		}
+	}
+}
+
+func TestNewTransformJob_Errors(t *testing.T) {
+	app := newTestApp(t)
+
+	drop := []jobutils.DataTransformStep{{Type: "drop", Field: "score"}}
+	tests := []struct {
+		name    string
+		data    jobutils.DataProcessingJobData
+		errText string
+	}{
+		{name: "unknown source", data: jobutils.DataProcessingJobData{Source: "missing", Steps: drop}, errText: `source collection "missing" not found`},
+		{name: "unknown target", data: jobutils.DataProcessingJobData{Source: "contacts", Target: "missing", Steps: drop}, errText: `target collection "missing" not found`},
+		{name: "system target", data: jobutils.DataProcessingJobData{Source: "contacts", Target: "_superusers", Steps: drop}, errText: "cannot be written to _superusers"},
+		{name: "no steps", data: jobutils.DataProcessingJobData{Source: "contacts"}, errText: "at least one transform step"},
+		{name: "unknown step", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "split"}}}, errText: `unsupported step type "split"`},
+		{name: "rename unknown field", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "rename", Field: "phone", To: "mobile"}}}, errText: `step 1 (rename): unknown field "phone"`},
+		{name: "rename to existing field", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "rename", Field: "email", To: "status"}}}, errText: `field "status" already exists`},
+		{name: "invalid expression", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "lower(email"}}}, errText: "invalid expression"},
+		{name: "dropped field in expression", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{drop[0], {Type: "compute", Field: "full_name", Expression: "score + 1"}}}, errText: "step 2 (compute): invalid expression"},
+		{name: "several statements", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "1; DELETE FROM contacts"}}}, errText: "single SQL expression"},
+		{name: "subquery", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "(SELECT password FROM _superusers LIMIT 1)"}}}, errText: `"SELECT" is not a field`},
+		{name: "other table", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "_superusers.email"}}}, errText: `"_superusers" is not a field`},
+		{name: "function not allowed", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "load_extension('x')"}}}, errText: `"load_extension" is not a field, keyword or allowed function`},
+		{name: "escaping the parentheses", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "email) || (email"}}}, errText: "unbalanced parentheses"},
+		{name: "comment", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "email -- x"}}}, errText: "comments are not allowed"},
+		{name: "parameter", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "compute", Field: "email", Expression: "{:c0}"}}}, errText: "unexpected character"},
+		{name: "map without values", data: jobutils.DataProcessingJobData{Source: "contacts", Steps: []jobutils.DataTransformStep{{Type: "map", Field: "status"}}}, errText: "values are required"},
+		{name: "missing target field", data: jobutils.DataProcessingJobData{Source: "contacts", Target: "people", Steps: drop}, errText: `people has no field "first_name"`},
+		{name: "invalid filter", data: jobutils.DataProcessingJobData{Source: "contacts", Filter: "score >", Steps: drop}, errText: "invalid filter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTransformJob(app, transformPayload(tt.data, false))
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("expected error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package hooks
 import (
 	"fmt"
 	"ims-pocketbase-baas-starter/internal/handlers/hook"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 	"ims-pocketbase-baas-starter/pkg/metrics"
 
@@ -99,6 +100,19 @@ func registerRecordHooks(app *pocketbase.PocketBase) error {
 		})
 	})
 
+	// Wake the job dispatcher as soon as a job is queued
+	app.OnRecordAfterCreateSuccess("queues").BindFunc(func(e *core.RecordEvent) error {
+		return hook.HandleQueueJobCreated(e)
+	})
+
+	// Validate scheduled jobs and keep their next run time in sync with their schedule
+	app.OnRecordCreate(jobutils.ScheduledJobsCollection).BindFunc(func(e *core.RecordEvent) error {
+		return hook.HandleScheduledJobSave(e)
+	})
+	app.OnRecordUpdate(jobutils.ScheduledJobsCollection).BindFunc(func(e *core.RecordEvent) error {
+		return hook.HandleScheduledJobSave(e)
+	})
+
 	// Invalidate user permission cache when user is updated
 	app.OnRecordUpdate("users").BindFunc(func(e *core.RecordEvent) error {
 		return hook.HandleUserCacheClear(e)
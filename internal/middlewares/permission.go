@@ -2,7 +2,9 @@ package middlewares
 
 import (
 	"ims-pocketbase-baas-starter/pkg/cache"
+	"ims-pocketbase-baas-starter/pkg/jobutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
+	"ims-pocketbase-baas-starter/pkg/permission"
 	"time"
 
 	"github.com/pocketbase/pocketbase/apis"
@@ -175,6 +177,52 @@ func (m *PermissionMiddleware) RequirePermission(permissions ...string) func(*co
 	}
 }
 
+// UserHasPermission checks if a user is a superuser or has any of the specified permissions.
+// It is meant for handlers that combine a permission with another rule, such as record ownership.
+//
+// Parameters:
+//   - app: The PocketBase app instance
+//   - user: The authenticated user record, nil is never allowed
+//   - permissions: String array of permission slugs to check
+//
+// Returns:
+//   - bool: True if the user is a superuser or has any of the specified permissions
+func (m *PermissionMiddleware) UserHasPermission(app core.App, user *core.Record, permissions ...string) bool {
+	if user == nil {
+		return false
+	}
+
+	if user.IsSuperuser() {
+		return true
+	}
+
+	return m.HasPermission(m.getUserPermissions(app, user), permissions)
+}
+
+// CanAccessJob checks if a user may see a job created by ownerId: its owner, superusers and users with the
+// job.view permission.
+func (m *PermissionMiddleware) CanAccessJob(app core.App, user *core.Record, ownerId string) bool {
+	if user == nil {
+		return false
+	}
+	if ownerId != "" && user.Id == ownerId {
+		return true
+	}
+
+	return m.UserHasPermission(app, user, permission.JobView)
+}
+
+// CanAccessJobID resolves the owner of a job, batch or export by ID and checks it with CanAccessJob.
+// Unknown IDs are never accessible.
+func (m *PermissionMiddleware) CanAccessJobID(app core.App, user *core.Record, jobId string) bool {
+	if user == nil {
+		return false
+	}
+
+	ownerId, found := jobutils.FindJobOwner(app, jobId)
+	return found && m.CanAccessJob(app, user, ownerId)
+}
+
 // InvalidateUserPermissions invalidates cached permissions for a specific user
 func (m *PermissionMiddleware) InvalidateUserPermissions(userID string) {
 	cacheKey := m.cacheKey.UserPermissions(userID)
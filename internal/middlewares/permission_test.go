@@ -2,6 +2,9 @@ package middlewares
 
 import (
 	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // TestHasPermission tests the HasPermission function with various scenarios
@@ -61,3 +64,22 @@ func TestHasPermission(t *testing.T) {
 		})
 	}
 }
+
+// TestCanAccessJob tests that jobs are accessible to their owner and never to anonymous users
+func TestCanAccessJob(t *testing.T) {
+	pm := NewPermissionMiddleware()
+	app := pocketbase.New()
+
+	user := core.NewRecord(core.NewAuthCollection("users"))
+	user.Id = "user1"
+
+	if !pm.CanAccessJob(app, user, "user1") {
+		t.Error("Expected the owner to access the job")
+	}
+	if pm.CanAccessJob(app, nil, "user1") {
+		t.Error("Expected anonymous users to be denied")
+	}
+	if pm.CanAccessJobID(app, nil, "job123") {
+		t.Error("Expected anonymous users to be denied by job ID")
+	}
+}
@@ -52,6 +52,17 @@ func RegisterCustom(e *core.ServeEvent) error {
 			Enabled:     true,
 			Description: "Clear all system cache (requires auth and cache.clear permission)",
 		},
+		{
+			Method:  "DELETE",
+			Path:    "/cache/email-templates",
+			Handler: route.HandleEmailTemplatesReload,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.CacheClear),
+			},
+			Enabled:     true,
+			Description: "Reload the email templates after validating them (requires auth and cache.clear permission)",
+		},
 		{
 			Method:  "POST",
 			Path:    "/users/export",
@@ -63,6 +74,28 @@ func RegisterCustom(e *core.ServeEvent) error {
 			Enabled:     true,
 			Description: "User export route",
 		},
+		{
+			Method:  "POST",
+			Path:    "/exports",
+			Handler: route.HandleCollectionExport,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.DataExport),
+			},
+			Enabled:     true,
+			Description: "Queue a CSV, JSON Lines or XLSX export of a collection (requires data.export permission and the collection list rule)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/imports",
+			Handler: route.HandleImport,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.DataImport),
+			},
+			Enabled:     true,
+			Description: "Upload a CSV, JSON or XLSX file and queue its import into a collection (requires data.import permission)",
+		},
 		{
 			Method:  "GET",
 			Path:    "/jobs/{id}/status",
@@ -71,17 +104,157 @@ func RegisterCustom(e *core.ServeEvent) error {
 				authMiddleware.RequireAuthFunc(),
 			},
 			Enabled:     true,
-			Description: "Get job status route",
+			Description: "Get job status route (owner or job.view permission)",
 		},
 		{
 			Method:  "POST",
 			Path:    "/jobs/{id}/download",
-			Handler: route.HandleDownloadJobFile,
+			Handler: route.HandleCreateJobDownloadLink,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+			},
+			Enabled:     true,
+			Description: "Create a signed download link for a job file (owner or job.view permission)",
+		},
+		{
+			Method:      "GET",
+			Path:        "/jobs/download",
+			Handler:     route.HandleDownloadJobFile,
+			Middlewares: []func(*core.RequestEvent) error{},
+			Enabled:     true,
+			Description: "Download a job file with a signed download token (public, the token grants access)",
+		},
+		{
+			Method:  "GET",
+			Path:    "/jobs/failed",
+			Handler: route.HandleListFailedJobs,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobFailedView),
+			},
+			Enabled:     true,
+			Description: "List dead-lettered jobs (requires auth and job.failed.view permission)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/jobs/failed/retry",
+			Handler: route.HandleRetryFailedJobs,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobFailedRetry),
+			},
+			Enabled:     true,
+			Description: "Re-queue all dead-lettered jobs (requires auth and job.failed.retry permission)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/jobs/failed/{id}/retry",
+			Handler: route.HandleRetryFailedJob,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobFailedRetry),
+			},
+			Enabled:     true,
+			Description: "Re-queue a dead-lettered job (requires auth and job.failed.retry permission)",
+		},
+		{
+			Method:  "DELETE",
+			Path:    "/jobs/failed/{id}",
+			Handler: route.HandleDeleteFailedJob,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobFailedPurge),
+			},
+			Enabled:     true,
+			Description: "Delete a dead-lettered job (requires auth and job.failed.purge permission)",
+		},
+		{
+			Method:  "DELETE",
+			Path:    "/jobs/failed",
+			Handler: route.HandlePurgeFailedJobs,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobFailedPurge),
+			},
+			Enabled:     true,
+			Description: "Purge dead-lettered jobs (requires auth and job.failed.purge permission)",
+		},
+		{
+			Method:  "GET",
+			Path:    "/admin/jobs",
+			Handler: route.HandleListJobs,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobView),
+			},
+			Enabled:     true,
+			Description: "List jobs filtered by type, status and attempts (requires auth and job.view permission)",
+		},
+		{
+			Method:  "GET",
+			Path:    "/admin/jobs/{id}",
+			Handler: route.HandleGetJob,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobView),
+			},
+			Enabled:     true,
+			Description: "View a job's payload and errors (requires auth and job.view permission)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/admin/jobs/{id}/cancel",
+			Handler: route.HandleCancelJob,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobCancel),
+			},
+			Enabled:     true,
+			Description: "Cancel a queued job (requires auth and job.cancel permission)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/admin/jobs/{id}/retry",
+			Handler: route.HandleForceRetryJob,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobRetry),
+			},
+			Enabled:     true,
+			Description: "Force a retry of a queued or dead-lettered job (requires auth and job.retry permission)",
+		},
+		{
+			Method:  "DELETE",
+			Path:    "/admin/jobs",
+			Handler: route.HandlePurgeJobs,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.JobPurge),
+			},
+			Enabled:     true,
+			Description: "Bulk purge jobs by status (requires auth and job.purge permission)",
+		},
+		{
+			Method:  "GET",
+			Path:    "/admin/crons",
+			Handler: route.HandleListCrons,
+			Middlewares: []func(*core.RequestEvent) error{
+				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.CronView),
+			},
+			Enabled:     true,
+			Description: "List crons with their next fire time and last run (requires auth and cron.view permission)",
+		},
+		{
+			Method:  "POST",
+			Path:    "/admin/crons/{id}/run",
+			Handler: route.HandleTriggerCron,
 			Middlewares: []func(*core.RequestEvent) error{
 				authMiddleware.RequireAuthFunc(),
+				permissionMiddleware.RequirePermission(permission.CronRun),
 			},
 			Enabled:     true,
-			Description: "Download job file route",
+			Description: "Trigger a cron manually (requires auth and cron.run permission)",
 		},
 		// Add more routes here as needed:
 	}
@@ -163,6 +163,11 @@ func (cs *CacheService) InvalidatePermissionCache() int {
 	return cs.DeletePattern("permission_")
 }
 
+// InvalidateEmailTemplateCache invalidates all parsed email templates
+func (cs *CacheService) InvalidateEmailTemplateCache() int {
+	return cs.DeletePattern("email_template_")
+}
+
 // Helper function for simple pattern matching
 func containsPattern(key, pattern string) bool {
 	return len(pattern) > 0 && len(key) >= len(pattern) && key[:len(pattern)] == pattern
@@ -210,3 +215,8 @@ func (CacheKey) BatchRoles() string {
 func (CacheKey) BatchPermissions() string {
 	return "batch_permissions_all"
 }
+
+// EmailTemplate generates a cache key for a parsed email template
+func (CacheKey) EmailTemplate(name, locale, extension string) string {
+	return fmt.Sprintf("email_template_%s_%s%s", name, locale, extension)
+}
@@ -0,0 +1,242 @@
+package cronutils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+	"ims-pocketbase-baas-starter/pkg/metrics"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Constants for the cron run history
+const (
+	CronRunsCollection = "cron_runs"
+
+	CronRunStatusRunning   = "running"
+	CronRunStatusCompleted = "completed"
+	CronRunStatusFailed    = "failed"
+
+	CronTriggerSchedule = "schedule"
+	CronTriggerManual   = "manual"
+
+	// DefaultCronLockTimeout is how long an unfinished run holds the lock of its cron before it is considered abandoned
+	DefaultCronLockTimeout = time.Hour
+)
+
+// ErrCronRunning is returned when a run of the cron has not finished yet, on this or another instance
+var ErrCronRunning = errors.New("cron is already running")
+
+// CronRunSummary is a single run of a cron as reported by the crons CLI command and admin API
+type CronRunSummary struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Trigger    string     `json:"trigger"`
+	Instance   string     `json:"instance"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int        `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// CronRun is a run of a cron that holds the cron's lock until it is finished by Execute
+type CronRun struct {
+	CronID    string
+	Record    *core.Record
+	StartTime time.Time
+
+	app core.App
+}
+
+// GetCronLockTimeout returns the cron lock timeout configured via CRON_LOCK_TIMEOUT_MINUTES
+func GetCronLockTimeout() time.Duration {
+	minutes := common.GetEnvInt("CRON_LOCK_TIMEOUT_MINUTES", int(DefaultCronLockTimeout/time.Minute))
+	if minutes <= 0 {
+		return DefaultCronLockTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// StartCronRun takes the lock of a cron and records a running entry in cron_runs. It returns ErrCronRunning
+// while another run of the cron has not finished, unless that run is older than the lock timeout.
+func StartCronRun(app core.App, cronID, trigger, instance string) (*CronRun, error) {
+	now := types.NowDateTime()
+
+	// Runs that never finished (e.g. their instance crashed) release the lock once they exceed the timeout
+	_, err := app.DB().Update(
+		CronRunsCollection,
+		dbx.Params{
+			"status":      CronRunStatusFailed,
+			"error":       "lock expired before the run finished",
+			"finished_at": now.String(),
+			"updated":     now.String(),
+		},
+		dbx.And(
+			dbx.HashExp{"cron_id": cronID, "status": CronRunStatusRunning},
+			dbx.NewExp("[[started_at]] <= {:expired}", dbx.Params{"expired": now.Add(-GetCronLockTimeout()).String()}),
+		),
+	).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to release expired lock of cron %s: %w", cronID, err)
+	}
+
+	// A single INSERT ... WHERE NOT EXISTS takes the lock atomically, also across instances sharing the database
+	id := core.GenerateDefaultRandomId()
+	result, err := app.DB().NewQuery(
+		"INSERT INTO {{" + CronRunsCollection + "}} ([[id]], [[cron_id]], [[status]], [[trigger]], [[instance]], [[started_at]], [[created]], [[updated]]) " +
+			"SELECT {:id}, {:cron_id}, {:running}, {:trigger}, {:instance}, {:now}, {:now}, {:now} " +
+			"WHERE NOT EXISTS (SELECT 1 FROM {{" + CronRunsCollection + "}} WHERE [[cron_id]] = {:cron_id} AND [[status]] = {:running})",
+	).Bind(dbx.Params{
+		"id":       id,
+		"cron_id":  cronID,
+		"running":  CronRunStatusRunning,
+		"trigger":  trigger,
+		"instance": instance,
+		"now":      now.String(),
+	}).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record run of cron %s: %w", cronID, err)
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		metrics.SafeIncrementCounter(metrics.GetInstance(), metrics.MetricCronSkippedTotal, map[string]string{
+			metrics.LabelCronID: cronID,
+		})
+		return nil, ErrCronRunning
+	}
+
+	record, err := app.FindRecordById(CronRunsCollection, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run of cron %s: %w", cronID, err)
+	}
+
+	return &CronRun{CronID: cronID, Record: record, StartTime: now.Time(), app: app}, nil
+}
+
+// Execute runs fn with panic recovery, records its outcome and duration and releases the lock of the cron
+func (r *CronRun) Execute(fn func() error) error {
+	err := func() (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("cron %s panicked: %v", r.CronID, rec)
+			}
+		}()
+		return fn()
+	}()
+
+	duration := time.Since(r.StartTime)
+	status, metricStatus := CronRunStatusCompleted, metrics.LabelSuccess
+	if err != nil {
+		status, metricStatus = CronRunStatusFailed, metrics.LabelError
+		r.Record.Set("error", err.Error())
+	}
+
+	r.Record.Set("status", status)
+	r.Record.Set("finished_at", time.Now().UTC())
+	r.Record.Set("duration_ms", duration.Milliseconds())
+	if saveErr := r.app.Save(r.Record); saveErr != nil {
+		log.Error("Failed to record cron run result", "cron_id", r.CronID, "run_id", r.Record.Id, "error", saveErr)
+	}
+
+	labels := map[string]string{
+		metrics.LabelCronID: r.CronID,
+		metrics.LabelStatus: metricStatus,
+	}
+	metrics.SafeIncrementCounter(metrics.GetInstance(), metrics.MetricCronExecutionTotal, labels)
+	metrics.SafeRecordDuration(metrics.GetInstance(), metrics.MetricCronExecutionDuration, duration, labels)
+
+	return err
+}
+
+// RunCron runs fn as a tracked run of a cron and waits for it to finish.
+// It returns ErrCronRunning without calling fn while another run of the cron holds the lock.
+func RunCron(app core.App, cronID, trigger, instance string, fn func() error) error {
+	run, err := StartCronRun(app, cronID, trigger, instance)
+	if err != nil {
+		return err
+	}
+
+	return run.Execute(fn)
+}
+
+// WithTracking wraps a cron handler for the cron scheduler: each run is recorded in cron_runs, skipped while
+// the previous run is still going and reported in the cron metrics
+func WithTracking(app core.App, cronID, instance string, fn func() error) func() {
+	return func() {
+		err := RunCron(app, cronID, CronTriggerSchedule, instance, fn)
+		switch {
+		case errors.Is(err, ErrCronRunning):
+			log.Warn("Skipped cron run, previous run still in progress", "cron_id", cronID)
+		case err != nil:
+			log.Error(fmt.Sprintf("Cron %s failed", cronID), "error", err)
+		}
+	}
+}
+
+// FindLastCronRun returns the most recent run of a cron, or nil if it never ran
+func FindLastCronRun(app core.App, cronID string) (*CronRunSummary, error) {
+	records, err := app.FindRecordsByFilter(CronRunsCollection, "cron_id = {:cron_id}", "-started_at", 1, 0, dbx.Params{"cron_id": cronID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last run of cron %s: %w", cronID, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return NewCronRunSummary(records[0]), nil
+}
+
+// NewCronRunSummary converts a cron_runs record into a CronRunSummary
+func NewCronRunSummary(record *core.Record) *CronRunSummary {
+	summary := &CronRunSummary{
+		ID:         record.Id,
+		Status:     record.GetString("status"),
+		Trigger:    record.GetString("trigger"),
+		Instance:   record.GetString("instance"),
+		StartedAt:  record.GetDateTime("started_at").Time(),
+		DurationMs: record.GetInt("duration_ms"),
+		Error:      record.GetString("error"),
+	}
+	if finishedAt := record.GetDateTime("finished_at"); !finishedAt.IsZero() {
+		t := finishedAt.Time()
+		summary.FinishedAt = &t
+	}
+
+	return summary
+}
+
+// PruneCronRuns deletes up to limit finished cron runs started before the given time and returns the number deleted
+func PruneCronRuns(app core.App, before time.Time, limit int) (int, error) {
+	records, err := app.FindRecordsByFilter(
+		CronRunsCollection,
+		"finished_at != '' && started_at < {:before}",
+		"started_at",
+		limit,
+		0,
+		dbx.Params{"before": before.UTC().Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired cron runs: %w", err)
+	}
+
+	pruned := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete cron run %s: %w", record.Id, err)
+			}
+			pruned++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,153 @@
+package cronutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// newRunsTestApp bootstraps a PocketBase app in a temp data dir with the cron_runs collection created
+func newRunsTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	cronRuns := core.NewBaseCollection(CronRunsCollection)
+	cronRuns.Fields.Add(
+		&core.TextField{Name: "cron_id", Required: true},
+		&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{CronRunStatusRunning, CronRunStatusCompleted, CronRunStatusFailed}},
+		&core.SelectField{Name: "trigger", MaxSelect: 1, Values: []string{CronTriggerSchedule, CronTriggerManual}},
+		&core.TextField{Name: "instance"},
+		&core.DateField{Name: "started_at", Required: true},
+		&core.DateField{Name: "finished_at"},
+		&core.NumberField{Name: "duration_ms", OnlyInt: true},
+		&core.TextField{Name: "error"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(cronRuns); err != nil {
+		t.Fatalf("failed to create cron_runs collection: %v", err)
+	}
+
+	return app
+}
+
+func TestRunCron_RecordsRuns(t *testing.T) {
+	app := newRunsTestApp(t)
+
+	if err := RunCron(app, "cleanup", CronTriggerSchedule, "instance-1", func() error { return nil }); err != nil {
+		t.Fatalf("RunCron returned error: %v", err)
+	}
+
+	lastRun, err := FindLastCronRun(app, "cleanup")
+	if err != nil || lastRun == nil {
+		t.Fatalf("expected the run to be recorded, got %v", err)
+	}
+	if lastRun.Status != CronRunStatusCompleted || lastRun.Trigger != CronTriggerSchedule || lastRun.Instance != "instance-1" || lastRun.FinishedAt == nil {
+		t.Errorf("unexpected completed run: %+v", lastRun)
+	}
+
+	failure := errors.New("disk full")
+	if err := RunCron(app, "cleanup", CronTriggerManual, "instance-1", func() error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+	if lastRun, _ := FindLastCronRun(app, "cleanup"); lastRun.Status != CronRunStatusFailed || lastRun.Error != "disk full" {
+		t.Errorf("expected a failed run, got %+v", lastRun)
+	}
+
+	err = RunCron(app, "cleanup", CronTriggerSchedule, "instance-1", func() error { panic("boom") })
+	if err == nil {
+		t.Fatal("expected a panicking handler to fail the run")
+	}
+	if lastRun, _ := FindLastCronRun(app, "cleanup"); lastRun.Status != CronRunStatusFailed {
+		t.Errorf("expected the panicking run to be recorded as failed, got %+v", lastRun)
+	}
+
+	if lastRun, err := FindLastCronRun(app, "never"); err != nil || lastRun != nil {
+		t.Errorf("expected no run for a cron that never ran, got %+v (%v)", lastRun, err)
+	}
+}
+
+func TestStartCronRun_SkipsOverlappingRuns(t *testing.T) {
+	app := newRunsTestApp(t)
+
+	run, err := StartCronRun(app, "slow", CronTriggerSchedule, "instance-1")
+	if err != nil {
+		t.Fatalf("StartCronRun returned error: %v", err)
+	}
+
+	// Another instance sharing the database must not start the cron while it is running
+	called := false
+	err = RunCron(app, "slow", CronTriggerSchedule, "instance-2", func() error { called = true; return nil })
+	if !errors.Is(err, ErrCronRunning) || called {
+		t.Fatalf("expected the overlapping run to be skipped, got %v (called %v)", err, called)
+	}
+
+	if _, err := StartCronRun(app, "other", CronTriggerSchedule, "instance-2"); err != nil {
+		t.Errorf("expected other crons to run, got %v", err)
+	}
+
+	if err := run.Execute(func() error { return nil }); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if err := RunCron(app, "slow", CronTriggerSchedule, "instance-2", func() error { return nil }); err != nil {
+		t.Errorf("expected the cron to run once the previous run finished, got %v", err)
+	}
+}
+
+func TestStartCronRun_ReleasesExpiredLock(t *testing.T) {
+	t.Setenv("CRON_LOCK_TIMEOUT_MINUTES", "10")
+
+	app := newRunsTestApp(t)
+
+	abandoned, err := StartCronRun(app, "crashed", CronTriggerSchedule, "instance-1")
+	if err != nil {
+		t.Fatalf("StartCronRun returned error: %v", err)
+	}
+	abandoned.Record.Set("started_at", types.NowDateTime().Add(-time.Hour))
+	if err := app.Save(abandoned.Record); err != nil {
+		t.Fatalf("failed to age run: %v", err)
+	}
+
+	if _, err := StartCronRun(app, "crashed", CronTriggerSchedule, "instance-2"); err != nil {
+		t.Fatalf("expected the expired lock to be released, got %v", err)
+	}
+
+	expired, _ := app.FindRecordById(CronRunsCollection, abandoned.Record.Id)
+	if expired.GetString("status") != CronRunStatusFailed || expired.GetDateTime("finished_at").IsZero() {
+		t.Errorf("expected the abandoned run to be marked as failed, got %s", expired.GetString("status"))
+	}
+}
+
+func TestPruneCronRuns(t *testing.T) {
+	app := newRunsTestApp(t)
+
+	_ = RunCron(app, "cleanup", CronTriggerSchedule, "instance-1", func() error { return nil })
+	running, _ := StartCronRun(app, "slow", CronTriggerSchedule, "instance-1")
+
+	if pruned, _ := PruneCronRuns(app, time.Now().Add(-time.Hour), 100); pruned != 0 {
+		t.Errorf("expected recent runs to be kept, pruned %d", pruned)
+	}
+
+	pruned, err := PruneCronRuns(app, time.Now().Add(time.Minute), 100)
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected the finished run to be pruned, got %d (%v)", pruned, err)
+	}
+	if _, err := app.FindRecordById(CronRunsCollection, running.Record.Id); err != nil {
+		t.Error("expected the running run to be kept")
+	}
+}
@@ -0,0 +1,428 @@
+package cronutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// maxScheduleSearch bounds the search for the next run time; even a leap day schedule fires within 8 years
+const maxScheduleSearch = 8 * 366 * 24 * time.Hour
+
+// MaxUpcomingRuns caps how many fire times NextRunTimes computes at once
+const MaxUpcomingRuns = 100
+
+// everyDescriptor is the prefix of interval expressions such as "@every 10m"
+const everyDescriptor = "@every"
+
+// cronDescriptors maps the supported descriptors to their five-field expression
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes a field of a cron expression and its allowed values
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var (
+	secondField = cronField{"second", 0, 59}
+	cronFields  = []cronField{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		{"day of week", 0, 7}, // 0 and 7 are both Sunday
+	}
+)
+
+// Schedule is a parsed cron expression evaluated in a timezone
+type Schedule struct {
+	Expr     string
+	Location *time.Location
+
+	// every is the interval of an "@every" expression, zero for field based expressions
+	every time.Duration
+
+	minutes  map[int]struct{}
+	hours    map[int]struct{}
+	days     map[int]struct{}
+	months   map[int]struct{}
+	weekdays map[int]struct{}
+}
+
+// LoadTimezone returns the location of an IANA timezone name, empty means UTC
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+
+	return loc, nil
+}
+
+// ParseSchedule parses a five-field cron expression, a descriptor such as "@daily" or an interval such as
+// "@every 10m" to be evaluated in the given IANA timezone (empty means UTC). Unlike ValidateCronExpression
+// it rejects the seconds field and expressions that never fire.
+func ParseSchedule(cronExpr, timezone string) (*Schedule, error) {
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := newSchedule(cronExpr, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := schedule.Next(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// NextRunTime returns the first minute after the given time at which the cron expression fires, evaluated
+// in the given location (nil means UTC)
+func NextRunTime(cronExpr string, after time.Time, loc *time.Location) (time.Time, error) {
+	schedule, err := newSchedule(cronExpr, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(after)
+}
+
+// NextRunTimes returns the next n fire times of the cron expression after the given time, evaluated in the
+// given location (nil means UTC), e.g. to preview a schedule in admin tooling
+func NextRunTimes(cronExpr string, after time.Time, loc *time.Location, n int) ([]time.Time, error) {
+	schedule, err := newSchedule(cronExpr, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule.NextN(after, n)
+}
+
+// Next returns the first minute after the given time at which the schedule fires
+func (s *Schedule) Next(after time.Time) (time.Time, error) {
+	next := after.In(s.Location).Truncate(time.Minute).Add(time.Minute)
+
+	// Intervals are counted from the Unix epoch so every instance agrees on the fire times
+	if s.every > 0 {
+		interval := int64(s.every / time.Second)
+		unix := next.Unix()
+		if rem := unix % interval; rem != 0 {
+			unix += interval - rem
+		}
+		return time.Unix(unix, 0).In(s.Location), nil
+	}
+
+	limit := next.Add(maxScheduleSearch)
+
+	// Skip whole months, days and hours that cannot match instead of checking every minute
+	for next.Before(limit) {
+		if _, ok := s.months[int(next.Month())]; !ok {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, s.Location)
+			continue
+		}
+
+		if !s.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, s.Location)
+			continue
+		}
+
+		if _, ok := s.hours[next.Hour()]; !ok {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, s.Location)
+			continue
+		}
+
+		if _, ok := s.minutes[next.Minute()]; !ok || s.skipsRepeatedHour(next) {
+			next = next.Add(time.Minute)
+			continue
+		}
+
+		return next, nil
+	}
+
+	return time.Time{}, fmt.Errorf("cron expression %q never fires", s.Expr)
+}
+
+// NextN returns the next n fire times of the schedule after the given time, at most MaxUpcomingRuns
+func (s *Schedule) NextN(after time.Time, n int) ([]time.Time, error) {
+	if n < 0 || n > MaxUpcomingRuns {
+		return nil, fmt.Errorf("number of fire times must be between 0 and %d, got %d", MaxUpcomingRuns, n)
+	}
+
+	times := make([]time.Time, 0, n)
+	for range n {
+		next, err := s.Next(after)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, next)
+		after = next
+	}
+
+	return times, nil
+}
+
+// IsDue reports whether the schedule fires in the minute of the given time
+func (s *Schedule) IsDue(t time.Time) bool {
+	t = t.In(s.Location).Truncate(time.Minute)
+
+	if s.every > 0 {
+		return t.Unix()%int64(s.every/time.Second) == 0
+	}
+
+	_, monthOk := s.months[int(t.Month())]
+	_, hourOk := s.hours[t.Hour()]
+	_, minuteOk := s.minutes[t.Minute()]
+
+	return monthOk && hourOk && minuteOk && s.matchesDay(t) && !s.skipsRepeatedHour(t)
+}
+
+// PocketBaseCompatible reports whether the PocketBase cron scheduler, which evaluates expressions in UTC
+// and has no "@every", fires the schedule at the same times
+func (s *Schedule) PocketBaseCompatible() bool {
+	if s.every > 0 || s.Location.String() != time.UTC.String() {
+		return false
+	}
+
+	_, err := cron.NewSchedule(s.Expr)
+	return err == nil
+}
+
+// matchesDay checks both day fields, like the PocketBase scheduler a day must match both of them
+func (s *Schedule) matchesDay(t time.Time) bool {
+	_, dayOk := s.days[t.Day()]
+	_, weekdayOk := s.weekdays[int(t.Weekday())]
+
+	return dayOk && weekdayOk
+}
+
+// skipsRepeatedHour reports whether t is in the second pass of a wall clock hour repeated when DST ends, which
+// schedules with fixed hours skip so they fire once. Schedules running every hour keep firing in both passes.
+func (s *Schedule) skipsRepeatedHour(t time.Time) bool {
+	if len(s.hours) == 24 {
+		return false
+	}
+
+	earlier := t.Add(-time.Hour)
+	return earlier.Hour() == t.Hour() && earlier.Day() == t.Day()
+}
+
+// WithSchedule wraps a handler that is called every minute so that it only runs when the schedule is due
+func WithSchedule(schedule *Schedule, fn func()) func() {
+	return func() {
+		if schedule.IsDue(time.Now()) {
+			fn()
+		}
+	}
+}
+
+// newSchedule parses a five-field expression, descriptor or interval evaluated in loc (nil means UTC)
+func newSchedule(cronExpr string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	fields, every, err := parseCronExpression(cronExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &Schedule{Expr: cronExpr, Location: loc, every: every}
+	if every > 0 {
+		return schedule, nil
+	}
+
+	if len(fields) == 6 {
+		return nil, fmt.Errorf("invalid cron expression %q: the seconds field is not supported by the scheduler, use 5 fields", cronExpr)
+	}
+
+	schedule.minutes = fields[0]
+	schedule.hours = fields[1]
+	schedule.days = fields[2]
+	schedule.months = fields[3]
+	schedule.weekdays = fields[4]
+
+	// 7 is an alias of Sunday
+	if _, ok := schedule.weekdays[7]; ok {
+		delete(schedule.weekdays, 7)
+		schedule.weekdays[0] = struct{}{}
+	}
+
+	return schedule, nil
+}
+
+// parseCronExpression parses the fields of a five or six-field expression (with leading seconds) or a
+// descriptor. For "@every" expressions it returns the interval instead of fields.
+func parseCronExpression(cronExpr string) ([]map[int]struct{}, time.Duration, error) {
+	expr := strings.TrimSpace(cronExpr)
+	if expr == "" {
+		return nil, 0, errors.New("cron expression cannot be empty")
+	}
+
+	if strings.HasPrefix(expr, "@") {
+		if interval, ok := strings.CutPrefix(expr, everyDescriptor); ok {
+			every, err := parseEvery(strings.TrimSpace(interval))
+			return nil, every, err
+		}
+
+		descriptor, ok := cronDescriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unknown cron descriptor %q, expected one of %s or @every <duration>", expr, strings.Join(descriptorNames(), ", "))
+		}
+		expr = descriptor
+	}
+
+	// Standard cron has 5 fields: minute hour day month weekday
+	// Some systems support 6 fields with seconds as the first field
+	parts := strings.Fields(expr)
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, 0, fmt.Errorf("invalid cron expression: expected 5 or 6 fields, got %d", len(parts))
+	}
+
+	fieldDefs := cronFields
+	if len(parts) == 6 {
+		fieldDefs = append([]cronField{secondField}, cronFields...)
+	}
+
+	fields := make([]map[int]struct{}, 0, len(parts))
+	for i, part := range parts {
+		values, err := parseCronField(part, fieldDefs[i])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid %s field %q: %w", fieldDefs[i].name, part, err)
+		}
+		fields = append(fields, values)
+	}
+
+	return fields, 0, nil
+}
+
+// parseEvery parses the duration of an "@every" expression, which must be a whole number of minutes
+func parseEvery(interval string) (time.Duration, error) {
+	if interval == "" {
+		return 0, errors.New("invalid @every expression: missing duration, e.g. @every 10m")
+	}
+
+	every, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid @every duration %q, expected a duration such as 10m or 1h30m", interval)
+	}
+	if every < time.Minute {
+		return 0, fmt.Errorf("invalid @every duration %q: the interval must be at least 1m", interval)
+	}
+	if every%time.Minute != 0 {
+		return 0, fmt.Errorf("invalid @every duration %q: the interval must be a whole number of minutes", interval)
+	}
+
+	return every, nil
+}
+
+// parseCronField returns the values matched by a field made of a comma separated list of "*", "?",
+// values, ranges ("1-5") and steps ("*/15", "1-30/5", "5/15")
+func parseCronField(value string, field cronField) (map[int]struct{}, error) {
+	values := map[int]struct{}{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item == "" {
+			return nil, errors.New("empty list item")
+		}
+
+		base, stepValue, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepValue)
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("step %q must be a positive number", stepValue)
+			}
+			if parsed > field.max-field.min {
+				return nil, fmt.Errorf("step %d is larger than the %d-%d range of the field", parsed, field.min, field.max)
+			}
+			step = parsed
+		}
+
+		start, end := field.min, field.max
+		switch {
+		case base == "*" || base == "?":
+		case strings.Contains(base, "-"):
+			from, to, _ := strings.Cut(base, "-")
+
+			var err error
+			if start, err = parseCronValue(from, field); err != nil {
+				return nil, fmt.Errorf("range %q: %w", base, err)
+			}
+			if end, err = parseCronValue(to, field); err != nil {
+				return nil, fmt.Errorf("range %q: %w", base, err)
+			}
+			if start > end {
+				return nil, fmt.Errorf("range %q: start %d is greater than end %d", base, start, end)
+			}
+		default:
+			parsed, err := parseCronValue(base, field)
+			if err != nil {
+				return nil, err
+			}
+
+			// A stepped single value ("5/15") runs from the value to the end of the field
+			start = parsed
+			if !hasStep {
+				end = parsed
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			values[i] = struct{}{}
+		}
+	}
+
+	return values, nil
+}
+
+// parseCronValue parses a single numeric value of a field and checks its bounds
+func parseCronValue(value string, field cronField) (int, error) {
+	if value == "" {
+		return 0, errors.New("missing value")
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q, expected a number between %d and %d", value, field.min, field.max)
+	}
+
+	if int(parsed) < field.min || int(parsed) > field.max {
+		return 0, fmt.Errorf("value %d is out of range %d-%d", parsed, field.min, field.max)
+	}
+
+	return int(parsed), nil
+}
+
+// descriptorNames returns the supported descriptors in alphabetical order
+func descriptorNames() []string {
+	names := make([]string, 0, len(cronDescriptors))
+	for name := range cronDescriptors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
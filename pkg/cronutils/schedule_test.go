@@ -0,0 +1,228 @@
+package cronutils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRunTime(t *testing.T) {
+	after := time.Date(2026, 3, 7, 10, 17, 42, 0, time.UTC) // Saturday
+
+	tests := []struct {
+		name     string
+		cronExpr string
+		expected time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2026, 3, 7, 10, 18, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", time.Date(2026, 3, 7, 10, 30, 0, 0, time.UTC)},
+		{"later today", "0 14 * * *", time.Date(2026, 3, 7, 14, 0, 0, 0, time.UTC)},
+		{"tomorrow", "0 9 * * *", time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"weekday", "0 9 * * 1-5", time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{"next month", "0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"macro", "@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := NextRunTime(tt.cronExpr, after, nil)
+			if err != nil {
+				t.Fatalf("NextRunTime returned error: %v", err)
+			}
+			if !next.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, next)
+			}
+		})
+	}
+
+	if _, err := NextRunTime("0 0 31 2 *", after, nil); err == nil {
+		t.Error("expected an expression that never fires to be rejected")
+	}
+	if _, err := NextRunTime("0 0 * *", after, nil); err == nil {
+		t.Error("expected an invalid expression to be rejected")
+	}
+}
+
+func TestNextRunTime_Timezone(t *testing.T) {
+	loc, err := LoadTimezone("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadTimezone returned error: %v", err)
+	}
+
+	// Clocks in Berlin move from 02:00 to 03:00 on 2026-03-29, so 02:30 does not exist that day
+	next, err := NextRunTime("30 2 * * *", time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC), loc)
+	if err != nil {
+		t.Fatalf("NextRunTime returned error: %v", err)
+	}
+	if expected := time.Date(2026, 3, 30, 2, 30, 0, 0, loc); !next.Equal(expected) {
+		t.Errorf("expected the skipped run to move to %v, got %v", expected, next)
+	}
+
+	// Clocks in Berlin move from 03:00 back to 02:00 on 2026-10-25, so 02:30 happens twice that day
+	next, _ = NextRunTime("30 2 * * *", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), loc)
+	if expected := time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("expected the first 02:30 (%v), got %v", expected, next)
+	}
+	next, _ = NextRunTime("30 2 * * *", next, loc)
+	if expected := time.Date(2026, 10, 26, 1, 30, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("expected the repeated 02:30 to be skipped (%v), got %v", expected, next)
+	}
+	next, _ = NextRunTime("30 * * * *", time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC), loc)
+	if expected := time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("expected an hourly schedule to fire in the repeated hour (%v), got %v", expected, next)
+	}
+
+	next, _ = NextRunTime("0 9 * * *", time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC), loc)
+	if expected := time.Date(2026, 1, 11, 8, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("expected 09:00 Berlin time (%v), got %v", expected, next)
+	}
+
+	if _, err := LoadTimezone("Mars/Olympus"); err == nil {
+		t.Error("expected an unknown timezone to be rejected")
+	}
+}
+
+func TestNextRunTime_Descriptors(t *testing.T) {
+	after := time.Date(2026, 3, 7, 10, 17, 42, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		cronExpr string
+		expected time.Time
+	}{
+		{"hourly", "@hourly", time.Date(2026, 3, 7, 11, 0, 0, 0, time.UTC)},
+		{"daily", "@daily", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"weekly", "@weekly", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"every 10 minutes", "@every 10m", time.Date(2026, 3, 7, 10, 20, 0, 0, time.UTC)},
+		{"every 90 minutes", "@every 90m", time.Date(2026, 3, 7, 10, 30, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"stepped value", "5/20 * * * *", time.Date(2026, 3, 7, 10, 25, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := NextRunTime(tt.cronExpr, after, nil)
+			if err != nil {
+				t.Fatalf("NextRunTime returned error: %v", err)
+			}
+			if !next.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, next)
+			}
+		})
+	}
+
+	if _, err := NextRunTime("0 0 0 * * *", after, nil); err == nil {
+		t.Error("expected the seconds field to be rejected by the scheduler")
+	}
+}
+
+func TestNextRunTimes(t *testing.T) {
+	loc, err := LoadTimezone("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadTimezone returned error: %v", err)
+	}
+
+	times, err := NextRunTimes("0 2 * * 1-5", time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC), loc, 3)
+	if err != nil {
+		t.Fatalf("NextRunTimes returned error: %v", err)
+	}
+
+	// The weekend is skipped and the runs after the DST change on 2026-03-08 stay at 02:00 local time
+	expected := []time.Time{
+		time.Date(2026, 3, 9, 2, 0, 0, 0, loc),
+		time.Date(2026, 3, 10, 2, 0, 0, 0, loc),
+		time.Date(2026, 3, 11, 2, 0, 0, 0, loc),
+	}
+	if len(times) != len(expected) {
+		t.Fatalf("expected %d fire times, got %v", len(expected), times)
+	}
+	for i := range expected {
+		if !times[i].Equal(expected[i]) {
+			t.Errorf("fire time %d: expected %v, got %v", i, expected[i], times[i])
+		}
+	}
+	if times[0].Location() != loc {
+		t.Errorf("expected fire times in %v, got %v", loc, times[0].Location())
+	}
+
+	every, err := NextRunTimes("@every 10m", time.Date(2026, 3, 7, 10, 17, 0, 0, time.UTC), nil, 3)
+	if err != nil {
+		t.Fatalf("NextRunTimes returned error: %v", err)
+	}
+	for i, minute := range []int{20, 30, 40} {
+		if every[i].Minute() != minute {
+			t.Errorf("fire time %d: expected minute %d, got %v", i, minute, every[i])
+		}
+	}
+
+	if _, err := NextRunTimes("* * * * *", time.Now(), nil, MaxUpcomingRuns+1); err == nil {
+		t.Error("expected too many fire times to be rejected")
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("0 9 * * *", "Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("ParseSchedule returned error: %v", err)
+	}
+
+	// 09:00 in Tokyo is 00:00 UTC
+	if !schedule.IsDue(time.Date(2026, 5, 1, 0, 0, 30, 0, time.UTC)) {
+		t.Error("expected the schedule to be due at 09:00 Tokyo time")
+	}
+	if schedule.IsDue(time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Error("expected the schedule not to be due at 09:00 UTC")
+	}
+	if schedule.PocketBaseCompatible() {
+		t.Error("expected a schedule outside UTC to need its own evaluation")
+	}
+
+	every, err := ParseSchedule("@every 15m", "")
+	if err != nil {
+		t.Fatalf("ParseSchedule returned error: %v", err)
+	}
+	if !every.IsDue(time.Date(2026, 5, 1, 10, 45, 0, 0, time.UTC)) || every.IsDue(time.Date(2026, 5, 1, 10, 50, 0, 0, time.UTC)) {
+		t.Error("expected @every 15m to be due on quarter hours only")
+	}
+	if every.PocketBaseCompatible() {
+		t.Error("expected @every to need its own evaluation")
+	}
+
+	if daily, _ := ParseSchedule("0 2 * * *", ""); daily == nil || !daily.PocketBaseCompatible() {
+		t.Error("expected a UTC five-field schedule to run on the PocketBase scheduler")
+	}
+
+	invalid := []struct {
+		cronExpr string
+		timezone string
+	}{
+		{"0 0 0 * * *", ""},
+		{"0 0 31 2 *", ""},
+		{"*/0 * * * *", ""},
+		{"0 9 * * *", "Mars/Olympus"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseSchedule(tt.cronExpr, tt.timezone); err == nil {
+			t.Errorf("expected %q in %q to be rejected", tt.cronExpr, tt.timezone)
+		}
+	}
+}
+
+func TestWithSchedule(t *testing.T) {
+	calls := 0
+	fn := func() { calls++ }
+
+	always, _ := ParseSchedule("* * * * *", "")
+	WithSchedule(always, fn)()
+
+	// Only fires on the 29th of February in a far away timezone, so it is never due in this test
+	never, _ := ParseSchedule("0 0 29 2 *", "Pacific/Kiritimati")
+	if never.IsDue(time.Now()) {
+		t.Skip("the test ran on the only minute the schedule fires")
+	}
+	WithSchedule(never, fn)()
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run only when due, got %d calls", calls)
+	}
+}
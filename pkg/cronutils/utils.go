@@ -1,10 +1,8 @@
 package cronutils
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
 	log "ims-pocketbase-baas-starter/pkg/logger"
@@ -12,22 +10,46 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-// CronExecutionContext provides common utilities for cron execution
+// ProgressReporter persists and publishes the progress of a running job
+type ProgressReporter func(done, total int, message string) error
+
+// CronExecutionContext provides common utilities for cron execution. It embeds the context.Context of the
+// execution, so it can be passed to context-aware APIs and handlers can stop once it is done (e.g. on a job timeout).
 type CronExecutionContext struct {
+	context.Context
+
 	App       *pocketbase.PocketBase
 	CronID    string
 	StartTime time.Time
+
+	progressReporter ProgressReporter
 }
 
 // NewCronExecutionContext creates a new job execution context
 func NewCronExecutionContext(app *pocketbase.PocketBase, CronID string) *CronExecutionContext {
 	return &CronExecutionContext{
+		Context:   context.Background(),
 		App:       app,
 		CronID:    CronID,
 		StartTime: time.Now(),
 	}
 }
 
+// SetProgressReporter sets the reporter used by ReportProgress (set by the job processor for queued jobs)
+func (ctx *CronExecutionContext) SetProgressReporter(reporter ProgressReporter) {
+	ctx.progressReporter = reporter
+}
+
+// ReportProgress reports how many of the total units of work are done. Outside of queued jobs it only logs the progress.
+func (ctx *CronExecutionContext) ReportProgress(done, total int, message string) error {
+	if ctx.progressReporter == nil {
+		log.Debug(fmt.Sprintf("Job %s progress", ctx.CronID), "done", done, "total", total, "message", message)
+		return nil
+	}
+
+	return ctx.progressReporter(done, total, message)
+}
+
 // LogStart logs the start of a job execution
 func (ctx *CronExecutionContext) LogStart(message string) {
 	log.Info(fmt.Sprintf("Job %s started", ctx.CronID), "message", message, "start_time", ctx.StartTime)
@@ -62,108 +84,10 @@ func WithRecovery(app *pocketbase.PocketBase, CronID string, jobFunc func()) fun
 	}
 }
 
-// ValidateCronExpression validates a cron expression format
+// ValidateCronExpression validates a five or six-field cron expression (with leading seconds), a descriptor
+// such as "@hourly" or "@daily", or an interval such as "@every 10m". Errors name the offending field, e.g.
+// `invalid minute field "*/0": step "0" must be a positive number`.
 func ValidateCronExpression(cronExpr string) error {
-	if cronExpr == "" {
-		return fmt.Errorf("cron expression cannot be empty")
-	}
-
-	// Split the expression into fields
-	fields := strings.Fields(cronExpr)
-
-	// Standard cron has 5 fields: minute hour day month weekday
-	// Some systems support 6 fields with seconds as the first field
-	if len(fields) != 5 && len(fields) != 6 {
-		return fmt.Errorf("invalid cron expression: expected 5 or 6 fields, got %d", len(fields))
-	}
-
-	// Regular expression for validating each field
-	// Supports: numbers, ranges (1-5), lists (1,3,5), steps (*/5, 1-10/2), wildcards (*)
-	fieldPattern := `^(\*(/\d+)?|(\d+(-\d+)?(,\d+(-\d+)?)*)(\/\d+)?|\?)$`
-
-	fieldRegex := regexp.MustCompile(fieldPattern)
-
-	// Field ranges for validation (min-max values)
-	var fieldRanges [][]int
-	if len(fields) == 6 {
-		// With seconds field: second, minute, hour, day, month, weekday
-		fieldRanges = [][]int{{0, 59}, {0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
-	} else {
-		// Standard 5-field: minute, hour, day, month, weekday
-		fieldRanges = [][]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
-	}
-
-	// Validate each field
-	for i, field := range fields {
-		// Check basic pattern
-		if !fieldRegex.MatchString(field) {
-			return fmt.Errorf("invalid cron field %d: %s", i+1, field)
-		}
-
-		// Skip wildcard and question mark
-		if field == "*" || field == "?" {
-			continue
-		}
-
-		// Validate numeric ranges
-		if err := validateFieldRange(field, fieldRanges[i][0], fieldRanges[i][1]); err != nil {
-			return fmt.Errorf("invalid cron field %d: %v", i+1, err)
-		}
-	}
-
-	return nil
-}
-
-// validateFieldRange validates that numeric values in a cron field are within acceptable ranges
-func validateFieldRange(field string, min, max int) error {
-	// Handle step notation (e.g., "*/5" or "1-10/2")
-	parts := strings.Split(field, "/")
-	baseField := parts[0]
-
-	// If it starts with *, it's a step pattern like */5
-	if baseField == "*" {
-		return nil // */N is always valid for step patterns
-	}
-
-	// Handle comma-separated values
-	values := strings.Split(baseField, ",")
-	for _, value := range values {
-		// Handle range notation (e.g., "1-5")
-		if strings.Contains(value, "-") {
-			rangeParts := strings.Split(value, "-")
-			if len(rangeParts) != 2 {
-				return fmt.Errorf("invalid range format: %s", value)
-			}
-
-			start, err := strconv.Atoi(rangeParts[0])
-			if err != nil {
-				return fmt.Errorf("invalid range start: %s", rangeParts[0])
-			}
-
-			end, err := strconv.Atoi(rangeParts[1])
-			if err != nil {
-				return fmt.Errorf("invalid range end: %s", rangeParts[1])
-			}
-
-			if start < min || start > max || end < min || end > max {
-				return fmt.Errorf("range %s outside valid bounds [%d-%d]", value, min, max)
-			}
-
-			if start > end {
-				return fmt.Errorf("invalid range: start %d greater than end %d", start, end)
-			}
-		} else {
-			// Handle single numeric value
-			num, err := strconv.Atoi(value)
-			if err != nil {
-				return fmt.Errorf("invalid numeric value: %s", value)
-			}
-
-			if num < min || num > max {
-				return fmt.Errorf("value %d outside valid bounds [%d-%d]", num, min, max)
-			}
-		}
-	}
-
-	return nil
+	_, _, err := parseCronExpression(cronExpr)
+	return err
 }
@@ -21,6 +21,14 @@ func TestValidateCronExpression(t *testing.T) {
 		{"valid complex", "0,15,30,45 8-17 * * 1-5", false},
 		{"valid 6-field with seconds", "0 0 0 * * *", false},
 		{"valid wildcard", "* * * * *", false},
+		{"valid stepped range", "0 8-18/2 * * *", false},
+		{"valid stepped value", "5/15 * * * *", false},
+		{"valid list of steps", "0,30 */6,23 * * *", false},
+		{"valid sunday as 7", "0 0 * * 7", false},
+		{"valid descriptor", "@hourly", false},
+		{"valid daily descriptor", "@daily", false},
+		{"valid every", "@every 10m", false},
+		{"valid every hours", "@every 1h30m", false},
 
 		// Invalid expressions
 		{"empty expression", "", true},
@@ -35,6 +43,16 @@ func TestValidateCronExpression(t *testing.T) {
 		{"invalid character", "0 0 * * X", true},
 		{"negative value", "0 0 -1 * *", true},
 		{"invalid range format", "0 0 1-2-3 * *", true},
+		{"zero step", "*/0 * * * *", true},
+		{"step larger than field", "*/60 * * * *", true},
+		{"non numeric step", "*/x * * * *", true},
+		{"stepped range out of bounds", "0 8-25/2 * * *", true},
+		{"empty list item", "0,,30 * * * *", true},
+		{"unknown descriptor", "@fortnightly", true},
+		{"every without duration", "@every", true},
+		{"every below a minute", "@every 30s", true},
+		{"every with seconds", "@every 90s", true},
+		{"every invalid duration", "@every soon", true},
 	}
 
 	for _, tt := range tests {
@@ -50,6 +68,29 @@ func TestValidateCronExpression(t *testing.T) {
 	}
 }
 
+func TestValidateCronExpression_ErrorMessages(t *testing.T) {
+	tests := []struct {
+		cronExpr string
+		expected string
+	}{
+		{"*/0 * * * *", `invalid minute field "*/0": step "0" must be a positive number`},
+		{"0 */30 * * *", `invalid hour field "*/30": step 30 is larger than the 0-23 range of the field`},
+		{"0 0 5-3 * *", `invalid day of month field "5-3": range "5-3": start 5 is greater than end 3`},
+		{"0 0 * 13 *", `invalid month field "13": value 13 is out of range 1-12`},
+		{"0 0 * * MON", `invalid day of week field "MON": invalid value "MON", expected a number between 0 and 7`},
+		{"@every 90s", `invalid @every duration "90s": the interval must be a whole number of minutes`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cronExpr, func(t *testing.T) {
+			err := ValidateCronExpression(tt.cronExpr)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
 func TestNewCronExecutionContext(t *testing.T) {
 	app := pocketbase.New()
 	cronID := "test-cron-123"
@@ -71,6 +112,10 @@ func TestNewCronExecutionContext(t *testing.T) {
 	if ctx.StartTime.IsZero() {
 		t.Error("Expected StartTime to be set")
 	}
+
+	if ctx.Context == nil || ctx.Err() != nil {
+		t.Error("Expected an active background context")
+	}
 }
 
 func TestCronExecutionContext_LogMethods(t *testing.T) {
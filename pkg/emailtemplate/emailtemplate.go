@@ -0,0 +1,370 @@
+// Package emailtemplate renders the email templates of the app. Templates are read from the defaults embedded
+// in the templates package, overridden by the files of EMAIL_TEMPLATES_DIR, and cached once parsed.
+//
+// A template is a <name>.html and/or <name>.txt file, with locale variants named <name>.<locale>.html
+// (e.g. welcome.fr.html). The files of the layouts and partials directories with the same extension are
+// parsed with every template, so a template can define blocks and execute a layout:
+//
+//	{{define "title"}}Welcome{{end}}
+//	{{define "content"}}<p>Hi {{.Name}}</p>{{end}}
+//	{{template "base" .}}
+package emailtemplate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"text/template/parse"
+
+	"ims-pocketbase-baas-starter/pkg/cache"
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/templates"
+)
+
+const (
+	// DefaultDir is the directory whose templates override the embedded defaults
+	DefaultDir = "templates/emails"
+	// DefaultLocale is the locale of templates without a locale in their name
+	DefaultLocale = "en"
+
+	layoutsDir  = "layouts"
+	partialsDir = "partials"
+)
+
+// Extensions are the template file extensions, HTML templates are escaped as HTML and text templates are not
+var Extensions = []string{".html", ".txt"}
+
+// ErrNotFound is returned for templates without any file
+var ErrNotFound = errors.New("email template not found")
+
+var (
+	namePattern   = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	localePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Engine renders email templates
+type Engine struct {
+	fsys          fs.FS
+	cache         *cache.CacheService
+	defaultLocale string
+}
+
+// template is a parsed template file with the layouts and partials it may use
+type template struct {
+	file    string
+	execute func(io.Writer, any) error
+}
+
+var (
+	instance *Engine
+	once     sync.Once
+)
+
+// GetInstance returns the engine of the embedded templates overridden by EMAIL_TEMPLATES_DIR, caching
+// templates in the global cache service
+func GetInstance() *Engine {
+	once.Do(func() {
+		defaults, err := fs.Sub(templates.Emails, "emails")
+		if err != nil {
+			panic(err) // the embedded directory always exists
+		}
+
+		instance = New(
+			defaults,
+			common.GetEnv("EMAIL_TEMPLATES_DIR", DefaultDir),
+			cache.GetInstance(),
+			common.GetEnv("EMAIL_DEFAULT_LOCALE", DefaultLocale),
+		)
+	})
+	return instance
+}
+
+// New creates an engine reading the templates of dir, then of defaults. An empty dir only uses defaults and
+// a missing one is ignored.
+func New(defaults fs.FS, dir string, cacheService *cache.CacheService, defaultLocale string) *Engine {
+	fsys := defaults
+	if dir != "" {
+		fsys = overlayFS{os.DirFS(dir), defaults}
+	}
+
+	return &Engine{
+		fsys:          fsys,
+		cache:         cacheService,
+		defaultLocale: normalizeLocale(defaultLocale),
+	}
+}
+
+// Render renders the HTML and text files of a template in the variant of a locale, falling back to the
+// language of the locale, the default locale and the file without locale. Either content is empty when the
+// template has no file of that type.
+func (e *Engine) Render(name, locale string, data any) (string, string, error) {
+	var contents [2]string
+	found := false
+
+	for i, extension := range Extensions {
+		tmpl, err := e.load(name, locale, extension)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		found = true
+
+		var buf bytes.Buffer
+		if err := tmpl.execute(&buf, data); err != nil {
+			return "", "", fmt.Errorf("failed to execute email template %s: %w", tmpl.file, err)
+		}
+		contents[i] = buf.String()
+	}
+
+	if !found {
+		return "", "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return contents[0], contents[1], nil
+}
+
+// Validate parses every template with the layouts and partials, so syntax errors and calls of undefined
+// templates are reported at startup instead of when an email is sent
+func (e *Engine) Validate() error {
+	entries, err := fs.ReadDir(e.fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to list email templates: %w", err)
+	}
+
+	var errs []error
+	for _, extension := range Extensions {
+		// Broken layouts or partials would fail every template, they are reported once
+		if _, err := e.parse("", nil, extension); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || path.Ext(entry.Name()) != extension {
+				continue
+			}
+			if _, err := e.compile(entry.Name(), extension); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Invalidate drops the parsed templates, so changed files are read again. Cached templates also expire with
+// the default expiration of the cache service.
+func (e *Engine) Invalidate() int {
+	return e.cache.InvalidateEmailTemplateCache()
+}
+
+// load returns the parsed variant of a template for a locale, from the cache when it was parsed before
+func (e *Engine) load(name, locale, extension string) (*template, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid email template name %q", name)
+	}
+	locale = normalizeLocale(locale)
+
+	key := cache.CacheKey{}.EmailTemplate(name, locale, extension)
+	if cached, ok := e.cache.Get(key); ok {
+		if tmpl, ok := cached.(*template); ok {
+			return tmpl, nil
+		}
+	}
+
+	for _, candidate := range e.variants(name, locale) {
+		file := candidate + extension
+		if _, err := fs.Stat(e.fsys, file); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read email template %s: %w", file, err)
+		}
+
+		tmpl, err := e.compile(file, extension)
+		if err != nil {
+			return nil, err
+		}
+
+		e.cache.Set(key, tmpl)
+		return tmpl, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// variants returns the file names of a template to try for a locale, most specific first
+func (e *Engine) variants(name, locale string) []string {
+	var variants []string
+	for _, l := range []string{locale, e.defaultLocale} {
+		if l == "" {
+			continue
+		}
+		variants = append(variants, name+"."+l)
+		if language, _, ok := strings.Cut(l, "-"); ok {
+			variants = append(variants, name+"."+language)
+		}
+	}
+	return append(slices.Compact(variants), name)
+}
+
+// compile parses a template file with the layouts and partials
+func (e *Engine) compile(file, extension string) (*template, error) {
+	content, err := fs.ReadFile(e.fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email template %s: %w", file, err)
+	}
+
+	return e.parse(file, content, extension)
+}
+
+// parse parses the layouts and partials of an extension, then content as the template named file
+func (e *Engine) parse(file string, content []byte, extension string) (*template, error) {
+	var shared []string
+	for _, dir := range []string{layoutsDir, partialsDir} {
+		entries, err := fs.ReadDir(e.fsys, dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to list email template %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && path.Ext(entry.Name()) == extension {
+				shared = append(shared, path.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	sharedContents := make([]string, len(shared))
+	for i, sharedFile := range shared {
+		sharedContent, err := fs.ReadFile(e.fsys, sharedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template %s: %w", sharedFile, err)
+		}
+		sharedContents[i] = string(sharedContent)
+	}
+
+	// The template is parsed last, so its definitions replace the blocks of layouts. Without a template
+	// file only the layouts and partials are parsed, their calls are checked with the templates.
+	if extension == ".txt" {
+		root := texttemplate.New(file)
+		for i, name := range shared {
+			if _, err := root.New(name).Parse(sharedContents[i]); err != nil {
+				return nil, fmt.Errorf("invalid email template %s: %w", name, err)
+			}
+		}
+		if file == "" {
+			return nil, nil
+		}
+		if _, err := root.Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("invalid email template %s: %w", file, err)
+		}
+		if err := checkTemplateCalls(textTrees(root.Templates()), file); err != nil {
+			return nil, fmt.Errorf("invalid email template %s: %w", file, err)
+		}
+		return &template{file: file, execute: root.Execute}, nil
+	}
+
+	root := htmltemplate.New(file)
+	for i, name := range shared {
+		if _, err := root.New(name).Parse(sharedContents[i]); err != nil {
+			return nil, fmt.Errorf("invalid email template %s: %w", name, err)
+		}
+	}
+	if file == "" {
+		return nil, nil
+	}
+	if _, err := root.Parse(string(content)); err != nil {
+		return nil, fmt.Errorf("invalid email template %s: %w", file, err)
+	}
+	if err := checkTemplateCalls(htmlTrees(root.Templates()), file); err != nil {
+		return nil, fmt.Errorf("invalid email template %s: %w", file, err)
+	}
+	return &template{file: file, execute: root.Execute}, nil
+}
+
+func textTrees(templates []*texttemplate.Template) map[string]*parse.Tree {
+	trees := map[string]*parse.Tree{}
+	for _, t := range templates {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+func htmlTrees(templates []*htmltemplate.Template) map[string]*parse.Tree {
+	trees := map[string]*parse.Tree{}
+	for _, t := range templates {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+// checkTemplateCalls reports the {{template}} calls of undefined templates that executing root can reach,
+// which Go templates only report when they are executed
+func checkTemplateCalls(trees map[string]*parse.Tree, root string) error {
+	var errs []error
+	visited := map[string]bool{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		visited[name] = true
+		walkTemplateCalls(trees[name].Root, func(node *parse.TemplateNode) {
+			switch _, ok := trees[node.Name]; {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%s calls undefined template %q", name, node.Name))
+			case !visited[node.Name]:
+				visit(node.Name)
+			}
+		})
+	}
+
+	if _, ok := trees[root]; ok {
+		visit(root)
+	}
+	return errors.Join(errs...)
+}
+
+func walkTemplateCalls(node parse.Node, visit func(*parse.TemplateNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateCalls(child, visit)
+		}
+	case *parse.TemplateNode:
+		visit(n)
+	case *parse.IfNode:
+		walkTemplateCalls(n.List, visit)
+		walkTemplateCalls(n.ElseList, visit)
+	case *parse.RangeNode:
+		walkTemplateCalls(n.List, visit)
+		walkTemplateCalls(n.ElseList, visit)
+	case *parse.WithNode:
+		walkTemplateCalls(n.List, visit)
+		walkTemplateCalls(n.ElseList, visit)
+	}
+}
+
+// normalizeLocale lowercases a locale and uses dashes as separator (fr_CA becomes fr-ca), invalid locales
+// are dropped
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
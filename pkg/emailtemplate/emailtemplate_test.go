@@ -0,0 +1,206 @@
+package emailtemplate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cache"
+)
+
+// testDefaults returns embedded-like defaults with a layout, a partial and a French variant
+func testDefaults() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html":   {Data: []byte(`{{define "base"}}<h1>{{template "title" .}}</h1>{{template "content" .}}<footer>{{block "footer" .}}Bye{{end}}</footer>{{end}}`)},
+		"layouts/base.txt":    {Data: []byte(`{{define "base"}}# {{template "title" .}}{{"\n"}}{{template "content" .}}{{end}}`)},
+		"partials/sign.html":  {Data: []byte(`{{define "sign"}}<i>{{.AppName}}</i>{{end}}`)},
+		"partials/sign.txt":   {Data: []byte(`{{define "sign"}}-- {{.AppName}}{{end}}`)},
+		"hello.html":          {Data: []byte(`{{define "title"}}Hello{{end}}{{define "content"}}<p>{{.Name}}</p>{{template "sign" .}}{{end}}{{template "base" .}}`)},
+		"hello.txt":           {Data: []byte(`{{define "title"}}Hello{{end}}{{define "content"}}{{.Name}} & co {{template "sign" .}}{{end}}{{template "base" .}}`)},
+		"hello.fr.html":       {Data: []byte(`{{define "title"}}Bonjour{{end}}{{define "content"}}<p>{{.Name}}</p>{{end}}{{define "footer"}}Salut{{end}}{{template "base" .}}`)},
+		"html_only.html":      {Data: []byte(`<p>{{.Name}}</p>`)},
+		"layouts/ignored.md":  {Data: []byte(`{{broken`)},
+		"partials/nested/x":   {Data: []byte(`{{broken`)},
+		"partials/README.txt": {Data: []byte(`{{define "readme"}}{{end}}`)},
+	}
+}
+
+func newTestCache() *cache.CacheService {
+	return cache.NewCacheService(cache.CacheConfig{
+		DefaultExpiration: time.Minute,
+		CleanupInterval:   time.Minute,
+	})
+}
+
+func TestEngine_RenderLayoutAndPartials(t *testing.T) {
+	engine := New(testDefaults(), "", newTestCache(), DefaultLocale)
+
+	html, text, err := engine.Render("hello", "", map[string]any{"Name": "<Ada>", "AppName": "IMS"})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	if html != "<h1>Hello</h1><p>&lt;Ada&gt;</p><i>IMS</i><footer>Bye</footer>" {
+		t.Errorf("unexpected HTML content %q", html)
+	}
+	// Text templates are not HTML escaped
+	if text != "# Hello\n<Ada> & co -- IMS" {
+		t.Errorf("unexpected text content %q", text)
+	}
+}
+
+func TestEngine_RenderLocaleFallback(t *testing.T) {
+	engine := New(testDefaults(), "", newTestCache(), DefaultLocale)
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"fr", "<h1>Bonjour</h1><p>Ada</p><footer>Salut</footer>"},
+		{"fr_CA", "<h1>Bonjour</h1><p>Ada</p><footer>Salut</footer>"},
+		{"de", "<h1>Hello</h1><p>Ada</p><i>IMS</i><footer>Bye</footer>"},
+		{"", "<h1>Hello</h1><p>Ada</p><i>IMS</i><footer>Bye</footer>"},
+		{"../fr", "<h1>Hello</h1><p>Ada</p><i>IMS</i><footer>Bye</footer>"},
+	}
+
+	for _, tt := range tests {
+		html, text, err := engine.Render("hello", tt.locale, map[string]any{"Name": "Ada", "AppName": "IMS"})
+		if err != nil {
+			t.Fatalf("Render(%q) returned error: %v", tt.locale, err)
+		}
+		if html != tt.want {
+			t.Errorf("Render(%q) HTML = %q, want %q", tt.locale, html, tt.want)
+		}
+		// The text template has no French variant
+		if !strings.HasPrefix(text, "# Hello") {
+			t.Errorf("Render(%q) text = %q, want the default text", tt.locale, text)
+		}
+	}
+
+	// The default locale is tried before the file without locale
+	engine = New(testDefaults(), "", newTestCache(), "fr")
+	if html, _, _ := engine.Render("hello", "de", map[string]any{"Name": "Ada"}); !strings.Contains(html, "Bonjour") {
+		t.Errorf("expected the default locale variant, got %q", html)
+	}
+}
+
+func TestEngine_RenderMissingFiles(t *testing.T) {
+	engine := New(testDefaults(), "", newTestCache(), DefaultLocale)
+
+	html, text, err := engine.Render("html_only", "", map[string]any{"Name": "Ada"})
+	if err != nil || html != "<p>Ada</p>" || text != "" {
+		t.Errorf("expected only HTML content, got %q, %q (%v)", html, text, err)
+	}
+
+	if _, _, err := engine.Render("missing", "", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, name := range []string{"../hello", "layouts/base", "hello.fr", ""} {
+		if _, _, err := engine.Render(name, "", nil); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %q to be rejected as an invalid name, got %v", name, err)
+		}
+	}
+}
+
+func TestEngine_DiskOverrideAndInvalidate(t *testing.T) {
+	dir := t.TempDir()
+	cacheService := newTestCache()
+	engine := New(testDefaults(), dir, cacheService, DefaultLocale)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Overridden partials are used by the embedded templates
+	write("partials/sign.html", `{{define "sign"}}<b>{{.AppName}}</b>{{end}}`)
+	html, _, err := engine.Render("hello", "", map[string]any{"Name": "Ada", "AppName": "IMS"})
+	if err != nil || !strings.Contains(html, "<b>IMS</b>") {
+		t.Fatalf("expected the overridden partial, got %q (%v)", html, err)
+	}
+
+	// Parsed templates are cached until they are invalidated
+	write("hello.html", `{{define "title"}}Hi{{end}}{{define "content"}}{{.Name}}{{end}}{{template "base" .}}`)
+	if html, _, _ := engine.Render("hello", "", map[string]any{"Name": "Ada"}); strings.Contains(html, "Hi") {
+		t.Errorf("expected the cached template, got %q", html)
+	}
+
+	if removed := engine.Invalidate(); removed == 0 {
+		t.Error("expected cached templates to be removed")
+	}
+	if html, _, _ := engine.Render("hello", "", map[string]any{"Name": "Ada"}); html != "<h1>Hi</h1>Ada<footer>Bye</footer>" {
+		t.Errorf("expected the overriding template, got %q", html)
+	}
+
+	// Templates only on disk are found as well
+	write("custom.txt", `Custom {{.Name}}`)
+	if _, text, err := engine.Render("custom", "", map[string]any{"Name": "Ada"}); err != nil || text != "Custom Ada" {
+		t.Errorf("expected the disk template, got %q (%v)", text, err)
+	}
+
+	if err := engine.Validate(); err != nil {
+		t.Errorf("expected the overridden templates to be valid, got %v", err)
+	}
+}
+
+func TestEngine_Validate(t *testing.T) {
+	if err := New(testDefaults(), "", newTestCache(), DefaultLocale).Validate(); err != nil {
+		t.Fatalf("expected the templates to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		wants string
+	}{
+		{"syntax error", "broken.html", `<p>{{.Name}</p>`, "broken.html"},
+		{"undefined template", "unknown.txt", `{{template "missing" .}}`, `undefined template "missing"`},
+		{"undefined block of layout", "nocontent.html", `{{define "title"}}T{{end}}{{template "base" .}}`, `undefined template "content"`},
+		{"broken partial", "partials/bad.txt", `{{define "bad"}}{{if}}{{end}}`, "partials/bad.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaults := testDefaults()
+			defaults[tt.file] = &fstest.MapFile{Data: []byte(tt.data)}
+
+			err := New(defaults, "", newTestCache(), DefaultLocale).Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wants) {
+				t.Errorf("expected an error about %q, got %v", tt.wants, err)
+			}
+		})
+	}
+}
+
+func TestGetInstance_EmbeddedTemplates(t *testing.T) {
+	engine := GetInstance()
+	if engine != GetInstance() {
+		t.Error("expected a single engine instance")
+	}
+
+	if err := engine.Validate(); err != nil {
+		t.Fatalf("expected the embedded templates to be valid, got %v", err)
+	}
+
+	data := map[string]any{"AppName": "IMS", "Name": "Ada", "Email": "ada@example.com", "Year": 2025}
+	for _, locale := range []string{"en", "fr"} {
+		html, text, err := engine.Render("welcome", locale, data)
+		if err != nil {
+			t.Fatalf("Render(welcome, %s) returned error: %v", locale, err)
+		}
+		if !strings.Contains(html, `<html lang="`+locale+`">`) || !strings.Contains(text, "Ada") {
+			t.Errorf("expected the %s welcome email, got %q", locale, text)
+		}
+	}
+}
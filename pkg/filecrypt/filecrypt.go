@@ -0,0 +1,293 @@
+// Package filecrypt encrypts files with AES-256-GCM as a stream of authenticated chunks, so files of any
+// size are encrypted and decrypted with bounded memory.
+//
+// An encrypted file starts with a header: the "IMSENC1\n" magic, the key derivation (0 for a random key,
+// 1 for PBKDF2-SHA256 of a passphrase), the PBKDF2 iteration count (uint32, big endian), a 16 byte salt and
+// a 7 byte nonce prefix. Chunks of 64 KiB of plaintext follow, each sealed with the header as additional data
+// and a nonce made of the prefix, the chunk index (uint32, big endian) and a last chunk flag, so chunks
+// cannot be reordered, dropped or truncated without decryption failing.
+package filecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Extension is the file name extension of encrypted files
+const Extension = ".enc"
+
+// KeySize is the size of AES-256 keys
+const KeySize = 32
+
+// PassphraseIterations is the PBKDF2 iteration count of keys derived from passphrases
+const PassphraseIterations = 600000
+
+const (
+	magic      = "IMSENC1\n"
+	headerSize = len(magic) + 1 + 4 + saltSize + prefixSize
+	saltSize   = 16
+	prefixSize = 7
+	chunkSize  = 64 * 1024
+)
+
+// Key derivations
+const (
+	kdfNone   byte = 0
+	kdfPBKDF2 byte = 1
+)
+
+// ErrDecrypt is returned for files that are not encrypted with the given secret, or were modified
+var ErrDecrypt = errors.New("filecrypt: wrong key or corrupted file")
+
+// GenerateKey returns a random key, encoded in base64
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("filecrypt: failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// NewWriter returns a writer encrypting to w with a base64 key from GenerateKey. Close must be called to
+// write the last chunk, it does not close w.
+func NewWriter(w io.Writer, key string) (io.WriteCloser, error) {
+	rawKey, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return newWriter(w, rawKey, kdfNone, 0, make([]byte, saltSize))
+}
+
+// NewPassphraseWriter returns a writer encrypting to w with a key derived from passphrase
+func NewPassphraseWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	if passphrase == "" {
+		return nil, errors.New("filecrypt: passphrase is empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("filecrypt: failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, PassphraseIterations, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("filecrypt: failed to derive key: %w", err)
+	}
+	return newWriter(w, key, kdfPBKDF2, PassphraseIterations, salt)
+}
+
+// NewReader returns a reader decrypting r. secret is the passphrase of files encrypted with a passphrase and
+// the base64 key of the other files.
+func NewReader(r io.Reader, secret string) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte(magic)) {
+		return nil, errors.New("filecrypt: not an encrypted file")
+	}
+
+	kdf := header[len(magic)]
+	iterations := binary.BigEndian.Uint32(header[len(magic)+1:])
+	salt := header[len(magic)+5 : len(magic)+5+saltSize]
+
+	var key []byte
+	var err error
+	switch kdf {
+	case kdfNone:
+		key, err = decodeKey(secret)
+	case kdfPBKDF2:
+		if iterations == 0 {
+			return nil, errors.New("filecrypt: invalid header")
+		}
+		key, err = pbkdf2.Key(sha256.New, secret, salt, int(iterations), KeySize)
+	default:
+		err = fmt.Errorf("filecrypt: unsupported key derivation %d", kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{
+		r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()+1),
+		aead:   aead,
+		header: header,
+		prefix: header[headerSize-prefixSize:],
+		chunk:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func decodeKey(key string) ([]byte, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != KeySize {
+		return nil, fmt.Errorf("filecrypt: the key must be %d bytes encoded in base64", KeySize)
+	}
+	return rawKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("filecrypt: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of a chunk
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, 0, prefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, index)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte
+	index  uint32
+	closed bool
+}
+
+func newWriter(w io.Writer, key []byte, kdf byte, iterations uint32, salt []byte) (*writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, kdf)
+	header = binary.BigEndian.AppendUint32(header, iterations)
+	header = append(header, salt...)
+
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("filecrypt: failed to generate nonce: %w", err)
+	}
+	header = append(header, prefix...)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &writer{w: w, aead: aead, header: header, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("filecrypt: write to closed writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, the last chunk is sealed by Close
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+func (w *writer) seal(last bool) error {
+	if w.index == math.MaxUint32 {
+		return errors.New("filecrypt: file too large")
+	}
+
+	sealed := w.aead.Seal(nil, nonce(w.prefix, w.index, last), w.buf, w.header)
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+
+	w.index++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	chunk  []byte
+	plain  []byte
+	index  uint32
+	done   bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk, a chunk is the last one when nothing follows it
+func (r *reader) open() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0], nonce(r.prefix, r.index, last), r.chunk[:n], r.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	r.plain = plain
+	r.index++
+	r.done = last
+	return nil
+}
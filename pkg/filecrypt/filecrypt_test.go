@@ -0,0 +1,126 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, plain []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := newWriter(&buf)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	// Odd sized writes cross chunk boundaries
+	for len(plain) > 0 {
+		n := min(len(plain), 10000)
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(encrypted []byte, secret string) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(encrypted), secret)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+
+		encrypted := encrypt(t, plain, func(w io.Writer) (io.WriteCloser, error) { return NewWriter(w, key) })
+		decrypted, err := decrypt(encrypted, key)
+		if err != nil {
+			t.Fatalf("size %d: decrypt returned error: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Fatalf("size %d: decrypted content differs", size)
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	plain := []byte("id,email\n1,ada@example.com\n")
+	encrypted := encrypt(t, plain, func(w io.Writer) (io.WriteCloser, error) { return NewPassphraseWriter(w, "correct horse") })
+
+	decrypted, err := decrypt(encrypted, "correct horse")
+	if err != nil || !bytes.Equal(decrypted, plain) {
+		t.Fatalf("expected the content back, got %q (%v)", decrypted, err)
+	}
+
+	if _, err := decrypt(encrypted, "wrong horse"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected a wrong passphrase to fail, got %v", err)
+	}
+
+	if _, err := NewPassphraseWriter(io.Discard, ""); err == nil {
+		t.Error("expected an empty passphrase to be rejected")
+	}
+}
+
+func TestTampering(t *testing.T) {
+	key, _ := GenerateKey()
+	otherKey, _ := GenerateKey()
+
+	plain := make([]byte, 2*chunkSize+100)
+	encrypted := encrypt(t, plain, func(w io.Writer) (io.WriteCloser, error) { return NewWriter(w, key) })
+	chunk := chunkSize + 16
+
+	flipped := bytes.Clone(encrypted)
+	flipped[headerSize+chunk+5] ^= 1
+
+	header := bytes.Clone(encrypted)
+	header[len(magic)+6] ^= 1
+
+	reordered := bytes.Clone(encrypted[:headerSize])
+	reordered = append(reordered, encrypted[headerSize+chunk:headerSize+2*chunk]...)
+	reordered = append(reordered, encrypted[headerSize:headerSize+chunk]...)
+	reordered = append(reordered, encrypted[headerSize+2*chunk:]...)
+
+	tests := map[string]struct {
+		data []byte
+		key  string
+	}{
+		"wrong key":           {encrypted, otherKey},
+		"flipped bit":         {flipped, key},
+		"modified header":     {header, key},
+		"reordered chunks":    {reordered, key},
+		"dropped last chunk":  {encrypted[:headerSize+2*chunk], key},
+		"truncated chunk":     {encrypted[:len(encrypted)-1], key},
+		"dropped every chunk": {encrypted[:headerSize], key},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decrypt(tt.data, tt.key); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("expected ErrDecrypt, got %v", err)
+			}
+		})
+	}
+
+	if _, err := decrypt([]byte("id,email\n"), key); err == nil {
+		t.Error("expected a plain file to be rejected")
+	}
+	if _, err := NewWriter(io.Discard, "c2hvcnQ="); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+}
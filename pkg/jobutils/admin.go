@@ -0,0 +1,276 @@
+package jobutils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Errors returned by the job administration functions
+var (
+	ErrJobProcessing    = errors.New("job is being processed")
+	ErrJobNotRetryable  = errors.New("only queued and dead-lettered jobs can be retried")
+	ErrInvalidJobStatus = errors.New("invalid job status")
+)
+
+// JobStatuses lists every status a job can be listed or purged by
+var JobStatuses = []string{JobStatusQueued, JobStatusProcessing, JobStatusCompleted, JobStatusFailed, JobStatusCancelled}
+
+// jobListSource merges queued and processing jobs from the queue with finished jobs from job_results
+const jobListSource = `SELECT * FROM (
+	SELECT [[id]], [[name]], json_extract([[payload]], '$.type') AS [[job_type]], [[queue]],
+		CASE WHEN COALESCE([[reserved_at]], '') = '' THEN 'queued' ELSE 'processing' END AS [[status]],
+		[[attempts]], [[last_error]] AS [[error]], [[user_id]], [[created]], '' AS [[finished_at]]
+	FROM {{queues}}
+	UNION ALL
+	SELECT [[job_id]] AS [[id]], [[name]], [[job_type]], [[queue]], [[status]],
+		[[attempts]], [[error]], [[user_id]], [[created]], [[finished_at]]
+	FROM {{job_results}}
+) AS [[jobs]]`
+
+// JobListFilter narrows the jobs returned by ListJobs; zero values match every job
+type JobListFilter struct {
+	Type        string // Job type from the payload
+	Status      string // One of JobStatuses
+	MinAttempts int    // Only jobs with at least this many attempts
+}
+
+// JobSummary is a single row of the admin job listing
+type JobSummary struct {
+	ID         string         `db:"id" json:"id"`
+	Name       string         `db:"name" json:"name"`
+	Type       string         `db:"job_type" json:"job_type"`
+	Queue      string         `db:"queue" json:"queue"`
+	Status     string         `db:"status" json:"status"`
+	Attempts   int            `db:"attempts" json:"attempts"`
+	Error      string         `db:"error" json:"error"`
+	UserID     string         `db:"user_id" json:"user_id"`
+	Created    types.DateTime `db:"created" json:"created"`
+	FinishedAt types.DateTime `db:"finished_at" json:"finished_at"`
+}
+
+// ListJobs returns a page of queued, processing and finished jobs (newest first) and the total count
+func ListJobs(app core.App, filter JobListFilter, limit, offset int) ([]JobSummary, int64, error) {
+	if filter.Status != "" && !slices.Contains(JobStatuses, filter.Status) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidJobStatus, filter.Status)
+	}
+
+	where, params := jobListWhere(filter)
+
+	var total int64
+	if err := app.DB().NewQuery("SELECT COUNT(*) FROM (" + jobListSource + where + ")").Bind(params).Row(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	params["limit"] = limit
+	params["offset"] = offset
+
+	jobs := []JobSummary{}
+	err := app.DB().NewQuery(jobListSource + where + " ORDER BY [[created]] DESC LIMIT {:limit} OFFSET {:offset}").
+		Bind(params).
+		All(&jobs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	for i := range jobs {
+		jobs[i].Queue = NormalizeQueueName(jobs[i].Queue)
+	}
+
+	return jobs, total, nil
+}
+
+func jobListWhere(filter JobListFilter) (string, dbx.Params) {
+	conditions := []string{}
+	params := dbx.Params{}
+
+	if filter.Type != "" {
+		conditions = append(conditions, "[[job_type]] = {:job_type}")
+		params["job_type"] = filter.Type
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "[[status]] = {:status}")
+		params["status"] = filter.Status
+	}
+	if filter.MinAttempts > 0 {
+		conditions = append(conditions, "[[attempts]] >= {:min_attempts}")
+		params["min_attempts"] = filter.MinAttempts
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// CancelJob removes a queued job that is not being processed and stores a cancelled job result.
+// A cancelled batch member counts as failed in its batch and the rest of its chain is dropped.
+func CancelJob(app core.App, jobId string) error {
+	var record *core.Record
+
+	err := runJobTransaction(app, func(txApp core.App) error {
+		var err error
+		record, err = txApp.FindRecordById(QueuesCollection, jobId)
+		if err != nil {
+			return fmt.Errorf("job %s not found: %w", jobId, err)
+		}
+		if !record.GetDateTime("reserved_at").IsZero() {
+			return ErrJobProcessing
+		}
+
+		if _, err := SaveJobResult(txApp, record, JobStatusCancelled, nil, nil, 0); err != nil {
+			return err
+		}
+
+		if err := txApp.Delete(record); err != nil {
+			return fmt.Errorf("failed to remove job %s from queue: %w", jobId, err)
+		}
+
+		return finishChainedJob(txApp, record, JobStatusCancelled)
+	})
+	if err != nil {
+		return err
+	}
+
+	publishJobProgress(app, jobId, JobStatusCancelled, nil)
+
+	log.Info("Job cancelled", "job_id", jobId, "job_name", record.GetString("name"))
+	return nil
+}
+
+// ForceRetryJob makes a queued job that is waiting for its retry backoff, or whose reservation expired,
+// available immediately, or re-queues a dead-lettered job by its original queue ID. It returns the queue
+// record that will run.
+func ForceRetryJob(app core.App, jobId string) (*core.Record, error) {
+	now := types.NowDateTime()
+	expired := now.Add(-GetReservationTimeout())
+
+	// A single conditional UPDATE, like ReserveJob, so a worker reserving the job meanwhile is not overwritten
+	result, err := app.DB().Update(
+		QueuesCollection,
+		dbx.Params{
+			"available_at": now.String(),
+			"reserved_at":  "",
+			"reserved_by":  "",
+			"updated":      now.String(),
+		},
+		dbx.NewExp(
+			"[[id]] = {:job_id} AND ([[reserved_at]] = '' OR [[reserved_at]] IS NULL OR [[reserved_at]] < {:expired})",
+			dbx.Params{
+				"job_id":  jobId,
+				"expired": expired.String(),
+			},
+		),
+	).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make job %s available: %w", jobId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make job %s available: %w", jobId, err)
+	}
+
+	record, err := app.FindRecordById(QueuesCollection, jobId)
+	if err == nil {
+		if affected == 0 {
+			return nil, ErrJobProcessing
+		}
+
+		log.Info("Job made available for retry", "job_id", jobId)
+		return record, nil
+	}
+
+	failedJob, err := app.FindFirstRecordByFilter(FailedJobsCollection, "queue_id = {:queue_id}", dbx.Params{"queue_id": jobId})
+	if err != nil {
+		return nil, ErrJobNotRetryable
+	}
+
+	return RetryFailedJob(app, failedJob.Id)
+}
+
+// JobPurgeFilter selects the jobs removed by PurgeJobs
+type JobPurgeFilter struct {
+	Status string    // Required; processing jobs cannot be purged
+	Type   string    // Job type from the payload, empty means all types
+	Before time.Time // Only jobs created (queued) or finished before this time, zero means all
+}
+
+// PurgeJobs bulk-removes jobs and returns the number removed. Queued jobs are cancelled one by one so their
+// batches stay consistent; completed, failed and cancelled jobs have their job results deleted.
+func PurgeJobs(app core.App, filter JobPurgeFilter) (int, error) {
+	if filter.Status == JobStatusProcessing || !slices.Contains(JobStatuses, filter.Status) {
+		return 0, fmt.Errorf("%w: %q cannot be purged", ErrInvalidJobStatus, filter.Status)
+	}
+
+	if filter.Status == JobStatusQueued {
+		return purgeQueuedJobs(app, filter)
+	}
+
+	exprs := []dbx.Expression{dbx.HashExp{"status": filter.Status}}
+	if filter.Type != "" {
+		exprs = append(exprs, dbx.HashExp{"job_type": filter.Type})
+	}
+	if !filter.Before.IsZero() {
+		exprs = append(exprs, dbx.NewExp("[[finished_at]] < {:before}", dbx.Params{"before": filter.Before.UTC().Format(types.DefaultDateLayout)}))
+	}
+
+	records, err := app.FindAllRecords(JobResultsCollection, exprs...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch job results: %w", err)
+	}
+
+	purged := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete job result %s: %w", record.Id, err)
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func purgeQueuedJobs(app core.App, filter JobPurgeFilter) (int, error) {
+	exprs := []dbx.Expression{dbx.NewExp("COALESCE([[reserved_at]], '') = ''")}
+	if filter.Type != "" {
+		exprs = append(exprs, dbx.NewExp("json_extract([[payload]], '$.type') = {:job_type}", dbx.Params{"job_type": filter.Type}))
+	}
+	if !filter.Before.IsZero() {
+		exprs = append(exprs, dbx.NewExp("[[created]] < {:before}", dbx.Params{"before": filter.Before.UTC().Format(types.DefaultDateLayout)}))
+	}
+
+	records, err := app.FindAllRecords(QueuesCollection, exprs...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch queued jobs: %w", err)
+	}
+
+	purged := 0
+	for _, record := range records {
+		if err := CancelJob(app, record.Id); err != nil {
+			// A worker may have reserved the job in the meantime
+			if errors.Is(err, ErrJobProcessing) {
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,203 @@
+package jobutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestListJobs(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	createTestJob(t, app, "queued", map[string]any{"type": "step"})
+	processing := createTestJob(t, app, "processing", map[string]any{"type": "step"})
+	processing.Set("reserved_at", time.Now().UTC())
+	processing.Set("attempts", 2)
+	if err := app.Save(processing); err != nil {
+		t.Fatalf("failed to reserve job: %v", err)
+	}
+	_ = processor.ProcessJob(createTestJob(t, app, "completed", map[string]any{"type": "step"}))
+	_ = processor.ProcessJob(createTestJob(t, app, "failed", map[string]any{"type": "broken"}))
+
+	tests := []struct {
+		name     string
+		filter   JobListFilter
+		expected []string
+	}{
+		{name: "all", filter: JobListFilter{}, expected: []string{"queued", "processing", "completed", "failed"}},
+		{name: "queued", filter: JobListFilter{Status: JobStatusQueued}, expected: []string{"queued"}},
+		{name: "processing", filter: JobListFilter{Status: JobStatusProcessing}, expected: []string{"processing"}},
+		{name: "completed", filter: JobListFilter{Status: JobStatusCompleted}, expected: []string{"completed"}},
+		{name: "failed", filter: JobListFilter{Status: JobStatusFailed}, expected: []string{"failed"}},
+		{name: "type", filter: JobListFilter{Type: "broken"}, expected: []string{"failed"}},
+		{name: "attempts", filter: JobListFilter{MinAttempts: 1}, expected: []string{"processing", "failed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, total, err := ListJobs(app, tt.filter, 10, 0)
+			if err != nil {
+				t.Fatalf("ListJobs returned error: %v", err)
+			}
+			if int(total) != len(tt.expected) || len(jobs) != len(tt.expected) {
+				t.Fatalf("expected %d jobs, got %d (total %d)", len(tt.expected), len(jobs), total)
+			}
+
+			names := map[string]bool{}
+			for _, job := range jobs {
+				names[job.Name] = true
+				if job.Queue != DefaultQueueName {
+					t.Errorf("expected queue %s, got %q", DefaultQueueName, job.Queue)
+				}
+			}
+			for _, name := range tt.expected {
+				if !names[name] {
+					t.Errorf("expected job %s in %+v", name, jobs)
+				}
+			}
+		})
+	}
+
+	jobs, total, err := ListJobs(app, JobListFilter{}, 1, 1)
+	if err != nil || len(jobs) != 1 || total != 4 {
+		t.Errorf("expected a single job of 4 on the second page, got %d of %d (%v)", len(jobs), total, err)
+	}
+
+	if _, _, err := ListJobs(app, JobListFilter{Status: "unknown"}, 10, 0); !errors.Is(err, ErrInvalidJobStatus) {
+		t.Errorf("expected ErrInvalidJobStatus, got %v", err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	app := newTestApp(t)
+
+	job := createTestJob(t, app, "cancel me", map[string]any{"type": "step"})
+	if err := CancelJob(app, job.Id); err != nil {
+		t.Fatalf("CancelJob returned error: %v", err)
+	}
+
+	if _, err := app.FindRecordById(QueuesCollection, job.Id); err == nil {
+		t.Error("cancelled job should be removed from the queue")
+	}
+	jobResult, err := FindJobResult(app, job.Id)
+	if err != nil || jobResult.GetString("status") != JobStatusCancelled {
+		t.Errorf("expected a cancelled job result, got %v", err)
+	}
+
+	reserved := createTestJob(t, app, "running", map[string]any{"type": "step"})
+	reserved.Set("reserved_at", time.Now().UTC())
+	if err := app.Save(reserved); err != nil {
+		t.Fatalf("failed to reserve job: %v", err)
+	}
+	if err := CancelJob(app, reserved.Id); !errors.Is(err, ErrJobProcessing) {
+		t.Errorf("expected ErrJobProcessing, got %v", err)
+	}
+}
+
+func TestCancelJob_FinishesBatch(t *testing.T) {
+	app := newTestApp(t)
+
+	batch, err := EnqueueBatch(app, []JobSpec{stepSpec("only")}, BatchOptions{Name: "cancelled"})
+	if err != nil {
+		t.Fatalf("EnqueueBatch returned error: %v", err)
+	}
+
+	if err := CancelJob(app, findQueuedJob(t, app, "only").Id); err != nil {
+		t.Fatalf("CancelJob returned error: %v", err)
+	}
+
+	reloaded, _ := FindJobBatch(app, batch.Id)
+	if progress := GetBatchProgress(reloaded); progress.Status != JobStatusFailed || progress.Failed != 1 {
+		t.Errorf("expected the batch to fail with the cancelled job, got %+v", progress)
+	}
+}
+
+func TestForceRetryJob(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	waiting := createTestJob(t, app, "waiting", map[string]any{"type": "step"})
+	waiting.Set("available_at", time.Now().UTC().Add(time.Hour))
+	if err := app.Save(waiting); err != nil {
+		t.Fatalf("failed to delay job: %v", err)
+	}
+
+	retried, err := ForceRetryJob(app, waiting.Id)
+	if err != nil {
+		t.Fatalf("ForceRetryJob returned error: %v", err)
+	}
+	if retried.GetDateTime("available_at").Time().After(time.Now().UTC()) {
+		t.Error("expected the delayed job to be available immediately")
+	}
+
+	// Reserved jobs are left to their worker until the reservation expires
+	reserved := createTestJob(t, app, "reserved", map[string]any{"type": "step"})
+	if _, err := ReserveJob(app, reserved.Id, "worker-1", GetReservationTimeout()); err != nil {
+		t.Fatalf("failed to reserve job: %v", err)
+	}
+	if _, err := ForceRetryJob(app, reserved.Id); !errors.Is(err, ErrJobProcessing) {
+		t.Errorf("expected ErrJobProcessing for a reserved job, got %v", err)
+	}
+
+	reserved.Set("reserved_at", time.Now().UTC().Add(-2*GetReservationTimeout()))
+	reserved.Set("reserved_by", "worker-1")
+	if err := app.Save(reserved); err != nil {
+		t.Fatalf("failed to expire reservation: %v", err)
+	}
+	abandoned, err := ForceRetryJob(app, reserved.Id)
+	if err != nil {
+		t.Fatalf("ForceRetryJob returned error for an expired reservation: %v", err)
+	}
+	if !abandoned.GetDateTime("reserved_at").IsZero() || abandoned.GetString("reserved_by") != "" {
+		t.Error("expected the expired reservation to be cleared")
+	}
+
+	failed := createTestJob(t, app, "failed", map[string]any{"type": "broken"})
+	_ = processor.ProcessJob(failed)
+
+	requeued, err := ForceRetryJob(app, failed.Id)
+	if err != nil {
+		t.Fatalf("ForceRetryJob returned error for dead-lettered job: %v", err)
+	}
+	if requeued.Id == failed.Id || requeued.GetString("name") != "failed" {
+		t.Errorf("expected the dead-lettered job to be re-queued as a new job, got %s", requeued.Id)
+	}
+
+	if _, err := ForceRetryJob(app, "missing"); !errors.Is(err, ErrJobNotRetryable) {
+		t.Errorf("expected ErrJobNotRetryable, got %v", err)
+	}
+}
+
+func TestPurgeJobs(t *testing.T) {
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	createTestJob(t, app, "queued step", map[string]any{"type": "step"})
+	createTestJob(t, app, "queued other", map[string]any{"type": "other"})
+	_ = processor.ProcessJob(createTestJob(t, app, "completed", map[string]any{"type": "step"}))
+
+	if _, err := PurgeJobs(app, JobPurgeFilter{Status: JobStatusProcessing}); !errors.Is(err, ErrInvalidJobStatus) {
+		t.Errorf("expected processing jobs to be rejected, got %v", err)
+	}
+
+	purged, err := PurgeJobs(app, JobPurgeFilter{Status: JobStatusQueued, Type: "step"})
+	if err != nil || purged != 1 {
+		t.Fatalf("expected one queued job to be purged, got %d (%v)", purged, err)
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 1 {
+		t.Errorf("expected the other queued job to remain, got %d", total)
+	}
+
+	if purged, _ := PurgeJobs(app, JobPurgeFilter{Status: JobStatusCompleted, Before: time.Now().Add(-time.Hour)}); purged != 0 {
+		t.Errorf("expected recent results to be kept, purged %d", purged)
+	}
+	purged, err = PurgeJobs(app, JobPurgeFilter{Status: JobStatusCompleted})
+	if err != nil || purged != 1 {
+		t.Errorf("expected one completed job to be purged, got %d (%v)", purged, err)
+	}
+}
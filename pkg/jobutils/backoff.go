@@ -0,0 +1,135 @@
+package jobutils
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+)
+
+// Backoff strategy names
+const (
+	BackoffFixed       = "fixed"
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+)
+
+// Default backoff configuration values
+const (
+	DefaultBackoffBase = 30 * time.Second
+	DefaultBackoffMax  = time.Hour
+)
+
+// BackoffStrategy computes how long a failed job waits before it becomes available again
+type BackoffStrategy interface {
+	// NextDelay returns the delay before the next attempt, given the number of attempts made so far (1-based)
+	NextDelay(attempt int) time.Duration
+}
+
+// BackoffProvider can be implemented by job handlers to use their own retry backoff strategy
+type BackoffProvider interface {
+	// GetBackoffStrategy returns the backoff strategy for the handler's job type
+	GetBackoffStrategy() BackoffStrategy
+}
+
+// FixedBackoff waits the same delay between every attempt
+type FixedBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay implements BackoffStrategy
+func (b FixedBackoff) NextDelay(attempt int) time.Duration {
+	return b.Delay
+}
+
+// LinearBackoff grows the delay by Base on every attempt, capped at Max
+type LinearBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NextDelay implements BackoffStrategy
+func (b LinearBackoff) NextDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return capDelay(b.Base*time.Duration(attempt), b.Max)
+}
+
+// ExponentialBackoff doubles the delay on every attempt, capped at Max.
+// When Jitter is true, the delay is randomized between half and the full computed value.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter bool
+}
+
+// NextDelay implements BackoffStrategy
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	raw := float64(b.Base) * math.Pow(2, float64(attempt-1))
+	delay := time.Duration(math.MaxInt64)
+	if raw < math.MaxInt64 {
+		delay = time.Duration(raw)
+	}
+	delay = capDelay(delay, b.Max)
+
+	if b.Jitter && delay > 1 {
+		half := delay / 2
+		delay = half + rand.N(delay-half)
+	}
+
+	return delay
+}
+
+// NewBackoffStrategy creates a backoff strategy by name, falling back to exponential with jitter
+func NewBackoffStrategy(name string, base, max time.Duration) BackoffStrategy {
+	switch strings.ToLower(name) {
+	case BackoffFixed:
+		return FixedBackoff{Delay: base}
+	case BackoffLinear:
+		return LinearBackoff{Base: base, Max: max}
+	default:
+		return ExponentialBackoff{Base: base, Max: max, Jitter: true}
+	}
+}
+
+// GetBackoffStrategy returns the retry backoff strategy for a job type. The strategy is resolved from
+// JOB_BACKOFF_STRATEGY_<TYPE>, then the handler's BackoffProvider implementation, then JOB_BACKOFF_STRATEGY,
+// with the delays of JOB_BACKOFF_BASE_SECONDS and JOB_BACKOFF_MAX_SECONDS.
+func (r *JobRegistry) GetBackoffStrategy(jobType string) BackoffStrategy {
+	base := time.Duration(common.GetEnvInt("JOB_BACKOFF_BASE_SECONDS", int(DefaultBackoffBase/time.Second))) * time.Second
+	max := time.Duration(common.GetEnvInt("JOB_BACKOFF_MAX_SECONDS", int(DefaultBackoffMax/time.Second))) * time.Second
+
+	if jobType != "" {
+		if name := common.GetEnv("JOB_BACKOFF_STRATEGY_"+strings.ToUpper(jobType), ""); name != "" {
+			return NewBackoffStrategy(name, base, max)
+		}
+	}
+
+	if r != nil {
+		r.mu.RLock()
+		handler, exists := r.handlers[jobType]
+		r.mu.RUnlock()
+
+		if provider, ok := handler.(BackoffProvider); exists && ok {
+			if strategy := provider.GetBackoffStrategy(); strategy != nil {
+				return strategy
+			}
+		}
+	}
+
+	return NewBackoffStrategy(common.GetEnv("JOB_BACKOFF_STRATEGY", BackoffExponential), base, max)
+}
+
+func capDelay(delay, max time.Duration) time.Duration {
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
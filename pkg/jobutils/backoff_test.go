@@ -0,0 +1,152 @@
+package jobutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type backoffJobHandler struct {
+	MockJobHandler
+	strategy BackoffStrategy
+}
+
+func (h *backoffJobHandler) GetBackoffStrategy() BackoffStrategy {
+	return h.strategy
+}
+
+func TestFixedBackoff(t *testing.T) {
+	strategy := FixedBackoff{Delay: 10 * time.Second}
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		if got := strategy.NextDelay(attempt); got != 10*time.Second {
+			t.Errorf("attempt %d: expected 10s, got %v", attempt, got)
+		}
+	}
+}
+
+func TestLinearBackoff(t *testing.T) {
+	strategy := LinearBackoff{Base: 10 * time.Second, Max: 35 * time.Second}
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 30 * time.Second},
+		{4, 35 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := strategy.NextDelay(tt.attempt); got != tt.expected {
+			t.Errorf("attempt %d: expected %v, got %v", tt.attempt, tt.expected, got)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	strategy := ExponentialBackoff{Base: time.Second, Max: time.Minute}
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{7, time.Minute},
+		{200, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := strategy.NextDelay(tt.attempt); got != tt.expected {
+			t.Errorf("attempt %d: expected %v, got %v", tt.attempt, tt.expected, got)
+		}
+	}
+}
+
+func TestExponentialBackoff_Jitter(t *testing.T) {
+	strategy := ExponentialBackoff{Base: 8 * time.Second, Max: time.Hour, Jitter: true}
+
+	for i := 0; i < 100; i++ {
+		got := strategy.NextDelay(2)
+		if got < 8*time.Second || got > 16*time.Second {
+			t.Fatalf("jittered delay %v outside [8s, 16s]", got)
+		}
+	}
+}
+
+func TestNewBackoffStrategy(t *testing.T) {
+	if _, ok := NewBackoffStrategy("fixed", time.Second, time.Minute).(FixedBackoff); !ok {
+		t.Error("expected FixedBackoff for 'fixed'")
+	}
+	if _, ok := NewBackoffStrategy("LINEAR", time.Second, time.Minute).(LinearBackoff); !ok {
+		t.Error("expected LinearBackoff for 'LINEAR'")
+	}
+	if _, ok := NewBackoffStrategy("unknown", time.Second, time.Minute).(ExponentialBackoff); !ok {
+		t.Error("expected ExponentialBackoff fallback for unknown strategy")
+	}
+}
+
+func TestJobRegistry_GetBackoffStrategy(t *testing.T) {
+	registry := NewJobRegistry()
+	custom := FixedBackoff{Delay: 42 * time.Second}
+	_ = registry.Register(&backoffJobHandler{MockJobHandler: MockJobHandler{jobType: "custom"}, strategy: custom})
+
+	if got := registry.GetBackoffStrategy("custom"); got != custom {
+		t.Errorf("expected handler strategy, got %#v", got)
+	}
+
+	t.Setenv("JOB_BACKOFF_STRATEGY", "linear")
+	t.Setenv("JOB_BACKOFF_STRATEGY_EMAIL", "fixed")
+	t.Setenv("JOB_BACKOFF_BASE_SECONDS", "5")
+
+	if got, ok := registry.GetBackoffStrategy("other").(LinearBackoff); !ok || got.Base != 5*time.Second {
+		t.Errorf("expected linear strategy with 5s base, got %#v", got)
+	}
+	if _, ok := registry.GetBackoffStrategy("email").(FixedBackoff); !ok {
+		t.Error("expected per-type fixed strategy for email")
+	}
+
+	// The global strategy does not replace the handler's, the per-type one does
+	if got := registry.GetBackoffStrategy("custom"); got != custom {
+		t.Errorf("expected handler strategy over JOB_BACKOFF_STRATEGY, got %#v", got)
+	}
+	t.Setenv("JOB_BACKOFF_STRATEGY_CUSTOM", "linear")
+	if _, ok := registry.GetBackoffStrategy("custom").(LinearBackoff); !ok {
+		t.Error("expected JOB_BACKOFF_STRATEGY_CUSTOM to override the handler strategy")
+	}
+}
+
+func TestRecordJobFailure_PushesAvailableAt(t *testing.T) {
+	t.Setenv("JOB_BACKOFF_STRATEGY", "fixed")
+	t.Setenv("JOB_BACKOFF_BASE_SECONDS", "120")
+
+	app := newTestApp(t)
+	job := createTestJob(t, app, "delayed", map[string]any{"type": "test_job"})
+
+	before := time.Now()
+	if _, err := recordJobFailure(app, NewJobRegistry(), job, errors.New("failed"), 0); err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+
+	reloaded, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+
+	availableAt := reloaded.GetDateTime("available_at").Time()
+	if availableAt.Before(before.Add(119*time.Second)) || availableAt.After(time.Now().Add(121*time.Second)) {
+		t.Errorf("expected available_at ~120s in the future, got %v", availableAt)
+	}
+
+	jobData, err := ParseJobDataFromRecord(reloaded)
+	if err != nil {
+		t.Fatalf("ParseJobDataFromRecord returned error: %v", err)
+	}
+	if jobData.AvailableAt == nil || !jobData.AvailableAt.Equal(availableAt) {
+		t.Errorf("expected JobData.AvailableAt %v, got %v", availableAt, jobData.AvailableAt)
+	}
+}
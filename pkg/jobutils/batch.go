@@ -0,0 +1,375 @@
+package jobutils
+
+import (
+	"fmt"
+	"time"
+
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Constants for job chains and batches
+const (
+	JobBatchesCollection = "job_batches"
+
+	// PreviousJobIDOption is the payload option set on a chained job with the ID of the job that ran before it
+	PreviousJobIDOption = "previous_job_id"
+	// BatchIDOption is the payload option set on a batch callback job with the ID of its batch
+	BatchIDOption = "batch_id"
+)
+
+// JobSpec describes a job that is enqueued later: a link of a chain, a batch member or a batch callback
+type JobSpec struct {
+	Payload any            `json:"payload"`
+	Options EnqueueOptions `json:"options"`
+}
+
+// BatchOptions configures a batch of jobs and the callbacks that run once every job has finished
+type BatchOptions struct {
+	Name       string   // Batch name (required)
+	UserID     string   // User that created the batch, inherited by jobs and callbacks without their own UserID
+	OnComplete *JobSpec // Enqueued when every job of the batch succeeded
+	OnFailure  *JobSpec // Enqueued when every job of the batch finished and at least one was moved to failed jobs
+}
+
+// BatchProgress represents the aggregate progress of a batch as reported by the jobs status API
+type BatchProgress struct {
+	BatchID       string     `json:"batch_id"`
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	Total         int        `json:"total"`
+	Pending       int        `json:"pending"`
+	Completed     int        `json:"completed"`
+	Failed        int        `json:"failed"`
+	Percent       float64    `json:"percent"`
+	CallbackJobID string     `json:"callback_job_id,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// EnqueueChain queues the first job of a chain and stores the remaining jobs on it. Each following job is
+// enqueued once the previous one completes, with options.previous_job_id set so it can read the previous
+// job's result. A job that is moved to failed jobs stops the chain; retrying it resumes the chain.
+func EnqueueChain(app core.App, jobs []JobSpec) (*core.Record, error) {
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("chain must contain at least one job")
+	}
+
+	for _, job := range jobs {
+		if err := validateJobSpec(job); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := jobs[0].Options
+	opts.Chain = jobs[1:]
+
+	record, _, err := Enqueue(app, jobs[0].Payload, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Job chain queued", "job_id", record.Id, "length", len(jobs))
+	return record, nil
+}
+
+// EnqueueBatch creates a job_batches record and queues every job as a member of it. Once all members
+// have finished, OnComplete or OnFailure is enqueued with options.batch_id set. A member that starts
+// a chain counts as finished when the last job of its chain has.
+func EnqueueBatch(app core.App, jobs []JobSpec, opts BatchOptions) (*core.Record, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("batch name is required")
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("batch must contain at least one job")
+	}
+
+	for _, job := range jobs {
+		if err := validateJobSpec(job); err != nil {
+			return nil, err
+		}
+	}
+	for _, callback := range []*JobSpec{opts.OnComplete, opts.OnFailure} {
+		if callback == nil {
+			continue
+		}
+		if err := validateJobSpec(*callback); err != nil {
+			return nil, fmt.Errorf("invalid batch callback: %w", err)
+		}
+	}
+
+	var batch *core.Record
+
+	err := runJobTransaction(app, func(txApp core.App) error {
+		collection, err := txApp.FindCollectionByNameOrId(JobBatchesCollection)
+		if err != nil {
+			return fmt.Errorf("failed to find %s collection: %w", JobBatchesCollection, err)
+		}
+
+		batch = core.NewRecord(collection)
+		batch.Set("name", opts.Name)
+		batch.Set("status", JobStatusQueued)
+		batch.Set("total_jobs", len(jobs))
+		batch.Set("pending_jobs", len(jobs))
+		batch.Set("completed_jobs", 0)
+		batch.Set("failed_jobs", 0)
+		batch.Set("user_id", opts.UserID)
+		if opts.OnComplete != nil {
+			batch.Set("on_complete", opts.OnComplete)
+		}
+		if opts.OnFailure != nil {
+			batch.Set("on_failure", opts.OnFailure)
+		}
+
+		if err := txApp.Save(batch); err != nil {
+			return fmt.Errorf("failed to save batch %s: %w", opts.Name, err)
+		}
+
+		for _, job := range jobs {
+			jobOpts := job.Options
+			jobOpts.batchID = batch.Id
+			if jobOpts.UserID == "" {
+				jobOpts.UserID = opts.UserID
+			}
+
+			record, created, err := Enqueue(txApp, job.Payload, jobOpts)
+			if err != nil {
+				return err
+			}
+			// A deduplicated job belongs to another batch (or none) and would never be counted in this one
+			if !created {
+				return fmt.Errorf("batch job %s is already queued as %s", jobOpts.Name, record.Id)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Job batch queued", "batch_id", batch.Id, "name", opts.Name, "jobs", len(jobs))
+	return batch, nil
+}
+
+// FindJobBatch returns the job_batches record with the given ID
+func FindJobBatch(app core.App, batchId string) (*core.Record, error) {
+	return app.FindRecordById(JobBatchesCollection, batchId)
+}
+
+// GetBatchProgress builds the aggregate progress of a job_batches record
+func GetBatchProgress(batch *core.Record) *BatchProgress {
+	if batch == nil {
+		return nil
+	}
+
+	total := batch.GetInt("total_jobs")
+	completed := batch.GetInt("completed_jobs")
+	failed := batch.GetInt("failed_jobs")
+
+	progress := &BatchProgress{
+		BatchID:       batch.Id,
+		Name:          batch.GetString("name"),
+		Status:        batch.GetString("status"),
+		Total:         total,
+		Pending:       batch.GetInt("pending_jobs"),
+		Completed:     completed,
+		Failed:        failed,
+		Percent:       NewJobProgress(completed+failed, total, "").Percent,
+		CallbackJobID: batch.GetString("callback_job_id"),
+	}
+
+	if finishedAt := batch.GetDateTime("finished_at"); !finishedAt.IsZero() {
+		finished := finishedAt.Time()
+		progress.FinishedAt = &finished
+	}
+
+	return progress
+}
+
+// PruneJobBatches deletes up to limit finished batches that finished before the given time and returns the number deleted
+func PruneJobBatches(app core.App, before time.Time, limit int) (int, error) {
+	records, err := app.FindRecordsByFilter(
+		JobBatchesCollection,
+		"finished_at != '' && finished_at < {:before}",
+		"finished_at",
+		limit,
+		0,
+		dbx.Params{"before": before.UTC().Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired job batches: %w", err)
+	}
+
+	pruned := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete job batch %s: %w", record.Id, err)
+			}
+			pruned++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// GetJobChain returns the jobs that still have to run after a queue or failed_jobs record
+func GetJobChain(record *core.Record) []JobSpec {
+	chain := []JobSpec{}
+	if record == nil {
+		return chain
+	}
+
+	if err := record.UnmarshalJSONField("chain", &chain); err != nil {
+		return []JobSpec{}
+	}
+
+	return chain
+}
+
+// finishChainedJob runs inside the transaction that removes a finished job from the queue. A completed job
+// with a chain enqueues the next link; otherwise the job's batch, if any, is updated.
+func finishChainedJob(txApp core.App, record *core.Record, status string) error {
+	if status == JobStatusCompleted {
+		continued, err := continueChain(txApp, record)
+		if err != nil || continued {
+			return err
+		}
+	}
+
+	return finishBatchJob(txApp, record, status)
+}
+
+// continueChain enqueues the next job of a completed job's chain and reports whether the chain went on
+func continueChain(txApp core.App, record *core.Record) (bool, error) {
+	chain := GetJobChain(record)
+	if len(chain) == 0 {
+		return false, nil
+	}
+
+	opts := chain[0].Options
+	opts.Chain = chain[1:]
+	opts.batchID = record.GetString("batch_id")
+	opts.payloadOptions = map[string]any{PreviousJobIDOption: record.Id}
+	if opts.UserID == "" {
+		opts.UserID = record.GetString("user_id")
+	}
+
+	next, created, err := Enqueue(txApp, chain[0].Payload, opts)
+	if err != nil {
+		return false, fmt.Errorf("failed to queue next job of chain after %s: %w", record.Id, err)
+	}
+
+	log.Debug("Chained job queued", "previous_job_id", record.Id, "job_id", next.Id, "remaining", len(opts.Chain))
+	return created, nil
+}
+
+// finishBatchJob counts a finished member of a batch and enqueues the batch callback once no jobs are pending
+func finishBatchJob(txApp core.App, record *core.Record, status string) error {
+	batchId := record.GetString("batch_id")
+	if batchId == "" {
+		return nil
+	}
+
+	// Cancelled members count as failed so the batch still finishes
+	column := "failed_jobs"
+	if status == JobStatusCompleted {
+		column = "completed_jobs"
+	}
+
+	// Update the counters in SQL so concurrent members never overwrite each other's increments
+	_, err := txApp.DB().NewQuery(
+		"UPDATE {{" + JobBatchesCollection + "}} SET [[pending_jobs]] = [[pending_jobs]] - 1, " +
+			"[[" + column + "]] = [[" + column + "]] + 1, [[status]] = {:processing}, [[updated]] = {:now} " +
+			"WHERE [[id]] = {:id} AND [[pending_jobs]] > 0",
+	).Bind(dbx.Params{
+		"processing": JobStatusProcessing,
+		"now":        time.Now().UTC().Format(types.DefaultDateLayout),
+		"id":         batchId,
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update batch %s: %w", batchId, err)
+	}
+
+	batch, err := FindJobBatch(txApp, batchId)
+	if err != nil {
+		log.Warn("Batch of finished job not found", "job_id", record.Id, "batch_id", batchId)
+		return nil
+	}
+	if batch.GetInt("pending_jobs") > 0 || batch.GetString("status") != JobStatusProcessing {
+		return nil
+	}
+
+	batchStatus := JobStatusCompleted
+	callbackField := "on_complete"
+	if batch.GetInt("failed_jobs") > 0 {
+		batchStatus = JobStatusFailed
+		callbackField = "on_failure"
+	}
+
+	batch.Set("status", batchStatus)
+	batch.Set("finished_at", time.Now().UTC())
+
+	var callback *JobSpec
+	if err := batch.UnmarshalJSONField(callbackField, &callback); err != nil {
+		return fmt.Errorf("failed to parse %s callback of batch %s: %w", callbackField, batchId, err)
+	}
+
+	if callback != nil {
+		opts := callback.Options
+		opts.payloadOptions = map[string]any{BatchIDOption: batchId}
+		if opts.UserID == "" {
+			opts.UserID = batch.GetString("user_id")
+		}
+
+		callbackJob, _, err := Enqueue(txApp, callback.Payload, opts)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s callback of batch %s: %w", callbackField, batchId, err)
+		}
+		batch.Set("callback_job_id", callbackJob.Id)
+	}
+
+	if err := txApp.Save(batch); err != nil {
+		return fmt.Errorf("failed to finish batch %s: %w", batchId, err)
+	}
+
+	log.Info("Job batch finished",
+		"batch_id", batchId,
+		"status", batchStatus,
+		"completed", batch.GetInt("completed_jobs"),
+		"failed", batch.GetInt("failed_jobs"))
+
+	return nil
+}
+
+// validateJobSpec checks a job spec before it is stored for later so mistakes surface when the chain or batch is created
+func validateJobSpec(spec JobSpec) error {
+	if spec.Options.Name == "" {
+		return fmt.Errorf("job name is required")
+	}
+
+	_, err := marshalJobPayload(spec.Payload, nil)
+	return err
+}
+
+// JobOption returns an option of a job payload, e.g. PreviousJobIDOption or BatchIDOption, or an empty string
+func JobOption(job *JobData, key string) string {
+	if job == nil {
+		return ""
+	}
+
+	options, ok := job.Payload["options"].(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	value, _ := options[key].(string)
+	return value
+}
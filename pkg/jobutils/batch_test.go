@@ -0,0 +1,296 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newBatchTestProcessor returns a processor with a succeeding "step" handler and a failing "broken" handler
+func newBatchTestProcessor(t *testing.T, app *pocketbase.PocketBase) *JobProcessor {
+	t.Helper()
+
+	processor := NewJobProcessor(app)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	})
+
+	_ = processor.RegisterHandler(&MockJobHandler{jobType: "step"})
+	_ = processor.RegisterHandler(&MockJobHandler{jobType: "broken", err: errors.New("broken job")})
+
+	return processor
+}
+
+// findQueuedJob returns the queue record with the given name
+func findQueuedJob(t *testing.T, app core.App, name string) *core.Record {
+	t.Helper()
+
+	record, err := app.FindFirstRecordByFilter(QueuesCollection, "name = {:name}", dbx.Params{"name": name})
+	if err != nil {
+		t.Fatalf("expected job %s to be queued: %v", name, err)
+	}
+
+	return record
+}
+
+func stepSpec(name string) JobSpec {
+	return JobSpec{Payload: map[string]any{"type": "step"}, Options: EnqueueOptions{Name: name}}
+}
+
+func TestEnqueueChain_RunsJobsInOrder(t *testing.T) {
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	first, err := EnqueueChain(app, []JobSpec{stepSpec("export"), stepSpec("notify"), stepSpec("cleanup")})
+	if err != nil {
+		t.Fatalf("EnqueueChain returned error: %v", err)
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 1 {
+		t.Fatalf("expected only the first job to be queued, got %d", total)
+	}
+
+	previous := first
+	for _, name := range []string{"notify", "cleanup"} {
+		if err := processor.ProcessJob(previous); err != nil {
+			t.Fatalf("ProcessJob returned error: %v", err)
+		}
+
+		next := findQueuedJob(t, app, name)
+		jobData, err := ParseJobDataFromRecord(next)
+		if err != nil {
+			t.Fatalf("failed to parse chained job: %v", err)
+		}
+		if got := JobOption(jobData, PreviousJobIDOption); got != previous.Id {
+			t.Errorf("expected %s to reference previous job %s, got %q", name, previous.Id, got)
+		}
+		previous = next
+	}
+
+	if err := processor.ProcessJob(previous); err != nil {
+		t.Fatalf("ProcessJob returned error: %v", err)
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 0 {
+		t.Errorf("expected the chain to be finished, %d jobs left", total)
+	}
+}
+
+func TestEnqueueChain_StopsOnFailureAndResumesOnRetry(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	broken := JobSpec{Payload: map[string]any{"type": "broken"}, Options: EnqueueOptions{Name: "export"}}
+	first, err := EnqueueChain(app, []JobSpec{broken, stepSpec("notify")})
+	if err != nil {
+		t.Fatalf("EnqueueChain returned error: %v", err)
+	}
+
+	if err := processor.ProcessJob(first); err == nil {
+		t.Fatal("expected the broken job to fail")
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 0 {
+		t.Fatalf("expected the chain to stop, %d jobs queued", total)
+	}
+
+	failedJob, err := app.FindFirstRecordByFilter(FailedJobsCollection, "queue_id = {:id}", dbx.Params{"id": first.Id})
+	if err != nil {
+		t.Fatalf("failed job not found: %v", err)
+	}
+	if chain := GetJobChain(failedJob); len(chain) != 1 || chain[0].Options.Name != "notify" {
+		t.Fatalf("expected the failed job to keep the rest of its chain, got %+v", chain)
+	}
+
+	retried, err := RetryFailedJob(app, failedJob.Id)
+	if err != nil {
+		t.Fatalf("RetryFailedJob returned error: %v", err)
+	}
+	if chain := GetJobChain(retried); len(chain) != 1 {
+		t.Errorf("expected the retried job to resume its chain, got %+v", chain)
+	}
+}
+
+func TestEnqueueBatch_RunsOnCompleteCallback(t *testing.T) {
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	onComplete := stepSpec("batch done")
+	batch, err := EnqueueBatch(app, []JobSpec{stepSpec("a"), stepSpec("b"), stepSpec("c")}, BatchOptions{
+		Name:       "nightly",
+		OnComplete: &onComplete,
+		OnFailure:  &JobSpec{Payload: map[string]any{"type": "step"}, Options: EnqueueOptions{Name: "batch failed"}},
+	})
+	if err != nil {
+		t.Fatalf("EnqueueBatch returned error: %v", err)
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		job := findQueuedJob(t, app, name)
+		if job.GetString("batch_id") != batch.Id {
+			t.Errorf("expected job %s to belong to batch %s", name, batch.Id)
+		}
+		if err := processor.ProcessJob(job); err != nil {
+			t.Fatalf("ProcessJob returned error: %v", err)
+		}
+
+		reloaded, err := FindJobBatch(app, batch.Id)
+		if err != nil {
+			t.Fatalf("batch not found: %v", err)
+		}
+		progress := GetBatchProgress(reloaded)
+		if progress.Completed != i+1 || progress.Pending != 2-i {
+			t.Errorf("unexpected batch progress after %s: %+v", name, progress)
+		}
+	}
+
+	reloaded, _ := FindJobBatch(app, batch.Id)
+	progress := GetBatchProgress(reloaded)
+	if progress.Status != JobStatusCompleted || progress.Percent != 100 || progress.FinishedAt == nil {
+		t.Errorf("expected a completed batch, got %+v", progress)
+	}
+
+	callback := findQueuedJob(t, app, "batch done")
+	if progress.CallbackJobID != callback.Id {
+		t.Errorf("expected callback job %s, got %s", callback.Id, progress.CallbackJobID)
+	}
+	callbackData, _ := ParseJobDataFromRecord(callback)
+	if got := JobOption(callbackData, BatchIDOption); got != batch.Id {
+		t.Errorf("expected callback to reference batch %s, got %q", batch.Id, got)
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 1 {
+		t.Errorf("expected only the on-complete callback to be queued, got %d jobs", total)
+	}
+}
+
+func TestEnqueueBatch_RunsOnFailureCallback(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	broken := JobSpec{Payload: map[string]any{"type": "broken"}, Options: EnqueueOptions{Name: "b"}}
+	batch, err := EnqueueBatch(app, []JobSpec{stepSpec("a"), broken}, BatchOptions{
+		Name:       "nightly",
+		OnComplete: &JobSpec{Payload: map[string]any{"type": "step"}, Options: EnqueueOptions{Name: "batch done"}},
+		OnFailure:  &JobSpec{Payload: map[string]any{"type": "step"}, Options: EnqueueOptions{Name: "batch failed"}},
+	})
+	if err != nil {
+		t.Fatalf("EnqueueBatch returned error: %v", err)
+	}
+
+	_ = processor.ProcessJob(findQueuedJob(t, app, "a"))
+	_ = processor.ProcessJob(findQueuedJob(t, app, "b"))
+
+	reloaded, _ := FindJobBatch(app, batch.Id)
+	progress := GetBatchProgress(reloaded)
+	if progress.Status != JobStatusFailed || progress.Completed != 1 || progress.Failed != 1 {
+		t.Errorf("expected a failed batch with one failure, got %+v", progress)
+	}
+
+	findQueuedJob(t, app, "batch failed")
+	if _, err := app.FindFirstRecordByFilter(QueuesCollection, "name = 'batch done'"); err == nil {
+		t.Error("on-complete callback should not run for a failed batch")
+	}
+}
+
+func TestEnqueueBatch_ChainedMemberFinishesWithChain(t *testing.T) {
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	chained := stepSpec("export")
+	chained.Options.Chain = []JobSpec{stepSpec("notify")}
+	batch, err := EnqueueBatch(app, []JobSpec{chained}, BatchOptions{Name: "chained"})
+	if err != nil {
+		t.Fatalf("EnqueueBatch returned error: %v", err)
+	}
+
+	_ = processor.ProcessJob(findQueuedJob(t, app, "export"))
+
+	reloaded, _ := FindJobBatch(app, batch.Id)
+	if progress := GetBatchProgress(reloaded); progress.Pending != 1 {
+		t.Fatalf("batch member should stay pending until its chain finished, got %+v", progress)
+	}
+
+	notify := findQueuedJob(t, app, "notify")
+	if notify.GetString("batch_id") != batch.Id {
+		t.Errorf("expected chained job to inherit batch %s", batch.Id)
+	}
+	_ = processor.ProcessJob(notify)
+
+	reloaded, _ = FindJobBatch(app, batch.Id)
+	if progress := GetBatchProgress(reloaded); progress.Status != JobStatusCompleted {
+		t.Errorf("expected batch to complete with its chain, got %+v", progress)
+	}
+}
+
+func TestEnqueueBatch_Validation(t *testing.T) {
+	app := newTestApp(t)
+
+	if _, err := EnqueueBatch(app, []JobSpec{stepSpec("a")}, BatchOptions{}); err == nil {
+		t.Error("expected a batch without name to be rejected")
+	}
+	if _, err := EnqueueBatch(app, nil, BatchOptions{Name: "empty"}); err == nil {
+		t.Error("expected an empty batch to be rejected")
+	}
+
+	invalid := JobSpec{Payload: map[string]any{"data": map[string]any{}}, Options: EnqueueOptions{Name: "untyped"}}
+	if _, err := EnqueueBatch(app, []JobSpec{stepSpec("a")}, BatchOptions{Name: "bad callback", OnComplete: &invalid}); err == nil {
+		t.Error("expected an invalid callback to be rejected")
+	}
+
+	unique := stepSpec("unique")
+	unique.Options.UniqueKey = "only-once"
+	if _, _, err := Enqueue(app, unique.Payload, unique.Options); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if _, err := EnqueueBatch(app, []JobSpec{unique}, BatchOptions{Name: "duplicate"}); err == nil {
+		t.Error("expected a batch with an already queued unique job to be rejected")
+	}
+	if total, _ := app.CountRecords(JobBatchesCollection); total != 0 {
+		t.Errorf("rejected batches should not be stored, got %d", total)
+	}
+}
+
+func TestEnqueueChain_PropagatesOwner(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	processor := newBatchTestProcessor(t, app)
+
+	export := stepSpec("export")
+	export.Options.UserID = "user123"
+	broken := JobSpec{Payload: map[string]any{"type": "broken"}, Options: EnqueueOptions{Name: "notify"}}
+
+	first, err := EnqueueChain(app, []JobSpec{export, broken})
+	if err != nil {
+		t.Fatalf("EnqueueChain returned error: %v", err)
+	}
+	_ = processor.ProcessJob(first)
+
+	if jobResult, err := FindJobResult(app, first.Id); err != nil || jobResult.GetString("user_id") != "user123" {
+		t.Errorf("expected the job result to record the owner, got %v", err)
+	}
+
+	next := findQueuedJob(t, app, "notify")
+	if next.GetString("user_id") != "user123" {
+		t.Errorf("expected the next link to inherit the owner, got %q", next.GetString("user_id"))
+	}
+
+	_ = processor.ProcessJob(next)
+	failedJob, err := app.FindFirstRecordByFilter(FailedJobsCollection, "queue_id = {:id}", dbx.Params{"id": next.Id})
+	if err != nil || failedJob.GetString("user_id") != "user123" {
+		t.Fatalf("expected the dead-lettered job to keep the owner, got %v", err)
+	}
+
+	retried, err := RetryFailedJob(app, failedJob.Id)
+	if err != nil || retried.GetString("user_id") != "user123" {
+		t.Errorf("expected the retried job to keep the owner, got %v", err)
+	}
+}
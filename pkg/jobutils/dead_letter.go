@@ -0,0 +1,384 @@
+package jobutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+	"ims-pocketbase-baas-starter/pkg/metrics"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Constants for the dead-letter queue
+const (
+	FailedJobsCollection = "failed_jobs"
+	DefaultMaxAttempts   = 3
+)
+
+// GetMaxAttempts returns the maximum number of attempts allowed for a job type.
+// The limit is resolved from JOB_MAX_RETRIES_<TYPE>, then the handler's MaxAttemptsProvider
+// implementation, then JOB_MAX_RETRIES and finally DefaultMaxAttempts.
+func (r *JobRegistry) GetMaxAttempts(jobType string) int {
+	if jobType != "" {
+		envKey := "JOB_MAX_RETRIES_" + strings.ToUpper(jobType)
+		if maxAttempts := common.GetEnvInt(envKey, 0); maxAttempts > 0 {
+			return maxAttempts
+		}
+	}
+
+	if r != nil {
+		r.mu.RLock()
+		handler, exists := r.handlers[jobType]
+		r.mu.RUnlock()
+
+		if provider, ok := handler.(MaxAttemptsProvider); exists && ok {
+			if maxAttempts := provider.GetMaxAttempts(); maxAttempts > 0 {
+				return maxAttempts
+			}
+		}
+	}
+
+	if maxAttempts := common.GetEnvInt("JOB_MAX_RETRIES", DefaultMaxAttempts); maxAttempts > 0 {
+		return maxAttempts
+	}
+
+	return DefaultMaxAttempts
+}
+
+// recordJobFailure increments the attempt counter of a queue record and stores the error in its
+// attempt history. Jobs that reach their max attempts are moved to the failed_jobs collection,
+// others are delayed by pushing available_at forward using the job type's backoff strategy.
+// Dead-lettered jobs also get a failed entry in job_results and count as failed in their batch. It returns true when the job was dead-lettered.
+// Nothing is changed when the job is no longer reserved as it was when it started (ErrJobReservationLost), and a job
+// whose handler still runs after its timeout stays reserved until the handler returns.
+func recordJobFailure(app core.App, registry *JobRegistry, record *core.Record, jobErr error, duration time.Duration) (bool, error) {
+	reservedBy := record.GetString("reserved_by")
+	attempts := int(record.GetFloat("attempts")) + 1
+	reason := failureReason(jobErr)
+
+	history := GetAttemptHistory(record)
+	history = append(history, JobAttempt{
+		Attempt:  attempts,
+		Error:    errorText(jobErr),
+		Reason:   reason,
+		FailedAt: time.Now().UTC(),
+	})
+
+	record.Set("attempts", attempts)
+	if runningHandler(jobErr) != nil {
+		record.Set("reserved_at", types.NowDateTime().String())
+	} else {
+		record.Set("reserved_at", "")
+		record.Set("reserved_by", "")
+	}
+	record.Set("last_error", errorText(jobErr))
+	record.Set("attempt_history", history)
+	record.Set("progress", nil)
+
+	jobType := extractJobType(record)
+	maxAttempts := registry.GetMaxAttempts(jobType)
+
+	metrics.SafeIncrementCounter(metrics.GetInstance(), metrics.MetricJobFailuresTotal, map[string]string{
+		metrics.LabelJobType: jobType,
+		metrics.LabelReason:  reason,
+	})
+
+	if attempts >= maxAttempts {
+		err := runJobTransaction(app, func(txApp core.App) error {
+			if err := checkJobReservation(txApp, record.Id, reservedBy); err != nil {
+				return err
+			}
+			if _, err := MoveToFailedJobs(txApp, record, jobErr); err != nil {
+				return err
+			}
+			if _, err := SaveJobResult(txApp, record, JobStatusFailed, nil, jobErr, duration); err != nil {
+				return err
+			}
+			return finishChainedJob(txApp, record, JobStatusFailed)
+		})
+		if err != nil {
+			return false, err
+		}
+
+		metrics.SafeIncrementCounter(metrics.GetInstance(), metrics.MetricJobDeadLetteredTotal, map[string]string{
+			metrics.LabelJobType: jobType,
+		})
+
+		publishJobProgress(app, record.Id, JobStatusFailed, nil)
+		handleJobFailure(registry, record, jobErr)
+
+		log.Warn("Job moved to failed jobs",
+			"job_id", record.Id,
+			"job_name", record.GetString("name"),
+			"job_type", jobType,
+			"attempts", attempts,
+			"max_attempts", maxAttempts)
+
+		return true, nil
+	}
+
+	delay := registry.GetBackoffStrategy(jobType).NextDelay(attempts)
+	record.Set("available_at", time.Now().UTC().Add(delay))
+
+	err := runJobTransaction(app, func(txApp core.App) error {
+		if err := checkJobReservation(txApp, record.Id, reservedBy); err != nil {
+			return err
+		}
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("failed to save job attempt for %s: %w", record.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	publishJobProgress(app, record.Id, JobStatusQueued, nil)
+
+	log.Debug("Job scheduled for retry", "job_id", record.Id, "attempts", attempts, "retry_in", delay)
+	return false, nil
+}
+
+// handleJobFailure passes a dead-lettered job to its handler when it implements JobFailureHandler. Errors
+// are only logged, the job is already in failed_jobs.
+func handleJobFailure(registry *JobRegistry, record *core.Record, jobErr error) {
+	jobData, err := ParseJobDataFromRecord(record)
+	if err != nil || registry == nil {
+		return
+	}
+
+	handler, err := registry.GetHandler(jobData.Type)
+	if err != nil {
+		return
+	}
+
+	failureHandler, ok := handler.(JobFailureHandler)
+	if !ok {
+		return
+	}
+
+	if err := failureHandler.HandleFailure(jobData, jobErr); err != nil {
+		log.Error("Job failure handler failed", "job_id", record.Id, "job_type", jobData.Type, "error", err)
+	}
+}
+
+// MoveToFailedJobs copies a queue record into the failed_jobs collection and removes it from the queue
+func MoveToFailedJobs(app core.App, record *core.Record, jobErr error) (*core.Record, error) {
+	if record == nil {
+		return nil, fmt.Errorf("record cannot be nil")
+	}
+
+	var failedJob *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		collection, err := txApp.FindCollectionByNameOrId(FailedJobsCollection)
+		if err != nil {
+			return fmt.Errorf("failed to find %s collection: %w", FailedJobsCollection, err)
+		}
+
+		failedJob = core.NewRecord(collection)
+		failedJob.Set("queue_id", record.Id)
+		failedJob.Set("name", record.GetString("name"))
+		failedJob.Set("description", record.GetString("description"))
+		failedJob.Set("job_type", extractJobType(record))
+		// Failed jobs are kept for inspection, not to run with the requester's secrets
+		failedJob.Set("payload", RedactPayloadSecrets(record.Get("payload")))
+		failedJob.Set("attempts", record.GetFloat("attempts"))
+		failedJob.Set("error", errorText(jobErr))
+		failedJob.Set("stack", errorStack(jobErr))
+		failedJob.Set("attempt_history", GetAttemptHistory(record))
+		failedJob.Set("failed_at", time.Now().UTC())
+		failedJob.Set("queue", record.GetString("queue"))
+		failedJob.Set("priority", record.GetFloat("priority"))
+		failedJob.Set("chain", GetJobChain(record))
+		failedJob.Set("user_id", record.GetString("user_id"))
+
+		if err := txApp.Save(failedJob); err != nil {
+			return fmt.Errorf("failed to save failed job for %s: %w", record.Id, err)
+		}
+
+		if err := txApp.Delete(record); err != nil {
+			return fmt.Errorf("failed to remove job %s from queue: %w", record.Id, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return failedJob, nil
+}
+
+// ListFailedJobs returns a page of failed jobs (newest first) and the total count, optionally filtered by job type
+func ListFailedJobs(app core.App, jobType string, limit, offset int) ([]*core.Record, int64, error) {
+	filter, params := failedJobsFilter(jobType)
+
+	records, err := app.FindRecordsByFilter(FailedJobsCollection, filter, "-failed_at", limit, offset, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed jobs: %w", err)
+	}
+
+	total, err := app.CountRecords(FailedJobsCollection, failedJobsExpr(jobType))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count failed jobs: %w", err)
+	}
+
+	return records, total, nil
+}
+
+// RetryFailedJob re-queues a failed job with a reset attempt counter and removes it from failed_jobs.
+// The rest of the job's chain is kept; the job no longer belongs to the batch it failed in.
+func RetryFailedJob(app core.App, failedJobId string) (*core.Record, error) {
+	var job *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		failedJob, err := txApp.FindRecordById(FailedJobsCollection, failedJobId)
+		if err != nil {
+			return fmt.Errorf("failed job %s not found: %w", failedJobId, err)
+		}
+
+		job, _, err = Enqueue(txApp, failedJob.Get("payload"), EnqueueOptions{
+			Name:        failedJob.GetString("name"),
+			Description: failedJob.GetString("description"),
+			Queue:       failedJob.GetString("queue"),
+			Priority:    failedJob.GetInt("priority"),
+			Chain:       GetJobChain(failedJob),
+			UserID:      failedJob.GetString("user_id"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to re-queue failed job %s: %w", failedJobId, err)
+		}
+
+		if err := txApp.Delete(failedJob); err != nil {
+			return fmt.Errorf("failed to remove failed job %s: %w", failedJobId, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Failed job re-queued", "failed_job_id", failedJobId, "job_id", job.Id)
+	return job, nil
+}
+
+// RetryFailedJobs re-queues all failed jobs, optionally filtered by job type, and returns the number re-queued
+func RetryFailedJobs(app core.App, jobType string) (int, error) {
+	records, err := app.FindAllRecords(FailedJobsCollection, failedJobsExpr(jobType))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch failed jobs: %w", err)
+	}
+
+	retried := 0
+	for _, record := range records {
+		if _, err := RetryFailedJob(app, record.Id); err != nil {
+			return retried, err
+		}
+		retried++
+	}
+
+	return retried, nil
+}
+
+// DeleteFailedJob permanently removes a single failed job
+func DeleteFailedJob(app core.App, failedJobId string) error {
+	record, err := app.FindRecordById(FailedJobsCollection, failedJobId)
+	if err != nil {
+		return fmt.Errorf("failed job %s not found: %w", failedJobId, err)
+	}
+
+	if err := app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete failed job %s: %w", failedJobId, err)
+	}
+
+	return nil
+}
+
+// PurgeFailedJobs permanently removes all failed jobs, optionally filtered by job type, and returns the number removed
+func PurgeFailedJobs(app core.App, jobType string) (int, error) {
+	records, err := app.FindAllRecords(FailedJobsCollection, failedJobsExpr(jobType))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch failed jobs: %w", err)
+	}
+
+	purged := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete failed job %s: %w", record.Id, err)
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// GetAttemptHistory returns the attempt history stored on a queue or failed_jobs record
+func GetAttemptHistory(record *core.Record) []JobAttempt {
+	history := []JobAttempt{}
+	if record == nil {
+		return history
+	}
+
+	if err := record.UnmarshalJSONField("attempt_history", &history); err != nil {
+		return []JobAttempt{}
+	}
+
+	return history
+}
+
+// extractJobType reads the job type from a record payload without validating the rest of it
+func extractJobType(record *core.Record) string {
+	var payload struct {
+		Type string `json:"type"`
+	}
+
+	if err := json.Unmarshal([]byte(record.GetString("payload")), &payload); err != nil {
+		return ""
+	}
+
+	return payload.Type
+}
+
+func failedJobsFilter(jobType string) (string, dbx.Params) {
+	if jobType == "" {
+		return "", dbx.Params{}
+	}
+	return "job_type = {:job_type}", dbx.Params{"job_type": jobType}
+}
+
+func failedJobsExpr(jobType string) dbx.Expression {
+	if jobType == "" {
+		return nil
+	}
+	return dbx.HashExp{"job_type": jobType}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func errorStack(err error) string {
+	var panicErr *JobPanicError
+	if errors.As(err, &panicErr) {
+		return string(panicErr.Stack)
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	"testing"
+	"time"
+)
+
+type maxAttemptsJobHandler struct {
+	MockJobHandler
+	maxAttempts int
+}
+
+func (h *maxAttemptsJobHandler) GetMaxAttempts() int {
+	return h.maxAttempts
+}
+
+type panicJobHandler struct {
+	jobType string
+}
+
+func (h *panicJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *JobData) error {
+	panic("boom")
+}
+
+func (h *panicJobHandler) GetJobType() string {
+	return h.jobType
+}
+
+type failureJobHandler struct {
+	MockJobHandler
+	failures []string
+}
+
+func (h *failureJobHandler) HandleFailure(job *JobData, jobErr error) error {
+	h.failures = append(h.failures, job.ID+": "+jobErr.Error())
+	return nil
+}
+
+func TestRecordJobFailure_CallsFailureHandler(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "2")
+
+	app := newTestApp(t)
+	handler := &failureJobHandler{MockJobHandler: MockJobHandler{jobType: "test_job"}}
+	registry := NewJobRegistry()
+	_ = registry.Register(handler)
+	job := createTestJob(t, app, "notify me", map[string]any{"type": "test_job"})
+
+	if _, err := recordJobFailure(app, registry, job, errors.New("attempt one"), 0); err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+	if len(handler.failures) != 0 {
+		t.Fatalf("failure handler should wait for the last attempt, got %v", handler.failures)
+	}
+
+	if _, err := recordJobFailure(app, registry, job, errors.New("attempt two"), 0); err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+	if len(handler.failures) != 1 || handler.failures[0] != job.Id+": attempt two" {
+		t.Errorf("expected the dead-lettered job with its last error, got %v", handler.failures)
+	}
+}
+
+func TestJobRegistry_GetMaxAttempts(t *testing.T) {
+	registry := NewJobRegistry()
+	_ = registry.Register(&maxAttemptsJobHandler{MockJobHandler: MockJobHandler{jobType: "custom"}, maxAttempts: 7})
+	_ = registry.Register(&MockJobHandler{jobType: "plain"})
+
+	if got := registry.GetMaxAttempts("plain"); got != DefaultMaxAttempts {
+		t.Errorf("expected default max attempts %d, got %d", DefaultMaxAttempts, got)
+	}
+
+	if got := registry.GetMaxAttempts("custom"); got != 7 {
+		t.Errorf("expected handler max attempts 7, got %d", got)
+	}
+
+	t.Setenv("JOB_MAX_RETRIES", "5")
+	if got := registry.GetMaxAttempts("plain"); got != 5 {
+		t.Errorf("expected JOB_MAX_RETRIES to apply, got %d", got)
+	}
+
+	t.Setenv("JOB_MAX_RETRIES_CUSTOM", "2")
+	if got := registry.GetMaxAttempts("custom"); got != 2 {
+		t.Errorf("expected per-type env override to apply, got %d", got)
+	}
+}
+
+func TestRecordJobFailure_BelowMaxAttempts(t *testing.T) {
+	app := newTestApp(t)
+	registry := NewJobRegistry()
+	job := createTestJob(t, app, "retry me", map[string]any{"type": "test_job"})
+
+	deadLettered, err := recordJobFailure(app, registry, job, errors.New("first failure"), 0)
+	if err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+	if deadLettered {
+		t.Fatal("job should not be dead-lettered after the first attempt")
+	}
+
+	reloaded, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("job should still be queued: %v", err)
+	}
+
+	if got := int(reloaded.GetFloat("attempts")); got != 1 {
+		t.Errorf("expected 1 attempt, got %d", got)
+	}
+	if got := reloaded.GetString("last_error"); got != "first failure" {
+		t.Errorf("expected last_error to be stored, got %q", got)
+	}
+
+	history := GetAttemptHistory(reloaded)
+	if len(history) != 1 || history[0].Error != "first failure" {
+		t.Errorf("expected one attempt in history, got %+v", history)
+	}
+}
+
+func TestRecordJobFailure_MovesToFailedJobs(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "2")
+
+	app := newTestApp(t)
+	registry := NewJobRegistry()
+	job := createTestJob(t, app, "poisoned", map[string]any{"type": "test_job"})
+
+	if _, err := recordJobFailure(app, registry, job, errors.New("attempt one"), 0); err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+
+	panicErr := &JobPanicError{Value: "boom", Stack: []byte("goroutine 1 [running]")}
+	deadLettered, err := recordJobFailure(app, registry, job, panicErr, 0)
+	if err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+	if !deadLettered {
+		t.Fatal("job should be dead-lettered after reaching max attempts")
+	}
+
+	if _, err := app.FindRecordById(QueuesCollection, job.Id); err == nil {
+		t.Error("dead-lettered job should be removed from the queue")
+	}
+
+	failed, err := app.FindFirstRecordByData(FailedJobsCollection, "queue_id", job.Id)
+	if err != nil {
+		t.Fatalf("failed job record not found: %v", err)
+	}
+
+	if got := failed.GetString("job_type"); got != "test_job" {
+		t.Errorf("expected job_type test_job, got %q", got)
+	}
+	if got := failed.GetString("error"); got != panicErr.Error() {
+		t.Errorf("expected last error %q, got %q", panicErr.Error(), got)
+	}
+	if got := failed.GetString("stack"); got != "goroutine 1 [running]" {
+		t.Errorf("expected panic stack to be stored, got %q", got)
+	}
+	if history := GetAttemptHistory(failed); len(history) != 2 {
+		t.Errorf("expected 2 attempts in history, got %d", len(history))
+	}
+}
+
+func TestRetryAndPurgeFailedJobs(t *testing.T) {
+	app := newTestApp(t)
+
+	jobs := []string{"a", "b", "c"}
+	for _, name := range jobs {
+		job := createTestJob(t, app, name, map[string]any{"type": "test_job"})
+		if _, err := MoveToFailedJobs(app, job, errors.New("failed")); err != nil {
+			t.Fatalf("MoveToFailedJobs returned error: %v", err)
+		}
+	}
+
+	records, total, err := ListFailedJobs(app, "test_job", 10, 0)
+	if err != nil {
+		t.Fatalf("ListFailedJobs returned error: %v", err)
+	}
+	if total != 3 || len(records) != 3 {
+		t.Fatalf("expected 3 failed jobs, got total=%d len=%d", total, len(records))
+	}
+
+	requeued, err := RetryFailedJob(app, records[0].Id)
+	if err != nil {
+		t.Fatalf("RetryFailedJob returned error: %v", err)
+	}
+	if got := int(requeued.GetFloat("attempts")); got != 0 {
+		t.Errorf("re-queued job should have 0 attempts, got %d", got)
+	}
+	if requeued.GetString("name") != records[0].GetString("name") {
+		t.Error("re-queued job should keep its name")
+	}
+
+	purged, err := PurgeFailedJobs(app, "")
+	if err != nil {
+		t.Fatalf("PurgeFailedJobs returned error: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("expected 2 purged jobs, got %d", purged)
+	}
+
+	if _, total, _ := ListFailedJobs(app, "", 10, 0); total != 0 {
+		t.Errorf("expected no failed jobs after purge, got %d", total)
+	}
+}
+
+func TestJobProcessor_ProcessJob_DeadLettersPanickingJob(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES_PANIC_JOB", "1")
+
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	if err := processor.RegisterHandler(&panicJobHandler{jobType: "panic_job"}); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	job := createTestJob(t, app, "panics", map[string]any{"type": "panic_job"})
+
+	if err := processor.ProcessJob(job); err == nil {
+		t.Fatal("expected ProcessJob to return the panic error")
+	}
+
+	failed, err := app.FindFirstRecordByData(FailedJobsCollection, "queue_id", job.Id)
+	if err != nil {
+		t.Fatalf("panicking job should be dead-lettered: %v", err)
+	}
+	if failed.GetString("stack") == "" {
+		t.Error("expected panic stack trace to be stored")
+	}
+}
@@ -0,0 +1,252 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+)
+
+// Default dispatcher configuration values
+const (
+	DefaultPollInterval    = 500 * time.Millisecond
+	DefaultMaxPollInterval = 5 * time.Second
+	DefaultDispatchBatch   = 50
+)
+
+// DispatcherConfig configures the continuous queue dispatcher
+type DispatcherConfig struct {
+	PollInterval    time.Duration // Interval used while jobs keep arriving
+	MaxPollInterval time.Duration // Upper bound of the idle backoff
+	BatchSize       int           // Maximum number of jobs fetched per queue and cycle
+}
+
+// Dispatcher continuously polls the queues collection and hands pending jobs to the worker pool.
+// Each named queue is polled by its own loop so a long running batch on one queue does not delay
+// the others. Idle loops double their poll interval up to MaxPollInterval and reset it as soon as
+// jobs are found or Wake is called.
+type Dispatcher struct {
+	processor *JobProcessor
+	config    DispatcherConfig
+	wakers    map[string]chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	running   bool
+	mu        sync.Mutex
+}
+
+// NewDispatcherConfigFromEnv builds a dispatcher configuration from JOB_POLL_INTERVAL_MS,
+// JOB_POLL_MAX_INTERVAL_MS and JOB_BATCH_SIZE
+func NewDispatcherConfigFromEnv() DispatcherConfig {
+	return DispatcherConfig{
+		PollInterval:    time.Duration(common.GetEnvInt("JOB_POLL_INTERVAL_MS", int(DefaultPollInterval/time.Millisecond))) * time.Millisecond,
+		MaxPollInterval: time.Duration(common.GetEnvInt("JOB_POLL_MAX_INTERVAL_MS", int(DefaultMaxPollInterval/time.Millisecond))) * time.Millisecond,
+		BatchSize:       common.GetEnvInt("JOB_BATCH_SIZE", DefaultDispatchBatch),
+	}
+}
+
+// NewDispatcher creates a dispatcher for a job processor, filling in defaults for unset values
+func NewDispatcher(processor *JobProcessor, config DispatcherConfig) *Dispatcher {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.MaxPollInterval < config.PollInterval {
+		config.MaxPollInterval = config.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultDispatchBatch
+	}
+
+	return &Dispatcher{
+		processor: processor,
+		config:    config,
+	}
+}
+
+// Start launches one polling loop per named queue. Starting a running dispatcher is a no-op.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return
+	}
+
+	d.stop = make(chan struct{})
+	d.wakers = make(map[string]chan struct{})
+	for _, queueName := range d.processor.QueueNames() {
+		wake := make(chan struct{}, 1)
+		d.wakers[queueName] = wake
+		d.wg.Add(1)
+		go d.run(queueName, wake)
+	}
+	d.running = true
+
+	log.Info("Job dispatcher started",
+		"queues", len(d.wakers),
+		"poll_interval", d.config.PollInterval,
+		"max_poll_interval", d.config.MaxPollInterval)
+}
+
+// Stop signals all polling loops to exit and waits for in-flight batches to finish or ctx to expire
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return nil
+	}
+	d.running = false
+	close(d.stop)
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("Job dispatcher stopped")
+		return nil
+	case <-ctx.Done():
+		log.Warn("Job dispatcher stop timed out with batches still in flight")
+		return ctx.Err()
+	}
+}
+
+// Wake makes the polling loops fetch jobs immediately instead of waiting for their next tick
+func (d *Dispatcher) Wake() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.running {
+		return
+	}
+
+	for _, wake := range d.wakers {
+		select {
+		case wake <- struct{}{}:
+		default:
+			// A wake-up is already pending for this queue
+		}
+	}
+}
+
+// IsRunning returns whether the dispatcher polling loops are active
+func (d *Dispatcher) IsRunning() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.running
+}
+
+// run polls a single named queue until the dispatcher is stopped
+func (d *Dispatcher) run(queueName string, wake chan struct{}) {
+	defer d.wg.Done()
+
+	interval := d.config.PollInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-wake:
+			interval = d.config.PollInterval
+		case <-timer.C:
+		}
+
+		dispatched, err := d.dispatch(queueName)
+		if err != nil {
+			log.Error("Job dispatch failed", "queue", queueName, "error", err)
+		}
+
+		if dispatched > 0 {
+			interval = d.config.PollInterval
+		} else {
+			interval = min(interval*2, d.config.MaxPollInterval)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// dispatch fetches one batch of pending jobs of a queue and processes it on the worker pool
+func (d *Dispatcher) dispatch(queueName string) (int, error) {
+	records, err := d.processor.FetchPendingJobs(queueName, d.config.BatchSize, GetReservationTimeout())
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	failed := 0
+	for _, err := range d.processor.ProcessJobsConcurrently(records, 0) {
+		if err != nil && !errors.Is(err, ErrJobAlreadyReserved) && !errors.Is(err, ErrWorkerPoolDraining) {
+			failed++
+		}
+	}
+
+	log.Debug("Job dispatch cycle completed", "queue", queueName, "jobs", len(records), "failed", failed)
+	return len(records), nil
+}
+
+// StartDispatcher starts continuous polling of the queues collection for this processor
+func (p *JobProcessor) StartDispatcher(config DispatcherConfig) {
+	p.dispatcherMu.Lock()
+	if p.dispatcher == nil {
+		p.dispatcher = NewDispatcher(p, config)
+	}
+	dispatcher := p.dispatcher
+	p.dispatcherMu.Unlock()
+
+	dispatcher.Start()
+}
+
+// StopDispatcher stops continuous polling, waiting for in-flight batches until ctx expires
+func (p *JobProcessor) StopDispatcher(ctx context.Context) error {
+	p.dispatcherMu.Lock()
+	dispatcher := p.dispatcher
+	p.dispatcherMu.Unlock()
+
+	if dispatcher == nil {
+		return nil
+	}
+
+	if err := dispatcher.Stop(ctx); err != nil {
+		return fmt.Errorf("failed to stop job dispatcher: %w", err)
+	}
+	return nil
+}
+
+// WakeDispatcher makes a running dispatcher fetch jobs immediately, e.g. after a job was queued
+func (p *JobProcessor) WakeDispatcher() {
+	p.dispatcherMu.Lock()
+	dispatcher := p.dispatcher
+	p.dispatcherMu.Unlock()
+
+	if dispatcher != nil {
+		dispatcher.Wake()
+	}
+}
+
+// IsDispatcherRunning returns whether continuous polling is active for this processor
+func (p *JobProcessor) IsDispatcherRunning() bool {
+	p.dispatcherMu.Lock()
+	dispatcher := p.dispatcher
+	p.dispatcherMu.Unlock()
+
+	return dispatcher != nil && dispatcher.IsRunning()
+}
@@ -0,0 +1,119 @@
+package jobutils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitForJobRuns polls the counting handler until it has executed the expected number of jobs
+func waitForJobRuns(t *testing.T, handler *countingJobHandler, expected int64, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for handler.total.Load() < expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d job executions within %v, got %d", expected, timeout, handler.total.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewDispatcher_Defaults(t *testing.T) {
+	dispatcher := NewDispatcher(&JobProcessor{}, DispatcherConfig{PollInterval: 2 * time.Second, MaxPollInterval: time.Second})
+
+	if dispatcher.config.MaxPollInterval != 2*time.Second {
+		t.Errorf("expected max poll interval to be raised to the poll interval, got %v", dispatcher.config.MaxPollInterval)
+	}
+	if dispatcher.config.BatchSize != DefaultDispatchBatch {
+		t.Errorf("expected default batch size %d, got %d", DefaultDispatchBatch, dispatcher.config.BatchSize)
+	}
+}
+
+func TestDispatcher_ProcessesJobsContinuously(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	handler := &countingJobHandler{jobType: "counted", runs: make(map[string]int)}
+	if err := processor.RegisterHandler(handler); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	processor.StartDispatcher(DispatcherConfig{PollInterval: 10 * time.Millisecond, MaxPollInterval: 50 * time.Millisecond})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.StopDispatcher(ctx)
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	if !processor.IsDispatcherRunning() {
+		t.Fatal("expected dispatcher to be running")
+	}
+
+	for i := 0; i < 3; i++ {
+		createTestJob(t, app, "continuous", map[string]any{"type": "counted"})
+	}
+
+	waitForJobRuns(t, handler, 3, 5*time.Second)
+}
+
+func TestDispatcher_WakeSkipsIdleBackoff(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	handler := &countingJobHandler{jobType: "counted", runs: make(map[string]int)}
+	if err := processor.RegisterHandler(handler); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	// With an hour long poll interval only a wake-up can get the job processed in time
+	processor.StartDispatcher(DispatcherConfig{PollInterval: time.Hour, MaxPollInterval: time.Hour})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.StopDispatcher(ctx)
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	// Let the initial poll run on the empty queue
+	time.Sleep(50 * time.Millisecond)
+
+	createTestJob(t, app, "woken", map[string]any{"type": "counted"})
+	processor.WakeDispatcher()
+
+	waitForJobRuns(t, handler, 1, 5*time.Second)
+}
+
+func TestDispatcher_Stop(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := processor.StopDispatcher(ctx); err != nil {
+		t.Fatalf("stopping a dispatcher that never started should not fail: %v", err)
+	}
+
+	processor.StartDispatcher(DispatcherConfig{PollInterval: 10 * time.Millisecond})
+	if err := processor.StopDispatcher(ctx); err != nil {
+		t.Fatalf("StopDispatcher returned error: %v", err)
+	}
+	if processor.IsDispatcherRunning() {
+		t.Error("expected dispatcher to be stopped")
+	}
+
+	// Waking a stopped dispatcher is a no-op and it can be started again
+	processor.WakeDispatcher()
+	processor.StartDispatcher(DispatcherConfig{})
+	if !processor.IsDispatcherRunning() {
+		t.Error("expected dispatcher to be restarted")
+	}
+	if err := processor.StopDispatcher(ctx); err != nil {
+		t.Fatalf("StopDispatcher returned error: %v", err)
+	}
+}
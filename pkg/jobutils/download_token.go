@@ -0,0 +1,87 @@
+package jobutils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// Constants for signed job download tokens
+const (
+	DefaultDownloadTokenTTL = 5 * time.Minute
+	downloadTokenType       = "job_download"
+)
+
+// GetDownloadTokenTTL returns how long a download token is valid, configured via JOB_DOWNLOAD_TOKEN_TTL_SECONDS
+func GetDownloadTokenTTL() time.Duration {
+	seconds := common.GetEnvInt("JOB_DOWNLOAD_TOKEN_TTL_SECONDS", int(DefaultDownloadTokenTTL/time.Second))
+	if seconds <= 0 {
+		return DefaultDownloadTokenTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// NewJobDownloadToken returns a signed token that grants access to the export file of a job until it expires
+func NewJobDownloadToken(app core.App, jobId string, ttl time.Duration) (string, time.Time, error) {
+	secret, err := downloadTokenSecret(app)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := security.NewJWT(jwt.MapClaims{
+		"type":   downloadTokenType,
+		"job_id": jobId,
+	}, secret, ttl)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign download token for job %s: %w", jobId, err)
+	}
+
+	return token, time.Now().Add(ttl), nil
+}
+
+// ParseJobDownloadToken verifies a download token and returns the ID of the job it grants access to
+func ParseJobDownloadToken(app core.App, token string) (string, error) {
+	secret, err := downloadTokenSecret(app)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := security.ParseJWT(token, secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid download token: %w", err)
+	}
+
+	jobId, _ := claims["job_id"].(string)
+	if claims["type"] != downloadTokenType || jobId == "" {
+		return "", fmt.Errorf("invalid download token: not a job download token")
+	}
+
+	return jobId, nil
+}
+
+// downloadTokenSecret returns JOB_DOWNLOAD_TOKEN_SECRET, falling back to a key derived from the superusers
+// file token secret, which is stored in the database and therefore shared by every instance
+func downloadTokenSecret(app core.App) (string, error) {
+	if secret := common.GetEnv("JOB_DOWNLOAD_TOKEN_SECRET", ""); secret != "" {
+		return secret, nil
+	}
+
+	superusers, err := app.FindCachedCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve download token secret: %w", err)
+	}
+
+	return superusers.FileToken.Secret + downloadTokenType, nil
+}
+
+// JobDownloadURL returns the public URL at which a download token can be redeemed
+func JobDownloadURL(app core.App, token string) string {
+	return strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/api/v1/jobs/download?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,63 @@
+package jobutils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+func TestJobDownloadToken(t *testing.T) {
+	app := newTestApp(t)
+
+	token, expiresAt, err := NewJobDownloadToken(app, "job123", time.Minute)
+	if err != nil {
+		t.Fatalf("NewJobDownloadToken returned error: %v", err)
+	}
+	if expiresAt.Before(time.Now().Add(50 * time.Second)) {
+		t.Errorf("expected the token to expire in about a minute, got %v", expiresAt)
+	}
+
+	jobId, err := ParseJobDownloadToken(app, token)
+	if err != nil || jobId != "job123" {
+		t.Fatalf("expected job123, got %q (%v)", jobId, err)
+	}
+
+	if _, err := ParseJobDownloadToken(app, token+"x"); err == nil {
+		t.Error("expected a tampered token to be rejected")
+	}
+
+	expired, _, _ := NewJobDownloadToken(app, "job123", -time.Minute)
+	if _, err := ParseJobDownloadToken(app, expired); err == nil {
+		t.Error("expected an expired token to be rejected")
+	}
+
+	secret, _ := downloadTokenSecret(app)
+	other, _ := security.NewJWT(jwt.MapClaims{"type": "auth", "job_id": "job123"}, secret, time.Minute)
+	if _, err := ParseJobDownloadToken(app, other); err == nil {
+		t.Error("expected a token of another type to be rejected")
+	}
+
+	t.Setenv("JOB_DOWNLOAD_TOKEN_SECRET", "rotated")
+	if _, err := ParseJobDownloadToken(app, token); err == nil {
+		t.Error("expected a token signed with another secret to be rejected")
+	}
+
+	if url := JobDownloadURL(app, token); !strings.HasSuffix(url, "/api/v1/jobs/download?token="+token) {
+		t.Errorf("unexpected download URL %s", url)
+	}
+}
+
+func TestGetDownloadTokenTTL(t *testing.T) {
+	t.Setenv("JOB_DOWNLOAD_TOKEN_TTL_SECONDS", "60")
+	if ttl := GetDownloadTokenTTL(); ttl != time.Minute {
+		t.Errorf("expected 1m, got %v", ttl)
+	}
+
+	t.Setenv("JOB_DOWNLOAD_TOKEN_TTL_SECONDS", "0")
+	if ttl := GetDownloadTokenTTL(); ttl != DefaultDownloadTokenTTL {
+		t.Errorf("expected the default TTL, got %v", ttl)
+	}
+}
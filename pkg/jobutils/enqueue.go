@@ -0,0 +1,154 @@
+package jobutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// EnqueueOptions configures how a job is added to the queue
+type EnqueueOptions struct {
+	Name        string    `json:"name"`                  // Job name (required)
+	Description string    `json:"description,omitempty"` // Job description
+	Queue       string    `json:"queue,omitempty"`       // Named queue, empty means the default queue
+	Priority    int       `json:"priority,omitempty"`    // Job priority (higher runs first)
+	AvailableAt time.Time `json:"available_at"`          // When the job becomes eligible for processing, zero means immediately
+	UserID      string    `json:"user_id,omitempty"`     // User that created the job and may view its status and files
+
+	// UniqueKey deduplicates jobs: while a job with the same key is queued or processing,
+	// enqueueing returns that job instead of creating a new one
+	UniqueKey string `json:"unique_key,omitempty"`
+	// UniqueFor limits deduplication to jobs created within this window, zero means as long as the job is in the queue
+	UniqueFor time.Duration `json:"unique_for,omitempty"`
+
+	// Chain lists jobs to enqueue one after another once this job completes (see EnqueueChain)
+	Chain []JobSpec `json:"chain,omitempty"`
+
+	batchID        string         // Batch the job is a member of, set by EnqueueBatch and chain continuations
+	payloadOptions map[string]any // Options merged into the payload, e.g. PreviousJobIDOption
+}
+
+// Enqueue validates a job payload (a typed payload struct or a map with a "type" field) and adds it to the queue.
+// When opts.UniqueKey matches a job that is still queued or processing, that job is returned with created
+// set to false and nothing is inserted.
+func Enqueue(app core.App, payload any, opts EnqueueOptions) (record *core.Record, created bool, err error) {
+	if opts.Name == "" {
+		return nil, false, fmt.Errorf("job name is required")
+	}
+
+	payloadJSON, err := marshalJobPayload(payload, opts.payloadOptions)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Lookup and insert share a transaction so concurrent enqueues with the same key cannot both insert
+	err = runJobTransaction(app, func(txApp core.App) error {
+		record, created = nil, false
+
+		if opts.UniqueKey != "" {
+			existing, err := findUniqueJob(txApp, opts.UniqueKey, opts.UniqueFor)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				record = existing
+				return nil
+			}
+		}
+
+		collection, err := txApp.FindCollectionByNameOrId(QueuesCollection)
+		if err != nil {
+			return fmt.Errorf("failed to find %s collection: %w", QueuesCollection, err)
+		}
+
+		job := core.NewRecord(collection)
+		job.Set("name", opts.Name)
+		job.Set("description", opts.Description)
+		job.Set("payload", string(payloadJSON))
+		job.Set("attempts", 0)
+		job.Set("queue", opts.Queue)
+		job.Set("priority", opts.Priority)
+		job.Set("unique_key", opts.UniqueKey)
+		job.Set("batch_id", opts.batchID)
+		job.Set("user_id", opts.UserID)
+		if len(opts.Chain) > 0 {
+			job.Set("chain", opts.Chain)
+		}
+		if !opts.AvailableAt.IsZero() {
+			job.Set("available_at", opts.AvailableAt.UTC())
+		}
+
+		if err := txApp.Save(job); err != nil {
+			return fmt.Errorf("failed to queue job %s: %w", opts.Name, err)
+		}
+
+		record, created = job, true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !created {
+		log.Debug("Duplicate job enqueue skipped", "job_id", record.Id, "unique_key", opts.UniqueKey)
+	}
+
+	return record, created, nil
+}
+
+// marshalJobPayload encodes and validates a job payload, merging extra values into its options
+func marshalJobPayload(payload any, options map[string]any) ([]byte, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	var payloadMap map[string]any
+	if err := json.Unmarshal(payloadJSON, &payloadMap); err != nil {
+		return nil, fmt.Errorf("job payload must be a JSON object: %w", err)
+	}
+	if err := ValidateJobPayload(payloadMap); err != nil {
+		return nil, err
+	}
+
+	if len(options) == 0 {
+		return payloadJSON, nil
+	}
+
+	payloadOptions, _ := payloadMap["options"].(map[string]any)
+	if payloadOptions == nil {
+		payloadOptions = map[string]any{}
+	}
+	for key, value := range options {
+		payloadOptions[key] = value
+	}
+	payloadMap["options"] = payloadOptions
+
+	return json.Marshal(payloadMap)
+}
+
+// findUniqueJob returns the newest queued or processing job with the given unique key, or nil if there is none
+func findUniqueJob(app core.App, uniqueKey string, uniqueFor time.Duration) (*core.Record, error) {
+	filter := "unique_key = {:unique_key}"
+	params := dbx.Params{"unique_key": uniqueKey}
+	if uniqueFor > 0 {
+		filter += " && created >= {:since}"
+		params["since"] = time.Now().UTC().Add(-uniqueFor).Format(types.DefaultDateLayout)
+	}
+
+	records, err := app.FindRecordsByFilter(QueuesCollection, filter, "-created", 1, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up job with unique key %s: %w", uniqueKey, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records[0], nil
+}
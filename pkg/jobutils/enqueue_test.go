@@ -0,0 +1,150 @@
+package jobutils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestEnqueue(t *testing.T) {
+	app := newTestApp(t)
+
+	payload := EmailJobPayload{
+		Type: JobTypeEmail,
+		Data: EmailJobData{To: "user@example.com", Subject: "Hello", Template: "welcome"},
+	}
+	availableAt := time.Now().Add(time.Hour)
+
+	job, created, err := Enqueue(app, payload, EnqueueOptions{
+		Name:        "Welcome email",
+		Queue:       QueueEmails,
+		Priority:    JobPriorityHigh,
+		AvailableAt: availableAt,
+	})
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if !created {
+		t.Error("expected a new job to be created")
+	}
+
+	jobData, err := ParseJobDataFromRecord(job)
+	if err != nil {
+		t.Fatalf("failed to parse enqueued job: %v", err)
+	}
+	if jobData.Type != JobTypeEmail || jobData.Queue != QueueEmails || jobData.Priority != JobPriorityHigh {
+		t.Errorf("unexpected job data: type=%s queue=%s priority=%d", jobData.Type, jobData.Queue, jobData.Priority)
+	}
+	if jobData.AvailableAt == nil || jobData.AvailableAt.Unix() != availableAt.Unix() {
+		t.Errorf("expected available_at %v, got %v", availableAt, jobData.AvailableAt)
+	}
+}
+
+func TestEnqueue_InvalidPayload(t *testing.T) {
+	app := newTestApp(t)
+
+	if _, _, err := Enqueue(app, map[string]any{"data": map[string]any{}}, EnqueueOptions{Name: "untyped"}); err == nil {
+		t.Error("expected a payload without type to be rejected")
+	}
+	if _, _, err := Enqueue(app, map[string]any{"type": "test_job"}, EnqueueOptions{}); err == nil {
+		t.Error("expected a job without name to be rejected")
+	}
+}
+
+func TestEnqueue_UniqueKey(t *testing.T) {
+	app := newTestApp(t)
+	payload := map[string]any{"type": "test_job"}
+	opts := EnqueueOptions{Name: "export", UniqueKey: "user_export:abc"}
+
+	first, created, err := Enqueue(app, payload, opts)
+	if err != nil || !created {
+		t.Fatalf("expected first enqueue to create a job, created=%v err=%v", created, err)
+	}
+
+	second, created, err := Enqueue(app, payload, opts)
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if created || second.Id != first.Id {
+		t.Errorf("expected duplicate enqueue to return job %s, got %s (created=%v)", first.Id, second.Id, created)
+	}
+
+	// A different key is not deduplicated
+	if _, created, _ := Enqueue(app, payload, EnqueueOptions{Name: "export", UniqueKey: "user_export:def"}); !created {
+		t.Error("expected a job with another unique key to be created")
+	}
+
+	// Once the job has left the queue the key can be used again
+	if err := app.Delete(first); err != nil {
+		t.Fatalf("failed to delete job: %v", err)
+	}
+	if _, created, _ := Enqueue(app, payload, opts); !created {
+		t.Error("expected a new job once the previous one left the queue")
+	}
+}
+
+func TestEnqueue_UniqueForWindow(t *testing.T) {
+	app := newTestApp(t)
+	payload := map[string]any{"type": "test_job"}
+	opts := EnqueueOptions{Name: "report", UniqueKey: "daily_report", UniqueFor: time.Hour}
+
+	first, _, err := Enqueue(app, payload, opts)
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	// Age the job beyond the uniqueness window
+	if _, err := app.DB().NewQuery("UPDATE queues SET created = {:created} WHERE id = {:id}").Bind(map[string]any{
+		"created": time.Now().UTC().Add(-2 * time.Hour).Format(types.DefaultDateLayout),
+		"id":      first.Id,
+	}).Execute(); err != nil {
+		t.Fatalf("failed to age job: %v", err)
+	}
+
+	second, created, err := Enqueue(app, payload, opts)
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if !created || second.Id == first.Id {
+		t.Error("expected a new job once the uniqueness window passed")
+	}
+}
+
+func TestEnqueue_ConcurrentDuplicates(t *testing.T) {
+	app := newTestApp(t)
+	payload := map[string]any{"type": "test_job"}
+	opts := EnqueueOptions{Name: "clicked", UniqueKey: "double_click"}
+
+	const callers = 10
+	ids := make([]string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job, _, err := Enqueue(app, payload, opts)
+			if err != nil {
+				t.Errorf("Enqueue returned error: %v", err)
+				return
+			}
+			ids[i] = job.Id
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Fatalf("expected all callers to get the same job, got %v", ids)
+		}
+	}
+
+	total, err := app.CountRecords(QueuesCollection)
+	if err != nil {
+		t.Fatalf("failed to count jobs: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("expected exactly one queued job, got %d", total)
+	}
+}
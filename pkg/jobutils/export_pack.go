@@ -0,0 +1,320 @@
+package jobutils
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/filecrypt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// MinPassphraseLength is the minimum length of export file passphrases
+const MinPassphraseLength = 8
+
+// ErrExportChecksumMismatch is returned for export files whose content does not match their stored checksum
+var ErrExportChecksumMismatch = errors.New("export file checksum mismatch")
+
+// SavedExportFile describes an export file saved to the export_files collection
+type SavedExportFile struct {
+	Record      *core.Record
+	Name        string
+	Size        int64
+	Checksum    string
+	Compression string
+	Encryption  string
+}
+
+// ExportResult returns the result of the job that saved the file. contentType is the type of the file as
+// written, compressed and encrypted files are archives and binary data.
+func (f *SavedExportFile) ExportResult(message string, recordCount int, contentType string) *FileExportResult {
+	switch {
+	case f.Encryption != "":
+		contentType = "application/octet-stream"
+	case f.Compression == ExportCompressionGzip:
+		contentType = "application/gzip"
+	case f.Compression == ExportCompressionZip:
+		contentType = "application/zip"
+	}
+
+	return &FileExportResult{
+		BaseJobResultData: BaseJobResultData{
+			Message:   message,
+			Timestamp: time.Now(),
+		},
+		ExportRecordId: f.Record.Id,
+		FileName:       f.Name,
+		FileSize:       f.Size,
+		RecordCount:    recordCount,
+		ContentType:    contentType,
+		Checksum:       f.Checksum,
+		Compression:    f.Compression,
+		Encryption:     f.Encryption,
+	}
+}
+
+// ValidateExportFileOptions checks the compression and encryption of an export file
+func ValidateExportFileOptions(opts ExportFileOptions) error {
+	switch opts.Compression {
+	case "", ExportCompressionGzip, ExportCompressionZip:
+	default:
+		return fmt.Errorf("unsupported compression %q, expected %s or %s", opts.Compression, ExportCompressionGzip, ExportCompressionZip)
+	}
+
+	switch opts.Encryption {
+	case "":
+		if opts.Passphrase != "" || opts.Key != "" {
+			return fmt.Errorf("a passphrase or key requires %s encryption", ExportEncryptionAESGCM)
+		}
+	case ExportEncryptionAESGCM:
+		switch {
+		case opts.Passphrase != "" && opts.Key != "":
+			return fmt.Errorf("%s encryption takes a passphrase or a key, not both", ExportEncryptionAESGCM)
+		case opts.Passphrase == "" && opts.Key == "":
+			return fmt.Errorf("%s encryption requires a passphrase or a key", ExportEncryptionAESGCM)
+		case opts.Passphrase != "" && len(opts.Passphrase) < MinPassphraseLength:
+			return fmt.Errorf("the passphrase must be at least %d characters", MinPassphraseLength)
+		}
+	default:
+		return fmt.Errorf("unsupported encryption %q, expected %s", opts.Encryption, ExportEncryptionAESGCM)
+	}
+
+	return nil
+}
+
+// SealExportFileOptions seals the passphrase or key of opts, so they are stored encrypted in the job payload.
+// Encryption without a passphrase gets a new key, which the caller returns to the requester: it is not
+// stored in clear anywhere.
+func SealExportFileOptions(app core.App, opts ExportFileOptions) (ExportFileOptions, error) {
+	if opts.Encryption != "" && opts.Passphrase == "" && opts.Key == "" {
+		key, err := filecrypt.GenerateKey()
+		if err != nil {
+			return opts, err
+		}
+		opts.Key = key
+	}
+
+	if err := ValidateExportFileOptions(opts); err != nil {
+		return opts, err
+	}
+
+	var err error
+	if opts.Passphrase != "" {
+		if opts.SealedPassphrase, err = SealPayloadSecret(app, opts.Passphrase); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Key != "" {
+		if opts.SealedKey, err = SealPayloadSecret(app, opts.Key); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// OpenExportFileOptions opens the sealed passphrase or key of options read from a job payload and validates
+// them. Jobs whose secret was redacted, e.g. retried from failed_jobs, return ErrPayloadSecretUnavailable.
+func OpenExportFileOptions(app core.App, opts ExportFileOptions) (ExportFileOptions, error) {
+	var err error
+	if opts.SealedPassphrase != "" {
+		if opts.Passphrase, err = OpenPayloadSecret(app, opts.SealedPassphrase); err != nil {
+			return opts, err
+		}
+	}
+	if opts.SealedKey != "" {
+		if opts.Key, err = OpenPayloadSecret(app, opts.SealedKey); err != nil {
+			return opts, err
+		}
+	}
+
+	if opts.Encryption != "" && opts.Passphrase == "" && opts.Key == "" {
+		return opts, ErrPayloadSecretUnavailable
+	}
+	return opts, ValidateExportFileOptions(opts)
+}
+
+// VerifyExportFile checks the file of an export_files record against its stored checksum. Files saved
+// before checksums were stored are not checked.
+func VerifyExportFile(app core.App, record *core.Record) error {
+	expected := record.GetString("checksum")
+	if expected == "" {
+		return nil
+	}
+
+	reader, err := OpenExportFile(app, record)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return fmt.Errorf("failed to read export file %s: %w", record.Id, err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != expected {
+		return fmt.Errorf("%w: %s", ErrExportChecksumMismatch, record.Id)
+	}
+	return nil
+}
+
+// packedExportFile is an export file ready to be stored, cleanup removes its temporary files
+type packedExportFile struct {
+	file     *filesystem.File
+	size     int64
+	checksum string
+	cleanup  func()
+}
+
+// packExportFile compresses then encrypts a file as set by opts, into a temporary file, and computes the
+// checksum of the result
+func packExportFile(file *filesystem.File, opts ExportFileOptions) (*packedExportFile, error) {
+	if err := ValidateExportFileOptions(opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Compression == "" && opts.Encryption == "" {
+		size, checksum, err := checksumFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return &packedExportFile{file: file, size: size, checksum: checksum, cleanup: func() {}}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "export-pack-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	packed := &packedExportFile{cleanup: func() { _ = os.RemoveAll(dir) }}
+
+	name, err := packed.write(file, filepath.Join(dir, "packed"), opts)
+	if err != nil {
+		packed.cleanup()
+		return nil, err
+	}
+
+	packed.file, err = filesystem.NewFileFromPath(filepath.Join(dir, "packed"))
+	if err != nil {
+		packed.cleanup()
+		return nil, err
+	}
+	packed.file.Name = name
+	packed.file.OriginalName = name
+
+	return packed, nil
+}
+
+// write writes the packed content of file to path and returns the name of the packed file
+func (p *packedExportFile) write(file *filesystem.File, path string, opts ExportFileOptions) (string, error) {
+	src, err := file.Reader.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create packed file: %w", err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(out, hash)}
+
+	// Writers are stacked so data is compressed, then encrypted, then hashed as stored
+	var dst io.Writer = counter
+	var closers []io.Closer
+	name := file.Name
+
+	if opts.Encryption != "" {
+		var encrypter io.WriteCloser
+		if opts.Passphrase != "" {
+			encrypter, err = filecrypt.NewPassphraseWriter(dst, opts.Passphrase)
+		} else {
+			encrypter, err = filecrypt.NewWriter(dst, opts.Key)
+		}
+		if err != nil {
+			return "", err
+		}
+		dst = encrypter
+		closers = append(closers, encrypter)
+	}
+
+	switch opts.Compression {
+	case ExportCompressionGzip:
+		gz := gzip.NewWriter(dst)
+		gz.Name = file.OriginalName
+		dst = gz
+		closers = append(closers, gz)
+		name += ".gz"
+	case ExportCompressionZip:
+		archive := zip.NewWriter(dst)
+		entry, err := archive.Create(file.OriginalName)
+		if err != nil {
+			return "", fmt.Errorf("failed to create zip entry: %w", err)
+		}
+		dst = entry
+		closers = append(closers, archive)
+		name += ".zip"
+	}
+
+	if opts.Encryption != "" {
+		name += filecrypt.Extension
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", fmt.Errorf("failed to pack %s: %w", file.Name, err)
+	}
+
+	// Outer writers first, they flush into the inner ones
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return "", fmt.Errorf("failed to pack %s: %w", file.Name, err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("failed to write packed file: %w", err)
+	}
+
+	p.size = counter.n
+	p.checksum = hex.EncodeToString(hash.Sum(nil))
+	return name, nil
+}
+
+// checksumFile returns the size and hex SHA-256 of a file
+func checksumFile(file *filesystem.File) (int64, string, error) {
+	src, err := file.Reader.Open()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,177 @@
+package jobutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ims-pocketbase-baas-starter/pkg/filecrypt"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const packTestContent = "id,email\n1,ada@example.com\n2,alan@example.com\n"
+
+// saveLocalExport saves the test content with opts to a local export storage and returns the stored bytes
+func saveLocalExport(t *testing.T, opts ExportFileOptions) (*SavedExportFile, []byte) {
+	t.Helper()
+
+	app := newTestApp(t)
+	createExportFilesCollection(t, app)
+
+	dir := t.TempDir()
+	t.Setenv("EXPORT_STORAGE", ExportStorageLocal)
+	t.Setenv("EXPORT_STORAGE_DIR", dir)
+
+	file, err := filesystem.NewFileFromBytes([]byte(packTestContent), "users.csv")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	saved, err := SaveExportFileWithOptions(app, "job1", "user1", file, 2, opts)
+	if err != nil {
+		t.Fatalf("SaveExportFileWithOptions returned error: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(saved.Record.GetString("storage_key"))))
+	if err != nil {
+		t.Fatalf("failed to read stored file: %v", err)
+	}
+
+	sum := sha256.Sum256(stored)
+	if saved.Checksum != hex.EncodeToString(sum[:]) || saved.Record.GetString("checksum") != saved.Checksum {
+		t.Errorf("expected the checksum of the stored file, got %s", saved.Checksum)
+	}
+	if saved.Size != int64(len(stored)) {
+		t.Errorf("expected size %d, got %d", len(stored), saved.Size)
+	}
+
+	if err := VerifyExportFile(app, saved.Record); err != nil {
+		t.Errorf("VerifyExportFile returned error: %v", err)
+	}
+
+	return saved, stored
+}
+
+func TestSaveExportFileWithOptions_Plain(t *testing.T) {
+	saved, stored := saveLocalExport(t, ExportFileOptions{})
+
+	if string(stored) != packTestContent {
+		t.Errorf("expected the file stored as written, got %q", stored)
+	}
+
+	result := saved.ExportResult("Exported", 2, "text/csv")
+	if result.ContentType != "text/csv" || result.Checksum != saved.Checksum || result.FileName != saved.Name {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSaveExportFileWithOptions_GzipWithKey(t *testing.T) {
+	key, err := filecrypt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	saved, stored := saveLocalExport(t, ExportFileOptions{Compression: ExportCompressionGzip, Encryption: ExportEncryptionAESGCM, Key: key})
+
+	if !strings.HasSuffix(saved.Name, ".csv.gz.enc") || saved.Record.GetString("encryption") != ExportEncryptionAESGCM {
+		t.Errorf("unexpected file %s", saved.Name)
+	}
+	if bytes.Contains(stored, []byte("ada@example.com")) {
+		t.Fatal("expected the file to be encrypted")
+	}
+
+	decrypted, err := filecrypt.NewReader(bytes.NewReader(stored), key)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	gz, err := gzip.NewReader(decrypted)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	content, _ := io.ReadAll(gz)
+	if string(content) != packTestContent || gz.Name != "users.csv" {
+		t.Errorf("unexpected content %q of %s", content, gz.Name)
+	}
+
+	if result := saved.ExportResult("Exported", 2, "text/csv"); result.ContentType != "application/octet-stream" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSaveExportFileWithOptions_ZipWithPassphrase(t *testing.T) {
+	_, stored := saveLocalExport(t, ExportFileOptions{Compression: ExportCompressionZip, Encryption: ExportEncryptionAESGCM, Passphrase: "correct horse"})
+
+	decrypted, err := filecrypt.NewReader(bytes.NewReader(stored), "correct horse")
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	archive, _ := io.ReadAll(decrypted)
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil || len(zr.File) != 1 || zr.File[0].Name != "users.csv" {
+		t.Fatalf("expected a zip with users.csv, got %v (%v)", zr, err)
+	}
+	entry, _ := zr.File[0].Open()
+	content, _ := io.ReadAll(entry)
+	if string(content) != packTestContent {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestVerifyExportFile_Corrupted(t *testing.T) {
+	app := newTestApp(t)
+	createExportFilesCollection(t, app)
+
+	dir := t.TempDir()
+	t.Setenv("EXPORT_STORAGE", ExportStorageLocal)
+	t.Setenv("EXPORT_STORAGE_DIR", dir)
+
+	record, err := SaveExportFile(app, "job1", "users.csv", []byte(packTestContent), 2)
+	if err != nil {
+		t.Fatalf("SaveExportFile returned error: %v", err)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(record.GetString("storage_key")))
+	if err := os.WriteFile(path, []byte("id,email\n"), 0o644); err != nil {
+		t.Fatalf("failed to modify stored file: %v", err)
+	}
+
+	if err := VerifyExportFile(app, record); !errors.Is(err, ErrExportChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestValidateExportFileOptions(t *testing.T) {
+	tests := []struct {
+		opts    ExportFileOptions
+		errText string
+	}{
+		{opts: ExportFileOptions{}},
+		{opts: ExportFileOptions{Compression: "gzip", Encryption: "aes-gcm", Passphrase: "long enough"}},
+		{opts: ExportFileOptions{Compression: "bzip2"}, errText: `unsupported compression "bzip2"`},
+		{opts: ExportFileOptions{Encryption: "des"}, errText: `unsupported encryption "des"`},
+		{opts: ExportFileOptions{Encryption: "aes-gcm", Key: "a2V5"}},
+		{opts: ExportFileOptions{Passphrase: "long enough"}, errText: "requires aes-gcm encryption"},
+		{opts: ExportFileOptions{Encryption: "aes-gcm"}, errText: "requires a passphrase or a key"},
+		{opts: ExportFileOptions{Encryption: "aes-gcm", Passphrase: "long enough", Key: "a2V5"}, errText: "not both"},
+		{opts: ExportFileOptions{Encryption: "aes-gcm", Passphrase: "short"}, errText: "at least 8 characters"},
+	}
+
+	for _, tt := range tests {
+		err := ValidateExportFileOptions(tt.opts)
+		if tt.errText == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.opts, err)
+		}
+		if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.opts, tt.errText, err)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package jobutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// Export storage backends, the value of EXPORT_STORAGE and of the storage field of export_files records
+const (
+	// ExportStoragePocketBase keeps export files in the PocketBase file storage: the S3 bucket configured in
+	// the PocketBase settings, or pb_data/storage when S3 is disabled
+	ExportStoragePocketBase = "pocketbase"
+	// ExportStorageLocal keeps export files in a local directory (EXPORT_STORAGE_DIR)
+	ExportStorageLocal = "local"
+)
+
+// DefaultExportStorageDir is the directory of the local export storage, relative to the data dir
+const DefaultExportStorageDir = "exports"
+
+// ExportStorage stores the files of export_files records under keys
+type ExportStorage interface {
+	// Name is the storage backend, stored in the storage field of export_files records
+	Name() string
+	// Upload stores a file under key
+	Upload(file *filesystem.File, key string) error
+	// Open returns a reader of the file stored under key
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key, files that do not exist are not an error
+	Delete(key string) error
+	// SignedURL returns a URL downloading the file stored under key as fileName until ttl elapses, or an
+	// empty string when the storage cannot sign URLs and the file has to be served by the app
+	SignedURL(key, fileName string, ttl time.Duration) (string, error)
+}
+
+// GetExportStorage returns the storage new export files are saved to, configured via EXPORT_STORAGE
+func GetExportStorage(app core.App) (ExportStorage, error) {
+	return NewExportStorage(app, common.GetEnv("EXPORT_STORAGE", ExportStoragePocketBase))
+}
+
+// NewExportStorage returns the export storage backend of the given name. Records saved before storages
+// were configurable have no storage and are kept in the PocketBase file storage.
+func NewExportStorage(app core.App, name string) (ExportStorage, error) {
+	switch name {
+	case ExportStoragePocketBase, "":
+		return &pocketBaseExportStorage{app: app}, nil
+	case ExportStorageLocal:
+		dir := common.GetEnv("EXPORT_STORAGE_DIR", "")
+		if dir == "" {
+			dir = filepath.Join(app.DataDir(), DefaultExportStorageDir)
+		}
+		return &localExportStorage{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export storage %q, expected %s or %s", name, ExportStoragePocketBase, ExportStorageLocal)
+	}
+}
+
+// ExportFileStorage returns the storage holding the file of an export_files record and the key of the file
+func ExportFileStorage(app core.App, record *core.Record) (ExportStorage, string, error) {
+	storage, err := NewExportStorage(app, record.GetString("storage"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := record.GetString("storage_key")
+	if key == "" {
+		// Files saved before storages were configurable are files of the record
+		key = record.BaseFilesPath() + "/" + record.GetString("file")
+	}
+
+	return storage, key, nil
+}
+
+// ExportFileName returns the name of the file of an export_files record
+func ExportFileName(record *core.Record) string {
+	if key := record.GetString("storage_key"); key != "" {
+		return path.Base(key)
+	}
+	return record.GetString("file")
+}
+
+// OpenExportFile returns a reader of the file of an export_files record
+func OpenExportFile(app core.App, record *core.Record) (io.ReadCloser, error) {
+	storage, key, err := ExportFileStorage(app, record)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := storage.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file %s: %w", record.Id, err)
+	}
+	return reader, nil
+}
+
+// DeleteExportFile deletes an export_files record and its file from the storage holding it
+func DeleteExportFile(app core.App, record *core.Record) error {
+	storage, key, err := ExportFileStorage(app, record)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Delete(key); err != nil {
+		return fmt.Errorf("failed to delete export file %s from %s storage: %w", record.Id, storage.Name(), err)
+	}
+
+	if err := app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete export file record %s: %w", record.Id, err)
+	}
+
+	return nil
+}
+
+// ExportFileDownloadURL returns a URL downloading the file of an export_files record until ttl elapses.
+// Storages that sign URLs are downloaded from directly, the other files through the app with a signed
+// download token of the job.
+func ExportFileDownloadURL(app core.App, record *core.Record, ttl time.Duration) (string, time.Time, error) {
+	storage, key, err := ExportFileStorage(app, record)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	signedURL, err := storage.SignedURL(key, ExportFileName(record), ttl)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign download URL of export file %s: %w", record.Id, err)
+	}
+	if signedURL != "" {
+		return signedURL, expiresAt, nil
+	}
+
+	token, expiresAt, err := NewJobDownloadToken(app, record.GetString("job_id"), ttl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return JobDownloadURL(app, token), expiresAt, nil
+}
+
+// pocketBaseExportStorage keeps export files in the PocketBase file storage
+type pocketBaseExportStorage struct {
+	app core.App
+}
+
+func (s *pocketBaseExportStorage) Name() string {
+	return ExportStoragePocketBase
+}
+
+func (s *pocketBaseExportStorage) Upload(file *filesystem.File, key string) error {
+	fsys, err := s.app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("failed to open filesystem: %w", err)
+	}
+	defer fsys.Close()
+
+	return fsys.UploadFile(file, key)
+}
+
+func (s *pocketBaseExportStorage) Open(key string) (io.ReadCloser, error) {
+	fsys, err := s.app.NewFilesystem()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open filesystem: %w", err)
+	}
+
+	reader, err := fsys.GetReader(key)
+	if err != nil {
+		fsys.Close()
+		return nil, err
+	}
+
+	return &filesystemReader{ReadCloser: reader, fsys: fsys}, nil
+}
+
+func (s *pocketBaseExportStorage) Delete(key string) error {
+	fsys, err := s.app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("failed to open filesystem: %w", err)
+	}
+	defer fsys.Close()
+
+	if err := fsys.Delete(key); err != nil && !errors.Is(err, filesystem.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL presigns an S3 URL when the PocketBase file storage is S3, local files are served by the app
+func (s *pocketBaseExportStorage) SignedURL(key, fileName string, ttl time.Duration) (string, error) {
+	s3 := s.app.Settings().S3
+	if !s3.Enabled {
+		return "", nil
+	}
+
+	return PresignS3GetURL(s3, key, fileName, ttl, time.Now())
+}
+
+// filesystemReader closes the filesystem a file was opened from along with the file
+type filesystemReader struct {
+	io.ReadCloser
+	fsys *filesystem.System
+}
+
+func (r *filesystemReader) Close() error {
+	err := r.ReadCloser.Close()
+	return errors.Join(err, r.fsys.Close())
+}
+
+// localExportStorage keeps export files in a local directory
+type localExportStorage struct {
+	dir string
+}
+
+func (s *localExportStorage) Name() string {
+	return ExportStorageLocal
+}
+
+func (s *localExportStorage) Upload(file *filesystem.File, key string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	src, err := file.Reader.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return out.Close()
+}
+
+func (s *localExportStorage) Open(key string) (io.ReadCloser, error) {
+	src, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(src)
+}
+
+// Delete removes a file and the directories of its key left empty
+func (s *localExportStorage) Delete(key string) error {
+	file, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for dir := filepath.Dir(file); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// SignedURL returns no URL, local files are served by the app
+func (s *localExportStorage) SignedURL(key, fileName string, ttl time.Duration) (string, error) {
+	return "", nil
+}
+
+// path returns the path of the file stored under key, keys cannot leave the storage directory
+func (s *localExportStorage) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid export file key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
@@ -1,7 +1,9 @@
 package jobutils
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"ims-pocketbase-baas-starter/pkg/common"
@@ -17,6 +19,12 @@ const (
 	DefaultFileExpirationDays = 30
 )
 
+// Constants for uploaded import files
+const (
+	ImportFilesCollectionName       = "import_files"
+	DefaultImportFileExpirationDays = 7
+)
+
 // SaveExportFile saves file data to the export_files collection
 func SaveExportFile(app *pocketbase.PocketBase, jobId, filename string, fileData []byte, recordCount int) (*core.Record, error) {
 	return saveExportFile(app, jobId, "", filename, fileData, recordCount)
@@ -27,14 +35,67 @@ func SaveExportFileWithUser(app *pocketbase.PocketBase, jobId, userId, filename
 	return saveExportFile(app, jobId, userId, filename, fileData, recordCount)
 }
 
+// SaveExportFileFromPath saves a file written to disk to the export_files collection with a specific user ID.
+// The file is streamed to the storage instead of being loaded into memory and is named after the path.
+func SaveExportFileFromPath(app *pocketbase.PocketBase, jobId, userId, path string, recordCount int) (*core.Record, error) {
+	file, err := filesystem.NewFileFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file for job %s: %w", jobId, err)
+	}
+
+	saved, err := saveExportRecord(app, jobId, userId, file, recordCount, ExportFileOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return saved.Record, nil
+}
+
+// SaveExportFileWithOptions compresses and encrypts a file as set by opts and saves it to the export_files
+// collection with a specific user ID. opts holds the passphrase or key in clear, see OpenExportFileOptions.
+func SaveExportFileWithOptions(app *pocketbase.PocketBase, jobId, userId string, file *filesystem.File, recordCount int, opts ExportFileOptions) (*SavedExportFile, error) {
+	return saveExportRecord(app, jobId, userId, file, recordCount, opts)
+}
+
 // saveExportFile is the internal implementation for saving export files
 func saveExportFile(app *pocketbase.PocketBase, jobId, userId, filename string, fileData []byte, recordCount int) (*core.Record, error) {
+	file, err := filesystem.NewFileFromBytes(fileData, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file from data for job %s: %w", jobId, err)
+	}
+
+	saved, err := saveExportRecord(app, jobId, userId, file, recordCount, ExportFileOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return saved.Record, nil
+}
+
+// saveExportRecord packs a file, uploads it to the export storage and creates its export_files record
+func saveExportRecord(app *pocketbase.PocketBase, jobId, userId string, file *filesystem.File, recordCount int, opts ExportFileOptions) (*SavedExportFile, error) {
 	collection, err := app.FindCollectionByNameOrId(ExportFilesCollectionName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find export_files collection for job %s: %w", jobId, err)
 	}
 
+	storage, err := GetExportStorage(app)
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := packExportFile(file, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack export file for job %s: %w", jobId, err)
+	}
+	defer packed.cleanup()
+
 	record := core.NewRecord(collection)
+	record.Id = core.GenerateDefaultRandomId()
+
+	// Files are stored under the path of the record, as record files of PocketBase
+	key := record.BaseFilesPath() + "/" + packed.file.Name
+	if err := storage.Upload(packed.file, key); err != nil {
+		return nil, fmt.Errorf("failed to upload export file for job %s to %s storage: %w", jobId, storage.Name(), err)
+	}
 
 	expirationDays := common.GetEnvInt("EXPORT_FILE_EXPIRATION_DAYS", DefaultFileExpirationDays)
 	expirationDate := time.Now().AddDate(0, 0, expirationDays)
@@ -43,17 +104,73 @@ func saveExportFile(app *pocketbase.PocketBase, jobId, userId, filename string,
 	record.Set("user_id", userId)
 	record.Set("record_count", recordCount)
 	record.Set("expires_at", expirationDate)
+	record.Set("storage", storage.Name())
+	record.Set("storage_key", key)
+	record.Set("checksum", packed.checksum)
+	record.Set("compression", opts.Compression)
+	record.Set("encryption", opts.Encryption)
 
-	file, err := filesystem.NewFileFromBytes(fileData, filename)
+	if err := app.Save(record); err != nil {
+		if deleteErr := storage.Delete(key); deleteErr != nil {
+			err = errors.Join(err, deleteErr)
+		}
+		return nil, fmt.Errorf("failed to save export_files record for job %s: %w", jobId, err)
+	}
+
+	return &SavedExportFile{
+		Record:      record,
+		Name:        packed.file.Name,
+		Size:        packed.size,
+		Checksum:    packed.checksum,
+		Compression: opts.Compression,
+		Encryption:  opts.Encryption,
+	}, nil
+}
+
+// SaveImportFile stores an uploaded file in the import_files collection until it expires
+func SaveImportFile(app core.App, userId string, file *filesystem.File) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(ImportFilesCollectionName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file from data for job %s: %w", jobId, err)
+		return nil, fmt.Errorf("failed to find import_files collection: %w", err)
 	}
 
+	expirationDays := common.GetEnvInt("IMPORT_FILE_EXPIRATION_DAYS", DefaultImportFileExpirationDays)
+
+	record := core.NewRecord(collection)
+	record.Set("user_id", userId)
 	record.Set("file", file)
+	record.Set("expires_at", time.Now().AddDate(0, 0, expirationDays))
 
 	if err := app.Save(record); err != nil {
-		return nil, fmt.Errorf("failed to save export_files record for job %s: %w", jobId, err)
+		return nil, fmt.Errorf("failed to save import_files record: %w", err)
 	}
 
 	return record, nil
 }
+
+// ReadImportFile returns the record and content of an uploaded import file
+func ReadImportFile(app core.App, importFileId string) (*core.Record, []byte, error) {
+	record, err := app.FindRecordById(ImportFilesCollectionName, importFileId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("import file %s not found: %w", importFileId, err)
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open filesystem: %w", err)
+	}
+	defer fsys.Close()
+
+	reader, err := fsys.GetReader(record.BaseFilesPath() + "/" + record.GetString("file"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open import file %s: %w", importFileId, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read import file %s: %w", importFileId, err)
+	}
+
+	return record, data, nil
+}
@@ -0,0 +1,29 @@
+package jobutils
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+// RecordFilterExpression returns a condition selecting the records of a collection that match a PocketBase
+// filter, with superuser access to every field. Filters on relations join related records, so the records
+// are selected by id and each of them matches once.
+func RecordFilterExpression(app core.App, collection *core.Collection, filter string) (dbx.Expression, error) {
+	resolver := core.NewRecordFieldResolver(app, collection, nil, true)
+
+	expr, err := search.FilterData(filter).BuildExpr(resolver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	ids := app.DB().Select(collection.Name + ".id").From(collection.Name).AndWhere(expr)
+	if err := resolver.UpdateQuery(ids); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	subquery := ids.Build()
+	return dbx.NewExp("[["+collection.Name+".id]] IN ("+subquery.SQL()+")", subquery.Params()), nil
+}
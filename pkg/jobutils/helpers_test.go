@@ -0,0 +1,162 @@
+package jobutils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp bootstraps a PocketBase app in a temp data dir with the job collections created
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap test app: %v", err)
+	}
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("failed to run system migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = app.ResetBootstrapState()
+	})
+
+	queues := core.NewBaseCollection(QueuesCollection)
+	queues.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.TextField{Name: "description"},
+		&core.JSONField{Name: "payload"},
+		&core.NumberField{Name: "attempts"},
+		&core.DateField{Name: "reserved_at"},
+		&core.TextField{Name: "reserved_by"},
+		&core.TextField{Name: "last_error"},
+		&core.JSONField{Name: "attempt_history"},
+		&core.DateField{Name: "available_at"},
+		&core.TextField{Name: "queue"},
+		&core.NumberField{Name: "priority", OnlyInt: true},
+		&core.JSONField{Name: "progress"},
+		&core.TextField{Name: "unique_key"},
+		&core.TextField{Name: "batch_id"},
+		&core.JSONField{Name: "chain"},
+		&core.TextField{Name: "user_id"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(queues); err != nil {
+		t.Fatalf("failed to create queues collection: %v", err)
+	}
+
+	failedJobs := core.NewBaseCollection(FailedJobsCollection)
+	failedJobs.Fields.Add(
+		&core.TextField{Name: "queue_id", Required: true},
+		&core.TextField{Name: "name", Required: true},
+		&core.TextField{Name: "description"},
+		&core.TextField{Name: "job_type"},
+		&core.JSONField{Name: "payload"},
+		&core.NumberField{Name: "attempts"},
+		&core.TextField{Name: "error"},
+		&core.TextField{Name: "stack"},
+		&core.JSONField{Name: "attempt_history"},
+		&core.DateField{Name: "failed_at"},
+		&core.TextField{Name: "queue"},
+		&core.NumberField{Name: "priority", OnlyInt: true},
+		&core.JSONField{Name: "chain"},
+		&core.TextField{Name: "user_id"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(failedJobs); err != nil {
+		t.Fatalf("failed to create failed_jobs collection: %v", err)
+	}
+
+	jobResults := core.NewBaseCollection(JobResultsCollection)
+	jobResults.Fields.Add(
+		&core.TextField{Name: "job_id", Required: true},
+		&core.TextField{Name: "name"},
+		&core.TextField{Name: "job_type"},
+		&core.TextField{Name: "queue"},
+		&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{JobStatusCompleted, JobStatusFailed, JobStatusCancelled}},
+		&core.JSONField{Name: "result"},
+		&core.TextField{Name: "error"},
+		&core.NumberField{Name: "attempts", OnlyInt: true},
+		&core.NumberField{Name: "duration_ms", OnlyInt: true},
+		&core.DateField{Name: "finished_at"},
+		&core.TextField{Name: "batch_id"},
+		&core.TextField{Name: "user_id"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(jobResults); err != nil {
+		t.Fatalf("failed to create job_results collection: %v", err)
+	}
+
+	jobBatches := core.NewBaseCollection(JobBatchesCollection)
+	jobBatches.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{JobStatusQueued, JobStatusProcessing, JobStatusCompleted, JobStatusFailed}},
+		&core.NumberField{Name: "total_jobs", OnlyInt: true},
+		&core.NumberField{Name: "pending_jobs", OnlyInt: true},
+		&core.NumberField{Name: "completed_jobs", OnlyInt: true},
+		&core.NumberField{Name: "failed_jobs", OnlyInt: true},
+		&core.JSONField{Name: "on_complete"},
+		&core.JSONField{Name: "on_failure"},
+		&core.TextField{Name: "callback_job_id"},
+		&core.DateField{Name: "finished_at"},
+		&core.TextField{Name: "user_id"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(jobBatches); err != nil {
+		t.Fatalf("failed to create job_batches collection: %v", err)
+	}
+
+	scheduledJobs := core.NewBaseCollection(ScheduledJobsCollection)
+	scheduledJobs.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.TextField{Name: "description"},
+		&core.TextField{Name: "cron", Required: true},
+		&core.JSONField{Name: "payload", Required: true},
+		&core.TextField{Name: "queue"},
+		&core.NumberField{Name: "priority", OnlyInt: true},
+		&core.BoolField{Name: "enabled"},
+		&core.TextField{Name: "timezone"},
+		&core.DateField{Name: "last_run_at"},
+		&core.DateField{Name: "next_run_at"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(scheduledJobs); err != nil {
+		t.Fatalf("failed to create scheduled_jobs collection: %v", err)
+	}
+
+	return app
+}
+
+// createTestJob inserts a queue record with the given payload
+func createTestJob(t *testing.T, app *pocketbase.PocketBase, name string, payload map[string]any) *core.Record {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId(QueuesCollection)
+	if err != nil {
+		t.Fatalf("failed to find queues collection: %v", err)
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("payload", string(payloadJSON))
+	record.Set("attempts", 0)
+
+	if err := app.Save(record); err != nil {
+		t.Fatalf("failed to save test job: %v", err)
+	}
+
+	return record
+}
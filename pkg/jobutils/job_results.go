@@ -0,0 +1,130 @@
+package jobutils
+
+import (
+	"fmt"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Constants for job result persistence
+const (
+	JobResultsCollection      = "job_results"
+	DefaultJobResultRetention = 7 * 24 * time.Hour
+)
+
+// GetJobResultRetention returns how long job results are kept, configured via JOB_RESULT_RETENTION_HOURS
+func GetJobResultRetention() time.Duration {
+	hours := common.GetEnvInt("JOB_RESULT_RETENTION_HOURS", int(DefaultJobResultRetention/time.Hour))
+	if hours <= 0 {
+		return DefaultJobResultRetention
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// SaveJobResult stores the final outcome of a queue record in the job_results collection
+func SaveJobResult(app core.App, record *core.Record, status string, result any, jobErr error, duration time.Duration) (*core.Record, error) {
+	if record == nil {
+		return nil, fmt.Errorf("record cannot be nil")
+	}
+
+	collection, err := app.FindCollectionByNameOrId(JobResultsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s collection: %w", JobResultsCollection, err)
+	}
+
+	jobResult := core.NewRecord(collection)
+	jobResult.Set("job_id", record.Id)
+	jobResult.Set("name", record.GetString("name"))
+	jobResult.Set("job_type", extractJobType(record))
+	jobResult.Set("queue", NormalizeQueueName(record.GetString("queue")))
+	jobResult.Set("status", status)
+	jobResult.Set("error", errorText(jobErr))
+	jobResult.Set("attempts", record.GetFloat("attempts"))
+	jobResult.Set("duration_ms", duration.Milliseconds())
+	jobResult.Set("finished_at", time.Now().UTC())
+	jobResult.Set("batch_id", record.GetString("batch_id"))
+	jobResult.Set("user_id", record.GetString("user_id"))
+	if result != nil {
+		jobResult.Set("result", result)
+	}
+
+	if err := app.Save(jobResult); err != nil {
+		return nil, fmt.Errorf("failed to save job result for %s: %w", record.Id, err)
+	}
+
+	return jobResult, nil
+}
+
+// FindJobResult returns the stored result of a job if it finished within the retention window
+func FindJobResult(app core.App, jobId string) (*core.Record, error) {
+	since := types.NowDateTime().Add(-GetJobResultRetention())
+
+	return app.FindFirstRecordByFilter(
+		JobResultsCollection,
+		"job_id = {:job_id} && finished_at >= {:since}",
+		dbx.Params{"job_id": jobId, "since": since.String()},
+	)
+}
+
+// PruneJobResults deletes up to limit job results that finished before the given time and returns the number deleted
+func PruneJobResults(app core.App, before time.Time, limit int) (int, error) {
+	records, err := app.FindRecordsByFilter(
+		JobResultsCollection,
+		"finished_at < {:before}",
+		"finished_at",
+		limit,
+		0,
+		dbx.Params{"before": before.UTC().Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired job results: %w", err)
+	}
+
+	pruned := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete job result %s: %w", record.Id, err)
+			}
+			pruned++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// completeJob stores the result of a successful job, removes it from the queue and continues its chain or
+// batch in a single transaction, then notifies the job's realtime subscribers. ErrJobReservationLost is
+// returned, and nothing changed, when the job is no longer reserved as it was when it started.
+func completeJob(app core.App, record *core.Record, result any, duration time.Duration) error {
+	err := runJobTransaction(app, func(txApp core.App) error {
+		if err := checkJobReservation(txApp, record.Id, record.GetString("reserved_by")); err != nil {
+			return err
+		}
+
+		if _, err := SaveJobResult(txApp, record, JobStatusCompleted, result, nil, duration); err != nil {
+			return err
+		}
+
+		if err := txApp.Delete(record); err != nil {
+			return fmt.Errorf("failed to delete completed job %s: %w", record.Id, err)
+		}
+
+		return finishChainedJob(txApp, record, JobStatusCompleted)
+	})
+	if err != nil {
+		return err
+	}
+
+	publishJobProgress(app, record.Id, JobStatusCompleted, GetJobProgress(record))
+	return nil
+}
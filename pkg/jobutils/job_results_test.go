@@ -0,0 +1,144 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+)
+
+// resultJobHandler returns a typed result for every job it processes
+type resultJobHandler struct {
+	jobType string
+}
+
+func (h *resultJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *JobData) error {
+	_, err := h.HandleWithResult(ctx, job)
+	return err
+}
+
+func (h *resultJobHandler) HandleWithResult(ctx *cronutils.CronExecutionContext, job *JobData) (any, error) {
+	return &DataProcessingResult{ProcessedRecords: 42, OutputLocation: "exports/" + job.Name}, nil
+}
+
+func (h *resultJobHandler) GetJobType() string {
+	return h.jobType
+}
+
+func TestJobProcessor_ProcessJob_StoresResult(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	if err := processor.RegisterHandler(&resultJobHandler{jobType: "result_job"}); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	job := createTestJob(t, app, "with-result", map[string]any{"type": "result_job"})
+
+	if err := processor.ProcessJob(job); err != nil {
+		t.Fatalf("ProcessJob returned error: %v", err)
+	}
+
+	if _, err := app.FindRecordById(QueuesCollection, job.Id); err == nil {
+		t.Error("completed job should be removed from the queue")
+	}
+
+	jobResult, err := FindJobResult(app, job.Id)
+	if err != nil {
+		t.Fatalf("job result not found: %v", err)
+	}
+	if got := jobResult.GetString("status"); got != JobStatusCompleted {
+		t.Errorf("expected status %s, got %s", JobStatusCompleted, got)
+	}
+	if got := jobResult.GetString("job_type"); got != "result_job" {
+		t.Errorf("expected job_type result_job, got %q", got)
+	}
+
+	var result DataProcessingResult
+	if err := jobResult.UnmarshalJSONField("result", &result); err != nil {
+		t.Fatalf("failed to decode stored result: %v", err)
+	}
+	if result.ProcessedRecords != 42 || result.OutputLocation != "exports/with-result" {
+		t.Errorf("unexpected stored result: %+v", result)
+	}
+}
+
+func TestRecordJobFailure_StoresFailedResult(t *testing.T) {
+	t.Setenv("JOB_MAX_RETRIES", "1")
+
+	app := newTestApp(t)
+	job := createTestJob(t, app, "doomed", map[string]any{"type": "test_job"})
+
+	deadLettered, err := recordJobFailure(app, NewJobRegistry(), job, errors.New("permanent failure"), 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("recordJobFailure returned error: %v", err)
+	}
+	if !deadLettered {
+		t.Fatal("job should be dead-lettered after reaching max attempts")
+	}
+
+	jobResult, err := FindJobResult(app, job.Id)
+	if err != nil {
+		t.Fatalf("job result not found: %v", err)
+	}
+	if got := jobResult.GetString("status"); got != JobStatusFailed {
+		t.Errorf("expected status %s, got %s", JobStatusFailed, got)
+	}
+	if got := jobResult.GetString("error"); got != "permanent failure" {
+		t.Errorf("expected error to be stored, got %q", got)
+	}
+	if got := jobResult.GetInt("duration_ms"); got != 1500 {
+		t.Errorf("expected duration 1500ms, got %d", got)
+	}
+}
+
+func TestFindAndPruneJobResults(t *testing.T) {
+	t.Setenv("JOB_RESULT_RETENTION_HOURS", "1")
+
+	app := newTestApp(t)
+
+	recent := createTestJob(t, app, "recent", map[string]any{"type": "test_job"})
+	if _, err := SaveJobResult(app, recent, JobStatusCompleted, nil, nil, time.Second); err != nil {
+		t.Fatalf("SaveJobResult returned error: %v", err)
+	}
+
+	old := createTestJob(t, app, "old", map[string]any{"type": "test_job"})
+	oldResult, err := SaveJobResult(app, old, JobStatusCompleted, nil, nil, time.Second)
+	if err != nil {
+		t.Fatalf("SaveJobResult returned error: %v", err)
+	}
+	oldResult.Set("finished_at", time.Now().UTC().Add(-2*time.Hour))
+	if err := app.Save(oldResult); err != nil {
+		t.Fatalf("failed to age job result: %v", err)
+	}
+
+	if _, err := FindJobResult(app, recent.Id); err != nil {
+		t.Errorf("recent job result should be found: %v", err)
+	}
+	if _, err := FindJobResult(app, old.Id); err == nil {
+		t.Error("job result outside the retention window should not be found")
+	}
+
+	pruned, err := PruneJobResults(app, time.Now().Add(-GetJobResultRetention()), 100)
+	if err != nil {
+		t.Fatalf("PruneJobResults returned error: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected 1 pruned job result, got %d", pruned)
+	}
+
+	remaining, err := app.CountRecords(JobResultsCollection)
+	if err != nil {
+		t.Fatalf("failed to count job results: %v", err)
+	}
+	if remaining != 1 {
+		t.Errorf("expected 1 remaining job result, got %d", remaining)
+	}
+}
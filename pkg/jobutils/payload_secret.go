@@ -0,0 +1,142 @@
+package jobutils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const payloadSecretType = "job_payload"
+
+// ErrPayloadSecretUnavailable is returned for jobs whose sealed secret was removed, e.g. jobs retried from
+// failed_jobs, or cannot be opened with the current secret
+var ErrPayloadSecretUnavailable = errors.New("the secret of the job is not available, request it again")
+
+// payloadSecretFields are the payload options removed by RedactPayloadSecrets, with the clear passphrase of
+// jobs queued before secrets were sealed
+var payloadSecretFields = []string{"sealed_passphrase", "sealed_key", "passphrase"}
+
+// SealPayloadSecret encrypts a secret with AES-256-GCM so it can travel in a job payload without being
+// stored in clear. Sealed values are opened with OpenPayloadSecret.
+func SealPayloadSecret(app core.App, secret string) (string, error) {
+	aead, err := payloadSecretAEAD(app)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to seal job payload secret: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// OpenPayloadSecret decrypts a secret sealed by SealPayloadSecret
+func OpenPayloadSecret(app core.App, sealed string) (string, error) {
+	aead, err := payloadSecretAEAD(app)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", ErrPayloadSecretUnavailable
+	}
+
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrPayloadSecretUnavailable
+	}
+	return string(secret), nil
+}
+
+// PayloadDigest returns a keyed hex digest of values, to compare secrets (e.g. in unique keys) without
+// storing them
+func PayloadDigest(app core.App, values ...string) (string, error) {
+	key, err := payloadSecretKey(app)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	for _, value := range values {
+		// Length prefixes keep ("ab", "c") and ("a", "bc") apart
+		fmt.Fprintf(mac, "%d:%s", len(value), value)
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// RedactPayloadSecrets returns a copy of a job payload without its sealed secrets, for payloads kept after
+// the job ran (failed_jobs) or shown to admins
+func RedactPayloadSecrets(payload any) any {
+	var raw []byte
+	switch value := payload.(type) {
+	case nil:
+		return nil
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return payload
+		}
+		raw = encoded
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return payload
+	}
+
+	options, ok := decoded["options"].(map[string]any)
+	if !ok {
+		return decoded
+	}
+	for _, field := range payloadSecretFields {
+		delete(options, field)
+	}
+	return decoded
+}
+
+// payloadSecretKey returns the AES-256 key sealing payload secrets, derived from JOB_PAYLOAD_SECRET or,
+// like download tokens, from the superusers file token secret shared by every instance
+func payloadSecretKey(app core.App) ([]byte, error) {
+	secret := common.GetEnv("JOB_PAYLOAD_SECRET", "")
+	if secret == "" {
+		superusers, err := app.FindCachedCollectionByNameOrId(core.CollectionNameSuperusers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve job payload secret: %w", err)
+		}
+		secret = superusers.FileToken.Secret + payloadSecretType
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:], nil
+}
+
+// payloadSecretAEAD returns the AES-256-GCM cipher sealing payload secrets
+func payloadSecretAEAD(app core.App) (cipher.AEAD, error) {
+	key, err := payloadSecretKey(app)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job payload cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,102 @@
+package jobutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSealExportFileOptions(t *testing.T) {
+	app := newTestApp(t)
+
+	sealed, err := SealExportFileOptions(app, ExportFileOptions{Encryption: ExportEncryptionAESGCM, Passphrase: "correct horse"})
+	if err != nil {
+		t.Fatalf("SealExportFileOptions returned error: %v", err)
+	}
+
+	// Only the sealed passphrase is written to the payload
+	encoded, _ := json.Marshal(sealed)
+	if strings.Contains(string(encoded), "correct horse") || sealed.SealedPassphrase == "" {
+		t.Fatalf("expected the passphrase to be sealed, got %s", encoded)
+	}
+
+	var decoded ExportFileOptions
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := OpenExportFileOptions(app, decoded)
+	if err != nil || opened.Passphrase != "correct horse" || opened.Key != "" {
+		t.Fatalf("expected the opened passphrase, got %+v (%v)", opened, err)
+	}
+
+	// Encryption without a passphrase gets a key, returned to the requester and sealed in the payload
+	sealed, err = SealExportFileOptions(app, ExportFileOptions{Encryption: ExportEncryptionAESGCM})
+	if err != nil || sealed.Key == "" || sealed.SealedKey == "" {
+		t.Fatalf("expected a generated and sealed key, got %+v (%v)", sealed, err)
+	}
+	encoded, _ = json.Marshal(sealed)
+	if strings.Contains(string(encoded), sealed.Key) {
+		t.Fatalf("expected the key to be sealed, got %s", encoded)
+	}
+	if opened, err := OpenExportFileOptions(app, ExportFileOptions{Encryption: sealed.Encryption, SealedKey: sealed.SealedKey}); err != nil || opened.Key != sealed.Key {
+		t.Fatalf("expected the opened key, got %+v (%v)", opened, err)
+	}
+
+	if _, err := SealExportFileOptions(app, ExportFileOptions{Encryption: ExportEncryptionAESGCM, Passphrase: "short"}); err == nil {
+		t.Error("expected a short passphrase to be rejected")
+	}
+
+	// Redacted or tampered secrets cannot be opened
+	if _, err := OpenExportFileOptions(app, ExportFileOptions{Encryption: ExportEncryptionAESGCM}); !errors.Is(err, ErrPayloadSecretUnavailable) {
+		t.Errorf("expected ErrPayloadSecretUnavailable without a secret, got %v", err)
+	}
+	if _, err := OpenExportFileOptions(app, ExportFileOptions{Encryption: ExportEncryptionAESGCM, SealedKey: "bm90IHNlYWxlZA=="}); !errors.Is(err, ErrPayloadSecretUnavailable) {
+		t.Errorf("expected ErrPayloadSecretUnavailable for an invalid secret, got %v", err)
+	}
+}
+
+func TestPayloadDigest(t *testing.T) {
+	app := newTestApp(t)
+
+	first, err := PayloadDigest(app, "gzip", "correct horse")
+	if err != nil {
+		t.Fatalf("PayloadDigest returned error: %v", err)
+	}
+	if second, _ := PayloadDigest(app, "gzip", "correct horse"); second != first {
+		t.Error("expected the same digest for the same values")
+	}
+	if other, _ := PayloadDigest(app, "gzipc", "orrect horse"); other == first {
+		t.Error("expected values to be kept apart")
+	}
+	if strings.Contains(first, "correct") {
+		t.Errorf("expected a digest, got %s", first)
+	}
+}
+
+func TestMoveToFailedJobs_RedactsSecrets(t *testing.T) {
+	app := newTestApp(t)
+
+	record := createTestJob(t, app, "Export", map[string]any{
+		"type": JobTypeDataProcessing,
+		"options": map[string]any{
+			"encryption":        ExportEncryptionAESGCM,
+			"sealed_passphrase": "sealed",
+			"passphrase":        "queued before sealing",
+		},
+	})
+
+	failedJob, err := MoveToFailedJobs(app, record, fmt.Errorf("boom"))
+	if err != nil {
+		t.Fatalf("MoveToFailedJobs returned error: %v", err)
+	}
+
+	payload := failedJob.GetString("payload")
+	if strings.Contains(payload, "sealed_passphrase") || strings.Contains(payload, "queued before sealing") {
+		t.Errorf("expected the secrets to be removed from the failed job, got %s", payload)
+	}
+	if !strings.Contains(payload, ExportEncryptionAESGCM) {
+		t.Errorf("expected the other options to be kept, got %s", payload)
+	}
+}
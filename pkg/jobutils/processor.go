@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"ims-pocketbase-baas-starter/pkg/common"
-	"ims-pocketbase-baas-starter/pkg/cronutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
 	"time"
 
@@ -97,12 +96,16 @@ func ParseJobDataFromRecord(record *core.Record) (*JobData, error) {
 		return nil, fmt.Errorf("job payload must contain a 'type' field")
 	}
 
-	// Parse reserved_at timestamp
 	var reservedAt *time.Time
-	if reservedAtStr := record.GetString("reserved_at"); reservedAtStr != "" {
-		if parsed, err := time.Parse(time.RFC3339, reservedAtStr); err == nil {
-			reservedAt = &parsed
-		}
+	if reserved := record.GetDateTime("reserved_at"); !reserved.IsZero() {
+		parsed := reserved.Time()
+		reservedAt = &parsed
+	}
+
+	var availableAt *time.Time
+	if available := record.GetDateTime("available_at"); !available.IsZero() {
+		parsed := available.Time()
+		availableAt = &parsed
 	}
 
 	return &JobData{
@@ -111,8 +114,14 @@ func ParseJobDataFromRecord(record *core.Record) (*JobData, error) {
 		Description: record.GetString("description"),
 		Type:        jobType,
 		Payload:     payload,
+		Queue:       NormalizeQueueName(record.GetString("queue")),
+		Priority:    int(record.GetFloat("priority")),
 		Attempts:    int(record.GetFloat("attempts")),
 		ReservedAt:  reservedAt,
+		ReservedBy:  record.GetString("reserved_by"),
+		BatchID:     record.GetString("batch_id"),
+		UserID:      record.GetString("user_id"),
+		AvailableAt: availableAt,
 		CreatedAt:   record.GetDateTime("created").Time(),
 		UpdatedAt:   record.GetDateTime("updated").Time(),
 	}, nil
@@ -149,7 +158,8 @@ func ValidateJobPayload(payload map[string]any) error {
 	return nil
 }
 
-// NewJobProcessor creates a new job processor with initialized registry and worker pool
+// NewJobProcessor creates a new job processor with initialized registry and worker pool.
+// Workers are reserved per named queue via JOB_QUEUE_WORKERS (e.g. "emails:2,exports:1,default:3").
 func NewJobProcessor(app *pocketbase.PocketBase) *JobProcessor {
 	if app == nil {
 		panic("NewJobProcessor: app cannot be nil")
@@ -157,10 +167,17 @@ func NewJobProcessor(app *pocketbase.PocketBase) *JobProcessor {
 
 	registry := NewJobRegistry()
 
+	maxWorkers := common.GetEnvInt("JOB_MAX_WORKERS", 5)
+	queueWorkers, err := ParseQueueWorkers(common.GetEnv("JOB_QUEUE_WORKERS", ""), maxWorkers)
+	if err != nil {
+		log.Error("Invalid JOB_QUEUE_WORKERS, using a single default queue", "error", err)
+		queueWorkers = map[string]int{DefaultQueueName: maxWorkers}
+	}
+
 	return &JobProcessor{
 		app:        app,
 		registry:   registry,
-		workerPool: NewWorkerPool(app, registry, common.GetEnvInt("JOB_MAX_WORKERS", 5)),
+		workerPool: NewWorkerPoolWithQueues(app, registry, queueWorkers),
 	}
 }
 
@@ -180,22 +197,14 @@ func (p *JobProcessor) ProcessJob(record *core.Record) error {
 		return fmt.Errorf("invalid job record")
 	}
 
-	originalReservedAt := record.GetString("reserved_at")
-	if originalReservedAt != "" && p.isJobReserved(record) {
-		return fmt.Errorf("job %s is already reserved", record.Id)
-	}
-
-	now := time.Now()
-	record.Set("reserved_at", now.Format(time.RFC3339))
-
-	if err := p.app.Save(record); err != nil {
-		record.Set("reserved_at", originalReservedAt)
-		return fmt.Errorf("failed to reserve job %s: %w", record.Id, err)
+	record, err := ReserveJob(p.app, record.Id, InstanceID()+"/processor", GetReservationTimeout())
+	if err != nil {
+		return err
 	}
 
 	jobData, err := ParseJobDataFromRecord(record)
 	if err != nil {
-		failErr := p.failJob(record, fmt.Errorf("failed to parse job data: %w", err))
+		failErr := p.failJob(record, fmt.Errorf("failed to parse job data: %w", err), 0)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "error", failErr)
 		}
@@ -203,7 +212,7 @@ func (p *JobProcessor) ProcessJob(record *core.Record) error {
 	}
 
 	if err := ValidateJobPayload(jobData.Payload); err != nil {
-		failErr := p.failJob(record, fmt.Errorf("invalid job payload: %w", err))
+		failErr := p.failJob(record, fmt.Errorf("invalid job payload: %w", err), 0)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "error", failErr)
 		}
@@ -212,31 +221,29 @@ func (p *JobProcessor) ProcessJob(record *core.Record) error {
 
 	handler, err := p.registry.GetHandler(jobData.Type)
 	if err != nil {
-		failErr := p.failJob(record, fmt.Errorf("no handler found for job type '%s': %w", jobData.Type, err))
+		failErr := p.failJob(record, fmt.Errorf("no handler found for job type '%s': %w", jobData.Type, err), 0)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "error", failErr)
 		}
 		return err
 	}
 
-	ctx := cronutils.NewCronExecutionContext(p.app, record.Id)
-	var jobErr error
+	timeout := p.registry.GetTimeout(jobData.Type, jobData.Payload)
+	ctx, cancel := newJobExecutionContext(p.app, record, timeout)
+	defer cancel()
 
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				jobErr = fmt.Errorf("job handler panicked: %v", r)
-				ctx.LogError(jobErr, "Job handler panic recovered")
-			}
-		}()
+	// The reservation is refreshed while the job runs, so it never expires before the job's timeout
+	hold := holdReservation(p.app, record, reservationRefreshInterval(), cancel)
 
-		ctx.LogStart(fmt.Sprintf("Processing %s job: %s", jobData.Type, jobData.Name))
-		jobErr = handler.Handle(ctx, jobData)
-	}()
+	started := time.Now()
+	ctx.LogStart(fmt.Sprintf("Processing %s job: %s", jobData.Type, jobData.Name))
+	result, jobErr := runJobHandler(ctx, handler, jobData, timeout)
+	defer hold.release(jobErr)
+	duration := time.Since(started)
 
 	if jobErr != nil {
 		ctx.LogError(jobErr, "Job processing failed")
-		failErr := p.failJob(record, jobErr)
+		failErr := p.failJob(record, jobErr, duration)
 		if failErr != nil {
 			ctx.LogError(failErr, "Failed to mark job as failed")
 		}
@@ -245,8 +252,8 @@ func (p *JobProcessor) ProcessJob(record *core.Record) error {
 
 	ctx.LogEnd("Job processed successfully")
 
-	if err := p.app.Delete(record); err != nil {
-		return fmt.Errorf("failed to delete completed job %s: %w", record.Id, err)
+	if err := completeJob(p.app, record, result, duration); err != nil {
+		return err
 	}
 
 	log.Info("Job completed and removed from queue", "job_id", record.Id, "job_name", record.GetString("name"))
@@ -277,30 +284,19 @@ func (p *JobProcessor) ProcessJobs(records []*core.Record) []error {
 	return errors
 }
 
-func (p *JobProcessor) isJobReserved(record *core.Record) bool {
-	reservedAtStr := record.GetString("reserved_at")
-	if reservedAtStr == "" {
-		return false
-	}
-
-	reservedAt, err := time.Parse(time.RFC3339, reservedAtStr)
+// failJob records a failed attempt and dead-letters the job once it reaches its max attempts
+func (p *JobProcessor) failJob(record *core.Record, jobErr error, duration time.Duration) error {
+	deadLettered, err := recordJobFailure(p.app, p.registry, record, jobErr, duration)
 	if err != nil {
-		return false
-	}
-
-	return time.Since(reservedAt) < 5*time.Minute
-}
-
-func (p *JobProcessor) failJob(record *core.Record, jobErr error) error {
-	currentAttempts := int(record.GetFloat("attempts"))
-	record.Set("attempts", currentAttempts+1)
-	record.Set("reserved_at", "")
-
-	if err := p.app.Save(record); err != nil {
 		log.Error("Failed to update failed job record", "job_id", record.Id, "error", err)
 		return fmt.Errorf("failed to update failed job %s: %w", record.Id, err)
 	}
 
-	log.Error("Job failed", "job_id", record.Id, "job_name", record.GetString("name"), "attempts", currentAttempts+1, "error", jobErr)
-	return jobErr
+	log.Error("Job failed",
+		"job_id", record.Id,
+		"job_name", record.GetString("name"),
+		"attempts", int(record.GetFloat("attempts")),
+		"dead_lettered", deadLettered,
+		"error", jobErr)
+	return nil
 }
@@ -0,0 +1,165 @@
+package jobutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+// realtimeClientsChunkSize is the number of realtime clients checked per chunk when broadcasting
+const realtimeClientsChunkSize = 300
+
+// JobProgress represents the progress of a running job stored in the queue record's progress field
+type JobProgress struct {
+	Done      int       `json:"done"`
+	Total     int       `json:"total"`
+	Percent   float64   `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobProgressEvent is the realtime message published on a job's progress topic
+type JobProgressEvent struct {
+	JobID    string       `json:"job_id"`
+	Status   string       `json:"status"`
+	Progress *JobProgress `json:"progress,omitempty"`
+}
+
+// JobProgressTopic returns the realtime topic on which the progress of a job is published
+func JobProgressTopic(jobId string) string {
+	return "jobs/" + jobId + "/progress"
+}
+
+// ParseJobProgressTopic returns the job ID of a realtime job progress topic, ignoring subscription options
+func ParseJobProgressTopic(topic string) (string, bool) {
+	topic, _, _ = strings.Cut(topic, "?")
+
+	jobId, ok := strings.CutPrefix(topic, "jobs/")
+	if !ok {
+		return "", false
+	}
+	jobId, ok = strings.CutSuffix(jobId, "/progress")
+	if !ok || jobId == "" || strings.Contains(jobId, "/") {
+		return "", false
+	}
+	return jobId, true
+}
+
+// NewJobProgress builds a progress snapshot, clamping done to the [0, total] range
+func NewJobProgress(done, total int, message string) *JobProgress {
+	if total < 0 {
+		total = 0
+	}
+	if done < 0 {
+		done = 0
+	}
+	if total > 0 && done > total {
+		done = total
+	}
+
+	percent := 0.0
+	if total > 0 {
+		percent = float64(done) * 100 / float64(total)
+	}
+
+	return &JobProgress{
+		Done:      done,
+		Total:     total,
+		Percent:   percent,
+		Message:   message,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+// GetJobProgress returns the last progress reported for a queue record, or nil if none was reported
+func GetJobProgress(record *core.Record) *JobProgress {
+	raw := record.GetString("progress")
+	if raw == "" || raw == "null" {
+		return nil
+	}
+
+	var progress JobProgress
+	if err := json.Unmarshal([]byte(raw), &progress); err != nil {
+		return nil
+	}
+
+	return &progress
+}
+
+// ReportJobProgress stores the progress of a job on its queue record and publishes it on the job's realtime topic
+func ReportJobProgress(app core.App, jobId string, done, total int, message string) (*JobProgress, error) {
+	progress := NewJobProgress(done, total, message)
+
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job progress: %w", err)
+	}
+
+	// Update only the progress column so the reservation fields of the running job are never overwritten
+	_, err = app.DB().Update(
+		QueuesCollection,
+		dbx.Params{"progress": string(progressJSON)},
+		dbx.HashExp{"id": jobId},
+	).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save progress of job %s: %w", jobId, err)
+	}
+
+	publishJobProgress(app, jobId, JobStatusProcessing, progress)
+
+	return progress, nil
+}
+
+// publishJobProgress sends a progress event to the realtime clients subscribed to the job's topic
+func publishJobProgress(app core.App, jobId, status string, progress *JobProgress) {
+	topic := JobProgressTopic(jobId)
+
+	data, err := json.Marshal(JobProgressEvent{JobID: jobId, Status: status, Progress: progress})
+	if err != nil {
+		log.Error("Failed to marshal job progress event", "job_id", jobId, "error", err)
+		return
+	}
+
+	message := subscriptions.Message{Name: topic, Data: data}
+	for _, chunk := range app.SubscriptionsBroker().ChunkedClients(realtimeClientsChunkSize) {
+		for _, client := range chunk {
+			if client.HasSubscription(topic) {
+				// Send blocks until the client reads the message, so never hold up the job on a slow client
+				routine.FireAndForget(func() {
+					client.Send(message)
+				})
+			}
+		}
+	}
+}
+
+// newJobExecutionContext creates the execution context passed to job handlers. Its context is cancelled after
+// timeout and it reports progress for the given queue record; the reported progress is also kept on the
+// in-memory record for the completion event.
+func newJobExecutionContext(app *pocketbase.PocketBase, record *core.Record, timeout time.Duration) (*cronutils.CronExecutionContext, context.CancelFunc) {
+	ctx := cronutils.NewCronExecutionContext(app, record.Id)
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithTimeout(context.Background(), timeout)
+
+	ctx.SetProgressReporter(func(done, total int, message string) error {
+		progress, err := ReportJobProgress(app, record.Id, done, total, message)
+		if err != nil {
+			return err
+		}
+		record.Set("progress", progress)
+		return nil
+	})
+	return ctx, cancel
+}
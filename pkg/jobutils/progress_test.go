@@ -0,0 +1,168 @@
+package jobutils
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+// progressJobHandler reports progress in steps before completing
+type progressJobHandler struct {
+	jobType string
+	steps   int
+}
+
+func (h *progressJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *JobData) error {
+	for i := 1; i <= h.steps; i++ {
+		if err := ctx.ReportProgress(i, h.steps, "step"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *progressJobHandler) GetJobType() string {
+	return h.jobType
+}
+
+// subscribeToJobProgress registers a realtime client subscribed to the progress topic of a job
+func subscribeToJobProgress(t *testing.T, app *pocketbase.PocketBase, jobId string) *subscriptions.DefaultClient {
+	t.Helper()
+
+	client := subscriptions.NewDefaultClient()
+	client.Subscribe(JobProgressTopic(jobId))
+	app.SubscriptionsBroker().Register(client)
+	t.Cleanup(func() {
+		app.SubscriptionsBroker().Unregister(client.Id())
+	})
+
+	return client
+}
+
+// receiveProgressEvents reads events from a realtime client until one with the given status arrives
+func receiveProgressEvents(t *testing.T, client *subscriptions.DefaultClient, status string) []JobProgressEvent {
+	t.Helper()
+
+	var events []JobProgressEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-client.Channel():
+			var event JobProgressEvent
+			if err := json.Unmarshal(message.Data, &event); err != nil {
+				t.Fatalf("failed to decode progress event: %v", err)
+			}
+			events = append(events, event)
+			if event.Status == status {
+				return events
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s progress event, got %+v", status, events)
+		}
+	}
+}
+
+func TestNewJobProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		done, total int
+		wantDone    int
+		wantPercent float64
+	}{
+		{name: "halfway", done: 50, total: 200, wantDone: 50, wantPercent: 25},
+		{name: "done beyond total", done: 12, total: 10, wantDone: 10, wantPercent: 100},
+		{name: "negative done", done: -1, total: 10, wantDone: 0, wantPercent: 0},
+		{name: "unknown total", done: 7, total: 0, wantDone: 7, wantPercent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := NewJobProgress(tt.done, tt.total, "")
+			if progress.Done != tt.wantDone || progress.Percent != tt.wantPercent {
+				t.Errorf("expected done=%d percent=%v, got done=%d percent=%v", tt.wantDone, tt.wantPercent, progress.Done, progress.Percent)
+			}
+		})
+	}
+}
+
+func TestParseJobProgressTopic(t *testing.T) {
+	tests := []struct {
+		topic  string
+		wantId string
+		wantOk bool
+	}{
+		{topic: JobProgressTopic("abc123"), wantId: "abc123", wantOk: true},
+		{topic: `jobs/abc123/progress?options={"query":{}}`, wantId: "abc123", wantOk: true},
+		{topic: "jobs//progress"},
+		{topic: "jobs/a/b/progress"},
+		{topic: "users/abc123"},
+	}
+
+	for _, tt := range tests {
+		jobId, ok := ParseJobProgressTopic(tt.topic)
+		if jobId != tt.wantId || ok != tt.wantOk {
+			t.Errorf("ParseJobProgressTopic(%q) = %q, %v, want %q, %v", tt.topic, jobId, ok, tt.wantId, tt.wantOk)
+		}
+	}
+}
+
+func TestReportJobProgress(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "long-running", map[string]any{"type": "test_job"})
+	client := subscribeToJobProgress(t, app, job.Id)
+
+	if _, err := ReportJobProgress(app, job.Id, 30, 120, "Exporting users"); err != nil {
+		t.Fatalf("ReportJobProgress returned error: %v", err)
+	}
+
+	reloaded, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+	progress := GetJobProgress(reloaded)
+	if progress == nil {
+		t.Fatal("expected progress to be stored on the job record")
+	}
+	if progress.Done != 30 || progress.Total != 120 || progress.Percent != 25 || progress.Message != "Exporting users" {
+		t.Errorf("unexpected stored progress: %+v", progress)
+	}
+
+	events := receiveProgressEvents(t, client, JobStatusProcessing)
+	if events[0].JobID != job.Id || events[0].Progress == nil || events[0].Progress.Done != 30 {
+		t.Errorf("unexpected progress event: %+v", events[0])
+	}
+}
+
+func TestJobProcessor_ProcessJob_PublishesProgress(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	if err := processor.RegisterHandler(&progressJobHandler{jobType: "progress_job", steps: 3}); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	job := createTestJob(t, app, "with-progress", map[string]any{"type": "progress_job"})
+	client := subscribeToJobProgress(t, app, job.Id)
+
+	if err := processor.ProcessJob(job); err != nil {
+		t.Fatalf("ProcessJob returned error: %v", err)
+	}
+
+	// Messages are delivered asynchronously, so only the completion event's content is checked
+	events := receiveProgressEvents(t, client, JobStatusCompleted)
+	completed := events[len(events)-1]
+	if completed.Progress == nil || completed.Progress.Done != 3 || completed.Progress.Total != 3 {
+		t.Errorf("expected completion event with the final progress, got %+v", completed.Progress)
+	}
+}
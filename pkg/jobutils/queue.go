@@ -0,0 +1,183 @@
+package jobutils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/metrics"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Named queue constants
+const (
+	DefaultQueueName = "default"
+	QueueEmails      = "emails"
+	QueueExports     = "exports"
+)
+
+// Job priority constants (higher priorities are processed first)
+const (
+	JobPriorityLow    = -10
+	JobPriorityNormal = 0
+	JobPriorityHigh   = 10
+)
+
+// ParseQueueWorkers parses a queue worker spec like "emails:2,exports:1,default:3" into a map of
+// queue name to reserved worker count. The default queue is always present so that jobs with an
+// unknown or empty queue name still have workers; it gets defaultWorkers when not listed.
+func ParseQueueWorkers(spec string, defaultWorkers int) (map[string]int, error) {
+	if defaultWorkers <= 0 {
+		defaultWorkers = 1
+	}
+
+	queueWorkers := make(map[string]int)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, countStr, found := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid queue worker entry %q: expected <queue>:<workers>", entry)
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(countStr))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid worker count for queue %q: %s", name, countStr)
+		}
+
+		queueWorkers[name] = count
+	}
+
+	if _, exists := queueWorkers[DefaultQueueName]; !exists {
+		queueWorkers[DefaultQueueName] = defaultWorkers
+	}
+
+	return queueWorkers, nil
+}
+
+// NormalizeQueueName maps an empty queue name to the default queue
+func NormalizeQueueName(queueName string) string {
+	queueName = strings.TrimSpace(queueName)
+	if queueName == "" {
+		return DefaultQueueName
+	}
+	return queueName
+}
+
+// QueueNames returns the named queues served by the processor's worker pool, sorted by name
+func (p *JobProcessor) QueueNames() []string {
+	if p.workerPool == nil {
+		return []string{DefaultQueueName}
+	}
+	return p.workerPool.QueueNames()
+}
+
+// FetchPendingJobs returns up to limit jobs of a named queue that are available and not reserved,
+// ordered by priority (highest first) and then by creation date (oldest first).
+// The default queue also picks up jobs whose queue name has no reserved workers.
+func (p *JobProcessor) FetchPendingJobs(queueName string, limit int, reservationTimeout time.Duration) ([]*core.Record, error) {
+	queueName = NormalizeQueueName(queueName)
+	now := time.Now()
+
+	params := dbx.Params{
+		"now":     types.NowDateTime().String(),
+		"expired": now.Add(-reservationTimeout).UTC().Format(types.DefaultDateLayout),
+	}
+
+	filter := "(available_at = '' || available_at <= {:now}) && (reserved_at = '' || reserved_at < {:expired})"
+
+	if queueName == DefaultQueueName {
+		// Everything not claimed by another named queue belongs to the default queue
+		for i, name := range p.QueueNames() {
+			if name == DefaultQueueName {
+				continue
+			}
+			key := fmt.Sprintf("excluded%d", i)
+			filter += fmt.Sprintf(" && queue != {:%s}", key)
+			params[key] = name
+		}
+	} else {
+		filter += " && queue = {:queue}"
+		params["queue"] = queueName
+	}
+
+	records, err := p.app.FindRecordsByFilter(QueuesCollection, filter, "-priority,created", limit, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pending jobs for queue %s: %w", queueName, err)
+	}
+
+	return records, nil
+}
+
+// RecordQueueSizes reports the number of queued jobs of each named queue served by the processor as
+// gauges. Jobs of queues without reserved workers are counted in the default queue that serves them.
+func (p *JobProcessor) RecordQueueSizes(provider metrics.MetricsProvider) error {
+	if provider == nil {
+		return nil
+	}
+
+	counts, err := CountJobsByQueue(p.app)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[string]int)
+	for _, queueName := range p.QueueNames() {
+		sizes[queueName] = 0
+	}
+	for queueName, count := range counts {
+		if _, served := sizes[queueName]; !served {
+			queueName = DefaultQueueName
+		}
+		sizes[queueName] += count
+	}
+	for queueName, size := range sizes {
+		metrics.RecordQueueSize(provider, queueName, size)
+	}
+
+	return nil
+}
+
+// CountJobsByQueue returns the number of queued jobs per queue name (empty names count as default)
+func CountJobsByQueue(app core.App) (map[string]int, error) {
+	rows := []struct {
+		Queue string `db:"queue"`
+		Total int    `db:"total"`
+	}{}
+
+	err := app.DB().
+		Select("queue", "COUNT(*) as total").
+		From(QueuesCollection).
+		GroupBy("queue").
+		All(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs by queue: %w", err)
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[NormalizeQueueName(row.Queue)] += row.Total
+	}
+
+	return counts, nil
+}
+
+// sortedQueueNames returns the keys of a queue worker map in a stable order
+func sortedQueueNames(queueWorkers map[string]int) []string {
+	names := make([]string, 0, len(queueWorkers))
+	for name := range queueWorkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,163 @@
+package jobutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// createQueuedTestJob inserts a queue record on a named queue with a priority
+func createQueuedTestJob(t *testing.T, app *pocketbase.PocketBase, name, queue string, priority int) *core.Record {
+	t.Helper()
+
+	job := createTestJob(t, app, name, map[string]any{"type": "test_job"})
+	job.Set("queue", queue)
+	job.Set("priority", priority)
+	if err := app.Save(job); err != nil {
+		t.Fatalf("failed to save queued test job: %v", err)
+	}
+
+	return job
+}
+
+func TestParseQueueWorkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected map[string]int
+		wantErr  bool
+	}{
+		{
+			name:     "empty spec uses default workers",
+			spec:     "",
+			expected: map[string]int{"default": 5},
+		},
+		{
+			name:     "named queues with explicit default",
+			spec:     "emails:2, exports:1,default:3",
+			expected: map[string]int{"emails": 2, "exports": 1, "default": 3},
+		},
+		{
+			name:     "default queue is always added",
+			spec:     "emails:2",
+			expected: map[string]int{"emails": 2, "default": 5},
+		},
+		{
+			name:    "missing worker count",
+			spec:    "emails",
+			wantErr: true,
+		},
+		{
+			name:    "invalid worker count",
+			spec:    "emails:0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQueueWorkers(tt.spec, 5)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for spec %q", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for name, count := range tt.expected {
+				if got[name] != count {
+					t.Errorf("queue %s: expected %d workers, got %d", name, count, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestNewWorkerPoolWithQueues(t *testing.T) {
+	app := pocketbase.New()
+	pool := NewWorkerPoolWithQueues(app, NewJobRegistry(), map[string]int{"emails": 2, "exports": 1})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = pool.Shutdown(ctx)
+	}()
+
+	if pool.maxWorkers != 4 || len(pool.workers) != 4 {
+		t.Errorf("expected 4 workers including the implicit default worker, got %d (%d started)", pool.maxWorkers, len(pool.workers))
+	}
+
+	names := pool.QueueNames()
+	expected := []string{"default", "emails", "exports"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected queues %v, got %v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("expected queue %s at index %d, got %s", name, i, names[i])
+		}
+	}
+
+	if pool.QueueWorkers("emails") != 2 || pool.QueueWorkers("") != 1 {
+		t.Errorf("unexpected worker reservation: emails=%d default=%d", pool.QueueWorkers("emails"), pool.QueueWorkers(""))
+	}
+}
+
+func TestJobProcessor_FetchPendingJobs(t *testing.T) {
+	t.Setenv("JOB_QUEUE_WORKERS", "emails:1,default:1")
+
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	low := createQueuedTestJob(t, app, "low", QueueEmails, JobPriorityLow)
+	high := createQueuedTestJob(t, app, "high", QueueEmails, JobPriorityHigh)
+	normal := createQueuedTestJob(t, app, "normal", QueueEmails, JobPriorityNormal)
+	unnamed := createQueuedTestJob(t, app, "unnamed", "", JobPriorityNormal)
+	unserved := createQueuedTestJob(t, app, "unserved", QueueExports, JobPriorityNormal)
+
+	emails, err := processor.FetchPendingJobs(QueueEmails, 10, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("FetchPendingJobs returned error: %v", err)
+	}
+	expected := []string{high.Id, normal.Id, low.Id}
+	if len(emails) != len(expected) {
+		t.Fatalf("expected %d email jobs, got %d", len(expected), len(emails))
+	}
+	for i, id := range expected {
+		if emails[i].Id != id {
+			t.Errorf("expected job %s at position %d, got %s", id, i, emails[i].Id)
+		}
+	}
+
+	defaults, err := processor.FetchPendingJobs(DefaultQueueName, 10, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("FetchPendingJobs returned error: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, record := range defaults {
+		ids[record.Id] = true
+	}
+	if len(defaults) != 2 || !ids[unnamed.Id] || !ids[unserved.Id] {
+		t.Errorf("expected default queue to serve unnamed and unserved jobs, got %d jobs", len(defaults))
+	}
+
+	counts, err := CountJobsByQueue(app)
+	if err != nil {
+		t.Fatalf("CountJobsByQueue returned error: %v", err)
+	}
+	if counts[QueueEmails] != 3 || counts[DefaultQueueName] != 1 || counts[QueueExports] != 1 {
+		t.Errorf("unexpected queue counts: %v", counts)
+	}
+}
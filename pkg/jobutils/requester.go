@@ -0,0 +1,55 @@
+package jobutils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ErrJobRequesterNotFound is returned for jobs whose user no longer exists
+var ErrJobRequesterNotFound = errors.New("job requester no longer exists")
+
+// FindJobRequester returns the auth record of the user that created a job (its user_id), nil for jobs
+// without a user. Jobs that run with the access of their requester use it to apply collection rules.
+func FindJobRequester(app core.App, userId string) (*core.Record, error) {
+	if userId == "" {
+		return nil, nil
+	}
+
+	authCollections, err := app.FindAllCollections(core.CollectionTypeAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load auth collections: %w", err)
+	}
+
+	for _, collection := range authCollections {
+		if record, err := app.FindRecordById(collection, userId); err == nil {
+			return record, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrJobRequesterNotFound, userId)
+}
+
+// FindJobOwner returns the user_id of a job, looking it up in the queue, its stored result, the dead-letter
+// queue, the job batches and the export files. found is false when the ID matches none of them.
+func FindJobOwner(app core.App, jobId string) (ownerId string, found bool) {
+	if job, err := app.FindRecordById(QueuesCollection, jobId); err == nil {
+		return job.GetString("user_id"), true
+	}
+	if jobResult, err := FindJobResult(app, jobId); err == nil {
+		return jobResult.GetString("user_id"), true
+	}
+	if failedJob, err := app.FindFirstRecordByFilter(FailedJobsCollection, "queue_id = {:job_id}", dbx.Params{"job_id": jobId}); err == nil {
+		return failedJob.GetString("user_id"), true
+	}
+	if batch, err := FindJobBatch(app, jobId); err == nil {
+		return batch.GetString("user_id"), true
+	}
+	if exportRecord, err := app.FindFirstRecordByFilter(ExportFilesCollectionName, "job_id = {:job_id}", dbx.Params{"job_id": jobId}); err == nil {
+		return exportRecord.GetString("user_id"), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,32 @@
+package jobutils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFindJobOwner(t *testing.T) {
+	app := newTestApp(t)
+
+	record := createTestJob(t, app, "Owned", map[string]any{"type": "test_job"})
+	record.Set("user_id", "user1")
+	if err := app.Save(record); err != nil {
+		t.Fatalf("failed to save test job: %v", err)
+	}
+
+	if ownerId, found := FindJobOwner(app, record.Id); !found || ownerId != "user1" {
+		t.Errorf("expected the queued job to be owned by user1, got %q (found %v)", ownerId, found)
+	}
+
+	// The owner is still resolved once the job was dead-lettered
+	if _, err := MoveToFailedJobs(app, record, fmt.Errorf("boom")); err != nil {
+		t.Fatalf("MoveToFailedJobs returned error: %v", err)
+	}
+	if ownerId, found := FindJobOwner(app, record.Id); !found || ownerId != "user1" {
+		t.Errorf("expected the failed job to be owned by user1, got %q (found %v)", ownerId, found)
+	}
+
+	if _, found := FindJobOwner(app, "missing"); found {
+		t.Error("expected unknown job IDs not to be found")
+	}
+}
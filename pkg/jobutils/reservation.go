@@ -0,0 +1,280 @@
+package jobutils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// DefaultReservationTimeout is how long a reservation is honoured before another worker may take over the job
+const DefaultReservationTimeout = 5 * time.Minute
+
+// ErrJobAlreadyReserved is returned when a job is reserved by another worker or no longer available
+var ErrJobAlreadyReserved = errors.New("job is already reserved")
+
+// ErrJobReservationLost is returned when a job is no longer reserved by the worker that ran it, because its
+// reservation was taken over or the job was removed from the queue
+var ErrJobReservationLost = errors.New("job reservation was lost")
+
+var (
+	instanceID     string
+	instanceIDOnce sync.Once
+)
+
+// InstanceID returns the identifier of this application instance used in reserved_by.
+// It defaults to "<hostname>-<pid>-<random>" and can be fixed with JOB_INSTANCE_ID.
+func InstanceID() string {
+	instanceIDOnce.Do(func() {
+		if id := common.GetEnv("JOB_INSTANCE_ID", ""); id != "" {
+			instanceID = id
+			return
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "unknown"
+		}
+
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+
+		instanceID = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+	})
+
+	return instanceID
+}
+
+// GetReservationTimeout returns the reservation timeout configured via JOB_RESERVATION_TIMEOUT (in minutes)
+func GetReservationTimeout() time.Duration {
+	minutes := common.GetEnvInt("JOB_RESERVATION_TIMEOUT", int(DefaultReservationTimeout/time.Minute))
+	if minutes <= 0 {
+		return DefaultReservationTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// ReserveJob atomically reserves a queued job for reservedBy with a single conditional UPDATE.
+// The update only succeeds if the job is available and not reserved (or its reservation expired),
+// so concurrent workers, overlapping cron runs and other app instances can never reserve the same
+// job twice. On success the freshly reserved record is reloaded and returned, otherwise
+// ErrJobAlreadyReserved is returned.
+func ReserveJob(app core.App, jobId string, reservedBy string, reservationTimeout time.Duration) (*core.Record, error) {
+	now := types.NowDateTime()
+	expired := now.Add(-reservationTimeout)
+
+	result, err := app.DB().Update(
+		QueuesCollection,
+		dbx.Params{
+			"reserved_at": now.String(),
+			"reserved_by": reservedBy,
+			"updated":     now.String(),
+		},
+		dbx.NewExp(
+			"[[id]] = {:job_id}"+
+				" AND ([[reserved_at]] = '' OR [[reserved_at]] IS NULL OR [[reserved_at]] < {:expired})"+
+				" AND ([[available_at]] = '' OR [[available_at]] IS NULL OR [[available_at]] <= {:now})",
+			dbx.Params{
+				"job_id":  jobId,
+				"expired": expired.String(),
+				"now":     now.String(),
+			},
+		),
+	).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve job %s: %w", jobId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve job %s: %w", jobId, err)
+	}
+	if affected == 0 {
+		return nil, fmt.Errorf("job %s: %w", jobId, ErrJobAlreadyReserved)
+	}
+
+	record, err := app.FindRecordById(QueuesCollection, jobId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reserved job %s: %w", jobId, err)
+	}
+
+	return record, nil
+}
+
+// ReleaseJob clears the reservation of a job still held by reservedBy so another worker can pick it up
+// immediately. Reservations taken over by someone else in the meantime are left untouched.
+func ReleaseJob(app core.App, jobId string, reservedBy string) error {
+	_, err := app.DB().Update(
+		QueuesCollection,
+		dbx.Params{
+			"reserved_at": "",
+			"reserved_by": "",
+			"updated":     types.NowDateTime().String(),
+		},
+		dbx.HashExp{"id": jobId, "reserved_by": reservedBy},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to release job %s: %w", jobId, err)
+	}
+
+	return nil
+}
+
+// ExtendReservation refreshes the reserved_at of a job still held by reservedBy, so the reservation does not
+// expire while the job runs. ErrJobReservationLost is returned when the job is no longer reserved by reservedBy.
+func ExtendReservation(app core.App, jobId string, reservedBy string) error {
+	result, err := app.DB().Update(
+		QueuesCollection,
+		dbx.Params{"reserved_at": types.NowDateTime().String()},
+		dbx.HashExp{"id": jobId, "reserved_by": reservedBy},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to extend reservation of job %s: %w", jobId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to extend reservation of job %s: %w", jobId, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("job %s: %w", jobId, ErrJobReservationLost)
+	}
+
+	return nil
+}
+
+// checkJobReservation returns ErrJobReservationLost unless the job is still in the queue and reserved by
+// reservedBy. Called in the transactions that complete or fail a job, so a worker whose reservation was taken
+// over never removes or reschedules the job of another worker.
+func checkJobReservation(txApp core.App, jobId string, reservedBy string) error {
+	var count int
+	err := txApp.DB().
+		Select("COUNT(*)").
+		From(QueuesCollection).
+		Where(dbx.NewExp("[[id]] = {:job_id} AND COALESCE([[reserved_by]], '') = {:reserved_by}", dbx.Params{
+			"job_id":      jobId,
+			"reserved_by": reservedBy,
+		})).
+		Row(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check reservation of job %s: %w", jobId, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("job %s: %w", jobId, ErrJobReservationLost)
+	}
+
+	return nil
+}
+
+// reservationHold keeps the reservation of a running job alive
+type reservationHold struct {
+	app        core.App
+	jobId      string
+	reservedBy string
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// reservationRefreshInterval is how often a running job refreshes its reservation, a third of the reservation
+// timeout so a slow refresh never lets it expire
+func reservationRefreshInterval() time.Duration {
+	return max(GetReservationTimeout()/3, time.Second)
+}
+
+// holdReservation refreshes the reservation of a reserved job every interval until the hold is released, so
+// jobs running longer than JOB_RESERVATION_TIMEOUT are never reserved by another worker. onLost is called when
+// the reservation was taken over or the job removed, to cancel the running handler.
+func holdReservation(app core.App, record *core.Record, interval time.Duration, onLost func()) *reservationHold {
+	hold := &reservationHold{
+		app:        app,
+		jobId:      record.Id,
+		reservedBy: record.GetString("reserved_by"),
+		stop:       make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hold.stop:
+				return
+			case <-ticker.C:
+				err := ExtendReservation(app, hold.jobId, hold.reservedBy)
+				if errors.Is(err, ErrJobReservationLost) {
+					log.Warn("Job reservation lost, cancelling the job", "job_id", hold.jobId, "reserved_by", hold.reservedBy)
+					onLost()
+					return
+				}
+				if err != nil {
+					log.Error("Failed to extend job reservation", "job_id", hold.jobId, "error", err)
+				}
+			}
+		}
+	}()
+
+	return hold
+}
+
+// release stops refreshing the reservation once the job is completed or its failure recorded. When the handler
+// outlived its deadline the job stays reserved until the handler returns, then the reservation is cleared so
+// the job can be retried without ever running twice at the same time.
+func (h *reservationHold) release(jobErr error) {
+	running := runningHandler(jobErr)
+	if running == nil {
+		h.stopRefreshing()
+		return
+	}
+
+	log.Warn("Job handler still running after its timeout, keeping the job reserved", "job_id", h.jobId)
+	go func() {
+		<-running
+		h.stopRefreshing()
+		if !h.app.IsBootstrapped() {
+			return // the app shut down, the reservation expires on its own
+		}
+		if err := ReleaseJob(h.app, h.jobId, h.reservedBy); err != nil {
+			log.Error("Failed to release timed out job", "job_id", h.jobId, "error", err)
+		}
+	}()
+}
+
+func (h *reservationHold) stopRefreshing() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
+
+// maxTransactionRetries is how many times a job transaction is retried when another instance holds the database lock
+const maxTransactionRetries = 5
+
+// runJobTransaction runs fn in a transaction, retrying the whole transaction when SQLite reports a lock conflict.
+// A transaction that read before writing cannot recover from a conflicting commit of another instance by retrying
+// single statements, so it has to start over with a fresh snapshot.
+func runJobTransaction(app core.App, fn func(txApp core.App) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTransactionRetries; attempt++ {
+		err = app.RunInTransaction(fn)
+		if err == nil || !isDatabaseLockError(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt*50) * time.Millisecond)
+	}
+	return err
+}
+
+// isDatabaseLockError reports whether err is a transient SQLite busy/locked error
+func isDatabaseLockError(err error) bool {
+	errStr := err.Error()
+	return strings.Contains(errStr, "database is locked") || strings.Contains(errStr, "table is locked")
+}
@@ -0,0 +1,276 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// countingJobHandler records how many times each job was executed
+type countingJobHandler struct {
+	jobType string
+	mu      sync.Mutex
+	runs    map[string]int
+	total   atomic.Int64
+}
+
+func (h *countingJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *JobData) error {
+	// Widen the window in which other processors could pick up the same job
+	time.Sleep(5 * time.Millisecond)
+
+	h.mu.Lock()
+	h.runs[job.ID]++
+	h.mu.Unlock()
+	h.total.Add(1)
+	return nil
+}
+
+func (h *countingJobHandler) GetJobType() string {
+	return h.jobType
+}
+
+// newSharedTestApp bootstraps another app instance on the data dir of an existing test app
+func newSharedTestApp(t *testing.T, app *pocketbase.PocketBase) *pocketbase.PocketBase {
+	t.Helper()
+
+	shared := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: app.DataDir()})
+	if err := shared.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap shared test app: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = shared.ResetBootstrapState()
+	})
+
+	return shared
+}
+
+func TestReserveJob(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "reserve", map[string]any{"type": "test_job"})
+
+	reserved, err := ReserveJob(app, job.Id, "instance-a", time.Minute)
+	if err != nil {
+		t.Fatalf("first reservation failed: %v", err)
+	}
+	if reserved.GetString("reserved_by") != "instance-a" || reserved.GetDateTime("reserved_at").IsZero() {
+		t.Errorf("expected reservation by instance-a, got %q at %v", reserved.GetString("reserved_by"), reserved.GetDateTime("reserved_at"))
+	}
+
+	if _, err := ReserveJob(app, job.Id, "instance-b", time.Minute); !errors.Is(err, ErrJobAlreadyReserved) {
+		t.Fatalf("expected ErrJobAlreadyReserved, got %v", err)
+	}
+
+	// An expired reservation can be taken over
+	time.Sleep(10 * time.Millisecond)
+	takenOver, err := ReserveJob(app, job.Id, "instance-b", time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected expired reservation to be taken over: %v", err)
+	}
+	if takenOver.GetString("reserved_by") != "instance-b" {
+		t.Errorf("expected reservation by instance-b, got %q", takenOver.GetString("reserved_by"))
+	}
+}
+
+func TestReserveJob_NotAvailableYet(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "delayed", map[string]any{"type": "test_job"})
+	job.Set("available_at", time.Now().Add(time.Hour))
+	if err := app.Save(job); err != nil {
+		t.Fatalf("failed to delay job: %v", err)
+	}
+
+	if _, err := ReserveJob(app, job.Id, "instance-a", time.Minute); !errors.Is(err, ErrJobAlreadyReserved) {
+		t.Fatalf("expected delayed job not to be reservable, got %v", err)
+	}
+}
+
+func TestExtendReservation(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "extended", map[string]any{"type": "test_job"})
+
+	reserved, err := ReserveJob(app, job.Id, "instance-a", time.Minute)
+	if err != nil {
+		t.Fatalf("reservation failed: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := ExtendReservation(app, job.Id, "instance-a"); err != nil {
+		t.Fatalf("ExtendReservation returned error: %v", err)
+	}
+	extended, _ := app.FindRecordById(QueuesCollection, job.Id)
+	if !extended.GetDateTime("reserved_at").Time().After(reserved.GetDateTime("reserved_at").Time()) {
+		t.Errorf("expected reserved_at to move forward, got %v", extended.GetDateTime("reserved_at"))
+	}
+
+	if err := ExtendReservation(app, job.Id, "instance-b"); !errors.Is(err, ErrJobReservationLost) {
+		t.Errorf("expected ErrJobReservationLost for another worker, got %v", err)
+	}
+}
+
+func TestCompleteAndFailJob_ReservationLost(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "taken-over", map[string]any{"type": "test_job"})
+
+	reserved, err := ReserveJob(app, job.Id, "instance-a", time.Minute)
+	if err != nil {
+		t.Fatalf("reservation failed: %v", err)
+	}
+
+	// Another worker took the job over after the reservation expired
+	time.Sleep(10 * time.Millisecond)
+	if _, err := ReserveJob(app, job.Id, "instance-b", time.Millisecond); err != nil {
+		t.Fatalf("takeover failed: %v", err)
+	}
+
+	if err := completeJob(app, reserved, nil, time.Second); !errors.Is(err, ErrJobReservationLost) {
+		t.Errorf("expected completeJob to fail with ErrJobReservationLost, got %v", err)
+	}
+	if _, err := recordJobFailure(app, NewJobRegistry(), reserved, errors.New("failed"), time.Second); !errors.Is(err, ErrJobReservationLost) {
+		t.Errorf("expected recordJobFailure to fail with ErrJobReservationLost, got %v", err)
+	}
+
+	current, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("the job of the other worker should stay queued: %v", err)
+	}
+	if current.GetString("reserved_by") != "instance-b" || current.GetInt("attempts") != 0 {
+		t.Errorf("expected the job to stay reserved by instance-b without attempts, got %q with %d attempts",
+			current.GetString("reserved_by"), current.GetInt("attempts"))
+	}
+	if _, err := FindJobResult(app, job.Id); err == nil {
+		t.Error("expected no result to be stored for the taken over job")
+	}
+}
+
+func TestHoldReservation(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "held", map[string]any{"type": "test_job"})
+
+	reserved, err := ReserveJob(app, job.Id, "instance-a", time.Minute)
+	if err != nil {
+		t.Fatalf("reservation failed: %v", err)
+	}
+
+	lost := make(chan struct{})
+	hold := holdReservation(app, reserved, 20*time.Millisecond, func() { close(lost) })
+	defer hold.release(nil)
+
+	// The reservation is refreshed while the job runs
+	time.Sleep(100 * time.Millisecond)
+	refreshed, _ := app.FindRecordById(QueuesCollection, job.Id)
+	if !refreshed.GetDateTime("reserved_at").Time().After(reserved.GetDateTime("reserved_at").Time()) {
+		t.Errorf("expected reserved_at to be refreshed, got %v", refreshed.GetDateTime("reserved_at"))
+	}
+
+	// A reservation taken over by another worker cancels the job
+	if _, err := app.DB().Update(QueuesCollection, dbx.Params{"reserved_by": "instance-b"}, dbx.HashExp{"id": job.Id}).Execute(); err != nil {
+		t.Fatalf("takeover failed: %v", err)
+	}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("expected the lost reservation to be reported")
+	}
+}
+
+func TestMultipleProcessors_ExecuteEachJobOnce(t *testing.T) {
+	const (
+		instances = 4
+		jobCount  = 40
+	)
+
+	app := newTestApp(t)
+
+	jobIds := make([]string, 0, jobCount)
+	for i := 0; i < jobCount; i++ {
+		job := createTestJob(t, app, fmt.Sprintf("job-%d", i), map[string]any{"type": "counted"})
+		jobIds = append(jobIds, job.Id)
+	}
+
+	handler := &countingJobHandler{jobType: "counted", runs: make(map[string]int)}
+
+	processors := make([]*JobProcessor, 0, instances)
+	for i := 0; i < instances; i++ {
+		instanceApp := app
+		if i > 0 {
+			instanceApp = newSharedTestApp(t, app)
+		}
+
+		processor := NewJobProcessor(instanceApp)
+		if err := processor.RegisterHandler(handler); err != nil {
+			t.Fatalf("failed to register handler: %v", err)
+		}
+		processors = append(processors, processor)
+	}
+	defer func() {
+		for _, processor := range processors {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_ = processor.workerPool.Shutdown(ctx)
+			cancel()
+		}
+	}()
+
+	// Every instance fetches the same pending jobs and races to process them, both through the
+	// worker pool and through direct ProcessJob calls, like overlapping cron ticks would
+	var wg sync.WaitGroup
+	var unexpected atomic.Int64
+	for _, processor := range processors {
+		records, err := processor.FetchPendingJobs(DefaultQueueName, jobCount, time.Minute)
+		if err != nil {
+			t.Fatalf("FetchPendingJobs returned error: %v", err)
+		}
+
+		wg.Add(2)
+		go func(processor *JobProcessor, records []*core.Record) {
+			defer wg.Done()
+			for _, err := range processor.ProcessJobsConcurrently(records, 0) {
+				if err != nil && !errors.Is(err, ErrJobAlreadyReserved) {
+					unexpected.Add(1)
+					t.Errorf("unexpected worker error: %v", err)
+				}
+			}
+		}(processor, records)
+		go func(processor *JobProcessor, records []*core.Record) {
+			defer wg.Done()
+			for _, record := range records {
+				if err := processor.ProcessJob(record); err != nil && !errors.Is(err, ErrJobAlreadyReserved) {
+					unexpected.Add(1)
+					t.Errorf("unexpected processor error: %v", err)
+				}
+			}
+		}(processor, records)
+	}
+	wg.Wait()
+
+	if unexpected.Load() > 0 {
+		t.Fatalf("%d jobs failed unexpectedly", unexpected.Load())
+	}
+
+	for _, id := range jobIds {
+		if runs := handler.runs[id]; runs != 1 {
+			t.Errorf("job %s executed %d times, expected exactly once", id, runs)
+		}
+	}
+	if total := handler.total.Load(); total != jobCount {
+		t.Errorf("expected %d executions, got %d", jobCount, total)
+	}
+
+	remaining, err := app.CountRecords(QueuesCollection)
+	if err != nil {
+		t.Fatalf("failed to count remaining jobs: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("expected queue to be empty, %d jobs remaining", remaining)
+	}
+}
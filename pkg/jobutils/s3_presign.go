@@ -0,0 +1,133 @@
+package jobutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// MaxPresignTTL is the longest validity of an S3 presigned URL
+const MaxPresignTTL = 7 * 24 * time.Hour
+
+const (
+	s3SignAlgorithm  = "AWS4-HMAC-SHA256"
+	s3DateTimeFormat = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+)
+
+// PresignS3GetURL returns a URL downloading the object stored under key in the bucket of an S3 config until
+// ttl elapses from now, signed with AWS Signature Version 4 query parameters. A fileName sets the name of
+// the downloaded file.
+func PresignS3GetURL(config core.S3Config, key, fileName string, ttl time.Duration, now time.Time) (string, error) {
+	if ttl <= 0 || ttl > MaxPresignTTL {
+		return "", fmt.Errorf("presigned URLs are valid for 1 second to 7 days, got %v", ttl)
+	}
+
+	objectURL, err := url.Parse(s3ObjectURL(config, key))
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint %q: %w", config.Endpoint, err)
+	}
+
+	now = now.UTC()
+	scope := strings.Join([]string{now.Format(s3DateFormat), config.Region, "s3", "aws4_request"}, "/")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3SignAlgorithm)
+	query.Set("X-Amz-Credential", config.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(s3DateTimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if fileName != "" {
+		query.Set("response-content-disposition", `attachment; filename="`+fileName+`"`)
+	}
+
+	canonicalQuery := s3CanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		s3Escape(objectURL.Path, false),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SignAlgorithm,
+		now.Format(s3DateTimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := []byte("AWS4" + config.Secret)
+	for _, part := range []string{now.Format(s3DateFormat), config.Region, "s3", "aws4_request"} {
+		signingKey = s3HMAC(signingKey, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	return objectURL.Scheme + "://" + objectURL.Host + s3Escape(objectURL.Path, false) + "?" +
+		canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// s3ObjectURL returns the URL of an object, following the addressing of the PocketBase S3 client
+func s3ObjectURL(config core.S3Config, key string) string {
+	scheme := "https"
+	endpoint := strings.TrimRight(config.Endpoint, "/")
+	if after, ok := strings.CutPrefix(endpoint, "https://"); ok {
+		endpoint = after
+	} else if after, ok := strings.CutPrefix(endpoint, "http://"); ok {
+		endpoint = after
+		scheme = "http"
+	}
+
+	key = strings.TrimLeft(key, "/")
+	if config.ForcePathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", scheme, endpoint, config.Bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", scheme, config.Bucket, endpoint, key)
+}
+
+// s3CanonicalQuery encodes query parameters sorted by name, as signed
+func s3CanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(query.Get(name), true))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but the unreserved characters of RFC 3986, and slashes unless
+// escapeSlash is set
+func s3Escape(value string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !escapeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
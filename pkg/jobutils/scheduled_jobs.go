@@ -0,0 +1,162 @@
+package jobutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Constants for recurring jobs stored in the database
+const (
+	ScheduledJobsCollection = "scheduled_jobs"
+
+	// ScheduledJobIDOption is the payload option set on a job enqueued by the scheduler with the scheduled job ID
+	ScheduledJobIDOption = "scheduled_job_id"
+	// ScheduledAtOption is the payload option set on a job enqueued by the scheduler with its planned run time
+	ScheduledAtOption = "scheduled_at"
+)
+
+// ValidateScheduledJob checks the cron expression, timezone and payload template of a scheduled job
+func ValidateScheduledJob(record *core.Record) error {
+	if _, err := cronutils.ParseSchedule(record.GetString("cron"), record.GetString("timezone")); err != nil {
+		return err
+	}
+
+	_, err := scheduledJobPayload(record)
+	return err
+}
+
+// ScheduleNextRun sets next_run_at of a scheduled job to its first run time after the given time,
+// or clears it when the job is disabled
+func ScheduleNextRun(record *core.Record, after time.Time) error {
+	if !record.GetBool("enabled") {
+		record.Set("next_run_at", "")
+		return nil
+	}
+
+	schedule, err := cronutils.ParseSchedule(record.GetString("cron"), record.GetString("timezone"))
+	if err != nil {
+		return err
+	}
+
+	next, err := schedule.Next(after)
+	if err != nil {
+		return err
+	}
+
+	record.Set("next_run_at", next.UTC())
+	return nil
+}
+
+// RunDueScheduledJobs enqueues every enabled scheduled job whose next run time has passed and returns the
+// number of jobs enqueued. Runs missed while no instance was up are not caught up: a job runs once and is
+// scheduled from now. Enabled jobs without a next run time (e.g. inserted without hooks) are only scheduled.
+func RunDueScheduledJobs(app core.App, now time.Time) (int, error) {
+	records, err := app.FindAllRecords(ScheduledJobsCollection,
+		dbx.HashExp{"enabled": true},
+		dbx.NewExp("[[next_run_at]] <= {:now}", dbx.Params{"now": now.UTC().Format(types.DefaultDateLayout)}),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch due scheduled jobs: %w", err)
+	}
+
+	enqueued := 0
+	for _, record := range records {
+		ran, err := runScheduledJob(app, record, now)
+		if err != nil {
+			log.Error("Failed to run scheduled job", "scheduled_job_id", record.Id, "name", record.GetString("name"), "error", err)
+			continue
+		}
+		if ran {
+			enqueued++
+		}
+	}
+
+	return enqueued, nil
+}
+
+// runScheduledJob claims a due run of a scheduled job and enqueues its job in the same transaction.
+// It reports false when the job was only (re)scheduled or another instance claimed the run first.
+func runScheduledJob(app core.App, record *core.Record, now time.Time) (bool, error) {
+	dueAt := record.GetDateTime("next_run_at")
+
+	if err := ScheduleNextRun(record, now); err != nil {
+		return false, err
+	}
+
+	ran := false
+	err := runJobTransaction(app, func(txApp core.App) error {
+		ran = false
+
+		params := dbx.Params{
+			"id":          record.Id,
+			"next_run_at": record.GetDateTime("next_run_at").String(),
+			"due_at":      dueAt.String(),
+		}
+		updates := "[[next_run_at]] = {:next_run_at}"
+		if !dueAt.IsZero() {
+			params["last_run_at"] = now.UTC().Format(types.DefaultDateLayout)
+			updates = "[[next_run_at]] = {:next_run_at}, [[last_run_at]] = {:last_run_at}"
+		}
+
+		// The conditional update lets only one instance claim a run
+		result, err := txApp.DB().NewQuery(
+			"UPDATE {{" + ScheduledJobsCollection + "}} SET " + updates +
+				" WHERE [[id]] = {:id} AND COALESCE([[next_run_at]], '') = {:due_at}",
+		).Bind(params).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to update scheduled job %s: %w", record.Id, err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 || dueAt.IsZero() {
+			return nil
+		}
+
+		payload, err := scheduledJobPayload(record)
+		if err != nil {
+			return err
+		}
+
+		job, _, err := Enqueue(txApp, payload, EnqueueOptions{
+			Name:        record.GetString("name"),
+			Description: record.GetString("description"),
+			Queue:       record.GetString("queue"),
+			Priority:    record.GetInt("priority"),
+			payloadOptions: map[string]any{
+				ScheduledJobIDOption: record.Id,
+				ScheduledAtOption:    dueAt.Time().UTC().Format(time.RFC3339),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Info("Scheduled job enqueued", "scheduled_job_id", record.Id, "name", record.GetString("name"), "job_id", job.Id)
+		ran = true
+		return nil
+	})
+
+	return ran, err
+}
+
+// scheduledJobPayload decodes the payload template of a scheduled job
+func scheduledJobPayload(record *core.Record) (map[string]any, error) {
+	var payload map[string]any
+	if raw, ok := record.Get("payload").(types.JSONRaw); ok && len(raw) > 0 {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, fmt.Errorf("scheduled job payload must be a JSON object: %w", err)
+		}
+	}
+
+	if err := ValidateJobPayload(payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,134 @@
+package jobutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// createScheduledJob inserts an enabled scheduled job with a step payload
+func createScheduledJob(t *testing.T, app *pocketbase.PocketBase, name, cronExpr string, nextRunAt time.Time) *core.Record {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId(ScheduledJobsCollection)
+	if err != nil {
+		t.Fatalf("failed to find scheduled_jobs collection: %v", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("cron", cronExpr)
+	record.Set("payload", map[string]any{"type": "step", "data": map[string]any{"report": "daily"}})
+	record.Set("enabled", true)
+	if !nextRunAt.IsZero() {
+		record.Set("next_run_at", nextRunAt)
+	}
+
+	if err := app.Save(record); err != nil {
+		t.Fatalf("failed to save scheduled job: %v", err)
+	}
+
+	return record
+}
+
+func TestValidateScheduledJob(t *testing.T) {
+	app := newTestApp(t)
+	record := createScheduledJob(t, app, "report", "0 2 * * *", time.Time{})
+
+	if err := ValidateScheduledJob(record); err != nil {
+		t.Fatalf("expected a valid scheduled job, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value any
+	}{
+		{name: "invalid cron", field: "cron", value: "61 * * * *"},
+		{name: "seconds field", field: "cron", value: "0 0 2 * * *"},
+		{name: "invalid timezone", field: "timezone", value: "Mars/Olympus"},
+		{name: "missing type", field: "payload", value: map[string]any{"data": map[string]any{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := record.Fresh()
+			invalid.Set(tt.field, tt.value)
+			if err := ValidateScheduledJob(invalid); err == nil {
+				t.Errorf("expected %s %v to be rejected", tt.field, tt.value)
+			}
+		})
+	}
+}
+
+func TestScheduleNextRun(t *testing.T) {
+	app := newTestApp(t)
+	record := createScheduledJob(t, app, "report", "30 2 * * *", time.Time{})
+	after := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	if err := ScheduleNextRun(record, after); err != nil {
+		t.Fatalf("ScheduleNextRun returned error: %v", err)
+	}
+	if next := record.GetDateTime("next_run_at").Time(); !next.Equal(time.Date(2026, 1, 11, 2, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected the next run at 02:30 UTC the next day, got %v", next)
+	}
+
+	record.Set("timezone", "America/New_York")
+	_ = ScheduleNextRun(record, after)
+	if next := record.GetDateTime("next_run_at").Time(); !next.Equal(time.Date(2026, 1, 11, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected the next run at 02:30 New York time, got %v", next)
+	}
+
+	record.Set("enabled", false)
+	_ = ScheduleNextRun(record, after)
+	if !record.GetDateTime("next_run_at").IsZero() {
+		t.Error("expected a disabled job to have no next run time")
+	}
+}
+
+func TestRunDueScheduledJobs(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC()
+
+	due := createScheduledJob(t, app, "due", "*/5 * * * *", now.Add(-time.Minute))
+	createScheduledJob(t, app, "later", "*/5 * * * *", now.Add(time.Hour))
+	unscheduled := createScheduledJob(t, app, "unscheduled", "*/5 * * * *", time.Time{})
+
+	enqueued, err := RunDueScheduledJobs(app, now)
+	if err != nil {
+		t.Fatalf("RunDueScheduledJobs returned error: %v", err)
+	}
+	if enqueued != 1 {
+		t.Fatalf("expected one job to be enqueued, got %d", enqueued)
+	}
+
+	job := findQueuedJob(t, app, "due")
+	jobData, err := ParseJobDataFromRecord(job)
+	if err != nil {
+		t.Fatalf("failed to parse enqueued job: %v", err)
+	}
+	if JobOption(jobData, ScheduledJobIDOption) != due.Id || JobOption(jobData, ScheduledAtOption) == "" {
+		t.Errorf("expected the scheduled job options on the payload, got %+v", jobData.Payload["options"])
+	}
+
+	reloaded, _ := app.FindRecordById(ScheduledJobsCollection, due.Id)
+	if reloaded.GetDateTime("last_run_at").IsZero() || !reloaded.GetDateTime("next_run_at").Time().After(now) {
+		t.Errorf("expected the due job to be rescheduled, got last_run_at=%v next_run_at=%v",
+			reloaded.GetDateTime("last_run_at"), reloaded.GetDateTime("next_run_at"))
+	}
+
+	reloaded, _ = app.FindRecordById(ScheduledJobsCollection, unscheduled.Id)
+	if reloaded.GetDateTime("next_run_at").IsZero() || !reloaded.GetDateTime("last_run_at").IsZero() {
+		t.Error("expected the unscheduled job to be scheduled without running")
+	}
+
+	// A second instance working from the same stale snapshot must not enqueue the run again
+	if ran, err := runScheduledJob(app, due, now); err != nil || ran {
+		t.Errorf("expected an already claimed run to be skipped, got ran=%v err=%v", ran, err)
+	}
+	if total, _ := app.CountRecords(QueuesCollection); total != 1 {
+		t.Errorf("expected a single queued job, got %d", total)
+	}
+}
@@ -0,0 +1,120 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	log "ims-pocketbase-baas-starter/pkg/logger"
+)
+
+// DefaultDrainTimeout is how long shutdown waits for in-flight jobs before releasing their reservations
+const DefaultDrainTimeout = 30 * time.Second
+
+// ErrWorkerPoolDraining is returned for jobs that were not started because the worker pool is shutting down
+var ErrWorkerPoolDraining = errors.New("worker pool is draining")
+
+// jobTracker keeps track of the reservations held by running workers and whether the pool is draining
+type jobTracker struct {
+	draining atomic.Bool
+	mu       sync.Mutex
+	jobs     map[string]string // job ID -> reserved_by
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[string]string)}
+}
+
+func (t *jobTracker) add(jobId, reservedBy string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.jobs[jobId] = reservedBy
+}
+
+func (t *jobTracker) remove(jobId string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.jobs, jobId)
+}
+
+func (t *jobTracker) count() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.jobs)
+}
+
+func (t *jobTracker) snapshot() map[string]string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make(map[string]string, len(t.jobs))
+	for jobId, reservedBy := range t.jobs {
+		jobs[jobId] = reservedBy
+	}
+	return jobs
+}
+
+func (t *jobTracker) startDraining() {
+	if t != nil {
+		t.draining.Store(true)
+	}
+}
+
+func (t *jobTracker) isDraining() bool {
+	return t != nil && t.draining.Load()
+}
+
+// GetDrainTimeout returns the shutdown drain timeout configured via JOB_DRAIN_TIMEOUT_SECONDS
+func GetDrainTimeout() time.Duration {
+	seconds := common.GetEnvInt("JOB_DRAIN_TIMEOUT_SECONDS", int(DefaultDrainTimeout/time.Second))
+	if seconds <= 0 {
+		return DefaultDrainTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Shutdown stops the dispatcher so no new jobs are accepted, then drains the worker pool until ctx
+// expires. Reservations of jobs still running at that point are released.
+func (p *JobProcessor) Shutdown(ctx context.Context) error {
+	log.Info("Shutting down job processor")
+
+	var errs []error
+
+	// Stop starting buffered jobs right away, the dispatcher's last batch only waits for running jobs
+	if p.workerPool != nil {
+		p.workerPool.tracker.startDraining()
+	}
+
+	if err := p.StopDispatcher(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.workerPool != nil {
+		if err := p.workerPool.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain worker pool: %w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	log.Info("Job processor shutdown completed")
+	return nil
+}
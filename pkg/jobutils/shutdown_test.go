@@ -0,0 +1,156 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// blockingJobHandler blocks every job until release is closed
+type blockingJobHandler struct {
+	jobType string
+	started chan string
+	release chan struct{}
+}
+
+func (h *blockingJobHandler) Handle(ctx *cronutils.CronExecutionContext, job *JobData) error {
+	h.started <- job.ID
+	<-h.release
+	return nil
+}
+
+func (h *blockingJobHandler) GetJobType() string {
+	return h.jobType
+}
+
+func TestWorkerPool_ShutdownDrainsInFlightJobs(t *testing.T) {
+	app := newTestApp(t)
+	registry := NewJobRegistry()
+	handler := &blockingJobHandler{jobType: "blocking", started: make(chan string, 1), release: make(chan struct{})}
+	_ = registry.Register(handler)
+
+	pool := NewWorkerPool(app, registry, 2)
+	job := createTestJob(t, app, "drained", map[string]any{"type": "blocking"})
+
+	results := make(chan []error, 1)
+	go func() {
+		results <- pool.ProcessJobs([]*core.Record{job})
+	}()
+	<-handler.started
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(handler.release)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("expected in-flight job to drain, got %v", err)
+	}
+
+	if errs := <-results; errs[0] != nil {
+		t.Errorf("expected drained job to succeed, got %v", errs[0])
+	}
+	if _, err := app.FindRecordById(QueuesCollection, job.Id); err == nil {
+		t.Error("expected drained job to be completed and removed from the queue")
+	}
+}
+
+func TestWorkerPool_ShutdownReleasesUnfinishedJobs(t *testing.T) {
+	app := newTestApp(t)
+	registry := NewJobRegistry()
+	handler := &blockingJobHandler{jobType: "blocking", started: make(chan string, 1), release: make(chan struct{})}
+	_ = registry.Register(handler)
+
+	pool := NewWorkerPool(app, registry, 1)
+	job := createTestJob(t, app, "unfinished", map[string]any{"type": "blocking"})
+
+	go pool.ProcessJobs([]*core.Record{job})
+	<-handler.started
+	defer close(handler.release)
+
+	reserved, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+	if reserved.GetString("reserved_by") == "" {
+		t.Fatal("expected running job to be reserved")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected drain timeout, got %v", err)
+	}
+
+	released, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+	if released.GetString("reserved_at") != "" || released.GetString("reserved_by") != "" {
+		t.Errorf("expected reservation to be released, got reserved_at=%q reserved_by=%q",
+			released.GetString("reserved_at"), released.GetString("reserved_by"))
+	}
+
+	// Another instance can pick the job up right away
+	if _, err := ReserveJob(app, job.Id, "other-instance", time.Hour); err != nil {
+		t.Errorf("expected released job to be reservable, got %v", err)
+	}
+}
+
+func TestWorker_SkipsJobsWhileDraining(t *testing.T) {
+	app := newTestApp(t)
+	job := createTestJob(t, app, "skipped", map[string]any{"type": "test_job"})
+
+	tracker := newJobTracker()
+	tracker.startDraining()
+	worker := &Worker{id: 1, app: app, registry: NewJobRegistry(), tracker: tracker}
+
+	if err := worker.processJob(job); !errors.Is(err, ErrWorkerPoolDraining) {
+		t.Fatalf("expected ErrWorkerPoolDraining, got %v", err)
+	}
+
+	reloaded, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+	if reloaded.GetString("reserved_at") != "" {
+		t.Error("expected skipped job not to be reserved")
+	}
+}
+
+func TestGetDrainTimeout(t *testing.T) {
+	if got := GetDrainTimeout(); got != DefaultDrainTimeout {
+		t.Errorf("expected default drain timeout %v, got %v", DefaultDrainTimeout, got)
+	}
+
+	t.Setenv("JOB_DRAIN_TIMEOUT_SECONDS", "5")
+	if got := GetDrainTimeout(); got != 5*time.Second {
+		t.Errorf("expected 5s drain timeout, got %v", got)
+	}
+}
+
+func TestJobProcessor_ShutdownStopsDispatcherAndPool(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	processor.StartDispatcher(DispatcherConfig{PollInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := processor.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	if processor.IsDispatcherRunning() {
+		t.Error("expected dispatcher to be stopped")
+	}
+	if !processor.workerPool.IsShutdown() {
+		t.Error("expected worker pool to be shut down")
+	}
+}
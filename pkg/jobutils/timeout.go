@@ -0,0 +1,179 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"ims-pocketbase-baas-starter/pkg/common"
+	"ims-pocketbase-baas-starter/pkg/cronutils"
+)
+
+// DefaultJobTimeout is how long a job handler may run when neither the payload nor the configuration sets a timeout
+const DefaultJobTimeout = 30 * time.Second
+
+// Failure reasons recorded in the attempt history and the job_failures_total metric
+const (
+	FailureReasonError   = "error"
+	FailureReasonTimeout = "timeout"
+	FailureReasonPanic   = "panic"
+)
+
+// JobTimeoutError is returned when a job handler does not finish before its deadline
+type JobTimeoutError struct {
+	Timeout time.Duration
+
+	// running is closed when a handler that outlived its deadline returns, nil when it already returned
+	running <-chan struct{}
+}
+
+// Error implements the error interface
+func (e *JobTimeoutError) Error() string {
+	return fmt.Sprintf("job timed out after %s", e.Timeout)
+}
+
+// Unwrap allows errors.Is(err, context.DeadlineExceeded) checks
+func (e *JobTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// GetTimeout returns how long a job may run. The timeout is resolved from the payload's options.timeout
+// (in seconds), then JOB_TIMEOUT_SECONDS_<TYPE>, then the handler's PayloadTimeoutProvider and
+// TimeoutProvider implementations, then JOB_TIMEOUT_SECONDS and finally DefaultJobTimeout.
+func (r *JobRegistry) GetTimeout(jobType string, payload map[string]any) time.Duration {
+	if timeout := payloadTimeout(payload); timeout > 0 {
+		return timeout
+	}
+
+	if jobType != "" {
+		envKey := "JOB_TIMEOUT_SECONDS_" + strings.ToUpper(jobType)
+		if seconds := common.GetEnvInt(envKey, 0); seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if r != nil {
+		r.mu.RLock()
+		handler, exists := r.handlers[jobType]
+		r.mu.RUnlock()
+
+		if provider, ok := handler.(PayloadTimeoutProvider); exists && ok {
+			if timeout := provider.GetPayloadTimeout(payload); timeout > 0 {
+				return timeout
+			}
+		}
+
+		if provider, ok := handler.(TimeoutProvider); exists && ok {
+			if timeout := provider.GetTimeout(); timeout > 0 {
+				return timeout
+			}
+		}
+	}
+
+	if seconds := common.GetEnvInt("JOB_TIMEOUT_SECONDS", int(DefaultJobTimeout/time.Second)); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return DefaultJobTimeout
+}
+
+// payloadTimeout returns the options.timeout of a job payload, or 0 when it is not set
+func payloadTimeout(payload map[string]any) time.Duration {
+	options, ok := payload["options"].(map[string]any)
+	if !ok {
+		return 0
+	}
+
+	seconds, ok := options["timeout"].(float64)
+	if !ok || seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// runningHandler returns the channel closed when the handler of a timed out job returns, or nil when the
+// handler is not running anymore
+func runningHandler(err error) <-chan struct{} {
+	var timeoutErr *JobTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr.running
+	}
+	return nil
+}
+
+// failureReason classifies a job error for the attempt history and metrics
+func failureReason(err error) string {
+	var timeoutErr *JobTimeoutError
+	var panicErr *JobPanicError
+
+	switch {
+	case errors.As(err, &timeoutErr):
+		return FailureReasonTimeout
+	case errors.As(err, &panicErr):
+		return FailureReasonPanic
+	default:
+		return FailureReasonError
+	}
+}
+
+// handlerOutcome carries the return values of a handler running in its own goroutine
+type handlerOutcome struct {
+	result any
+	err    error
+}
+
+// runJobHandler executes a handler until it returns or the execution context's deadline passes, collecting
+// its typed result when it implements JobResultHandler. The handler runs in its own goroutine so a handler
+// that ignores the context cannot block the worker; its late outcome is discarded and the returned
+// JobTimeoutError tells when it returns, so the job stays reserved meanwhile. Panics are recovered and
+// returned as a JobPanicError.
+func runJobHandler(ctx *cronutils.CronExecutionContext, handler JobHandler, jobData *JobData, timeout time.Duration) (any, error) {
+	done := make(chan handlerOutcome, 1)
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr := &JobPanicError{Value: r, Stack: debug.Stack()}
+				ctx.LogError(panicErr, "Job handler panic recovered")
+				done <- handlerOutcome{err: panicErr}
+			}
+		}()
+
+		if resultHandler, ok := handler.(JobResultHandler); ok {
+			result, err := resultHandler.HandleWithResult(ctx, jobData)
+			done <- handlerOutcome{result: result, err: err}
+			return
+		}
+
+		done <- handlerOutcome{err: handler.Handle(ctx, jobData)}
+	}()
+
+	select {
+	case outcome := <-done:
+		// A handler that returned the context error after its deadline still timed out
+		if outcome.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &JobTimeoutError{Timeout: timeout}
+		}
+		return outcome.result, outcome.err
+	case <-ctx.Done():
+		select {
+		case outcome := <-done:
+			// The handler finished at the same moment the deadline passed
+			if outcome.err == nil {
+				return outcome.result, nil
+			}
+		default:
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &JobTimeoutError{Timeout: timeout, running: finished}
+		}
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,168 @@
+package jobutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// timeoutProviderJobHandler overrides the job timeout of its type
+type timeoutProviderJobHandler struct {
+	countingJobHandler
+	timeout time.Duration
+}
+
+func (h *timeoutProviderJobHandler) GetTimeout() time.Duration {
+	return h.timeout
+}
+
+func TestJobRegistry_GetTimeout(t *testing.T) {
+	registry := NewJobRegistry()
+	_ = registry.Register(&timeoutProviderJobHandler{countingJobHandler: countingJobHandler{jobType: "provided"}, timeout: 2 * time.Minute})
+
+	withTimeout := map[string]any{"options": map[string]any{"timeout": float64(900)}}
+
+	if got := registry.GetTimeout("provided", withTimeout); got != 15*time.Minute {
+		t.Errorf("expected payload timeout to win, got %v", got)
+	}
+	if got := registry.GetTimeout("provided", nil); got != 2*time.Minute {
+		t.Errorf("expected handler timeout, got %v", got)
+	}
+	if got := registry.GetTimeout("other", nil); got != DefaultJobTimeout {
+		t.Errorf("expected default timeout, got %v", got)
+	}
+
+	t.Setenv("JOB_TIMEOUT_SECONDS", "45")
+	t.Setenv("JOB_TIMEOUT_SECONDS_PROVIDED", "10")
+
+	if got := registry.GetTimeout("provided", nil); got != 10*time.Second {
+		t.Errorf("expected per-type env timeout, got %v", got)
+	}
+	if got := registry.GetTimeout("other", nil); got != 45*time.Second {
+		t.Errorf("expected global env timeout, got %v", got)
+	}
+}
+
+func TestJobProcessor_ProcessJob_TimesOutRunawayHandler(t *testing.T) {
+	app := newTestApp(t)
+	processor := NewJobProcessor(app)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = processor.workerPool.Shutdown(ctx)
+	}()
+
+	handler := &blockingJobHandler{jobType: "runaway", started: make(chan string, 1), release: make(chan struct{})}
+	if err := processor.RegisterHandler(handler); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	job := createTestJob(t, app, "runaway", map[string]any{
+		"type":    "runaway",
+		"options": map[string]any{"timeout": 0.05},
+	})
+
+	started := time.Now()
+	err := processor.ProcessJob(job)
+
+	var timeoutErr *JobTimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected JobTimeoutError, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("ProcessJob should return at the deadline, took %v", elapsed)
+	}
+
+	reloaded, err := app.FindRecordById(QueuesCollection, job.Id)
+	if err != nil {
+		t.Fatalf("timed out job should stay queued for a retry: %v", err)
+	}
+	history := GetAttemptHistory(reloaded)
+	if len(history) != 1 || history[0].Reason != FailureReasonTimeout {
+		t.Errorf("expected one attempt with reason %s, got %+v", FailureReasonTimeout, history)
+	}
+
+	// The handler still runs, so the job must not be reserved by another worker until it returns
+	if reloaded.GetString("reserved_by") == "" {
+		t.Error("expected the job to stay reserved while its handler runs")
+	}
+	if _, err := ReserveJob(app, job.Id, "other-worker", GetReservationTimeout()); !errors.Is(err, ErrJobAlreadyReserved) {
+		t.Errorf("expected the running job to be reserved, got %v", err)
+	}
+
+	close(handler.release)
+	waitForJobRelease(t, app, job.Id)
+}
+
+// waitForJobRelease waits until the reservation of a job is cleared
+func waitForJobRelease(t *testing.T, app core.App, jobId string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		record, err := app.FindRecordById(QueuesCollection, jobId)
+		if err != nil || record.GetString("reserved_by") == "" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s was not released after its handler returned", jobId)
+}
+
+func TestWorkerPool_RunawayHandlerDoesNotBlockWorker(t *testing.T) {
+	app := newTestApp(t)
+	registry := NewJobRegistry()
+
+	runaway := &blockingJobHandler{jobType: "runaway", started: make(chan string, 1), release: make(chan struct{})}
+	counting := &countingJobHandler{jobType: "counted", runs: make(map[string]int)}
+	_ = registry.Register(runaway)
+	_ = registry.Register(counting)
+
+	pool := NewWorkerPool(app, registry, 1)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = pool.Shutdown(ctx)
+	}()
+
+	stuck := createTestJob(t, app, "stuck", map[string]any{
+		"type":    "runaway",
+		"options": map[string]any{"timeout": 0.05},
+	})
+	next := createTestJob(t, app, "next", map[string]any{"type": "counted"})
+
+	errs := pool.ProcessJobs([]*core.Record{stuck, next})
+
+	if failureReason(errs[0]) != FailureReasonTimeout {
+		t.Errorf("expected the runaway job to time out, got %v", errs[0])
+	}
+	if errs[1] != nil {
+		t.Errorf("expected the next job to run on the same worker, got %v", errs[1])
+	}
+	if counting.total.Load() != 1 {
+		t.Errorf("expected the next job to be executed once, got %d", counting.total.Load())
+	}
+
+	close(runaway.release)
+	waitForJobRelease(t, app, stuck.Id)
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: errors.New("boom"), expected: FailureReasonError},
+		{err: &JobTimeoutError{Timeout: time.Second}, expected: FailureReasonTimeout},
+		{err: &JobPanicError{Value: "boom"}, expected: FailureReasonPanic},
+	}
+
+	for _, tt := range tests {
+		if got := failureReason(tt.err); got != tt.expected {
+			t.Errorf("failureReason(%v) = %s, expected %s", tt.err, got, tt.expected)
+		}
+	}
+}
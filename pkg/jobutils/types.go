@@ -1,6 +1,7 @@
 package jobutils
 
 import (
+	"fmt"
 	"ims-pocketbase-baas-starter/pkg/cronutils"
 	"sync"
 	"time"
@@ -16,9 +17,11 @@ type JobRegistry struct {
 
 // JobProcessor coordinates job execution and queue management
 type JobProcessor struct {
-	app        *pocketbase.PocketBase
-	registry   *JobRegistry
-	workerPool *WorkerPool
+	app          *pocketbase.PocketBase
+	registry     *JobRegistry
+	workerPool   *WorkerPool
+	dispatcher   *Dispatcher
+	dispatcherMu sync.Mutex
 }
 
 // JobHandler defines the interface that all job handlers must implement
@@ -29,6 +32,43 @@ type JobHandler interface {
 	GetJobType() string
 }
 
+// JobResultHandler can be implemented by job handlers that produce a typed result (e.g. FileExportResult).
+// The processor calls HandleWithResult instead of Handle and stores the result in the job_results collection.
+type JobResultHandler interface {
+	JobHandler
+
+	// HandleWithResult processes a job like Handle and returns its result
+	HandleWithResult(ctx *cronutils.CronExecutionContext, job *JobData) (any, error)
+}
+
+// MaxAttemptsProvider can be implemented by job handlers to override the default
+// number of attempts before a job is moved to the failed_jobs collection
+type MaxAttemptsProvider interface {
+	// GetMaxAttempts returns the maximum number of attempts for the handler's job type
+	GetMaxAttempts() int
+}
+
+// JobFailureHandler can be implemented by job handlers to react to jobs that failed their last attempt
+// and were moved to the failed_jobs collection, e.g. to notify the user that created them
+type JobFailureHandler interface {
+	// HandleFailure is called once per dead-lettered job with the error of its last attempt
+	HandleFailure(job *JobData, jobErr error) error
+}
+
+// TimeoutProvider can be implemented by job handlers to override the default time a job may run
+// when its payload does not set options.timeout
+type TimeoutProvider interface {
+	// GetTimeout returns the maximum duration of a job of the handler's type
+	GetTimeout() time.Duration
+}
+
+// PayloadTimeoutProvider can be implemented by job handlers whose default timeout depends on the job, e.g.
+// on the operation of a data processing job. It takes precedence over TimeoutProvider.
+type PayloadTimeoutProvider interface {
+	// GetPayloadTimeout returns the maximum duration of a job with the given payload, 0 to use GetTimeout
+	GetPayloadTimeout(payload map[string]any) time.Duration
+}
+
 // JobData represents standardized job data extracted from queue records
 type JobData struct {
 	ID          string         // Job ID from queues table
@@ -36,8 +76,14 @@ type JobData struct {
 	Description string         // Job description
 	Type        string         // Job type extracted from payload
 	Payload     map[string]any // Parsed JSON payload
+	Queue       string         // Named queue the job belongs to
+	Priority    int            // Job priority (higher runs first)
 	Attempts    int            // Current attempt count
 	ReservedAt  *time.Time     // When job was reserved
+	ReservedBy  string         // Instance/worker that holds the reservation
+	AvailableAt *time.Time     // When job becomes eligible for processing (nil means immediately)
+	BatchID     string         // Batch the job is a member of, empty when it is not part of a batch
+	UserID      string         // User that created the job, empty for system jobs
 	CreatedAt   time.Time      // When job was created
 	UpdatedAt   time.Time      // When job was updated
 }
@@ -50,6 +96,25 @@ type JobResult struct {
 	Message   string // Additional message about the result
 }
 
+// JobAttempt represents a single failed attempt recorded in a job's attempt history
+type JobAttempt struct {
+	Attempt  int       `json:"attempt"`
+	Error    string    `json:"error"`
+	Reason   string    `json:"reason,omitempty"` // error, timeout or panic
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// JobPanicError wraps a recovered handler panic together with its stack trace
+type JobPanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *JobPanicError) Error() string {
+	return fmt.Sprintf("job handler panicked: %v", e.Value)
+}
+
 // BaseJobPayload represents the common structure for all job types
 type BaseJobPayload struct {
 	Type    string         `json:"type"`
@@ -84,6 +149,7 @@ type EmailJobData struct {
 	Subject   string         `json:"subject"`
 	Template  string         `json:"template"`
 	Variables map[string]any `json:"variables"`
+	Locale    string         `json:"locale,omitempty"` // Template variant, empty means the language setting of the recipient
 }
 
 // EmailJobOptions represents the options section for email jobs
@@ -101,14 +167,46 @@ type EmailJobPayload struct {
 
 // DataProcessingJobData represents the data section for data processing jobs
 type DataProcessingJobData struct {
-	Operation string `json:"operation"`
-	Source    string `json:"source"`
-	Target    string `json:"target"`
+	Operation  string              `json:"operation"`
+	Source     string              `json:"source"`
+	Target     string              `json:"target"`
+	Format     string              `json:"format,omitempty"`     // File format of an import or export, empty means detected from the file name or target
+	Mapping    map[string]string   `json:"mapping,omitempty"`    // Import column to collection field, empty means columns named like fields
+	KeyField   string              `json:"key_field,omitempty"`  // Field matching imported rows to existing records to update
+	Filter     string              `json:"filter,omitempty"`     // PocketBase filter expression selecting the exported or aggregated records
+	Fields     []string            `json:"fields,omitempty"`     // Exported fields, "expand.<relation>.<field>" for fields of expanded relations
+	Expand     []string            `json:"expand,omitempty"`     // Relations exported as JSON in an "expand" column, e.g. "roles.permissions"
+	Sort       string              `json:"sort,omitempty"`       // PocketBase sort expression, e.g. "-created,name"; result columns for aggregates
+	GroupBy    []string            `json:"group_by,omitempty"`   // Aggregate grouping fields, "<field>:<day|week|month|year>" for date buckets
+	Aggregates []DataAggregate     `json:"aggregates,omitempty"` // Aggregate functions computed per group
+	Steps      []DataTransformStep `json:"steps,omitempty"`      // Transform pipeline applied to every source record, in order
+}
+
+// DataAggregate is a function computed per group by aggregate jobs
+type DataAggregate struct {
+	Function string `json:"function"`        // count, sum, avg, min or max
+	Field    string `json:"field,omitempty"` // Field of the source collection, empty counts the records
+	As       string `json:"as,omitempty"`    // Result column, defaults to "<function>_<field>" or "count"
 }
 
 // DataProcessingJobOptions represents the options section for data processing jobs
 type DataProcessingJobOptions struct {
-	Timeout int `json:"timeout,omitempty"`
+	Timeout int  `json:"timeout,omitempty"`
+	DryRun  bool `json:"dry_run,omitempty"` // Validate and count the changes without saving them
+	Notify  bool `json:"notify,omitempty"`  // Email the user that created an export when it completes or fails
+	ExportFileOptions
+}
+
+// ExportFileOptions are the compression and encryption of the files written by exports and reports
+type ExportFileOptions struct {
+	Compression string `json:"compression,omitempty"` // gzip or zip, empty stores the file as written
+	Encryption  string `json:"encryption,omitempty"`  // aes-gcm, empty stores the file unencrypted
+	Passphrase  string `json:"-"`                     // Encrypts with a key derived from the passphrase instead of Key
+	Key         string `json:"-"`                     // Base64 key from filecrypt.GenerateKey, returned once to the requester
+
+	// The passphrase or key sealed with SealPayloadSecret, the only form stored in job payloads
+	SealedPassphrase string `json:"sealed_passphrase,omitempty"`
+	SealedKey        string `json:"sealed_key,omitempty"`
 }
 
 // DataProcessingJobPayload represents the complete payload for data processing jobs
@@ -132,6 +230,9 @@ type FileExportResult struct {
 	FileSize       int64  `json:"file_size"`
 	RecordCount    int    `json:"record_count"`
 	ContentType    string `json:"content_type"`
+	Checksum       string `json:"checksum"`              // Hex SHA-256 of the stored file, verified on download
+	Compression    string `json:"compression,omitempty"` // gzip or zip
+	Encryption     string `json:"encryption,omitempty"`  // aes-gcm
 }
 
 // EmailResult represents the result data for email jobs
@@ -149,12 +250,77 @@ type DataProcessingResult struct {
 	OutputLocation   string `json:"output_location,omitempty"`
 }
 
+// DataImportResult represents the result data for import jobs
+type DataImportResult struct {
+	DataProcessingResult
+	DryRun         bool     `json:"dry_run"`
+	Format         string   `json:"format"`
+	TotalRows      int      `json:"total_rows"`
+	Created        int      `json:"created"`
+	Updated        int      `json:"updated"`
+	Failed         int      `json:"failed"`
+	IgnoredColumns []string `json:"ignored_columns,omitempty"`
+	ErrorReportId  string   `json:"error_report_id,omitempty"` // ID of the export_files record of the error report
+	ErrorReport    string   `json:"error_report,omitempty"`    // File name of the error report
+}
+
+// DataTransformStep is a step of a transform pipeline
+type DataTransformStep struct {
+	Type       string         `json:"type"`                 // rename, compute, map, drop or dedupe
+	Field      string         `json:"field,omitempty"`      // Field that the step renames, computes or maps
+	To         string         `json:"to,omitempty"`         // New name of a renamed field
+	Expression string         `json:"expression,omitempty"` // SQLite expression of a computed field, e.g. "lower(trim(email))"
+	Values     map[string]any `json:"values,omitempty"`     // New values of a mapped field, by current value
+	Default    any            `json:"default,omitempty"`    // Value of unmapped values, nil keeps them
+	Fields     []string       `json:"fields,omitempty"`     // Dropped fields, or the fields identifying duplicates
+}
+
+// DataAggregateResult represents the result data for aggregate jobs
+type DataAggregateResult struct {
+	DataProcessingResult
+	DryRun         bool             `json:"dry_run"`
+	Columns        []string         `json:"columns"`
+	Groups         int              `json:"groups"`
+	Rows           []map[string]any `json:"rows,omitempty"`             // First rows of the result
+	Created        int              `json:"created,omitempty"`          // Records created in the target collection
+	ExportRecordId string           `json:"export_record_id,omitempty"` // ID of the export_files record of the report file
+	FileName       string           `json:"file_name,omitempty"`
+	Checksum       string           `json:"checksum,omitempty"` // Hex SHA-256 of the report file
+}
+
+// DataTransformResult represents the result data for transform jobs
+type DataTransformResult struct {
+	DataProcessingResult
+	DryRun    bool                  `json:"dry_run"`
+	Created   int                   `json:"created"`
+	Updated   int                   `json:"updated"`
+	Unchanged int                   `json:"unchanged"`
+	Skipped   int                   `json:"skipped"` // Duplicates removed by dedupe steps
+	Failed    int                   `json:"failed"`
+	Errors    []string              `json:"errors,omitempty"` // First errors of the failed records
+	Diff      []DataTransformChange `json:"diff,omitempty"`   // First created and updated records
+}
+
+// DataTransformChange is a record created or updated by a transform job
+type DataTransformChange struct {
+	Action string                     `json:"action"` // create or update
+	Id     string                     `json:"id,omitempty"`
+	Fields map[string]DataFieldChange `json:"fields"`
+}
+
+// DataFieldChange is the value of a field before and after a transform
+type DataFieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
 // Job status constants
 const (
 	JobStatusQueued     = "queued"
 	JobStatusProcessing = "processing"
 	JobStatusCompleted  = "completed"
 	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
 )
 
 // Job type constants
@@ -172,10 +338,36 @@ const (
 )
 
 const (
-	DataProcessingFileCSV  = "csv"
-	DataProcessingFileXLSX = "xlsx"
-	DataProcessingFileJSON = "json"
-	DataProcessingFilePDF  = "pdf"
+	DataProcessingFileCSV   = "csv"
+	DataProcessingFileXLSX  = "xlsx"
+	DataProcessingFileJSON  = "json"
+	DataProcessingFileJSONL = "jsonl"
+	DataProcessingFilePDF   = "pdf"
+)
+
+// Export file compression and encryption constants
+const (
+	ExportCompressionGzip  = "gzip"
+	ExportCompressionZip   = "zip"
+	ExportEncryptionAESGCM = "aes-gcm"
+)
+
+// Transform step constants
+const (
+	DataTransformRename  = "rename"
+	DataTransformCompute = "compute"
+	DataTransformMap     = "map"
+	DataTransformDrop    = "drop"
+	DataTransformDedupe  = "dedupe"
+)
+
+// Aggregate function constants
+const (
+	DataAggregateCount = "count"
+	DataAggregateSum   = "sum"
+	DataAggregateAvg   = "avg"
+	DataAggregateMin   = "min"
+	DataAggregateMax   = "max"
 )
 
 const (
@@ -3,8 +3,8 @@ package jobutils
 import (
 	"context"
 	"fmt"
-	"ims-pocketbase-baas-starter/pkg/cronutils"
 	log "ims-pocketbase-baas-starter/pkg/logger"
+	"ims-pocketbase-baas-starter/pkg/metrics"
 	"sync"
 	"time"
 
@@ -12,28 +12,36 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// WorkerPool manages a pool of persistent workers for job processing
+// WorkerPool manages a pool of persistent workers for job processing.
+// Workers are reserved per named queue so that slow jobs on one queue cannot starve another.
 type WorkerPool struct {
-	workers     []*Worker
-	jobQueue    chan *core.Record
-	resultQueue chan WorkerJobResult
-	quit        chan bool
-	wg          sync.WaitGroup
-	maxWorkers  int
-	app         *pocketbase.PocketBase
-	registry    *JobRegistry
-	isShutdown  bool
-	mu          sync.RWMutex
+	workers      []*Worker
+	jobQueue     chan *core.Record            // channel of the default queue
+	queues       map[string]chan *core.Record // channel per named queue
+	queueWorkers map[string]int               // reserved worker count per named queue
+	resultQueue  chan WorkerJobResult
+	waiters      map[string][]chan WorkerJobResult // result channels of in-flight ProcessJobs calls per job ID
+	waitersMu    sync.Mutex
+	quit         chan bool
+	wg           sync.WaitGroup
+	maxWorkers   int
+	app          *pocketbase.PocketBase
+	registry     *JobRegistry
+	tracker      *jobTracker
+	isShutdown   bool
+	mu           sync.RWMutex
 }
 
 // Worker represents a single worker in the pool
 type Worker struct {
 	id          int
+	queue       string
 	jobQueue    chan *core.Record
 	resultQueue chan WorkerJobResult
 	quit        chan bool
 	app         *pocketbase.PocketBase
 	registry    *JobRegistry
+	tracker     *jobTracker
 }
 
 // WorkerJobResult represents the result of job processing
@@ -42,44 +50,170 @@ type WorkerJobResult struct {
 	Error error
 }
 
-// NewWorkerPool creates a new persistent worker pool
+// NewWorkerPool creates a new persistent worker pool with all workers serving the default queue
 func NewWorkerPool(app *pocketbase.PocketBase, registry *JobRegistry, maxWorkers int) *WorkerPool {
 	if maxWorkers <= 0 {
 		maxWorkers = 5
 	}
 
-	jobQueueSize := maxWorkers * 10
+	return NewWorkerPoolWithQueues(app, registry, map[string]int{DefaultQueueName: maxWorkers})
+}
+
+// NewWorkerPoolWithQueues creates a new persistent worker pool with workers reserved per named queue.
+// A default queue is always created so jobs with an unknown queue name can still be processed.
+func NewWorkerPoolWithQueues(app *pocketbase.PocketBase, registry *JobRegistry, queueWorkers map[string]int) *WorkerPool {
+	workersByQueue := make(map[string]int, len(queueWorkers)+1)
+	maxWorkers := 0
+	for name, count := range queueWorkers {
+		if count <= 0 {
+			continue
+		}
+		workersByQueue[NormalizeQueueName(name)] += count
+		maxWorkers += count
+	}
+	if _, exists := workersByQueue[DefaultQueueName]; !exists {
+		workersByQueue[DefaultQueueName] = 1
+		maxWorkers++
+	}
+
 	resultQueueSize := maxWorkers * 10
 
 	pool := &WorkerPool{
-		workers:     make([]*Worker, 0, maxWorkers),
-		jobQueue:    make(chan *core.Record, jobQueueSize),
-		resultQueue: make(chan WorkerJobResult, resultQueueSize),
-		quit:        make(chan bool),
-		maxWorkers:  maxWorkers,
-		app:         app,
-		registry:    registry,
-		isShutdown:  false,
-	}
-
-	for i := 0; i < maxWorkers; i++ {
-		worker := &Worker{
-			id:          i,
-			jobQueue:    pool.jobQueue,
-			resultQueue: pool.resultQueue,
-			quit:        make(chan bool),
-			app:         app,
-			registry:    registry,
+		workers:      make([]*Worker, 0, maxWorkers),
+		queues:       make(map[string]chan *core.Record, len(workersByQueue)),
+		queueWorkers: workersByQueue,
+		resultQueue:  make(chan WorkerJobResult, resultQueueSize),
+		waiters:      make(map[string][]chan WorkerJobResult),
+		quit:         make(chan bool),
+		maxWorkers:   maxWorkers,
+		app:          app,
+		registry:     registry,
+		tracker:      newJobTracker(),
+		isShutdown:   false,
+	}
+
+	workerId := 0
+	for _, queueName := range sortedQueueNames(workersByQueue) {
+		count := workersByQueue[queueName]
+		jobQueue := make(chan *core.Record, count*10)
+		pool.queues[queueName] = jobQueue
+
+		for i := 0; i < count; i++ {
+			worker := &Worker{
+				id:          workerId,
+				queue:       queueName,
+				jobQueue:    jobQueue,
+				resultQueue: pool.resultQueue,
+				quit:        make(chan bool),
+				app:         app,
+				registry:    registry,
+				tracker:     pool.tracker,
+			}
+			workerId++
+			pool.workers = append(pool.workers, worker)
+			pool.wg.Add(1)
+			go worker.start(&pool.wg)
 		}
-		pool.workers = append(pool.workers, worker)
-		pool.wg.Add(1)
-		go worker.start(&pool.wg)
+
+		log.Info("Queue workers started", "queue", queueName, "workers", count, "job_queue_size", count*10)
 	}
+	pool.jobQueue = pool.queues[DefaultQueueName]
 
-	log.Info("Worker pool started", "workers", maxWorkers, "job_queue_size", jobQueueSize)
+	go pool.routeResults()
+
+	log.Info("Worker pool started", "workers", maxWorkers, "queues", len(pool.queues))
 	return pool
 }
 
+// QueueNames returns the named queues served by the pool, sorted by name
+func (wp *WorkerPool) QueueNames() []string {
+	return sortedQueueNames(wp.queueWorkers)
+}
+
+// QueueWorkers returns the number of workers reserved for a named queue
+func (wp *WorkerPool) QueueWorkers(queueName string) int {
+	return wp.queueWorkers[NormalizeQueueName(queueName)]
+}
+
+// routeResults delivers worker results to the ProcessJobs call waiting for them, so that
+// concurrent callers (e.g. the dispatcher and the fallback cron) never receive each other's results
+func (wp *WorkerPool) routeResults() {
+	for {
+		select {
+		case result := <-wp.resultQueue:
+			wp.deliverResult(result)
+
+		case <-wp.quit:
+			// quit is closed once every worker exited, so the buffered results are the last ones and
+			// their ProcessJobs calls are still waiting for them
+			for {
+				select {
+				case result := <-wp.resultQueue:
+					wp.deliverResult(result)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliverResult hands a worker result to the first ProcessJobs call waiting for its job
+func (wp *WorkerPool) deliverResult(result WorkerJobResult) {
+	wp.waitersMu.Lock()
+	waiting := wp.waiters[result.JobID]
+	var waiter chan WorkerJobResult
+	if len(waiting) > 0 {
+		waiter = waiting[0]
+		if len(waiting) == 1 {
+			delete(wp.waiters, result.JobID)
+		} else {
+			wp.waiters[result.JobID] = waiting[1:]
+		}
+	}
+	wp.waitersMu.Unlock()
+
+	if waiter == nil {
+		log.Warn("Received result for unknown job", "job_id", result.JobID)
+		return
+	}
+	waiter <- result
+}
+
+// addWaiter registers a result channel for a job submitted by a ProcessJobs call
+func (wp *WorkerPool) addWaiter(jobId string, results chan WorkerJobResult) {
+	wp.waitersMu.Lock()
+	defer wp.waitersMu.Unlock()
+	wp.waiters[jobId] = append(wp.waiters[jobId], results)
+}
+
+// removeWaiter unregisters a result channel that will no longer be read
+func (wp *WorkerPool) removeWaiter(jobId string, results chan WorkerJobResult) {
+	wp.waitersMu.Lock()
+	defer wp.waitersMu.Unlock()
+
+	waiting := wp.waiters[jobId]
+	for i, waiter := range waiting {
+		if waiter == results {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(wp.waiters, jobId)
+	} else {
+		wp.waiters[jobId] = waiting
+	}
+}
+
+// queueFor returns the channel serving a job record, falling back to the default queue
+func (wp *WorkerPool) queueFor(job *core.Record) chan *core.Record {
+	if jobQueue, exists := wp.queues[NormalizeQueueName(job.GetString("queue"))]; exists {
+		return jobQueue
+	}
+	return wp.jobQueue
+}
+
 // IsShutdown returns whether the worker pool has been shut down
 func (wp *WorkerPool) IsShutdown() bool {
 	wp.mu.RLock()
@@ -89,8 +223,14 @@ func (wp *WorkerPool) IsShutdown() bool {
 
 // ProcessJobs processes a batch of jobs using the worker pool
 func (wp *WorkerPool) ProcessJobs(jobs []*core.Record) []error {
-	// Check if pool is shutdown
-	if wp.IsShutdown() {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// Hold the read lock while sending so Shutdown cannot close a queue channel mid-send
+	wp.mu.RLock()
+	if wp.isShutdown {
+		wp.mu.RUnlock()
 		err := fmt.Errorf("worker pool is shutdown")
 		results := make([]error, len(jobs))
 		for i := range results {
@@ -99,29 +239,39 @@ func (wp *WorkerPool) ProcessJobs(jobs []*core.Record) []error {
 		return results
 	}
 
-	if len(jobs) == 0 {
-		return nil
-	}
-
 	jobIndexMap := make(map[string]int, len(jobs))
 	for i, job := range jobs {
 		jobIndexMap[job.Id] = i
 	}
 
-	// Send jobs to workers
+	// Send jobs to workers, registering where their results should be delivered
+	resultQueue := make(chan WorkerJobResult, len(jobs))
+	pending := make(map[string]bool, len(jobs))
+	defer func() {
+		for jobId := range pending {
+			wp.removeWaiter(jobId, resultQueue)
+		}
+	}()
+
 	sendErrors := make([]error, len(jobs))
 	jobsSent := 0
 	for i, job := range jobs {
+		wp.addWaiter(job.Id, resultQueue)
+
 		select {
-		case wp.jobQueue <- job:
+		case wp.queueFor(job) <- job:
+			pending[job.Id] = true
 			jobsSent++
 		case <-time.After(30 * time.Second):
+			wp.removeWaiter(job.Id, resultQueue)
 			err := fmt.Errorf("job queue timeout for job %s", job.Id)
 			log.Error("Job queue timeout", "job_id", job.Id)
 			sendErrors[i] = err
 		}
 	}
 
+	wp.mu.RUnlock()
+
 	// If we couldn't send any jobs, return the send errors
 	if jobsSent == 0 {
 		log.Warn("No jobs were sent to worker pool", "total_jobs", len(jobs))
@@ -132,23 +282,15 @@ func (wp *WorkerPool) ProcessJobs(jobs []*core.Record) []error {
 	results := make([]error, len(jobs))
 	copy(results, sendErrors)
 
+	// Every sent job reports a result: handlers are bounded by their job timeout and draining workers
+	// still report buffered jobs as not started
 	for i := 0; i < jobsSent; i++ {
-		select {
-		case result := <-wp.resultQueue:
-			if jobIndex, exists := jobIndexMap[result.JobID]; exists {
-				results[jobIndex] = result.Error
-			} else {
-				log.Warn("Received result for unknown job", "job_id", result.JobID)
-			}
-		case <-time.After(5 * time.Minute):
-			err := fmt.Errorf("job processing timeout")
-			log.Error("Job processing timeout")
-			for j := range results {
-				if results[j] == nil {
-					results[j] = err
-					break
-				}
-			}
+		result := <-resultQueue
+		delete(pending, result.JobID)
+		if jobIndex, exists := jobIndexMap[result.JobID]; exists {
+			results[jobIndex] = result.Error
+		} else {
+			log.Warn("Received result for unknown job", "job_id", result.JobID)
 		}
 	}
 
@@ -185,8 +327,13 @@ func (wp *WorkerPool) ProcessJobsConcurrently(jobs []*core.Record, maxWorkers in
 	return wp.ProcessJobs(jobs)
 }
 
-// Shutdown gracefully shuts down the worker pool
+// Shutdown gracefully drains the worker pool. New and buffered jobs are no longer started, running
+// jobs may finish until ctx expires, and the reservations of jobs still running after that are
+// released so another instance can pick them up without waiting for the reservation timeout.
 func (wp *WorkerPool) Shutdown(ctx context.Context) error {
+	// Stop workers from starting buffered jobs before waiting for the send lock
+	wp.tracker.startDraining()
+
 	wp.mu.Lock()
 	if wp.isShutdown {
 		wp.mu.Unlock()
@@ -196,26 +343,58 @@ func (wp *WorkerPool) Shutdown(ctx context.Context) error {
 	wp.isShutdown = true
 	wp.mu.Unlock()
 
-	log.Info("Shutting down worker pool")
-	close(wp.jobQueue)
+	started := time.Now()
+	inFlight := wp.tracker.count()
+	metricsProvider := metrics.GetInstance()
+	metrics.SafeSetGauge(metricsProvider, metrics.MetricJobShutdownInFlight, float64(inFlight), nil)
+
+	log.Info("Shutting down worker pool, draining in-flight jobs", "in_flight", inFlight)
+	for _, jobQueue := range wp.queues {
+		close(jobQueue)
+	}
 
 	done := make(chan struct{})
 	go func() {
 		wp.wg.Wait()
+		close(wp.quit)
 		close(done)
 	}()
 
 	select {
 	case <-done:
-		log.Info("Worker pool shutdown completed")
+		metrics.SafeSetGauge(metricsProvider, metrics.MetricJobShutdownInFlight, 0, nil)
+		metrics.SafeRecordDuration(metricsProvider, metrics.MetricJobShutdownDuration, time.Since(started), map[string]string{
+			metrics.LabelStatus: "drained",
+		})
+		log.Info("Worker pool shutdown completed", "drained_jobs", inFlight, "duration", time.Since(started))
 		return nil
 	case <-ctx.Done():
-		close(wp.quit)
-		log.Warn("Worker pool force shutdown due to timeout")
+		released := wp.releaseInFlight()
+		metrics.SafeSetGauge(metricsProvider, metrics.MetricJobShutdownInFlight, float64(wp.tracker.count()), nil)
+		metrics.SafeRecordDuration(metricsProvider, metrics.MetricJobShutdownDuration, time.Since(started), map[string]string{
+			metrics.LabelStatus: "timeout",
+		})
+		log.Warn("Worker pool force shutdown due to timeout", "released_jobs", released, "duration", time.Since(started))
 		return ctx.Err()
 	}
 }
 
+// releaseInFlight clears the reservations of jobs still running and returns how many were released
+func (wp *WorkerPool) releaseInFlight() int {
+	released := 0
+	for jobId, reservedBy := range wp.tracker.snapshot() {
+		if err := ReleaseJob(wp.app, jobId, reservedBy); err != nil {
+			log.Error("Failed to release job reservation", "job_id", jobId, "reserved_by", reservedBy, "error", err)
+			continue
+		}
+
+		released++
+		metrics.SafeIncrementCounter(metrics.GetInstance(), metrics.MetricJobShutdownReleasedTotal, nil)
+		log.Warn("Released reservation of unfinished job", "job_id", jobId, "reserved_by", reservedBy)
+	}
+	return released
+}
+
 func (w *Worker) start(wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -245,22 +424,21 @@ func (w *Worker) processJob(record *core.Record) error {
 		return fmt.Errorf("invalid job record")
 	}
 
-	originalReservedAt := record.GetString("reserved_at")
-	if originalReservedAt != "" && w.isJobReserved(record) {
-		return fmt.Errorf("job %s is already reserved", record.Id)
+	if w.tracker.isDraining() {
+		return fmt.Errorf("job %s not started: %w", record.Id, ErrWorkerPoolDraining)
 	}
 
-	now := time.Now()
-	record.Set("reserved_at", now.Format(time.RFC3339))
-
-	if err := w.app.Save(record); err != nil {
-		record.Set("reserved_at", originalReservedAt)
-		return fmt.Errorf("failed to reserve job %s: %w", record.Id, err)
+	record, err := ReserveJob(w.app, record.Id, w.reservedBy(), GetReservationTimeout())
+	if err != nil {
+		return err
 	}
 
+	w.tracker.add(record.Id, w.reservedBy())
+	defer w.tracker.remove(record.Id)
+
 	jobData, err := ParseJobDataFromRecord(record)
 	if err != nil {
-		failErr := w.failJob(record, fmt.Errorf("failed to parse job data: %w", err))
+		failErr := w.failJob(record, fmt.Errorf("failed to parse job data: %w", err), 0)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "worker_id", w.id, "error", failErr)
 		}
@@ -269,73 +447,63 @@ func (w *Worker) processJob(record *core.Record) error {
 
 	handler, err := w.registry.GetHandler(jobData.Type)
 	if err != nil {
-		failErr := w.failJob(record, fmt.Errorf("no handler for job type '%s': %w", jobData.Type, err))
+		failErr := w.failJob(record, fmt.Errorf("no handler for job type '%s': %w", jobData.Type, err), 0)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "worker_id", w.id, "error", failErr)
 		}
 		return err
 	}
 
-	// Execute job with panic recovery
-	var jobErr error
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				jobErr = fmt.Errorf("job handler panicked: %v", r)
-				log.Error("Job handler panic", "job_id", record.Id, "worker_id", w.id, "panic", r)
-			}
-		}()
+	// Execute job with a deadline, recovering panics
+	timeout := w.registry.GetTimeout(jobData.Type, jobData.Payload)
+	ctx, cancel := newJobExecutionContext(w.app, record, timeout)
+	defer cancel()
 
-		ctx := cronutils.NewCronExecutionContext(w.app, record.Id)
-		ctx.LogStart(fmt.Sprintf("Processing %s job: %s", jobData.Type, jobData.Name))
-		jobErr = handler.Handle(ctx, jobData)
+	// The reservation is refreshed while the job runs, so it never expires before the job's timeout
+	hold := holdReservation(w.app, record, reservationRefreshInterval(), cancel)
 
-		if jobErr == nil {
-			ctx.LogEnd("Job processed successfully")
-		}
-	}()
+	started := time.Now()
+	ctx.LogStart(fmt.Sprintf("Processing %s job: %s", jobData.Type, jobData.Name))
+	result, jobErr := runJobHandler(ctx, handler, jobData, timeout)
+	defer hold.release(jobErr)
+	if jobErr == nil {
+		ctx.LogEnd("Job processed successfully")
+	}
+	duration := time.Since(started)
 
 	if jobErr != nil {
 		log.Error("Job failed", "job_id", record.Id, "worker_id", w.id, "job_type", jobData.Type, "error", jobErr)
-		failErr := w.failJob(record, jobErr)
+		failErr := w.failJob(record, jobErr, duration)
 		if failErr != nil {
 			log.Error("Failed to mark job as failed", "job_id", record.Id, "worker_id", w.id, "error", failErr)
 		}
 		return jobErr
 	}
 
-	if err := w.app.Delete(record); err != nil {
+	if err := completeJob(w.app, record, result, duration); err != nil {
 		log.Error("Failed to complete job", "job_id", record.Id, "worker_id", w.id, "error", err)
 		return err
 	}
 
-	log.Info("Job completed successfully", "job_id", record.Id, "worker_id", w.id, "job_type", jobData.Type)
+	log.Info("Job completed successfully", "job_id", record.Id, "worker_id", w.id, "queue", w.queue, "job_type", jobData.Type)
 	return nil
 }
 
-func (w *Worker) isJobReserved(record *core.Record) bool {
-	reservedAtStr := record.GetString("reserved_at")
-	if reservedAtStr == "" {
-		return false
-	}
-
-	reservedAt, err := time.Parse(time.RFC3339, reservedAtStr)
-	if err != nil {
-		return false
-	}
-
-	return time.Since(reservedAt) < 5*time.Minute
+// reservedBy returns the reserved_by identifier of the worker, unique across app instances
+func (w *Worker) reservedBy() string {
+	return fmt.Sprintf("%s/%s-worker-%d", InstanceID(), w.queue, w.id)
 }
 
-func (w *Worker) failJob(record *core.Record, jobErr error) error {
-	currentAttempts := int(record.GetFloat("attempts"))
-	record.Set("attempts", currentAttempts+1)
-	record.Set("reserved_at", "")
-
-	if err := w.app.Save(record); err != nil {
+// failJob records a failed attempt and dead-letters the job once it reaches its max attempts
+func (w *Worker) failJob(record *core.Record, jobErr error, duration time.Duration) error {
+	deadLettered, err := recordJobFailure(w.app, w.registry, record, jobErr, duration)
+	if err != nil {
 		log.Error("Failed to update failed job", "job_id", record.Id, "error", err)
 		return fmt.Errorf("failed to update failed job: %w", err)
 	}
 
-	return jobErr
+	if deadLettered {
+		log.Warn("Job dead-lettered", "job_id", record.Id, "worker_id", w.id, "error", jobErr)
+	}
+	return nil
 }
@@ -187,6 +187,41 @@ func TestWorkerPool_Shutdown(t *testing.T) {
 	}
 }
 
+func TestWorkerPool_RouteResultsDeliversBufferedResultsOnQuit(t *testing.T) {
+	// Without a router running, results stay buffered until quit is closed like at the end of Shutdown
+	pool := &WorkerPool{
+		resultQueue: make(chan WorkerJobResult, 3),
+		waiters:     make(map[string][]chan WorkerJobResult),
+		quit:        make(chan bool),
+	}
+
+	results := make(chan WorkerJobResult, 3)
+	for _, jobId := range []string{"job1", "job2", "job3"} {
+		pool.addWaiter(jobId, results)
+		pool.resultQueue <- WorkerJobResult{JobID: jobId}
+	}
+	close(pool.quit)
+
+	done := make(chan struct{})
+	go func() {
+		pool.routeResults()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected routeResults to return after quit")
+	}
+
+	if len(results) != 3 {
+		t.Errorf("expected the 3 buffered results to be delivered, got %d", len(results))
+	}
+	if len(pool.waiters) != 0 {
+		t.Errorf("expected no waiters left, got %v", pool.waiters)
+	}
+}
+
 func TestWorkerJobResult(t *testing.T) {
 	result := WorkerJobResult{
 		JobID: "test-job-123",
@@ -85,6 +85,18 @@ const (
 	MetricJobExecutionTotal    = "job_execution_total"
 	MetricJobErrorsTotal       = "job_errors_total"
 	MetricJobQueueSize         = "job_queue_size"
+	MetricJobDeadLetteredTotal = "job_dead_lettered_total"
+	MetricJobFailuresTotal     = "job_failures_total"
+
+	// Job shutdown metrics
+	MetricJobShutdownInFlight      = "job_shutdown_in_flight"
+	MetricJobShutdownDuration      = "job_shutdown_duration_seconds"
+	MetricJobShutdownReleasedTotal = "job_shutdown_released_total"
+
+	// Cron metrics
+	MetricCronExecutionDuration = "cron_execution_duration_seconds"
+	MetricCronExecutionTotal    = "cron_execution_total"
+	MetricCronSkippedTotal      = "cron_skipped_total"
 
 	// Business metrics
 	MetricRecordOperationsTotal = "record_operations_total"
@@ -104,12 +116,14 @@ const (
 	LabelOperation   = "operation"
 	LabelStatus      = "status"
 	LabelJobType     = "job_type"
+	LabelCronID      = "cron_id"
 	LabelHandlerName = "handler"
 	LabelMethod      = "method"
 	LabelPath        = "path"
 	LabelStatusCode  = "status_code"
 	LabelError       = "error"
 	LabelSuccess     = "success"
+	LabelReason      = "reason"
 )
 
 // Default configuration values
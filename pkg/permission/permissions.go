@@ -20,6 +20,23 @@ const (
 	RoleViewAll = "role.view.all"
 	RoleUpdate  = "role.update"
 	RoleDelete  = "role.delete"
+
+	// Job permissions
+	JobFailedView  = "job.failed.view"
+	JobFailedRetry = "job.failed.retry"
+	JobFailedPurge = "job.failed.purge"
+	JobView        = "job.view"
+	JobCancel      = "job.cancel"
+	JobRetry       = "job.retry"
+	JobPurge       = "job.purge"
+
+	// Cron permissions
+	CronView = "cron.view"
+	CronRun  = "cron.run"
+
+	// Data permissions
+	DataImport = "data.import"
+	DataExport = "data.export"
 )
 
 // PermissionDefinition represents a permission with its metadata
@@ -46,5 +63,16 @@ func GetAllPermissions() []PermissionDefinition {
 		{Slug: RoleViewAll, Name: "View All Roles", Description: "Can view all roles"},
 		{Slug: RoleUpdate, Name: "Update Role", Description: "Can update role information"},
 		{Slug: RoleDelete, Name: "Delete Role", Description: "Can delete roles"},
+		{Slug: JobFailedView, Name: "View Failed Jobs", Description: "Can view dead-lettered jobs"},
+		{Slug: JobFailedRetry, Name: "Retry Failed Jobs", Description: "Can re-queue dead-lettered jobs"},
+		{Slug: JobFailedPurge, Name: "Purge Failed Jobs", Description: "Can permanently delete dead-lettered jobs"},
+		{Slug: JobView, Name: "View Jobs", Description: "Can list jobs and view their payloads and errors"},
+		{Slug: JobCancel, Name: "Cancel Jobs", Description: "Can cancel queued jobs"},
+		{Slug: JobRetry, Name: "Retry Jobs", Description: "Can force a retry of queued and dead-lettered jobs"},
+		{Slug: JobPurge, Name: "Purge Jobs", Description: "Can bulk-remove queued and finished jobs"},
+		{Slug: CronView, Name: "View Crons", Description: "Can list crons with their schedule and last run"},
+		{Slug: CronRun, Name: "Run Crons", Description: "Can trigger a cron manually"},
+		{Slug: DataImport, Name: "Import Data", Description: "Can import CSV, JSON and XLSX files into collections"},
+		{Slug: DataExport, Name: "Export Data", Description: "Can export the records of collections they can list"},
 	}
 }
@@ -23,6 +23,17 @@ func TestPermissionConstants(t *testing.T) {
 		{"RoleViewAll constant", RoleViewAll, "role.view.all"},
 		{"RoleUpdate constant", RoleUpdate, "role.update"},
 		{"RoleDelete constant", RoleDelete, "role.delete"},
+		{"JobFailedView constant", JobFailedView, "job.failed.view"},
+		{"JobFailedRetry constant", JobFailedRetry, "job.failed.retry"},
+		{"JobFailedPurge constant", JobFailedPurge, "job.failed.purge"},
+		{"JobView constant", JobView, "job.view"},
+		{"JobCancel constant", JobCancel, "job.cancel"},
+		{"JobRetry constant", JobRetry, "job.retry"},
+		{"JobPurge constant", JobPurge, "job.purge"},
+		{"CronView constant", CronView, "cron.view"},
+		{"CronRun constant", CronRun, "cron.run"},
+		{"DataImport constant", DataImport, "data.import"},
+		{"DataExport constant", DataExport, "data.export"},
 	}
 
 	for _, tt := range tests {
@@ -37,7 +48,7 @@ func TestPermissionConstants(t *testing.T) {
 func TestGetAllPermissions(t *testing.T) {
 	permissions := GetAllPermissions()
 
-	expectedCount := 14 // Updated to include CacheClear permission
+	expectedCount := 25 // Updated to include the data import and export permissions
 	if len(permissions) != expectedCount {
 		t.Errorf("Expected %d permissions, got %d", expectedCount, len(permissions))
 	}
@@ -72,6 +83,10 @@ func TestGetAllPermissions(t *testing.T) {
 		RoleViewAll:          {"View All Roles", "Can view all roles"},
 		RoleUpdate:           {"Update Role", "Can update role information"},
 		RoleDelete:           {"Delete Role", "Can delete roles"},
+		JobView:              {"View Jobs", "Can list jobs and view their payloads and errors"},
+		JobCancel:            {"Cancel Jobs", "Can cancel queued jobs"},
+		JobRetry:             {"Retry Jobs", "Can force a retry of queued and dead-lettered jobs"},
+		JobPurge:             {"Purge Jobs", "Can bulk-remove queued and finished jobs"},
 	}
 
 	returnedPerms := make(map[string]PermissionDefinition)
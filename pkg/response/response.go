@@ -104,10 +104,15 @@ func File(e *core.RequestEvent, fileName, basePath string) error {
 	}
 	defer fileReader.Close()
 
+	return Stream(e, fileName, fileReader)
+}
+
+// Stream serves the content of a reader as a file download
+func Stream(e *core.RequestEvent, fileName string, reader io.Reader) error {
 	e.Response.Header().Set("Content-Disposition", "attachment; filename=\""+fileName+"\"")
 	e.Response.Header().Set("Content-Type", "application/octet-stream")
 
-	_, err = io.Copy(e.Response, fileReader)
+	_, err := io.Copy(e.Response, reader)
 	if err != nil {
 		return InternalServerError(e, "Failed to serve file", nil)
 	}
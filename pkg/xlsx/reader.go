@@ -0,0 +1,242 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// defaultSheetPath is where most writers store the first sheet, used when the workbook does not say otherwise
+const defaultSheetPath = "xl/worksheets/sheet1.xml"
+
+// richText is a text element that is either plain (<t>) or made of runs (<r><t>)
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xmlCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+type xmlRow struct {
+	Ref   int       `xml:"r,attr"`
+	Cells []xmlCell `xml:"c"`
+}
+
+// ReadRows returns the cell values of the first sheet of a workbook as text, one slice per row. Rows skipped
+// by the file are returned empty, so the index of a row is its row number minus one.
+func ReadRows(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sharedStrings, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheetFile := files[firstSheetPath(files)]
+	if sheetFile == nil {
+		return nil, errors.New("invalid xlsx file: the workbook has no sheet")
+	}
+
+	sheet, err := sheetFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sheet: %w", err)
+	}
+	defer sheet.Close()
+
+	var rows [][]string
+	decoder := xml.NewDecoder(sheet)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xmlRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("failed to read sheet row: %w", err)
+		}
+
+		rowIndex := len(rows)
+		if row.Ref > 0 {
+			rowIndex = row.Ref - 1
+		}
+		for len(rows) < rowIndex {
+			rows = append(rows, nil)
+		}
+
+		values, err := rowValues(row, sharedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", rowIndex+1, err)
+		}
+		rows = append(rows, values)
+	}
+
+	return rows, nil
+}
+
+// rowValues converts the cells of a row to text, placing each cell in the column of its reference
+func rowValues(row xmlRow, sharedStrings []string) ([]string, error) {
+	var values []string
+	for _, cell := range row.Cells {
+		column := len(values)
+		if cell.Ref != "" {
+			parsed, err := columnIndex(cell.Ref)
+			if err != nil {
+				return nil, err
+			}
+			column = parsed
+		}
+		for len(values) <= column {
+			values = append(values, "")
+		}
+
+		switch cell.Type {
+		case "s":
+			index, err := strconv.Atoi(cell.Value)
+			if err != nil || index < 0 || index >= len(sharedStrings) {
+				return nil, fmt.Errorf("cell %s references an unknown shared string", cell.Ref)
+			}
+			values[column] = sharedStrings[index]
+		case "inlineStr":
+			values[column] = cell.Inline.String()
+		case "b":
+			values[column] = strconv.FormatBool(cell.Value == "1")
+		default:
+			values[column] = cell.Value
+		}
+	}
+
+	return values, nil
+}
+
+// readSharedStrings returns the shared string table of a workbook, which is optional
+func readSharedStrings(file *zip.File) ([]string, error) {
+	if file == nil {
+		return nil, nil
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shared strings: %w", err)
+	}
+	defer reader.Close()
+
+	var table struct {
+		Items []richText `xml:"si"`
+	}
+	if err := xml.NewDecoder(reader).Decode(&table); err != nil {
+		return nil, fmt.Errorf("failed to read shared strings: %w", err)
+	}
+
+	values := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		values[i] = item.String()
+	}
+	return values, nil
+}
+
+// firstSheetPath resolves the archive path of the first sheet listed in the workbook
+func firstSheetPath(files map[string]*zip.File) string {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	if decodeFile(files["xl/workbook.xml"], &workbook) != nil || len(workbook.Sheets) == 0 ||
+		decodeFile(files["xl/_rels/workbook.xml.rels"], &rels) != nil {
+		return defaultSheetPath
+	}
+
+	for _, rel := range rels.Items {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+
+	return defaultSheetPath
+}
+
+func decodeFile(file *zip.File, v any) error {
+	if file == nil {
+		return errors.New("missing file")
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return xml.NewDecoder(reader).Decode(v)
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12"
+func columnIndex(ref string) (int, error) {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+
+	return index - 1, nil
+}
@@ -0,0 +1,96 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriterReadRows_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter returned error: %v", err)
+	}
+
+	rows := [][]string{
+		{"name", "email", "notes"},
+		{"Ada", "ada@example.com", `<b>"quoted" & escaped</b>`},
+		{"Grace", "", "  leading spaces"},
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow returned error: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if writer.Rows() != len(rows) {
+		t.Errorf("expected %d rows written, got %d", len(rows), writer.Rows())
+	}
+	if err := writer.WriteRow([]string{"late"}); err != ErrClosed {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+
+	read, err := ReadRows(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadRows returned error: %v", err)
+	}
+
+	// Trailing empty cells are not stored
+	expected := [][]string{rows[0], rows[1], {"Grace", "", "  leading spaces"}}
+	if !reflect.DeepEqual(read, expected) {
+		t.Errorf("expected %q, got %q", expected, read)
+	}
+}
+
+func TestReadRows_SharedStringsAndGaps(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Data" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId7" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>name</t></si><si><r><t>Ada </t></r><r><t>Lovelace</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="str"><v>age</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3" t="b"><v>1</v></c><c r="C3"><v>36</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		w, _ := archive.Create(name)
+		_, _ = w.Write([]byte(content))
+	}
+	_ = archive.Close()
+
+	rows, err := ReadRows(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadRows returned error: %v", err)
+	}
+
+	expected := [][]string{
+		{"name", "", "age"},
+		nil,
+		{"Ada Lovelace", "true", "36"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+
+	if _, err := ReadRows([]byte("not a zip")); err == nil {
+		t.Error("expected an invalid file to be rejected")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if name := ColumnName(index); name != expected {
+			t.Errorf("ColumnName(%d): expected %s, got %s", index, expected, name)
+		}
+		if parsed, _ := columnIndex(expected + "1"); parsed != index {
+			t.Errorf("columnIndex(%s1): expected %d, got %d", expected, index, parsed)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// Package templates embeds the default template files of the app, so the binary runs without them on disk
+package templates
+
+import "embed"
+
+// Emails holds the default email templates, under the emails directory
+//
+//go:embed emails
+var Emails embed.FS